@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -28,6 +29,12 @@ func main() {
 
 	// Execute our root command and handle any errors
 	if err := cmd.Execute(buildInfo); err != nil {
+		// Commands reporting a result through the exit status print nothing
+		var status cmd.ExitStatus
+		if errors.As(err, &status) {
+			os.Exit(int(status))
+		}
+
 		// Exit with non-zero code to indicate failure
 		// This is important for CI/CD systems
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/internal/identity"
+	"github.com/vaultenv/vaultenv-cli/internal/keystore"
+)
+
+// ErrNoPendingRotation is returned when an environment has no unfinished
+// key rotation
+var ErrNoPendingRotation = errors.New("no key rotation in progress")
+
+// ErrNoDataKey is returned by DataKey for environments without a data key
+var ErrNoDataKey = errors.New("environment has no encryption key")
+
+// snapshotKeyName is the name the snapshot key of a vault is stored under
+// next to the data keys of the environments. Environment names cannot
+// contain '@'.
+const snapshotKeyName = "@snapshots"
+
+// GetOrCreateSnapshotKey returns the random key the snapshots of the vault
+// are encrypted with. It is stored like a data key, wrapped with the
+// project password key or for every recipient, so it outlives password
+// changes and the snapshots of one recipient open for all others.
+func (pm *PasswordManager) GetOrCreateSnapshotKey() ([]byte, error) {
+	return pm.GetOrCreateDataKey(snapshotKeyName)
+}
+
+// GetOrCreateDataKey returns the data key the values of an environment
+// are encrypted with. The data key is stored in the keystore wrapped with
+// the password key of the environment, so it is unlocked with the same
+// password as before and a password change only rewraps it. Vaults with
+// recipients unlock it with the local identity instead, see
+// AddRecipient.
+func (pm *PasswordManager) GetOrCreateDataKey(environment string) ([]byte, error) {
+	if key, ok := pm.cachedDataKey(environment); ok {
+		return key, nil
+	}
+
+	recipients, err := pm.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) > 0 {
+		return pm.recipientDataKey(environment, recipients)
+	}
+
+	return pm.passwordDataKey(environment)
+}
+
+// DataKey returns the data key of an environment like GetOrCreateDataKey,
+// but never creates a data key or password key: it returns ErrNoDataKey
+// instead, so read-only commands leave the keystore as it is.
+func (pm *PasswordManager) DataKey(environment string) ([]byte, error) {
+	if key, ok := pm.cachedDataKey(environment); ok {
+		return key, nil
+	}
+
+	recipients, err := pm.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) > 0 {
+		if _, err := identity.ReadKeyFile(pm.config.Vault.Path, environment); errors.Is(err, identity.ErrNoKeyFile) {
+			return nil, fmt.Errorf("%w: %s", ErrNoDataKey, environment)
+		}
+		return pm.recipientDataKey(environment, recipients)
+	}
+
+	if !pm.hasPasswordKey(environment) {
+		return nil, fmt.Errorf("%w: %s", ErrNoDataKey, environment)
+	}
+
+	_, err = pm.keystore.GetDataKey(pm.config.Project.ID, environment)
+	if errors.Is(err, keystore.ErrKeyNotFound) {
+		// Values from before data keys are encrypted with the password key
+		if environment != snapshotKeyName && pm.isLegacyPasswordKey(environment) {
+			return pm.wrappingKey(environment)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoDataKey, environment)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pm.passwordDataKey(environment)
+}
+
+// hasPasswordKey reports whether the password key unlocking the data key
+// of an environment exists
+func (pm *PasswordManager) hasPasswordKey(environment string) bool {
+	if environment != snapshotKeyName && pm.config.IsPerEnvironmentPasswordsEnabled() {
+		return pm.environmentKeyManager.HasEnvironmentKey(environment)
+	}
+
+	_, err := pm.keystore.GetKey(pm.config.Project.ID)
+	return err == nil
+}
+
+// cachedDataKey returns the data key of an environment unlocked earlier in
+// this session
+func (pm *PasswordManager) cachedDataKey(environment string) ([]byte, bool) {
+	pm.cacheMutex.RLock()
+	entry, ok := pm.sessionCache[pm.getDataKeyCacheKey(pm.config.Project.ID, environment)]
+	pm.cacheMutex.RUnlock()
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.key, true
+}
+
+// passwordDataKey returns the data key of an environment unlocked with the
+// password key of the environment
+func (pm *PasswordManager) passwordDataKey(environment string) ([]byte, error) {
+	projectID := pm.config.Project.ID
+
+	passwordKey, err := pm.wrappingKey(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKeyEntry, err := pm.keystore.GetDataKey(projectID, environment)
+	if errors.Is(err, keystore.ErrKeyNotFound) {
+		return pm.createDataKey(environment, passwordKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := keystore.UnwrapDataKey(dataKeyEntry.WrappedKey, passwordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock data key of %s: %w", environment, err)
+	}
+
+	pm.cacheDataKey(projectID, environment, dataKey)
+	return dataKey, nil
+}
+
+// wrappingKey returns the password key the data key of an environment is
+// wrapped with. The snapshot key belongs to no environment and is wrapped
+// with the project key.
+func (pm *PasswordManager) wrappingKey(environment string) ([]byte, error) {
+	if environment == snapshotKeyName {
+		return pm.GetOrCreateMasterKey(pm.config.Project.ID)
+	}
+	return pm.GetOrCreateEnvironmentKey(environment)
+}
+
+// createDataKey stores the first data key of an environment. Environments
+// unlocked by a password key from before data keys keep that key as their
+// data key, since their values are encrypted with it; all others get a
+// random one.
+func (pm *PasswordManager) createDataKey(environment string, passwordKey []byte) ([]byte, error) {
+	projectID := pm.config.Project.ID
+
+	var dataKey []byte
+	if environment != snapshotKeyName && pm.isLegacyPasswordKey(environment) {
+		dataKey = append([]byte(nil), passwordKey...)
+	} else {
+		var err error
+		if dataKey, err = keystore.GenerateDataKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := keystore.NewDataKeyEntry(projectID, environment, dataKey, passwordKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := pm.keystore.StoreDataKey(entry); err != nil {
+		return nil, err
+	}
+
+	pm.cacheDataKey(projectID, environment, dataKey)
+	return dataKey, nil
+}
+
+// isLegacyPasswordKey reports whether the password key unlocking an
+// environment was created before data keys, see keystore.KeyEntry
+func (pm *PasswordManager) isLegacyPasswordKey(environment string) bool {
+	projectID := pm.config.Project.ID
+
+	if pm.config.IsPerEnvironmentPasswordsEnabled() {
+		entry, err := pm.keystore.GetEnvironmentKey(projectID, environment)
+		return err == nil && !entry.DataKeys
+	}
+
+	entry, err := pm.keystore.GetKey(projectID)
+	return err == nil && !entry.DataKeys
+}
+
+// BeginDataKeyRotation generates a new data key for an environment and
+// records it as pending next to the current one, so values re-encrypted
+// with it stay readable if the rotation is interrupted. Call
+// FinishDataKeyRotation once every value is re-encrypted.
+func (pm *PasswordManager) BeginDataKeyRotation(environment string) ([]byte, error) {
+	if pm.recipientsEnabled() {
+		return pm.beginRecipientRotation(environment)
+	}
+
+	passwordKey, entry, err := pm.unlockDataKeyEntry(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := keystore.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.PendingKey, err = keystore.WrapDataKey(next, passwordKey); err != nil {
+		return nil, err
+	}
+	if err := pm.keystore.StoreDataKey(entry); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+// PendingDataKey returns the data key of an unfinished rotation, or
+// ErrNoPendingRotation
+func (pm *PasswordManager) PendingDataKey(environment string) ([]byte, error) {
+	if pm.recipientsEnabled() {
+		return pm.pendingRecipientKey(environment)
+	}
+
+	passwordKey, entry, err := pm.unlockDataKeyEntry(environment)
+	if err != nil {
+		return nil, err
+	}
+	if entry.PendingKey == nil {
+		return nil, ErrNoPendingRotation
+	}
+
+	return keystore.UnwrapDataKey(entry.PendingKey, passwordKey)
+}
+
+// FinishDataKeyRotation makes the pending data key of an environment its
+// current data key in a single keystore write
+func (pm *PasswordManager) FinishDataKeyRotation(environment string) error {
+	if pm.recipientsEnabled() {
+		return pm.finishRecipientRotation(environment)
+	}
+
+	_, entry, err := pm.unlockDataKeyEntry(environment)
+	if err != nil {
+		return err
+	}
+	if entry.PendingKey == nil {
+		return ErrNoPendingRotation
+	}
+
+	entry.WrappedKey = entry.PendingKey
+	entry.PendingKey = nil
+	entry.Version++
+
+	if err := pm.keystore.StoreDataKey(entry); err != nil {
+		return err
+	}
+
+	pm.ClearDataKeyCache(environment)
+	return nil
+}
+
+// AbortDataKeyRotation forgets the pending data key of an environment
+func (pm *PasswordManager) AbortDataKeyRotation(environment string) error {
+	if pm.recipientsEnabled() {
+		return pm.abortRecipientRotation(environment)
+	}
+
+	_, entry, err := pm.unlockDataKeyEntry(environment)
+	if err != nil {
+		return err
+	}
+
+	entry.PendingKey = nil
+	return pm.keystore.StoreDataKey(entry)
+}
+
+// unlockDataKeyEntry returns the password key and the data key entry of an
+// environment, creating the data key if it does not exist yet
+func (pm *PasswordManager) unlockDataKeyEntry(environment string) ([]byte, *keystore.DataKeyEntry, error) {
+	if _, err := pm.GetOrCreateDataKey(environment); err != nil {
+		return nil, nil, err
+	}
+
+	passwordKey, err := pm.wrappingKey(environment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry, err := pm.keystore.GetDataKey(pm.config.Project.ID, environment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return passwordKey, entry, nil
+}
+
+// ClearDataKeyCache clears the cached data key of an environment
+func (pm *PasswordManager) ClearDataKeyCache(environment string) {
+	pm.cacheMutex.Lock()
+	defer pm.cacheMutex.Unlock()
+	delete(pm.sessionCache, pm.getDataKeyCacheKey(pm.config.Project.ID, environment))
+}
+
+func (pm *PasswordManager) cacheDataKey(projectID, environment string, key []byte) {
+	pm.cacheMutex.Lock()
+	defer pm.cacheMutex.Unlock()
+	pm.sessionCache[pm.getDataKeyCacheKey(projectID, environment)] = &sessionEntry{
+		key:       key,
+		expiresAt: time.Now().Add(sessionCacheDuration),
+	}
+}
+
+func (pm *PasswordManager) getDataKeyCacheKey(projectID, environment string) string {
+	return fmt.Sprintf("project:%s:data:%s", projectID, environment)
+}
+
+// dataKeyEnvironments returns the configured environments and those with a
+// stored data key
+func (pm *PasswordManager) dataKeyEnvironments() ([]string, error) {
+	entries, err := pm.keystore.ListDataKeys(pm.config.Project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var environments []string
+	for _, env := range pm.config.GetEnvironmentNames() {
+		if !seen[env] {
+			seen[env] = true
+			environments = append(environments, env)
+		}
+	}
+	for _, entry := range entries {
+		if !seen[entry.Environment] {
+			seen[entry.Environment] = true
+			environments = append(environments, entry.Environment)
+		}
+	}
+
+	sort.Strings(environments)
+	return environments, nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/keystore"
+)
+
+func newDataKeyTestManager(t *testing.T) (*PasswordManager, *keystore.Keystore) {
+	t.Helper()
+
+	ks, err := keystore.NewKeystore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create keystore: %v", err)
+	}
+	t.Cleanup(func() { ks.Close() })
+
+	cfg := &config.Config{
+		Project: config.ProjectConfig{ID: "data-key-project"},
+	}
+
+	os.Setenv("VAULTENV_PASSWORD", "data-key-password")
+	t.Cleanup(func() { os.Unsetenv("VAULTENV_PASSWORD") })
+
+	return NewPasswordManager(ks, cfg), ks
+}
+
+func TestPasswordManager_GetOrCreateDataKey(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+
+	dataKey, err := pm.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+	if len(dataKey) != keystore.DataKeyLen {
+		t.Fatalf("data key length = %d, want %d", len(dataKey), keystore.DataKeyLen)
+	}
+
+	passwordKey, _ := pm.GetOrCreateMasterKey("data-key-project")
+	if bytes.Equal(dataKey, passwordKey) {
+		t.Error("a new vault uses the password key as its data key")
+	}
+
+	// A new session unlocks the same data key
+	other := NewPasswordManager(ks, pm.config)
+	again, err := other.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+	if !bytes.Equal(again, dataKey) {
+		t.Error("GetOrCreateDataKey() returned a different key in a new session")
+	}
+
+	staging, _ := other.GetOrCreateDataKey("staging")
+	if bytes.Equal(staging, dataKey) {
+		t.Error("environments share a data key")
+	}
+}
+
+func TestPasswordManager_GetOrCreateDataKey_Legacy(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+
+	// A key stored before data keys existed
+	salt, _ := pm.GenerateSalt()
+	passwordKey := pm.DeriveKey("data-key-password", salt)
+	ks.StoreKey("data-key-project", &keystore.KeyEntry{
+		ProjectID:        "data-key-project",
+		Salt:             salt,
+		VerificationHash: pm.generateVerificationHash(passwordKey),
+		CreatedAt:        time.Now(),
+	})
+
+	dataKey, err := pm.GetOrCreateDataKey("development")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+	if !bytes.Equal(dataKey, passwordKey) {
+		t.Error("existing values would no longer decrypt: the data key is not the legacy password key")
+	}
+}
+
+func TestPasswordManager_DataKeyRotation(t *testing.T) {
+	pm, _ := newDataKeyTestManager(t)
+
+	current, err := pm.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+
+	if _, err := pm.PendingDataKey("production"); !errors.Is(err, ErrNoPendingRotation) {
+		t.Errorf("PendingDataKey() error = %v, want ErrNoPendingRotation", err)
+	}
+
+	next, err := pm.BeginDataKeyRotation("production")
+	if err != nil {
+		t.Fatalf("BeginDataKeyRotation() error = %v", err)
+	}
+
+	// The current key stays in use until the rotation finishes
+	if got, _ := pm.GetOrCreateDataKey("production"); !bytes.Equal(got, current) {
+		t.Error("data key changed before the rotation finished")
+	}
+	if pending, err := pm.PendingDataKey("production"); err != nil || !bytes.Equal(pending, next) {
+		t.Errorf("PendingDataKey() = %x, %v", pending, err)
+	}
+
+	if err := pm.FinishDataKeyRotation("production"); err != nil {
+		t.Fatalf("FinishDataKeyRotation() error = %v", err)
+	}
+	if got, _ := pm.GetOrCreateDataKey("production"); !bytes.Equal(got, next) {
+		t.Error("data key not replaced after the rotation finished")
+	}
+
+	// An aborted rotation keeps the current key
+	if _, err := pm.BeginDataKeyRotation("production"); err != nil {
+		t.Fatalf("BeginDataKeyRotation() error = %v", err)
+	}
+	if err := pm.AbortDataKeyRotation("production"); err != nil {
+		t.Fatalf("AbortDataKeyRotation() error = %v", err)
+	}
+	if got, _ := pm.GetOrCreateDataKey("production"); !bytes.Equal(got, next) {
+		t.Error("data key changed by an aborted rotation")
+	}
+	if err := pm.FinishDataKeyRotation("production"); !errors.Is(err, ErrNoPendingRotation) {
+		t.Errorf("FinishDataKeyRotation() error = %v, want ErrNoPendingRotation", err)
+	}
+}
+
+func TestPasswordManager_DataKey(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+
+	// Neither a password key nor a data key is created
+	if _, err := pm.DataKey("production"); !errors.Is(err, ErrNoDataKey) {
+		t.Errorf("DataKey() error = %v, want ErrNoDataKey", err)
+	}
+	if _, err := ks.GetKey("data-key-project"); err == nil {
+		t.Error("DataKey() created a password key")
+	}
+
+	created, err := pm.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+
+	// With a password key, environments without a data key still have none
+	other := NewPasswordManager(ks, pm.config)
+	if _, err := other.DataKey("staging"); !errors.Is(err, ErrNoDataKey) {
+		t.Errorf("DataKey() error = %v, want ErrNoDataKey", err)
+	}
+	if _, err := ks.GetDataKey("data-key-project", "staging"); err == nil {
+		t.Error("DataKey() created a data key")
+	}
+
+	if got, err := other.DataKey("production"); err != nil || !bytes.Equal(got, created) {
+		t.Errorf("DataKey() = %x, %v, want the existing data key", got, err)
+	}
+}
+
+func TestPasswordManager_SnapshotKey(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+
+	key, err := pm.GetOrCreateSnapshotKey()
+	if err != nil {
+		t.Fatalf("GetOrCreateSnapshotKey() error = %v", err)
+	}
+	passwordKey, _ := pm.GetOrCreateMasterKey("data-key-project")
+	if bytes.Equal(key, passwordKey) {
+		t.Error("the snapshot key is the password key")
+	}
+
+	// A new password key rewraps the snapshot key instead of replacing it
+	pm.config.Vault.KeyDerivation = config.KDFConfig{Algorithm: "argon2id", Iterations: 4, Memory: 64 * 1024, Parallelism: 4}
+	upgraded := NewPasswordManager(ks, pm.config)
+	if got, err := upgraded.GetOrCreateSnapshotKey(); err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("GetOrCreateSnapshotKey() after a key upgrade = %x, %v", got, err)
+	}
+	if newKey, _ := upgraded.GetOrCreateMasterKey("data-key-project"); bytes.Equal(newKey, passwordKey) {
+		t.Fatal("password key not upgraded")
+	}
+}
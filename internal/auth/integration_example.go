@@ -105,8 +105,11 @@ func ExampleEnvironmentVariable(pm *PasswordManager, projectID string) error {
 			return fmt.Errorf("failed to get key entry: %w", err)
 		}
 
-		// Derive the key
-		key := pm.DeriveKey(password, keyEntry.Salt)
+		// Derive the key with the parameters it was created with
+		key, err := pm.unlockKey(keyEntry, password)
+		if err != nil {
+			return err
+		}
 
 		// Cache it for the session
 		pm.cacheSessionKey(projectID, key)
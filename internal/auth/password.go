@@ -17,17 +17,11 @@ import (
 	"github.com/vaultenv/vaultenv-cli/internal/config"
 	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
-	"golang.org/x/crypto/argon2"
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
 	"golang.org/x/term"
 )
 
 const (
-	// Argon2 parameters for key derivation
-	argon2Time    = 3
-	argon2Memory  = 64 * 1024 // 64 MB
-	argon2Threads = 4
-	argon2KeyLen  = 32 // 256-bit key
-
 	// Salt length
 	saltLen = 32
 
@@ -59,12 +53,14 @@ type sessionEntry struct {
 // NewPasswordManager creates a new password manager instance
 func NewPasswordManager(ks *keystore.Keystore, cfg *config.Config) *PasswordManager {
 	envKeyManager := keystore.NewEnvironmentKeyManager(ks, cfg.Project.ID)
-	return &PasswordManager{
+	pm := &PasswordManager{
 		keystore:              ks,
 		environmentKeyManager: envKeyManager,
 		config:                cfg,
 		sessionCache:          make(map[string]*sessionEntry),
 	}
+	envKeyManager.SetKDFParams(pm.kdfParams())
+	return pm
 }
 
 // PromptPassword prompts the user for a password with the given prompt message
@@ -123,16 +119,111 @@ func (pm *PasswordManager) PromptNewPassword() (string, error) {
 	return password, nil
 }
 
-// DeriveKey derives an encryption key from a password using Argon2
+// DeriveKey derives an encryption key from a password with the key
+// derivation parameters of vault.key_derivation. Existing keys are derived
+// with the parameters stored with them instead, see unlockKey.
 func (pm *PasswordManager) DeriveKey(password string, salt []byte) []byte {
-	return argon2.IDKey(
-		[]byte(password),
-		salt,
-		argon2Time,
-		argon2Memory,
-		argon2Threads,
-		argon2KeyLen,
-	)
+	// The parameters are validated by kdfParams, so derivation cannot fail
+	key, _ := pm.kdfParams().DeriveKey(password, salt)
+	return key
+}
+
+// kdfParams returns the parameters new keys are derived with. Invalid
+// settings are rejected when the configuration is loaded; configurations
+// built without validation get the defaults.
+func (pm *PasswordManager) kdfParams() encryption.KDFParams {
+	params, err := pm.config.Vault.KeyDerivation.Params()
+	if err != nil {
+		return encryption.DefaultKDFParams(encryption.KDFArgon2id)
+	}
+	return params
+}
+
+// unlockKey derives the key of a keystore entry from a password with the
+// parameters stored in the entry and verifies it
+func (pm *PasswordManager) unlockKey(entry *keystore.KeyEntry, password string) ([]byte, error) {
+	key, err := entry.KDF().DeriveKey(password, entry.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	if !pm.verifyKey(key, entry.VerificationHash) {
+		return nil, ErrInvalidPassword
+	}
+
+	return key, nil
+}
+
+// newKeyEntry derives a project key from a password with a new salt and
+// the configured parameters
+func (pm *PasswordManager) newKeyEntry(projectID, password string) (*keystore.KeyEntry, []byte, error) {
+	salt, err := pm.GenerateSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := pm.kdfParams()
+	key, err := params.DeriveKey(password, salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	entry := &keystore.KeyEntry{
+		ProjectID:        projectID,
+		Salt:             salt,
+		VerificationHash: pm.generateVerificationHash(key),
+		CreatedAt:        time.Now(),
+		DataKeys:         true,
+	}
+	entry.SetKDF(params)
+
+	return entry, key, nil
+}
+
+// upgradeMasterKey re-derives the key of a project with the configured
+// parameters if they are stronger than the ones it was created with,
+// rewrapping the data keys it unlocks. It returns the key to use from now
+// on; if the upgrade fails the old key keeps working and the upgrade is
+// retried on the next unlock.
+func (pm *PasswordManager) upgradeMasterKey(projectID, password string, entry *keystore.KeyEntry, key []byte) []byte {
+	params := pm.kdfParams()
+	if !entry.KDF().Weaker(params) {
+		return key
+	}
+
+	newEntry, newKey, err := pm.newKeyEntry(projectID, password)
+	if err == nil {
+		newEntry.CreatedAt = entry.CreatedAt
+		err = pm.replaceMasterKey(projectID, entry, newEntry, key, newKey)
+	}
+	if err != nil {
+		ui.Debug("Failed to upgrade key derivation of project %s: %v", projectID, err)
+		return key
+	}
+
+	ui.Debug("Upgraded key derivation of project %s to %s", projectID, params)
+	return newKey
+}
+
+// replaceMasterKey stores a new key entry for a project together with the
+// data keys rewrapped from the old key to the new one
+func (pm *PasswordManager) replaceMasterKey(projectID string, oldEntry, newEntry *keystore.KeyEntry, oldKey, newKey []byte) error {
+	// Values of environments from before data keys are encrypted with the
+	// old password key, which becomes their data key
+	environments, err := pm.dataKeyEnvironments()
+	if err != nil {
+		return err
+	}
+	adopt := !oldEntry.DataKeys && !pm.config.IsPerEnvironmentPasswordsEnabled()
+	dataKeys, err := pm.keystore.RewrapDataKeys(pm.config.Project.ID, environments, oldKey, newKey, adopt)
+	if err != nil {
+		return fmt.Errorf("failed to rewrap data keys: %w", err)
+	}
+
+	if err := pm.keystore.ReplaceKey(projectID, newEntry, dataKeys); err != nil {
+		return fmt.Errorf("failed to update key: %w", err)
+	}
+	return nil
 }
 
 // GenerateSalt generates a new random salt
@@ -173,13 +264,15 @@ func (pm *PasswordManager) GetOrCreateMasterKey(projectID string) ([]byte, error
 			return nil, err
 		}
 
-		key := pm.DeriveKey(password, existingKey.Salt)
-
-		// Verify the key by checking the verification hash
-		if !pm.verifyKey(key, existingKey.VerificationHash) {
-			return nil, ErrInvalidPassword
+		key, err := pm.unlockKey(existingKey, password)
+		if err != nil {
+			return nil, err
 		}
 
+		// Keys derived with weaker parameters than configured are
+		// upgraded while the password is at hand
+		key = pm.upgradeMasterKey(projectID, password, existingKey, key)
+
 		// Cache the key for the session
 		pm.cacheSessionKey(projectID, key)
 
@@ -193,24 +286,12 @@ func (pm *PasswordManager) GetOrCreateMasterKey(projectID string) ([]byte, error
 		return nil, err
 	}
 
-	salt, err := pm.GenerateSalt()
+	keyEntry, key, err := pm.newKeyEntry(projectID, password)
 	if err != nil {
 		return nil, err
 	}
 
-	key := pm.DeriveKey(password, salt)
-
-	// Generate verification hash
-	verificationHash := pm.generateVerificationHash(key)
-
 	// Store in keystore
-	keyEntry := &keystore.KeyEntry{
-		ProjectID:        projectID,
-		Salt:             salt,
-		VerificationHash: verificationHash,
-		CreatedAt:        time.Now(),
-	}
-
 	if err := pm.keystore.StoreKey(projectID, keyEntry); err != nil {
 		return nil, fmt.Errorf("failed to store key: %w", err)
 	}
@@ -228,16 +309,13 @@ func (pm *PasswordManager) VerifyPassword(projectID, password string) error {
 		return fmt.Errorf("failed to get key: %w", err)
 	}
 
-	key := pm.DeriveKey(password, keyEntry.Salt)
-
-	if !pm.verifyKey(key, keyEntry.VerificationHash) {
-		return ErrInvalidPassword
-	}
-
-	return nil
+	_, err = pm.unlockKey(keyEntry, password)
+	return err
 }
 
-// ChangePassword changes the password for a project
+// ChangePassword changes the password for a project. The data keys of the
+// environments are rewrapped with the new password key; the values
+// themselves are not touched.
 func (pm *PasswordManager) ChangePassword(projectID string) error {
 	// Verify current password
 	currentPassword, err := pm.PromptPassword("Enter current password: ")
@@ -245,7 +323,12 @@ func (pm *PasswordManager) ChangePassword(projectID string) error {
 		return err
 	}
 
-	if err := pm.VerifyPassword(projectID, currentPassword); err != nil {
+	oldEntry, err := pm.keystore.GetKey(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to get key: %w", err)
+	}
+	oldKey, err := pm.unlockKey(oldEntry, currentPassword)
+	if err != nil {
 		return err
 	}
 
@@ -255,28 +338,16 @@ func (pm *PasswordManager) ChangePassword(projectID string) error {
 		return err
 	}
 
-	// Generate new salt
-	salt, err := pm.GenerateSalt()
+	// Derive new key with a new salt and the configured parameters
+	keyEntry, newKey, err := pm.newKeyEntry(projectID, newPassword)
 	if err != nil {
 		return err
 	}
+	keyEntry.CreatedAt = oldEntry.CreatedAt
 
-	// Derive new key
-	newKey := pm.DeriveKey(newPassword, salt)
-
-	// Generate new verification hash
-	verificationHash := pm.generateVerificationHash(newKey)
-
-	// Update keystore
-	keyEntry := &keystore.KeyEntry{
-		ProjectID:        projectID,
-		Salt:             salt,
-		VerificationHash: verificationHash,
-		CreatedAt:        time.Now(),
-	}
-
-	if err := pm.keystore.StoreKey(projectID, keyEntry); err != nil {
-		return fmt.Errorf("failed to update key: %w", err)
+	// Update keystore, rewrapping the data keys with the new key
+	if err := pm.replaceMasterKey(projectID, oldEntry, keyEntry, oldKey, newKey); err != nil {
+		return err
 	}
 
 	// Clear session cache for this project
@@ -348,9 +419,8 @@ func (pm *PasswordManager) ExportKey(projectID string, password string) (string,
 	}
 
 	// Verify password
-	key := pm.DeriveKey(password, keyEntry.Salt)
-	if !pm.verifyKey(key, keyEntry.VerificationHash) {
-		return "", ErrInvalidPassword
+	if _, err := pm.unlockKey(keyEntry, password); err != nil {
+		return "", err
 	}
 
 	// Create export data
@@ -359,13 +429,24 @@ func (pm *PasswordManager) ExportKey(projectID string, password string) (string,
 		keyEntry.VerificationHash,
 	)
 
+	// Keys not derived with the defaults carry their parameters
+	if kdf := keyEntry.KDF(); kdf != encryption.DefaultKDFParams(encryption.KDFArgon2id) {
+		exportData = fmt.Sprintf("vaultenv:v2:%s:%s:%s:%d:%d:%d",
+			base64.StdEncoding.EncodeToString(keyEntry.Salt),
+			keyEntry.VerificationHash,
+			kdf.Algorithm, kdf.Iterations, kdf.Memory, kdf.Parallelism,
+		)
+	}
+
 	return exportData, nil
 }
 
 // ImportKey imports a key from export format
 func (pm *PasswordManager) ImportKey(projectID string, exportData string, password string) error {
 	parts := strings.Split(exportData, ":")
-	if len(parts) != 4 || parts[0] != "vaultenv" || parts[1] != "v1" {
+	valid := len(parts) == 4 && parts[0] == "vaultenv" && parts[1] == "v1" ||
+		len(parts) == 8 && parts[0] == "vaultenv" && parts[1] == "v2"
+	if !valid {
 		return errors.New("invalid export format")
 	}
 
@@ -374,22 +455,30 @@ func (pm *PasswordManager) ImportKey(projectID string, exportData string, passwo
 		return fmt.Errorf("invalid salt format: %w", err)
 	}
 
-	verificationHash := parts[3]
-
-	// Verify the password works with imported data
-	key := pm.DeriveKey(password, salt)
-	if !pm.verifyKey(key, verificationHash) {
-		return ErrInvalidPassword
-	}
-
 	// Store in keystore
 	keyEntry := &keystore.KeyEntry{
 		ProjectID:        projectID,
 		Salt:             salt,
-		VerificationHash: verificationHash,
+		VerificationHash: parts[3],
 		CreatedAt:        time.Now(),
 	}
 
+	if parts[1] == "v2" {
+		var kdf encryption.KDFParams
+		if _, err := fmt.Sscanf(strings.Join(parts[4:], " "), "%s %d %d %d", &kdf.Algorithm, &kdf.Iterations, &kdf.Memory, &kdf.Parallelism); err != nil {
+			return fmt.Errorf("invalid key derivation parameters: %w", err)
+		}
+		if err := kdf.Validate(); err != nil {
+			return fmt.Errorf("invalid key derivation parameters: %w", err)
+		}
+		keyEntry.SetKDF(kdf)
+	}
+
+	// Verify the password works with imported data
+	if _, err := pm.unlockKey(keyEntry, password); err != nil {
+		return err
+	}
+
 	if err := pm.keystore.StoreKey(projectID, keyEntry); err != nil {
 		return fmt.Errorf("failed to store imported key: %w", err)
 	}
@@ -1256,3 +1256,82 @@ func TestPasswordManager_ErrorHandling(t *testing.T) {
 		}
 	}
 }
+
+func TestPasswordManager_UpgradesKeyDerivation(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+
+	dataKey, err := pm.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+	old, _ := ks.GetKey("data-key-project")
+	if old.Algorithm != "argon2id" || old.Iterations != 3 {
+		t.Fatalf("stored key derivation = %+v", old.KDF())
+	}
+
+	// Stronger parameters are applied on the next unlock
+	pm.config.Vault.KeyDerivation = config.KDFConfig{Algorithm: "argon2id", Iterations: 4, Memory: 64 * 1024, Parallelism: 4}
+	upgraded := NewPasswordManager(ks, pm.config)
+	got, err := upgraded.GetOrCreateDataKey("production")
+	if err != nil || !bytes.Equal(got, dataKey) {
+		t.Fatalf("GetOrCreateDataKey() after upgrade = %x, %v", got, err)
+	}
+
+	entry, _ := ks.GetKey("data-key-project")
+	if entry.Iterations != 4 || bytes.Equal(entry.Salt, old.Salt) || !entry.CreatedAt.Equal(old.CreatedAt) {
+		t.Errorf("upgraded key entry = %+v", entry)
+	}
+
+	// Weaker parameters keep the stored ones, which still unlock the vault
+	pm.config.Vault.KeyDerivation.Iterations = 2
+	again := NewPasswordManager(ks, pm.config)
+	if got, err := again.GetOrCreateDataKey("production"); err != nil || !bytes.Equal(got, dataKey) {
+		t.Fatalf("GetOrCreateDataKey() with weaker settings = %x, %v", got, err)
+	}
+	if entry, _ := ks.GetKey("data-key-project"); entry.Iterations != 4 {
+		t.Errorf("key derivation downgraded to %+v", entry.KDF())
+	}
+}
+
+func TestPasswordManager_UpgradesEnvironmentKeyDerivation(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+	pm.config.Security.PerEnvironmentPasswords = true
+	pm = NewPasswordManager(ks, pm.config)
+
+	dataKey, err := pm.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+
+	pm.config.Vault.KeyDerivation = config.KDFConfig{Algorithm: "argon2id", Iterations: 3, Memory: 128 * 1024, Parallelism: 4}
+	upgraded := NewPasswordManager(ks, pm.config)
+	if got, err := upgraded.GetOrCreateDataKey("production"); err != nil || !bytes.Equal(got, dataKey) {
+		t.Fatalf("GetOrCreateDataKey() after upgrade = %x, %v", got, err)
+	}
+
+	entry, _ := ks.GetEnvironmentKey("data-key-project", "production")
+	if entry.Memory != 128*1024 {
+		t.Errorf("environment key derivation = %+v, want 128 MiB", entry.KDF())
+	}
+}
+
+func TestPasswordManager_ExportImportKey_KDFParams(t *testing.T) {
+	pm, _ := newDataKeyTestManager(t)
+	pm.config.Vault.KeyDerivation = config.KDFConfig{Algorithm: "scrypt", Memory: 1024, Parallelism: 1}
+
+	if _, err := pm.GetOrCreateMasterKey("data-key-project"); err != nil {
+		t.Fatalf("GetOrCreateMasterKey() error = %v", err)
+	}
+
+	exportData, err := pm.ExportKey("data-key-project", "data-key-password")
+	if err != nil || !strings.HasPrefix(exportData, "vaultenv:v2:") {
+		t.Fatalf("ExportKey() = %q, %v", exportData, err)
+	}
+
+	if err := pm.ImportKey("imported", exportData, "data-key-password"); err != nil {
+		t.Fatalf("ImportKey() error = %v", err)
+	}
+	if entry, _ := pm.keystore.GetKey("imported"); entry.Algorithm != "scrypt" || entry.Memory != 1024 {
+		t.Errorf("imported key derivation = %+v", entry.KDF())
+	}
+}
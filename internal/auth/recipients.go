@@ -0,0 +1,393 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/vaultenv/vaultenv-cli/internal/identity"
+	"github.com/vaultenv/vaultenv-cli/internal/keystore"
+)
+
+var (
+	ErrRecipientExists   = errors.New("recipient already exists")
+	ErrRecipientNotFound = errors.New("recipient not found")
+	ErrLastRecipient     = errors.New("cannot remove the last recipient")
+)
+
+// Recipients returns the recipients listed in the recipients file of the
+// vault, none for vaults unlocked with passwords
+func (pm *PasswordManager) Recipients() ([]identity.Entry, error) {
+	return identity.ReadRecipients(pm.config.Vault.Path)
+}
+
+// recipientsEnabled reports whether the data keys of the vault are wrapped
+// for recipients. An unreadable recipients file counts, so its error is
+// reported instead of falling back to passwords.
+func (pm *PasswordManager) recipientsEnabled() bool {
+	entries, err := pm.Recipients()
+	return err != nil || len(entries) > 0
+}
+
+// AddRecipient wraps the data key of every environment for another
+// recipient and lists it in the recipients file. The first recipient
+// switches the vault from passwords to recipients: the data keys are
+// unlocked with the password one last time, so it must be the recipient
+// of the local identity. Only the data keys are rewrapped; the values are
+// not touched.
+func (pm *PasswordManager) AddRecipient(entry identity.Entry) error {
+	entries, err := pm.Recipients()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Recipient == entry.Recipient {
+			return fmt.Errorf("%w: %s", ErrRecipientExists, entry.Recipient)
+		}
+	}
+	updated := append(append([]identity.Entry(nil), entries...), entry)
+
+	id, err := identity.Load()
+	if err != nil {
+		return err
+	}
+
+	var keyFiles []*identity.KeyFile
+	switch {
+	case len(entries) == 0 && id.Recipient() != entry.Recipient:
+		return fmt.Errorf("the first recipient must be your own identity %s, or you lose access to the vault", id.Recipient())
+	case len(entries) == 0:
+		keyFiles, err = pm.passwordKeyFiles(updated)
+	case !isRecipient(id, entries):
+		return fmt.Errorf("%w of this vault: %s", identity.ErrNotRecipient, id.Recipient())
+	default:
+		keyFiles, err = pm.rewrapKeyFiles(id, updated)
+	}
+	if err != nil {
+		return err
+	}
+
+	return pm.storeKeyFiles(keyFiles, updated)
+}
+
+// RemoveRecipient rewraps the data key of every environment for the
+// remaining recipients. The removed recipient may have kept the data keys
+// it could unlock; rotate the keys to lock it out of the values.
+func (pm *PasswordManager) RemoveRecipient(recipient identity.Recipient) error {
+	entries, err := pm.Recipients()
+	if err != nil {
+		return err
+	}
+
+	var updated []identity.Entry
+	for _, e := range entries {
+		if e.Recipient != recipient {
+			updated = append(updated, e)
+		}
+	}
+	if len(updated) == len(entries) {
+		return fmt.Errorf("%w: %s", ErrRecipientNotFound, recipient)
+	}
+	if len(updated) == 0 {
+		return ErrLastRecipient
+	}
+
+	id, err := identity.Load()
+	if err != nil {
+		return err
+	}
+	if !isRecipient(id, entries) {
+		return fmt.Errorf("%w of this vault: %s", identity.ErrNotRecipient, id.Recipient())
+	}
+
+	keyFiles, err := pm.rewrapKeyFiles(id, updated)
+	if err != nil {
+		return err
+	}
+
+	return pm.storeKeyFiles(keyFiles, updated)
+}
+
+// passwordKeyFiles wraps the data keys of a vault unlocked with passwords
+// for the recipients, together with the snapshot key if the vault has
+// one. Environments without a password key are left to get a data key on
+// first use, so a vault that never had a password is not given one.
+func (pm *PasswordManager) passwordKeyFiles(entries []identity.Entry) ([]*identity.KeyFile, error) {
+	projectID := pm.config.Project.ID
+
+	environments, err := pm.dataKeyEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyFiles []*identity.KeyFile
+	for _, env := range environments {
+		switch {
+		case env == snapshotKeyName:
+			// Listed only once created, wrapped with the project key
+		case pm.config.IsPerEnvironmentPasswordsEnabled():
+			if !pm.environmentKeyManager.HasEnvironmentKey(env) {
+				continue
+			}
+		default:
+			if _, err := pm.keystore.GetKey(projectID); err != nil {
+				continue
+			}
+		}
+
+		dataKey, err := pm.passwordDataKey(env)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := pm.keystore.GetDataKey(projectID, env)
+		if err != nil {
+			return nil, err
+		}
+		if entry.PendingKey != nil {
+			return nil, fmt.Errorf("the key rotation of %s has not finished, run 'vaultenv security rotate-keys --env %s' first", env, env)
+		}
+
+		stanzas, err := identity.Wrap(dataKey, identity.Recipients(entries))
+		if err != nil {
+			return nil, err
+		}
+		keyFiles = append(keyFiles, &identity.KeyFile{Environment: env, KeyVersion: entry.Version, Stanzas: stanzas})
+	}
+
+	return keyFiles, nil
+}
+
+// rewrapKeyFiles unwraps the data keys of every environment with the
+// local identity and wraps them for the recipients
+func (pm *PasswordManager) rewrapKeyFiles(id *identity.Identity, entries []identity.Entry) ([]*identity.KeyFile, error) {
+	environments, err := identity.ListKeyFiles(pm.config.Vault.Path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(environments)
+
+	recipients := identity.Recipients(entries)
+	keyFiles := make([]*identity.KeyFile, 0, len(environments))
+	for _, env := range environments {
+		kf, err := identity.ReadKeyFile(pm.config.Vault.Path, env)
+		if err != nil {
+			return nil, err
+		}
+
+		if kf.Stanzas, err = rewrap(kf.Stanzas, id, recipients); err != nil {
+			return nil, fmt.Errorf("failed to rewrap data key of %s: %w", env, err)
+		}
+		if kf.Pending != nil {
+			if kf.Pending, err = rewrap(kf.Pending, id, recipients); err != nil {
+				return nil, fmt.Errorf("failed to rewrap pending data key of %s: %w", env, err)
+			}
+		}
+
+		keyFiles = append(keyFiles, kf)
+	}
+
+	return keyFiles, nil
+}
+
+func rewrap(stanzas []identity.Stanza, id *identity.Identity, recipients []identity.Recipient) ([]identity.Stanza, error) {
+	dataKey, err := identity.Unwrap(stanzas, id)
+	if err != nil {
+		return nil, err
+	}
+	return identity.Wrap(dataKey, recipients)
+}
+
+// storeKeyFiles writes the wrapped data keys and then the recipients they
+// are wrapped for, so an interrupted change leaves the data keys wrapped
+// for every listed recipient
+func (pm *PasswordManager) storeKeyFiles(keyFiles []*identity.KeyFile, entries []identity.Entry) error {
+	for _, kf := range keyFiles {
+		if err := identity.WriteKeyFile(pm.config.Vault.Path, kf); err != nil {
+			return err
+		}
+	}
+
+	return identity.WriteRecipients(pm.config.Vault.Path, entries)
+}
+
+// recipientDataKey returns the data key of an environment unlocked with
+// the local identity, creating it if the environment has none
+func (pm *PasswordManager) recipientDataKey(environment string, entries []identity.Entry) ([]byte, error) {
+	id, err := identity.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	kf, err := identity.ReadKeyFile(pm.config.Vault.Path, environment)
+	if errors.Is(err, identity.ErrNoKeyFile) {
+		return pm.createRecipientDataKey(environment, id, entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := identity.Unwrap(kf.Stanzas, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock data key of %s: %w", environment, err)
+	}
+
+	pm.cacheDataKey(pm.config.Project.ID, environment, dataKey)
+	return dataKey, nil
+}
+
+// createRecipientDataKey wraps a new random data key for the recipients
+func (pm *PasswordManager) createRecipientDataKey(environment string, id *identity.Identity, entries []identity.Entry) ([]byte, error) {
+	// Values written with a key this identity cannot unwrap later would
+	// be lost to it
+	if !isRecipient(id, entries) {
+		return nil, fmt.Errorf("%w of this vault: %s", identity.ErrNotRecipient, id.Recipient())
+	}
+
+	dataKey, err := keystore.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	stanzas, err := identity.Wrap(dataKey, identity.Recipients(entries))
+	if err != nil {
+		return nil, err
+	}
+
+	err = identity.CreateKeyFile(pm.config.Vault.Path, &identity.KeyFile{Environment: environment, KeyVersion: 1, Stanzas: stanzas})
+	if errors.Is(err, identity.ErrKeyFileExists) {
+		// Created by another process in the meantime
+		return pm.recipientDataKey(environment, entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pm.cacheDataKey(pm.config.Project.ID, environment, dataKey)
+	return dataKey, nil
+}
+
+func isRecipient(id *identity.Identity, entries []identity.Entry) bool {
+	for _, e := range entries {
+		if e.Recipient == id.Recipient() {
+			return true
+		}
+	}
+	return false
+}
+
+// unlockKeyFile returns the local identity and the wrapped data key of an
+// environment, creating the data key if it does not exist yet
+func (pm *PasswordManager) unlockKeyFile(environment string) (*identity.Identity, *identity.KeyFile, error) {
+	if _, err := pm.GetOrCreateDataKey(environment); err != nil {
+		return nil, nil, err
+	}
+
+	id, err := identity.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kf, err := identity.ReadKeyFile(pm.config.Vault.Path, environment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return id, kf, nil
+}
+
+// beginRecipientRotation is BeginDataKeyRotation for vaults with
+// recipients: the pending data key is wrapped for every recipient
+func (pm *PasswordManager) beginRecipientRotation(environment string) ([]byte, error) {
+	entries, err := pm.Recipients()
+	if err != nil {
+		return nil, err
+	}
+
+	_, kf, err := pm.unlockKeyFile(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := keystore.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if kf.Pending, err = identity.Wrap(next, identity.Recipients(entries)); err != nil {
+		return nil, err
+	}
+	if err := identity.WriteKeyFile(pm.config.Vault.Path, kf); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+// pendingRecipientKey is PendingDataKey for vaults with recipients
+func (pm *PasswordManager) pendingRecipientKey(environment string) ([]byte, error) {
+	id, kf, err := pm.unlockKeyFile(environment)
+	if err != nil {
+		return nil, err
+	}
+	if kf.Pending == nil {
+		return nil, ErrNoPendingRotation
+	}
+
+	return identity.Unwrap(kf.Pending, id)
+}
+
+// finishRecipientRotation is FinishDataKeyRotation for vaults with
+// recipients
+func (pm *PasswordManager) finishRecipientRotation(environment string) error {
+	_, kf, err := pm.unlockKeyFile(environment)
+	if err != nil {
+		return err
+	}
+	if kf.Pending == nil {
+		return ErrNoPendingRotation
+	}
+
+	kf.Stanzas = kf.Pending
+	kf.Pending = nil
+	kf.KeyVersion++
+
+	if err := identity.WriteKeyFile(pm.config.Vault.Path, kf); err != nil {
+		return err
+	}
+
+	pm.ClearDataKeyCache(environment)
+	return nil
+}
+
+// abortRecipientRotation is AbortDataKeyRotation for vaults with
+// recipients
+func (pm *PasswordManager) abortRecipientRotation(environment string) error {
+	_, kf, err := pm.unlockKeyFile(environment)
+	if err != nil {
+		return err
+	}
+
+	kf.Pending = nil
+	return identity.WriteKeyFile(pm.config.Vault.Path, kf)
+}
+
+// GetOrCreateLocalKey returns the secret the keys of local data were
+// derived from: the local identity in vaults with recipients, the project
+// password key otherwise. Snapshots taken before the snapshot key are
+// encrypted with it, see GetOrCreateSnapshotKey.
+func (pm *PasswordManager) GetOrCreateLocalKey() ([]byte, error) {
+	entries, err := pm.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return pm.GetOrCreateMasterKey(pm.config.Project.ID)
+	}
+
+	id, err := identity.Load()
+	if err != nil {
+		return nil, err
+	}
+	return id.Secret(), nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/internal/identity"
+)
+
+func useIdentity(t *testing.T, id *identity.Identity) {
+	t.Helper()
+	os.Setenv(identity.IdentityEnv, id.String())
+	t.Cleanup(func() { os.Unsetenv(identity.IdentityEnv) })
+}
+
+func TestPasswordManager_Recipients(t *testing.T) {
+	pm, ks := newDataKeyTestManager(t)
+	pm.config.Vault.Path = t.TempDir()
+
+	alice, _ := identity.Generate()
+	bob, _ := identity.Generate()
+	useIdentity(t, alice)
+
+	production, err := pm.GetOrCreateDataKey("production")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() error = %v", err)
+	}
+
+	// The first recipient must be the local identity
+	if err := pm.AddRecipient(identity.Entry{Recipient: bob.Recipient()}); err == nil {
+		t.Fatal("AddRecipient() accepted a first recipient other than the local identity")
+	}
+	if err := pm.AddRecipient(identity.Entry{Recipient: alice.Recipient(), Name: "alice"}); err != nil {
+		t.Fatalf("AddRecipient() error = %v", err)
+	}
+	if err := pm.AddRecipient(identity.Entry{Recipient: alice.Recipient()}); !errors.Is(err, ErrRecipientExists) {
+		t.Errorf("AddRecipient() of an existing recipient error = %v", err)
+	}
+
+	// The existing data key is unlocked with the identity, without password
+	os.Unsetenv("VAULTENV_PASSWORD")
+	session := NewPasswordManager(ks, pm.config)
+	if got, err := session.GetOrCreateDataKey("production"); err != nil || !bytes.Equal(got, production) {
+		t.Fatalf("GetOrCreateDataKey() after switching to recipients = %x, %v", got, err)
+	}
+	staging, err := session.GetOrCreateDataKey("staging")
+	if err != nil {
+		t.Fatalf("GetOrCreateDataKey() of a new environment error = %v", err)
+	}
+
+	if err := session.AddRecipient(identity.Entry{Recipient: bob.Recipient(), Name: "bob"}); err != nil {
+		t.Fatalf("AddRecipient() error = %v", err)
+	}
+
+	useIdentity(t, bob)
+	session = NewPasswordManager(ks, pm.config)
+	for env, want := range map[string][]byte{"production": production, "staging": staging} {
+		if got, err := session.GetOrCreateDataKey(env); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("GetOrCreateDataKey(%s) for an added recipient = %x, %v", env, got, err)
+		}
+	}
+
+	// A rotation wraps the new key for every recipient
+	next, err := session.BeginDataKeyRotation("production")
+	if err != nil {
+		t.Fatalf("BeginDataKeyRotation() error = %v", err)
+	}
+	if err := session.FinishDataKeyRotation("production"); err != nil {
+		t.Fatalf("FinishDataKeyRotation() error = %v", err)
+	}
+
+	if err := session.RemoveRecipient(alice.Recipient()); err != nil {
+		t.Fatalf("RemoveRecipient() error = %v", err)
+	}
+	if err := session.RemoveRecipient(bob.Recipient()); !errors.Is(err, ErrLastRecipient) {
+		t.Errorf("RemoveRecipient() of the last recipient error = %v", err)
+	}
+	if got, err := NewPasswordManager(ks, pm.config).GetOrCreateDataKey("production"); err != nil || !bytes.Equal(got, next) {
+		t.Errorf("GetOrCreateDataKey() after rotation = %x, %v", got, err)
+	}
+
+	useIdentity(t, alice)
+	if _, err := NewPasswordManager(ks, pm.config).GetOrCreateDataKey("production"); !errors.Is(err, identity.ErrNotRecipient) {
+		t.Errorf("GetOrCreateDataKey() for a removed recipient error = %v, want ErrNotRecipient", err)
+	}
+}
+
+func TestPasswordManager_SnapshotKeyRecipients(t *testing.T) {
+	for _, perEnvironment := range []bool{false, true} {
+		t.Run(fmt.Sprintf("per-environment=%v", perEnvironment), func(t *testing.T) {
+			pm, ks := newDataKeyTestManager(t)
+			pm.config.Vault.Path = t.TempDir()
+			pm.config.Security.PerEnvironmentPasswords = perEnvironment
+			pm = NewPasswordManager(ks, pm.config)
+
+			alice, _ := identity.Generate()
+			bob, _ := identity.Generate()
+			useIdentity(t, alice)
+
+			key, err := pm.GetOrCreateSnapshotKey()
+			if err != nil {
+				t.Fatalf("GetOrCreateSnapshotKey() error = %v", err)
+			}
+
+			if err := pm.AddRecipient(identity.Entry{Recipient: alice.Recipient()}); err != nil {
+				t.Fatalf("AddRecipient() error = %v", err)
+			}
+			if err := NewPasswordManager(ks, pm.config).AddRecipient(identity.Entry{Recipient: bob.Recipient()}); err != nil {
+				t.Fatalf("AddRecipient() error = %v", err)
+			}
+
+			// Every recipient unlocks the snapshot key taken with the password
+			os.Unsetenv("VAULTENV_PASSWORD")
+			for name, id := range map[string]*identity.Identity{"alice": alice, "bob": bob} {
+				useIdentity(t, id)
+				if got, err := NewPasswordManager(ks, pm.config).GetOrCreateSnapshotKey(); err != nil || !bytes.Equal(got, key) {
+					t.Errorf("GetOrCreateSnapshotKey() for %s = %x, %v", name, got, err)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -139,13 +140,21 @@ func runBatchExport(cmd *cobra.Command, toDir, format string, timestamp bool,
 	// Create exporter factory
 	factory := export.NewExporterFactory()
 
-	// Export each environment
+	// Export each environment, stopping between environments on Ctrl-C
+	ctx := commandContext(cmd)
 	var exportedCount int
 	var errors []error
 
 	for _, env := range envs {
-		if err := exportSingleEnvironment(cfg, env, toDir, format, timestamp,
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := exportSingleEnvironment(ctx, cfg, env, toDir, format, timestamp,
 			includeEmpty, overwrite, dryRun, factory); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			errors = append(errors, fmt.Errorf("%s: %w", env, err))
 			ui.Error("Failed to export %s: %v", env, err)
 		} else {
@@ -154,6 +163,11 @@ func runBatchExport(cmd *cobra.Command, toDir, format string, timestamp bool,
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		ui.Warning("Export interrupted after %d/%d environments", exportedCount, len(envs))
+		return fmt.Errorf("batch export interrupted: %w", err)
+	}
+
 	// Report results
 	if dryRun {
 		ui.Info("Dry run complete - would export %d environments", len(envs))
@@ -173,7 +187,7 @@ func runBatchExport(cmd *cobra.Command, toDir, format string, timestamp bool,
 }
 
 // exportSingleEnvironment exports a single environment to a file
-func exportSingleEnvironment(cfg *config.Config, env, toDir, format string,
+func exportSingleEnvironment(ctx context.Context, cfg *config.Config, env, toDir, format string,
 	timestamp, includeEmpty, overwrite, dryRun bool, factory *export.ExporterFactory) error {
 
 	// Get storage for the environment
@@ -183,11 +197,16 @@ func exportSingleEnvironment(cfg *config.Config, env, toDir, format string,
 	}
 
 	// Get all variables
-	vars, err := getAllVariables(store)
+	vars, err := getAllVariables(ctx, store)
 	if err != nil {
 		return fmt.Errorf("failed to get variables: %w", err)
 	}
 
+	vars, err = resolveReferences(ctx, cfg, env, store, environmentStorage(cfg), vars)
+	if err != nil {
+		return err
+	}
+
 	if len(vars) == 0 {
 		ui.Debug("No variables found in environment %s", env)
 		return nil
@@ -200,7 +219,7 @@ func exportSingleEnvironment(cfg *config.Config, env, toDir, format string,
 	}
 
 	// Configure exporter
-	configureExporter(exporter, true, includeEmpty, false)
+	configureExporter(exporter, true, includeEmpty, false, nil)
 
 	// Generate filename
 	filename := fmt.Sprintf("%s%s", env, exporter.FileExtension())
@@ -318,8 +337,9 @@ func runBatchImport(cmd *cobra.Command, fromDir, pattern, toEnv string,
 
 	ui.Info("Found %d files to import", len(files))
 
-	// Process each file
-	var importedCount int
+	// Parse every file before writing anything, so one bad file
+	// leaves all environments unchanged
+	var planned []batchImportFile
 	var errors []error
 
 	for _, file := range files {
@@ -329,21 +349,14 @@ func runBatchImport(cmd *cobra.Command, fromDir, pattern, toEnv string,
 			env = deriveEnvironmentName(file)
 		}
 
-		if err := importSingleFile(cfg, file, env, createEnvs, noOverride,
-			dryRun, expandVars, ignoreInvalid); err != nil {
+		vars, err := parseImportFile(cfg, file, env, createEnvs, expandVars, ignoreInvalid)
+		if err != nil {
 			errors = append(errors, fmt.Errorf("%s: %w", filepath.Base(file), err))
 			ui.Error("Failed to import %s: %v", filepath.Base(file), err)
-		} else {
-			importedCount++
-			ui.Success("Imported %s to %s", filepath.Base(file), env)
+			continue
 		}
-	}
 
-	// Report results
-	if dryRun {
-		ui.Info("Dry run complete - would import %d files", len(files))
-	} else {
-		ui.Success("Successfully imported %d/%d files", importedCount, len(files))
+		planned = append(planned, batchImportFile{filename: file, env: env, vars: vars})
 	}
 
 	if len(errors) > 0 {
@@ -351,31 +364,99 @@ func runBatchImport(cmd *cobra.Command, fromDir, pattern, toEnv string,
 		for _, err := range errors {
 			ui.Error("  - %v", err)
 		}
-		return fmt.Errorf("batch import partially failed")
+		return fmt.Errorf("batch import failed, no variables were imported")
+	}
+
+	if dryRun {
+		for _, p := range planned {
+			if !cfg.HasEnvironment(p.env) {
+				ui.Info("Would create environment: %s", p.env)
+			}
+			ui.Info("Would import %d variables from %s to %s", len(p.vars), filepath.Base(p.filename), p.env)
+		}
+		ui.Info("Dry run complete - would import %d files", len(files))
+		return nil
+	}
+
+	// Snapshot the environments that are about to change
+	var existing []string
+	seen := make(map[string]bool)
+	for _, p := range planned {
+		if cfg.HasEnvironment(p.env) && !seen[p.env] {
+			seen[p.env] = true
+			existing = append(existing, p.env)
+		}
+	}
+	if err := autoSnapshot(cfg, cfg.Vault.Type, "before batch import-all", existing); err != nil {
+		return err
+	}
+
+	// Create missing environments
+	created := false
+	for _, p := range planned {
+		if !cfg.HasEnvironment(p.env) {
+			cfg.SetEnvironmentConfig(p.env, config.EnvironmentConfig{
+				Description: fmt.Sprintf("Auto-created from %s", filepath.Base(p.filename)),
+			})
+			created = true
+		}
+	}
+	if created {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config after creating environment: %w", err)
+		}
+	}
+
+	// Merge files targeting the same environment, later files win
+	var envs []string
+	byEnv := make(map[string]map[string]string)
+	for _, p := range planned {
+		if _, ok := byEnv[p.env]; !ok {
+			byEnv[p.env] = make(map[string]string)
+			envs = append(envs, p.env)
+		}
+		for key, value := range p.vars {
+			byEnv[p.env][key] = value
+		}
 	}
 
+	// Each environment is written in a single transaction
+	for _, env := range envs {
+		if len(byEnv[env]) == 0 {
+			continue
+		}
+
+		store, err := getStorageForEnvironment(cfg, env)
+		if err != nil {
+			return fmt.Errorf("failed to get storage for %s: %w", env, err)
+		}
+
+		err = importVariables(store, byEnv[env], env)
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("failed to import into %s: %w", env, err)
+		}
+	}
+
+	ui.Success("Successfully imported %d/%d files", len(planned), len(files))
 	return nil
 }
 
-// importSingleFile imports a single .env file
-func importSingleFile(cfg *config.Config, filename, env string, createEnvs, noOverride,
-	dryRun, expandVars, ignoreInvalid bool) error {
+// batchImportFile is a parsed .env file waiting to be imported
+type batchImportFile struct {
+	filename string
+	env      string
+	vars     map[string]string
+}
+
+// parseImportFile checks the target environment of a .env file and
+// parses its variables without changing anything
+func parseImportFile(cfg *config.Config, filename, env string, createEnvs,
+	expandVars, ignoreInvalid bool) (map[string]string, error) {
 
 	// Check if environment exists
-	if !cfg.HasEnvironment(env) {
-		if createEnvs {
-			if !dryRun {
-				cfg.SetEnvironmentConfig(env, config.EnvironmentConfig{
-					Description: fmt.Sprintf("Auto-created from %s", filepath.Base(filename)),
-				})
-				if err := cfg.Save(); err != nil {
-					return fmt.Errorf("failed to save config after creating environment: %w", err)
-				}
-			}
-			ui.Info("Would create environment: %s", env)
-		} else {
-			return fmt.Errorf("environment %s does not exist (use --create-envs to create)", env)
-		}
+	if !cfg.HasEnvironment(env) && !createEnvs {
+		return nil, fmt.Errorf("environment %s does not exist (use --create-envs to create)", env)
 	}
 
 	// Parse the file
@@ -385,26 +466,14 @@ func importSingleFile(cfg *config.Config, filename, env string, createEnvs, noOv
 
 	vars, err := parser.ParseFile(filename)
 	if err != nil {
-		return fmt.Errorf("failed to parse file: %w", err)
+		return nil, fmt.Errorf("failed to parse file: %w", err)
 	}
 
 	if len(vars) == 0 {
 		ui.Debug("No variables found in %s", filename)
-		return nil
-	}
-
-	if dryRun {
-		ui.Info("Would import %d variables from %s to %s", len(vars), filepath.Base(filename), env)
-		return nil
-	}
-
-	// Get storage and import
-	store, err := getStorageForEnvironment(cfg, env)
-	if err != nil {
-		return fmt.Errorf("failed to get storage: %w", err)
 	}
 
-	return importVariables(store, vars, env)
+	return vars, nil
 }
 
 // findMatchingFiles finds files matching a pattern in a directory
@@ -533,7 +602,7 @@ func runBatchCopy(cmd *cobra.Command, fromEnv, toEnv string, filter []string, no
 	}
 
 	// Get source variables
-	sourceVars, err := getAllVariables(sourceStore)
+	sourceVars, err := getAllVariables(commandContext(cmd), sourceStore)
 	if err != nil {
 		return fmt.Errorf("failed to get source variables: %w", err)
 	}
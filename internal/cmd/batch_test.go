@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
@@ -585,3 +588,48 @@ func pluralize(n int) string {
 	}
 	return "s"
 }
+
+// cancellingBackend cancels a context on its first read
+type cancellingBackend struct {
+	storage.Backend
+	cancel context.CancelFunc
+}
+
+func (c *cancellingBackend) Get(key string) (string, error) {
+	c.cancel()
+	return c.Backend.Get(key)
+}
+
+func TestBatchExportStopsWhenCancelled(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "batch_export_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := storage.NewMemoryBackend()
+	store.Set("API_KEY", "secret", false)
+	store.Set("DB_URL", "postgres://localhost", false)
+	storage.SetTestBackend(&cancellingBackend{Backend: store, cancel: cancel})
+	defer storage.ResetTestBackend()
+
+	cfg := config.DefaultConfig()
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.WithValue(ctx, configKey{}, cfg))
+
+	err = runBatchExport(cmd, tmpDir, "dotenv", false, nil, false, false, false)
+	if err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("runBatchExport() error = %v, want interrupted", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("runBatchExport() error = %v, want %v", err, context.Canceled)
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("interrupted export wrote %d files", len(entries))
+	}
+}
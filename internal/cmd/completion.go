@@ -82,6 +82,18 @@ func environmentCompletion(cmd *cobra.Command, args []string, toComplete string)
 	return matches, cobra.ShellCompDirectiveNoFileComp
 }
 
+// storageTypeCompletion provides shell completion for registered storage backends
+func storageTypeCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var matches []string
+	for _, t := range storage.Types() {
+		if strings.HasPrefix(t, toComplete) {
+			matches = append(matches, t)
+		}
+	}
+
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
 // variableNameCompletion provides shell completion for variable names
 func variableNameCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	// Common environment variable patterns
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"os"
 	"strings"
 	"testing"
 
@@ -215,6 +216,13 @@ func TestVariableNameCompletion(t *testing.T) {
 }
 
 func TestExistingVariableCompletion(t *testing.T) {
+	// Keep the vault the completion opens out of the source tree
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
 	// This function requires a storage backend, so we test error cases
 	cmd := &cobra.Command{}
 	cmd.Flags().String("env", "", "Environment")
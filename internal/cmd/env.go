@@ -1,17 +1,22 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/access"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
 func newEnvCommand() *cobra.Command {
@@ -131,26 +136,37 @@ func newEnvRenameCommand() *cobra.Command {
 }
 
 func newEnvDiffCommand() *cobra.Command {
-	var showValues bool
+	var (
+		showValues bool
+		output     string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "diff ENVIRONMENT1 ENVIRONMENT2",
 		Short: "Compare two environments",
-		Long:  `Compare variables between two environments and show differences.`,
+		Long: `Compare variables between two environments and show differences.
+
+Keys are reported as added (only in ENVIRONMENT2), removed (only in
+ENVIRONMENT1), changed or unchanged. The command exits with a non-zero
+status when the environments differ, so it can be used to gate deploys in CI.`,
 
 		Example: `  # Compare environments (values masked)
   vaultenv-cli env diff development production
   
   # Compare environments showing actual values
-  vaultenv-cli env diff development staging --show-values`,
+  vaultenv-cli env diff development staging --show-values
+
+  # Machine-readable output for CI
+  vaultenv-cli env diff staging production --output json`,
 
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runEnvDiff(args[0], args[1], showValues)
+			return runEnvDiff(cmd, args[0], args[1], showValues, output)
 		},
 	}
 
 	cmd.Flags().BoolVar(&showValues, "show-values", false, "show actual values instead of masking them")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "output format (text, json)")
 
 	return cmd
 }
@@ -318,7 +334,7 @@ func runEnvCreate(name, copyFrom, description string) error {
 			return fmt.Errorf("source environment '%s' does not exist", copyFrom)
 		}
 
-		count, err := copyEnvironmentVariables(cfg, copyFrom, name)
+		count, err := copyEnvironmentVariables(context.Background(), cfg, copyFrom, name)
 		if err != nil {
 			return fmt.Errorf("failed to copy variables: %w", err)
 		}
@@ -334,17 +350,15 @@ func runEnvCreate(name, copyFrom, description string) error {
 
 		// Check if encryption is enabled
 		if cfg.Vault.IsEncrypted() {
-			// Get keystore data directory
-			dataDir := filepath.Join(".vaultenv", "keys")
-			ks, err := keystore.NewKeystore(dataDir)
+			ks, err := openVaultKeystore(cfg)
 			if err != nil {
 				return fmt.Errorf("failed to initialize keystore: %w", err)
 			}
+			defer ks.Close()
 			pm := auth.NewPasswordManager(ks, cfg)
 
-			// Create a project-environment specific key
-			projectKey := fmt.Sprintf("%s-%s", cfg.Project.Name, name)
-			_, err = pm.GetOrCreateMasterKey(projectKey)
+			// Create the data key of the environment
+			_, err = pm.GetOrCreateDataKey(name)
 			if err != nil {
 				return fmt.Errorf("failed to initialize encryption: %w", err)
 			}
@@ -383,6 +397,10 @@ func runEnvDelete(name string, force bool) error {
 		}
 	}
 
+	if err := autoSnapshot(cfg, cfg.Vault.Type, "before env delete", []string{name}); err != nil {
+		return err
+	}
+
 	// Remove from configuration
 	delete(cfg.Environments, name)
 
@@ -535,48 +553,63 @@ func validateEnvironmentName(name string) error {
 	return nil
 }
 
-func copyEnvironmentVariables(cfg *config.Config, source, target string) (int, error) {
-	// For now, we'll implement a simplified version without encryption
-	// The full implementation would need to handle password prompts
-
+// copyEnvironmentVariables copies every variable of source into target in
+// one transaction. Values are decrypted with the key of the source and
+// encrypted again with the key of the target.
+func copyEnvironmentVariables(ctx context.Context, cfg *config.Config, source, target string) (int, error) {
 	ui.Info("Copying variables from '%s' to '%s'", source, target)
 
-	// Get storage path
-	storagePath := cfg.GetVaultPath()
-	if !filepath.IsAbs(storagePath) {
-		// Make relative to project root
-		storagePath = filepath.Join(".vaultenv", "data")
+	var pm *auth.PasswordManager
+	if !isTestEnvironment() && cfg.Vault.IsEncrypted() {
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to initialize keystore: %w", err)
+		}
+		defer ks.Close()
+		pm = auth.NewPasswordManager(ks, cfg)
 	}
 
-	// For file backend, we can directly copy the file
-	if cfg.Vault.Type == "file" {
-		sourceFile := filepath.Join(storagePath, fmt.Sprintf("%s.%s.json", cfg.Project.Name, source))
-		targetFile := filepath.Join(storagePath, fmt.Sprintf("%s.%s.json", cfg.Project.Name, target))
-
-		// Check if source file exists
-		if _, err := os.Stat(sourceFile); os.IsNotExist(err) {
-			ui.Info("No variables found in source environment")
-			return 0, nil
-		}
+	vars, err := readEnvironmentVariables(ctx, cfg, pm, source)
+	if err != nil {
+		return 0, err
+	}
+	if len(vars) == 0 {
+		ui.Info("No variables found in source environment")
+		return 0, nil
+	}
 
-		// Copy the file
-		data, err := os.ReadFile(sourceFile)
+	opts := vaultBackendOptions(cfg, target)
+	if pm != nil {
+		key, err := pm.GetOrCreateDataKey(target)
 		if err != nil {
-			return 0, fmt.Errorf("failed to read source file: %w", err)
+			return 0, fmt.Errorf("failed to get encryption key: %w", err)
 		}
+		opts.Password = string(key)
+	}
+
+	store, err := storage.GetBackendWithOptions(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get storage backend: %w", err)
+	}
+	defer store.Close()
 
-		if err := os.WriteFile(targetFile, data, 0644); err != nil {
-			return 0, fmt.Errorf("failed to write target file: %w", err)
+	tx, err := storage.BeginTx(store)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range vars {
+		if err := tx.Set(key, value, true); err != nil {
+			return 0, fmt.Errorf("failed to set variable %s: %w", key, err)
 		}
+	}
 
-		// Count variables (rough estimate)
-		count := strings.Count(string(data), `"key":`)
-		return count, nil
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to copy variables, no changes were made: %w", err)
 	}
 
-	// For other backends, we'd need full implementation
-	ui.Warning("Variable copying not yet implemented for %s backend", cfg.Vault.Type)
-	return 0, nil
+	return len(vars), nil
 }
 
 func deleteEnvironmentData(cfg *config.Config, environment string) error {
@@ -678,7 +711,11 @@ func runEnvRename(oldName, newName string, force bool) error {
 	return nil
 }
 
-func runEnvDiff(env1, env2 string, showValues bool) error {
+func runEnvDiff(cmd *cobra.Command, env1, env2 string, showValues bool, output string) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unsupported output format '%s'. Valid formats: text, json", output)
+	}
+
 	// Load configuration
 	cfg, err := loadConfig()
 	if err != nil {
@@ -693,22 +730,198 @@ func runEnvDiff(env1, env2 string, showValues bool) error {
 		return fmt.Errorf("environment '%s' does not exist", env2)
 	}
 
-	ui.Header(fmt.Sprintf("Comparing '%s' vs '%s'", env1, env2))
-	fmt.Println()
+	// Share one password manager so unlocked keys are cached across both reads
+	var pm *auth.PasswordManager
+	if !isTestEnvironment() && cfg.Vault.IsEncrypted() {
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize keystore: %w", err)
+		}
+		defer ks.Close()
+		pm = auth.NewPasswordManager(ks, cfg)
+	}
+
+	vars1, err := readEnvironmentVariables(commandContext(cmd), cfg, pm, env1)
+	if err != nil {
+		return fmt.Errorf("failed to read environment '%s': %w", env1, err)
+	}
+	vars2, err := readEnvironmentVariables(commandContext(cmd), cfg, pm, env2)
+	if err != nil {
+		return fmt.Errorf("failed to read environment '%s': %w", env2, err)
+	}
 
-	// For now, show placeholder message until storage integration is complete
-	ui.Info("Environment diff functionality is implemented but requires storage backend integration")
-	ui.Info("This feature will compare variables between the two environments")
+	diff := diffEnvironments(env1, env2, vars1, vars2)
+	if !showValues {
+		diff.maskValues()
+	}
 
-	if showValues {
-		ui.Info("Would show actual values (--show-values enabled)")
+	out := cmd.OutOrStdout()
+	if output == "json" {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal diff: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
 	} else {
-		ui.Info("Would mask values for security (use --show-values to show actual values)")
+		printEnvDiff(out, diff)
+	}
+
+	if diff.HasDifferences() {
+		return errEnvironmentsDiffer
 	}
 
 	return nil
 }
 
+// errEnvironmentsDiffer is returned by env diff so the process exits non-zero
+// without printing an error, like diff(1)
+var errEnvironmentsDiffer = ExitStatus(1)
+
+// envDiff is the result of comparing two environments
+type envDiff struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Added     []envDiffEntry `json:"added"`
+	Removed   []envDiffEntry `json:"removed"`
+	Changed   []envDiffEntry `json:"changed"`
+	Unchanged []envDiffEntry `json:"unchanged"`
+	Summary   envDiffSummary `json:"summary"`
+}
+
+// envDiffEntry describes a single key in an environment diff
+type envDiffEntry struct {
+	Key       string `json:"key"`
+	FromValue string `json:"from_value,omitempty"`
+	ToValue   string `json:"to_value,omitempty"`
+}
+
+// envDiffSummary holds the number of keys in each diff category
+type envDiffSummary struct {
+	Added     int  `json:"added"`
+	Removed   int  `json:"removed"`
+	Changed   int  `json:"changed"`
+	Unchanged int  `json:"unchanged"`
+	Identical bool `json:"identical"`
+}
+
+// diffEnvironments compares the variables of two environments. Keys only
+// present in the second environment are reported as added.
+func diffEnvironments(env1, env2 string, vars1, vars2 map[string]string) *envDiff {
+	diff := &envDiff{
+		From:      env1,
+		To:        env2,
+		Added:     []envDiffEntry{},
+		Removed:   []envDiffEntry{},
+		Changed:   []envDiffEntry{},
+		Unchanged: []envDiffEntry{},
+	}
+
+	for key, value1 := range vars1 {
+		value2, exists := vars2[key]
+		switch {
+		case !exists:
+			diff.Removed = append(diff.Removed, envDiffEntry{Key: key, FromValue: value1})
+		case value1 != value2:
+			diff.Changed = append(diff.Changed, envDiffEntry{Key: key, FromValue: value1, ToValue: value2})
+		default:
+			diff.Unchanged = append(diff.Unchanged, envDiffEntry{Key: key, FromValue: value1, ToValue: value2})
+		}
+	}
+
+	for key, value2 := range vars2 {
+		if _, exists := vars1[key]; !exists {
+			diff.Added = append(diff.Added, envDiffEntry{Key: key, ToValue: value2})
+		}
+	}
+
+	for _, entries := range [][]envDiffEntry{diff.Added, diff.Removed, diff.Changed, diff.Unchanged} {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	}
+
+	diff.Summary = envDiffSummary{
+		Added:     len(diff.Added),
+		Removed:   len(diff.Removed),
+		Changed:   len(diff.Changed),
+		Unchanged: len(diff.Unchanged),
+	}
+	diff.Summary.Identical = !diff.HasDifferences()
+
+	return diff
+}
+
+// HasDifferences reports whether any key was added, removed or changed
+func (d *envDiff) HasDifferences() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Changed) > 0
+}
+
+// maskValues replaces all values in the diff with masked versions
+func (d *envDiff) maskValues() {
+	for _, entries := range [][]envDiffEntry{d.Added, d.Removed, d.Changed, d.Unchanged} {
+		for i := range entries {
+			if entries[i].FromValue != "" {
+				entries[i].FromValue = maskValueForExport(entries[i].FromValue)
+			}
+			if entries[i].ToValue != "" {
+				entries[i].ToValue = maskValueForExport(entries[i].ToValue)
+			}
+		}
+	}
+}
+
+// printEnvDiff writes a human readable diff
+func printEnvDiff(out io.Writer, diff *envDiff) {
+	title := fmt.Sprintf("Comparing '%s' vs '%s'", diff.From, diff.To)
+	fmt.Fprintf(out, "\n%s\n%s\n\n", title, strings.Repeat("─", len(title)))
+
+	for _, entry := range diff.Added {
+		fmt.Fprintf(out, "  + %s = %s\n", entry.Key, entry.ToValue)
+	}
+	for _, entry := range diff.Removed {
+		fmt.Fprintf(out, "  - %s = %s\n", entry.Key, entry.FromValue)
+	}
+	for _, entry := range diff.Changed {
+		fmt.Fprintf(out, "  ~ %s: %s → %s\n", entry.Key, entry.FromValue, entry.ToValue)
+	}
+
+	if diff.HasDifferences() {
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintf(out, "%d added, %d removed, %d changed, %d unchanged\n",
+		diff.Summary.Added, diff.Summary.Removed, diff.Summary.Changed, diff.Summary.Unchanged)
+
+	if !diff.HasDifferences() {
+		fmt.Fprintf(out, "Environments '%s' and '%s' have identical variables\n", diff.From, diff.To)
+	}
+}
+
+// readEnvironmentVariables opens the storage backend for an environment,
+// unlocking it with that environment's key when pm is set, and returns all
+// of its variables. It never creates a key, so reading leaves the keystore
+// as it is.
+func readEnvironmentVariables(ctx context.Context, cfg *config.Config, pm *auth.PasswordManager, environment string) (map[string]string, error) {
+	opts := vaultBackendOptions(cfg, environment)
+
+	if pm != nil {
+		key, err := pm.DataKey(environment)
+		if errors.Is(err, auth.ErrNoDataKey) {
+			return nil, fmt.Errorf("environment has no encryption key yet; set a variable in it first")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get encryption key: %w", err)
+		}
+		opts.Password = string(key)
+	}
+
+	store, err := storage.GetBackendWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage backend: %w", err)
+	}
+	defer store.Close()
+
+	return getAllVariables(ctx, store)
+}
+
 // Helper functions for rename and diff
 
 func renameEnvironmentData(cfg *config.Config, oldName, newName string) error {
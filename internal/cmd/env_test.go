@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -471,3 +473,133 @@ func createEnvInfoCommand(cfg *config.Config) *cobra.Command {
 		},
 	}
 }
+
+func TestDiffEnvironments(t *testing.T) {
+	staging := map[string]string{
+		"API_KEY":      "staging-key",
+		"DATABASE_URL": "postgres://staging",
+		"LOG_LEVEL":    "debug",
+		"OLD_FLAG":     "true",
+	}
+	production := map[string]string{
+		"API_KEY":      "production-key",
+		"DATABASE_URL": "postgres://staging",
+		"LOG_LEVEL":    "debug",
+		"NEW_FLAG":     "on",
+	}
+
+	diff := diffEnvironments("staging", "production", staging, production)
+
+	if !diff.HasDifferences() {
+		t.Fatal("HasDifferences() = false, want true")
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Key != "NEW_FLAG" {
+		t.Errorf("Added = %v, want [NEW_FLAG]", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Key != "OLD_FLAG" {
+		t.Errorf("Removed = %v, want [OLD_FLAG]", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Key != "API_KEY" {
+		t.Errorf("Changed = %v, want [API_KEY]", diff.Changed)
+	}
+	if len(diff.Unchanged) != 2 || diff.Unchanged[0].Key != "DATABASE_URL" || diff.Unchanged[1].Key != "LOG_LEVEL" {
+		t.Errorf("Unchanged = %v, want [DATABASE_URL LOG_LEVEL]", diff.Unchanged)
+	}
+	if diff.Summary.Identical {
+		t.Error("Summary.Identical = true, want false")
+	}
+
+	diff.maskValues()
+	if diff.Changed[0].FromValue == "staging-key" || diff.Changed[0].ToValue == "production-key" {
+		t.Error("maskValues() left values in clear text")
+	}
+
+	same := diffEnvironments("a", "b", staging, staging)
+	if same.HasDifferences() {
+		t.Error("HasDifferences() = true for identical environments")
+	}
+	if !same.Summary.Identical {
+		t.Error("Summary.Identical = false for identical environments")
+	}
+}
+
+func TestRunEnvDiff(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	cfg := config.DefaultConfig()
+
+	development, err := storage.NewFileBackend(cfg.Vault.Path, "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+	development.Set("API_KEY", "secret", false)
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&buf)
+
+	// Differences are reported through the exit status only
+	err = runEnvDiff(cmd, "development", "staging", false, "text")
+	var status ExitStatus
+	if !errors.As(err, &status) || status != 1 {
+		t.Fatalf("runEnvDiff() error = %v, want ExitStatus(1)", err)
+	}
+	for _, want := range []string{"Comparing 'development' vs 'staging'", "- API_KEY", "0 added, 1 removed"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output %q does not contain %q", buf.String(), want)
+		}
+	}
+
+	buf.Reset()
+	if err := runEnvDiff(cmd, "staging", "production", false, "text"); err != nil {
+		t.Fatalf("runEnvDiff() of identical environments error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "have identical variables") {
+		t.Errorf("output %q does not report identical environments", buf.String())
+	}
+}
+
+func TestCopyEnvironmentVariables(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	cfg := config.DefaultConfig()
+
+	source, err := storage.NewFileBackend(cfg.Vault.Path, "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Set("API_KEY", "secret", false)
+	source.Set("DEBUG", "true", false)
+
+	count, err := copyEnvironmentVariables(context.Background(), cfg, "development", "staging")
+	if err != nil || count != 2 {
+		t.Fatalf("copyEnvironmentVariables() = %d, %v", count, err)
+	}
+
+	target, _ := storage.NewFileBackend(cfg.Vault.Path, "staging")
+	if value, err := target.Get("API_KEY"); err != nil || value != "secret" {
+		t.Errorf("Get(API_KEY) in the copy = %q, %v", value, err)
+	}
+
+	if count, err := copyEnvironmentVariables(context.Background(), cfg, "qa", "review"); err != nil || count != 0 {
+		t.Errorf("copyEnvironmentVariables() of an empty environment = %d, %v", count, err)
+	}
+}
@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -12,6 +16,7 @@ import (
 
 	"github.com/vaultenv/vaultenv-cli/internal/config"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
 // BuildInfo contains version information passed from main
@@ -74,9 +79,11 @@ Perfect for teams who are tired of:
 					os.Exit(1)
 				}
 				globalConfig = cfg
+				storage.SetDefaultLockTimeout(cfg.Vault.FileLockTimeout)
 
-				// Store config in command context
-				ctx := context.WithValue(cmd.Context(), configKey{}, cfg)
+				// Store config in the command context, which carries the
+				// cancellation of Execute down to the storage calls
+				ctx := context.WithValue(commandContext(cmd), configKey{}, cfg)
 				cmd.SetContext(ctx)
 
 				if verbose {
@@ -106,16 +113,38 @@ func Execute(info BuildInfo) error {
 	// Add all subcommands
 	addCommands()
 
+	// Ctrl-C cancels the command context, so long-running commands can
+	// stop cleanly. A second Ctrl-C falls back to the default behaviour.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// Execute the command tree
-	if err := rootCmd.Execute(); err != nil {
-		// Handle errors with helpful messages
-		handleError(err)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		// An exit status reports a result, not a failure
+		var status ExitStatus
+		if !errors.As(err, &status) {
+			// Handle errors with helpful messages
+			handleError(err)
+		}
 		return err
 	}
 
 	return nil
 }
 
+// ExitStatus is returned by commands that report their result through the
+// exit status of the process, like diff, rather than by failing. Nothing is
+// printed for it.
+type ExitStatus int
+
+func (s ExitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
 // NewRootCommand creates a new root command for testing
 func NewRootCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -141,9 +170,11 @@ func NewRootCommand() *cobra.Command {
 					os.Exit(1)
 				}
 				globalConfig = cfg
+				storage.SetDefaultLockTimeout(cfg.Vault.FileLockTimeout)
 
-				// Store config in command context
-				ctx := context.WithValue(cmd.Context(), configKey{}, cfg)
+				// Store config in the command context, which carries the
+				// cancellation of Execute down to the storage calls
+				ctx := context.WithValue(commandContext(cmd), configKey{}, cfg)
 				cmd.SetContext(ctx)
 
 				if verbose {
@@ -172,12 +203,19 @@ func NewRootCommand() *cobra.Command {
 	// Add all subcommands
 	cmd.AddCommand(newVersionCommand())
 	cmd.AddCommand(newSetCommand())
+	cmd.AddCommand(newSetFileCommand())
 	cmd.AddCommand(newGetCommand())
 	cmd.AddCommand(newListCommand())
 	cmd.AddCommand(newInitCommand())
 	cmd.AddCommand(newCompletionCommand())
 	cmd.AddCommand(newHistoryCommand())
 	cmd.AddCommand(newRestoreCommand())
+	cmd.AddCommand(newDeleteCommand())
+	cmd.AddCommand(newUndeleteCommand())
+	cmd.AddCommand(newTrashCommand())
+	cmd.AddCommand(newSnapshotCommand())
+	cmd.AddCommand(newVaultCommand())
+	cmd.AddCommand(newFsckCommand())
 	cmd.AddCommand(newAuditCommand())
 	cmd.AddCommand(newMigrateCommand())
 	cmd.AddCommand(newGitCommand())
@@ -187,8 +225,11 @@ func NewRootCommand() *cobra.Command {
 	cmd.AddCommand(newBatchCommand())
 	cmd.AddCommand(newConfigCommand())
 	cmd.AddCommand(newSecurityCommand())
+	cmd.AddCommand(newIdentityCommand())
+	cmd.AddCommand(newRecipientsCommand())
 	cmd.AddCommand(newShellCommand())
 	cmd.AddCommand(newRunCommand())
+	cmd.AddCommand(newServeCommand())
 
 	// Add command aliases for better UX
 	addAliases(cmd)
@@ -269,12 +310,19 @@ func addCommands() {
 	// Add all subcommands
 	rootCmd.AddCommand(newVersionCommand())
 	rootCmd.AddCommand(newSetCommand())
+	rootCmd.AddCommand(newSetFileCommand())
 	rootCmd.AddCommand(newGetCommand())
 	rootCmd.AddCommand(newListCommand())
 	rootCmd.AddCommand(newInitCommand())
 	rootCmd.AddCommand(newCompletionCommand())
 	rootCmd.AddCommand(newHistoryCommand())
 	rootCmd.AddCommand(newRestoreCommand())
+	rootCmd.AddCommand(newDeleteCommand())
+	rootCmd.AddCommand(newUndeleteCommand())
+	rootCmd.AddCommand(newTrashCommand())
+	rootCmd.AddCommand(newSnapshotCommand())
+	rootCmd.AddCommand(newVaultCommand())
+	rootCmd.AddCommand(newFsckCommand())
 	rootCmd.AddCommand(newAuditCommand())
 	rootCmd.AddCommand(newMigrateCommand())
 	rootCmd.AddCommand(newGitCommand())
@@ -284,8 +332,11 @@ func addCommands() {
 	rootCmd.AddCommand(newBatchCommand())
 	rootCmd.AddCommand(newConfigCommand())
 	rootCmd.AddCommand(newSecurityCommand())
+	rootCmd.AddCommand(newIdentityCommand())
+	rootCmd.AddCommand(newRecipientsCommand())
 	rootCmd.AddCommand(newShellCommand())
 	rootCmd.AddCommand(newRunCommand())
+	rootCmd.AddCommand(newServeCommand())
 
 	// Add command aliases for better UX
 	addAliases(rootCmd)
@@ -344,6 +395,16 @@ func GetConfig(cmd *cobra.Command) *config.Config {
 	return cfg
 }
 
+// commandContext returns the context of a command, or a background context
+// when the command was not started through Execute
+func commandContext(cmd *cobra.Command) context.Context {
+	if cmd == nil || cmd.Context() == nil {
+		return context.Background()
+	}
+
+	return cmd.Context()
+}
+
 // MustGetConfig retrieves the configuration or panics if not found
 func MustGetConfig(cmd *cobra.Command) *config.Config {
 	cfg := GetConfig(cmd)
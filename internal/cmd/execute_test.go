@@ -70,9 +70,9 @@ func TestNewRootCommand(t *testing.T) {
 
 	// Check that all subcommands are added
 	expectedCommands := []string{
-		"version", "set", "get", "list", "init", "completion",
-		"history", "restore", "audit", "migrate", "git", "env",
-		"load", "export", "batch", "config", "security", "shell", "run",
+		"version", "set", "set-file", "get", "list", "init", "completion",
+		"history", "restore", "delete", "undelete", "trash", "snapshot", "vault", "fsck", "audit", "migrate", "git", "env",
+		"load", "export", "batch", "config", "security", "identity", "recipients", "shell", "run",
 	}
 
 	for _, cmdName := range expectedCommands {
@@ -387,7 +387,7 @@ func TestAddCommands(t *testing.T) {
 		commandNames[cmd.Name()] = true
 	}
 
-	expectedCommands := []string{"version", "set", "get", "list", "init"}
+	expectedCommands := []string{"version", "set", "set-file", "get", "list", "init"}
 	for _, name := range expectedCommands {
 		assert.True(t, commandNames[name], "Expected command %s not found", name)
 	}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,6 +30,7 @@ func newExportCommand() *cobra.Command {
 		sortKeys     bool
 		includeEmpty bool
 		showComments bool
+		raw          bool
 	)
 
 	cmd := &cobra.Command{
@@ -39,7 +41,10 @@ Supports filtering, templating, and multiple output formats for different use ca
 
 The export command supports multiple output formats including .env, JSON, YAML,
 shell scripts, and Docker ENV instructions. Variables can be filtered, and
-output can be customized with various options.`,
+output can be customized with various options.
+
+References such as ${ref:DB_HOST} or ${ref:shared/DB_HOST} are resolved
+unless --raw is given.`,
 		Example: `  # Export to .env file
   vaultenv export --to .env.local
 
@@ -63,7 +68,7 @@ output can be customized with various options.`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runExport(cmd, fromEnv, toFile, format, filter, showValues, template,
-				overwrite, dryRun, sortKeys, includeEmpty, showComments)
+				overwrite, dryRun, sortKeys, includeEmpty, showComments, raw)
 		},
 	}
 
@@ -89,14 +94,16 @@ output can be customized with various options.`,
 	cmd.Flags().BoolVar(&includeEmpty, "include-empty", true,
 		"Include variables with empty values")
 	cmd.Flags().BoolVar(&showComments, "comments", false,
-		"Include comments in output (where supported)")
+		"Include comments and variable metadata in output (where supported)")
+	cmd.Flags().BoolVar(&raw, "raw", false,
+		"Export values without resolving ${ref:...} references")
 
 	return cmd
 }
 
 // runExport executes the export command
 func runExport(cmd *cobra.Command, fromEnv, toFile, format string, filter []string,
-	showValues bool, template string, overwrite, dryRun, sortKeys, includeEmpty, showComments bool) error {
+	showValues bool, template string, overwrite, dryRun, sortKeys, includeEmpty, showComments, raw bool) error {
 
 	// Get configuration
 	cfg := GetConfig(cmd)
@@ -131,11 +138,18 @@ func runExport(cmd *cobra.Command, fromEnv, toFile, format string, filter []stri
 	}
 
 	// Get all variables from storage
-	allVars, err := getAllVariables(store)
+	allVars, err := getAllVariables(commandContext(cmd), store)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve variables from %s: %w", fromEnv, err)
 	}
 
+	if !raw {
+		allVars, err = resolveReferences(commandContext(cmd), cfg, fromEnv, store, environmentStorage(cfg), allVars)
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(allVars) == 0 {
 		ui.Warning("No variables found in %s environment", fromEnv)
 		return nil
@@ -182,8 +196,14 @@ func runExport(cmd *cobra.Command, fromEnv, toFile, format string, filter []stri
 		}
 	}
 
+	// Collect metadata for exporters that can show it
+	var metadata map[string]export.VariableMetadata
+	if showComments || template != "" {
+		metadata = getExportMetadata(store, vars)
+	}
+
 	// Configure exporter options
-	configureExporter(exporter, sortKeys, includeEmpty, showComments)
+	configureExporter(exporter, sortKeys, includeEmpty, showComments, metadata)
 
 	// Determine output destination
 	var outputFile *os.File
@@ -255,22 +275,12 @@ func runExport(cmd *cobra.Command, fromEnv, toFile, format string, filter []stri
 	return nil
 }
 
-// getAllVariables retrieves all variables from storage
-func getAllVariables(store storage.Backend) (map[string]string, error) {
-	// Get list of all variables
-	keys, err := store.List()
+// getAllVariables retrieves all variables from storage, stopping when ctx
+// is cancelled
+func getAllVariables(ctx context.Context, store storage.Backend) (map[string]string, error) {
+	result, err := storage.GetAll(ctx, store)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list variables: %w", err)
-	}
-
-	// Retrieve all values
-	result := make(map[string]string)
-	for _, key := range keys {
-		value, err := store.Get(key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get variable %s: %w", key, err)
-		}
-		result[key] = value
+		return nil, fmt.Errorf("failed to read variables: %w", err)
 	}
 
 	return result, nil
@@ -355,13 +365,15 @@ func maskValueForExport(value string) string {
 }
 
 // configureExporter sets common options on an exporter
-func configureExporter(exporter export.Exporter, sortKeys, includeEmpty, showComments bool) {
+func configureExporter(exporter export.Exporter, sortKeys, includeEmpty, showComments bool,
+	metadata map[string]export.VariableMetadata) {
 	// Use type assertion to configure specific exporter types
 	switch e := exporter.(type) {
 	case *export.DotEnvExporter:
 		e.Options.SortKeys = sortKeys
 		e.Options.IncludeEmpty = includeEmpty
 		e.Options.ShowComments = showComments
+		e.Options.Metadata = metadata
 	case *export.JSONExporter:
 		e.Options.SortKeys = sortKeys
 		e.Options.IncludeEmpty = includeEmpty
@@ -369,20 +381,49 @@ func configureExporter(exporter export.Exporter, sortKeys, includeEmpty, showCom
 		e.Options.SortKeys = sortKeys
 		e.Options.IncludeEmpty = includeEmpty
 		e.Options.ShowComments = showComments
+		e.Options.Metadata = metadata
 	case *export.ShellExporter:
 		e.Options.SortKeys = sortKeys
 		e.Options.IncludeEmpty = includeEmpty
 		e.Options.ShowComments = showComments
+		e.Options.Metadata = metadata
 	case *export.DockerExporter:
 		e.Options.SortKeys = sortKeys
 		e.Options.IncludeEmpty = includeEmpty
 		e.Options.ShowComments = showComments
+		e.Options.Metadata = metadata
 	case *export.TemplateExporter:
 		e.Options.SortKeys = sortKeys
 		e.Options.IncludeEmpty = includeEmpty
+		e.Options.Metadata = metadata
 	}
 }
 
+// getExportMetadata collects the metadata of the exported variables.
+// Backends without metadata support yield no metadata.
+func getExportMetadata(store storage.Backend, vars map[string]string) map[string]export.VariableMetadata {
+	mb, ok := storage.AsMetadataBackend(store)
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string]export.VariableMetadata)
+	for key := range vars {
+		meta, err := mb.GetMetadata(key)
+		if err != nil {
+			ui.Debug("No metadata for %s: %v", key, err)
+			continue
+		}
+		result[key] = export.VariableMetadata{
+			Description: meta.Description,
+			Tags:        meta.Tags,
+			Owner:       meta.Owner,
+		}
+	}
+
+	return result
+}
+
 // displayExportPreview shows what will be exported
 func displayExportPreview(vars map[string]string, format string) {
 	ui.Info("Export preview (%s format):", format)
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/filesecret"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newSetFileCommand() *cobra.Command {
+	var (
+		environment string
+		force       bool
+		name        string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "set-file KEY PATH",
+		Short: "Store the contents of a file in a variable",
+		Long: `Store the contents of a file, such as a certificate or private key,
+in a variable. Any bytes can be stored, up to 1 MiB per file.
+
+The file is encrypted like every other value when the vault is
+encrypted; unencrypted vaults store it in plain text. Read it back with 'vaultenv get KEY --to-file
+PATH'; 'vaultenv run' writes it to a private temporary file and sets the
+variable to the path of that file.`,
+
+		Example: `  # Store a TLS certificate
+  vaultenv set-file TLS_CERT ./certs/server.crt
+
+  # Store a key for production under a different file name
+  vaultenv set-file SIGNING_KEY ./prod.pem --name signing.pem --env production
+
+  # Use it from a command
+  vaultenv run -- sh -c 'openssl x509 -in "$TLS_CERT" -noout -subject'`,
+
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSetFile(args[0], args[1], environment, name, force)
+		},
+	}
+
+	cmd.Flags().StringVarP(&environment, "env", "e", "development",
+		"environment to store the file in")
+	cmd.Flags().BoolVarP(&force, "force", "f", false,
+		"overwrite an existing variable without confirmation")
+	cmd.Flags().StringVar(&name, "name", "",
+		"file name used when the file is written out (default: the base name of PATH)")
+
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func runSetFile(key, path, environment, name string, force bool) error {
+	if !isValidVariableName(key) {
+		return fmt.Errorf("invalid variable name: %s", key)
+	}
+
+	file, err := filesecret.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if name != "" {
+		file.Name = name
+	}
+
+	value, err := filesecret.Encode(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode file: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	storageOpts, err := setStorageOptions(cfg, environment, true)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.GetBackendWithOptions(storageOpts)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	defer store.Close()
+
+	overwrite, err := confirmOverwrite(store, key, force)
+	if err != nil {
+		return err
+	}
+	if !overwrite {
+		ui.Info("Skipping %s", key)
+		return nil
+	}
+
+	err = ui.StartProgress(fmt.Sprintf("Setting %s", key), func() error {
+		return store.Set(key, value, true)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+
+	ui.Success("Stored %s (%d bytes) in %s as %s", file.Name, len(file.Data), environment, key)
+	return nil
+}
+
+// materializeFiles writes the files stored in vars to a private temporary
+// directory and replaces their values with the paths of the written
+// files. cleanup removes the directory; it is a no-op when vars holds no
+// files.
+func materializeFiles(vars map[string]string) (cleanup func(), err error) {
+	cleanup = func() {}
+
+	var dir string
+	for key, value := range vars {
+		if !filesecret.IsFile(value) {
+			continue
+		}
+
+		file, err := filesecret.Decode(value)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+
+		if dir == "" {
+			// MkdirTemp creates the directory readable by the owner only
+			dir, err = os.MkdirTemp("", "vaultenv-run-")
+			if err != nil {
+				return nil, err
+			}
+			cleanup = func() { os.RemoveAll(dir) }
+		}
+
+		// Each variable gets a directory so files keep their names
+		keyDir := filepath.Join(dir, key)
+		if err := os.Mkdir(keyDir, 0700); err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		path := filepath.Join(keyDir, file.FileName(key))
+		if err := file.WriteFile(path); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to write %s: %w", key, err)
+		}
+
+		vars[key] = path
+	}
+
+	return cleanup, nil
+}
+
+// forwardSignals keeps vaultenv running while a command runs, so
+// temporary files are still removed when the command exits. Ctrl-C already
+// reaches the command through the terminal and is ignored; termination
+// signals sent to vaultenv alone are passed on. The returned function
+// stops forwarding.
+func forwardSignals(process *os.Process) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig != os.Interrupt {
+					process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/filesecret"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func TestForwardSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent to a process on Windows")
+	}
+
+	child := exec.Command("sleep", "10")
+	if err := child.Start(); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- child.Wait() }()
+
+	stop := forwardSignals(child.Process)
+	defer stop()
+
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The terminal delivers Ctrl-C to the command itself, so passing it on
+	// would interrupt the command twice
+	self.Signal(os.Interrupt)
+	select {
+	case err := <-exited:
+		t.Fatalf("command exited after an interrupt of vaultenv: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	self.Signal(syscall.SIGTERM)
+	select {
+	case err := <-exited:
+		if err == nil {
+			t.Error("command exited cleanly, want terminated by SIGTERM")
+		}
+	case <-time.After(5 * time.Second):
+		child.Process.Kill()
+		t.Fatal("SIGTERM was not forwarded to the command")
+	}
+}
+
+func TestSetFileAndGetToFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	store := storage.NewMemoryBackend()
+	storage.SetTestBackend(store)
+	defer storage.ResetTestBackend()
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	cert := []byte("-----BEGIN CERTIFICATE-----\r\nMIIB\x00\xff\n\n")
+	certPath := filepath.Join(tmpDir, "server.crt")
+	os.WriteFile(certPath, cert, 0644)
+
+	if err := runSetFile("TLS_CERT", certPath, "test", "", true); err != nil {
+		t.Fatalf("runSetFile() error = %v", err)
+	}
+	if err := runSetFile("1BAD", certPath, "test", "", true); err == nil {
+		t.Error("runSetFile() accepted an invalid variable name")
+	}
+
+	big := filepath.Join(tmpDir, "big.bin")
+	os.WriteFile(big, make([]byte, filesecret.MaxSize+1), 0644)
+	if err := runSetFile("BIG", big, "test", "", true); err == nil {
+		t.Error("runSetFile() accepted a file over the size limit")
+	}
+
+	// Printing shows the file instead of its encoding
+	cmd := newGetCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"TLS_CERT", "--env", "test"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("get error = %v", err)
+	}
+	if !strings.Contains(out.String(), fmt.Sprintf("<file server.crt, %d bytes", len(cert))) {
+		t.Errorf("get output = %q", out.String())
+	}
+
+	outPath := filepath.Join(tmpDir, "out.crt")
+	cmd = newGetCommand()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"TLS_CERT", "--env", "test", "--to-file", outPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("get --to-file error = %v", err)
+	}
+	if data, _ := os.ReadFile(outPath); !bytes.Equal(data, cert) {
+		t.Errorf("get --to-file wrote %q, want %q", data, cert)
+	}
+
+	cmd = newGetCommand()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"TLS_CERT", "OTHER", "--to-file", outPath})
+	if err := cmd.Execute(); err == nil {
+		t.Error("get --to-file accepted two variables")
+	}
+}
+
+func TestMaterializeFiles(t *testing.T) {
+	key, _ := filesecret.Encode(filesecret.File{Name: "signing.pem", Data: []byte("private")})
+	unnamed, _ := filesecret.Encode(filesecret.File{Name: "../escape", Data: []byte{0x00}})
+
+	vars := map[string]string{
+		"DEBUG":       "true",
+		"SIGNING_KEY": key,
+		"UNNAMED":     unnamed,
+	}
+
+	cleanup, err := materializeFiles(vars)
+	if err != nil {
+		t.Fatalf("materializeFiles() error = %v", err)
+	}
+
+	if vars["DEBUG"] != "true" {
+		t.Errorf("DEBUG = %q, want it unchanged", vars["DEBUG"])
+	}
+	if filepath.Base(vars["SIGNING_KEY"]) != "signing.pem" || filepath.Base(vars["UNNAMED"]) != "UNNAMED" {
+		t.Errorf("file paths = %q, %q", vars["SIGNING_KEY"], vars["UNNAMED"])
+	}
+	if data, err := os.ReadFile(vars["SIGNING_KEY"]); err != nil || string(data) != "private" {
+		t.Errorf("SIGNING_KEY file = %q, %v", data, err)
+	}
+
+	dir := filepath.Dir(filepath.Dir(vars["SIGNING_KEY"]))
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(dir)
+		fileInfo, _ := os.Stat(vars["SIGNING_KEY"])
+		if info.Mode().Perm() != 0700 || fileInfo.Mode().Perm() != 0600 {
+			t.Errorf("modes = %v, %v, want 0700 and 0600", info.Mode().Perm(), fileInfo.Mode().Perm())
+		}
+	}
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("cleanup() kept the temporary directory")
+	}
+
+	// Nothing is written without files
+	cleanup, err = materializeFiles(map[string]string{"DEBUG": "true"})
+	if err != nil {
+		t.Fatalf("materializeFiles() error = %v", err)
+	}
+	cleanup()
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newFsckCommand() *cobra.Command {
+	var (
+		environment string
+		repair      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check the vault storage for inconsistencies",
+		Long: `Check the storage of every environment for inconsistencies left by
+crashes, interrupted writes or manual edits:
+
+  • data files that cannot be read and temporary files of interrupted writes
+  • metadata kept for variables that no longer exist
+  • SQLite history rows whose secret no longer exists
+  • files in a git vault that do not belong to any variable
+  • encrypted values that cannot be decrypted with the vault key
+
+With --repair the problems that can be repaired without losing data are
+repaired. The command exits with a non-zero status while problems remain,
+so it can be used in CI.`,
+
+		Example: `  # Check every environment
+  vaultenv fsck
+
+  # Check production only
+  vaultenv fsck --env production
+
+  # Repair what can be repaired safely
+  vaultenv fsck --repair`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFsck(environment, repair)
+		},
+	}
+
+	cmd.Flags().StringVarP(&environment, "env", "e", "", "check a single environment")
+	cmd.Flags().BoolVar(&repair, "repair", false, "repair the problems that can be repaired safely")
+
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func runFsck(environment string, repair bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	environments := cfg.GetEnvironmentNames()
+	if environment != "" {
+		environments = []string{environment}
+	}
+	sort.Strings(environments)
+
+	var pm *auth.PasswordManager
+	if !isTestEnvironment() && cfg.Vault.IsEncrypted() {
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize keystore: %w", err)
+		}
+		defer ks.Close()
+		pm = auth.NewPasswordManager(ks, cfg)
+	}
+
+	var problems []storage.Problem
+	for _, env := range environments {
+		var password string
+		if pm != nil {
+			key, err := pm.GetOrCreateDataKey(env)
+			if err != nil {
+				return fmt.Errorf("failed to get encryption key: %w", err)
+			}
+			password = string(key)
+		}
+
+		found, err := checkEnvironment(cfg, env, password, repair)
+		if errors.Is(err, storage.ErrCheckNotSupported) {
+			ui.Info("%s vaults cannot be checked", cfg.Vault.Type)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", env, err)
+		}
+		problems = append(problems, found...)
+	}
+	problems = dedupeProblems(problems)
+
+	if len(problems) == 0 {
+		ui.Success("No problems found in %d environment(s)", len(environments))
+		return nil
+	}
+
+	headers := []string{"Environment", "Kind", "Location", "Problem", "Repair"}
+	rows := make([][]string, 0, len(problems))
+	remaining := 0
+	for _, p := range problems {
+		action := p.Repair
+		switch {
+		case action == "":
+			action = "manual"
+		case p.Repaired:
+			action = "repaired: " + action
+		}
+		if !p.Repaired {
+			remaining++
+		}
+		rows = append(rows, []string{p.Environment, p.Kind, p.Path, p.Message, action})
+	}
+
+	ui.Header("Vault check")
+	ui.Table(headers, rows)
+
+	if remaining == 0 {
+		ui.Success("Repaired %d problem(s)", len(problems))
+		return nil
+	}
+
+	if repair {
+		return fmt.Errorf("%d problem(s) could not be repaired safely", remaining)
+	}
+
+	repairable := 0
+	for _, p := range problems {
+		if p.Repair != "" {
+			repairable++
+		}
+	}
+	if repairable > 0 {
+		ui.Info("Run 'vaultenv fsck --repair' to repair %d of them", repairable)
+	}
+
+	return fmt.Errorf("found %d problem(s)", remaining)
+}
+
+// checkEnvironment checks the storage of one environment
+func checkEnvironment(cfg *config.Config, env, password string, repair bool) ([]storage.Problem, error) {
+	opts := vaultBackendOptions(cfg, env)
+	opts.Password = password
+
+	store, err := storage.GetBackendWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage backend: %w", err)
+	}
+	defer store.Close()
+
+	cb, ok := storage.AsCheckBackend(store)
+	if !ok {
+		return nil, storage.ErrCheckNotSupported
+	}
+
+	problems, err := cb.Check(repair)
+	for i := range problems {
+		if problems[i].Environment == "" {
+			problems[i].Environment = env
+		}
+	}
+
+	return problems, err
+}
+
+// dedupeProblems keeps one report of damage to a file every environment
+// shares, such as the SQLite database
+func dedupeProblems(problems []storage.Problem) []storage.Problem {
+	seen := make(map[string]bool)
+
+	result := problems[:0]
+	for _, p := range problems {
+		if p.Kind == storage.ProblemCorruptData {
+			id := p.Path + "\x00" + p.Message
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		result = append(result, p)
+	}
+
+	return result
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFsck(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	if err := runFsck("", false); err != nil {
+		t.Fatalf("runFsck() on a new vault error = %v", err)
+	}
+
+	// An interrupted write of the development environment
+	dataFile := filepath.Join(".vaultenv", "data", "development.json")
+	os.WriteFile(dataFile, []byte(`{"API_KEY":"secret"}`), 0644)
+	os.WriteFile(dataFile+".tmp", []byte(`{"API_KEY":"sec`), 0644)
+
+	if err := runFsck("", false); err == nil {
+		t.Fatal("runFsck() succeeded with a leftover temporary file")
+	}
+	if err := runFsck("production", false); err != nil {
+		t.Errorf("runFsck(production) error = %v", err)
+	}
+
+	if err := runFsck("", true); err != nil {
+		t.Fatalf("runFsck(repair) error = %v", err)
+	}
+	if _, err := os.Stat(dataFile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("runFsck(repair) kept the temporary file")
+	}
+
+	// Damage without a complete write cannot be repaired
+	os.WriteFile(dataFile, []byte(`{"API_KEY":"sec`), 0644)
+	if err := runFsck("", true); err == nil {
+		t.Error("runFsck(repair) succeeded with a damaged data file")
+	}
+}
@@ -10,8 +10,8 @@ import (
 
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/filesecret"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
@@ -20,6 +20,8 @@ func newGetCommand() *cobra.Command {
 		environment string
 		export      bool
 		quiet       bool
+		raw         bool
+		toFile      string
 	)
 
 	cmd := &cobra.Command{
@@ -29,7 +31,14 @@ func newGetCommand() *cobra.Command {
 
 By default, prints the variable in KEY=VALUE format.
 Use --quiet to print only the value (useful for scripts).
-Use --export to print in shell export format.`,
+Use --export to print in shell export format.
+
+References to other variables such as ${ref:DB_HOST} or ${ref:shared/DB_HOST}
+are resolved. Use --raw to print the stored value instead.
+
+Variables holding files stored with 'vaultenv set-file' are shown by name
+and size. Use --to-file to write the contents of a single variable to a
+file readable only by you.`,
 
 		Example: `  # Get a single variable
   vaultenv-cli get DATABASE_URL
@@ -44,11 +53,20 @@ Use --export to print in shell export format.`,
   vaultenv-cli get API_KEY --quiet
 
   # Export format
-  vaultenv-cli get API_KEY --export`,
+  vaultenv-cli get API_KEY --export
+
+  # Show references without resolving them
+  vaultenv-cli get DATABASE_URL --raw
+
+  # Write a stored certificate to disk
+  vaultenv-cli get TLS_CERT --to-file ./server.crt`,
 
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runGet(cmd, args, environment, export, quiet)
+			if toFile != "" && len(args) != 1 {
+				return fmt.Errorf("--to-file takes a single variable")
+			}
+			return runGet(cmd, args, environment, export, quiet, raw, toFile)
 		},
 	}
 
@@ -59,6 +77,10 @@ Use --export to print in shell export format.`,
 		"output in shell export format")
 	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false,
 		"output only values (no keys)")
+	cmd.Flags().BoolVar(&raw, "raw", false,
+		"print values without resolving ${ref:...} references")
+	cmd.Flags().StringVar(&toFile, "to-file", "",
+		"write the value to a file instead of printing it")
 
 	// Register completion functions
 	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
@@ -69,23 +91,30 @@ Use --export to print in shell export format.`,
 	return cmd
 }
 
-func runGet(cmd *cobra.Command, keys []string, environment string, export, quiet bool) error {
+func runGet(cmd *cobra.Command, keys []string, environment string, export, quiet, raw bool, toFile string) error {
 	// Initialize storage options
 	storageOpts := storage.BackendOptions{
 		Environment: environment,
 	}
+	var cfg *config.Config
+	var pm *auth.PasswordManager
 
 	// Check if we're using a test backend (for unit tests)
 	if !isTestEnvironment() {
 		// Load configuration
-		cfg, err := config.Load()
+		var err error
+		cfg, err = config.Load()
 		if err != nil {
 			return fmt.Errorf("failed to load configuration: %w", err)
 		}
+		storageOpts = vaultBackendOptions(cfg, environment)
+
+		// Remote vaults can only be read with the key
+		needsKey := vaultRequiresPassword(cfg)
 
 		// Check if the vault exists and might be encrypted
 		vaultPath := filepath.Join(".vaultenv", environment+".env")
-		if _, err := os.Stat(vaultPath); err == nil {
+		if _, err := os.Stat(vaultPath); err == nil && !needsKey {
 			// Vault exists, check if it's encrypted by trying to read it
 			tempStore, err := storage.GetBackend(environment)
 			if err != nil {
@@ -97,37 +126,28 @@ func runGet(cmd *cobra.Command, keys []string, environment string, export, quiet
 			tempStore.Close()
 
 			// If we get an error that looks like encryption-related, set up authentication
-			if listErr != nil {
-				// Get project ID from config or use default
-				projectID := cfg.Project.ID
-				if projectID == "" {
-					projectID = cfg.Project.Name
-				}
-
-				// Initialize keystore
-				homeDir, err := os.UserHomeDir()
-				if err != nil {
-					return fmt.Errorf("failed to get home directory: %w", err)
-				}
-				dataDir := filepath.Join(homeDir, ".vaultenv", "data")
-
-				ks, err := keystore.NewKeystore(dataDir)
-				if err != nil {
-					return fmt.Errorf("failed to initialize keystore: %w", err)
-				}
+			needsKey = listErr != nil
+		}
 
-				// Create password manager
-				pm := auth.NewPasswordManager(ks, cfg)
+		if needsKey {
+			// Initialize keystore
+			ks, err := openVaultKeystore(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to initialize keystore: %w", err)
+			}
+			defer ks.Close()
 
-				// Get or create encryption key
-				key, err := pm.GetOrCreateMasterKey(projectID)
-				if err != nil {
-					return fmt.Errorf("failed to get encryption key: %w", err)
-				}
+			// Create password manager
+			pm = auth.NewPasswordManager(ks, cfg)
 
-				// Convert key to string for storage options
-				storageOpts.Password = string(key)
+			// Get or create the data key of the environment
+			key, err := pm.GetOrCreateDataKey(environment)
+			if err != nil {
+				return fmt.Errorf("failed to get encryption key: %w", err)
 			}
+
+			// Convert key to string for storage options
+			storageOpts.Password = string(key)
 		}
 	}
 
@@ -138,6 +158,22 @@ func runGet(cmd *cobra.Command, keys []string, environment string, export, quiet
 	}
 	defer store.Close()
 
+	// Referenced environments are opened like this one, with their own key
+	resolver, closeRefs := newReferenceResolver(commandContext(cmd), cfg, environment, store,
+		func(env string) (storage.Backend, error) {
+			opts := storageOpts
+			opts.Environment = env
+			if pm != nil {
+				key, err := pm.GetOrCreateDataKey(env)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get encryption key: %w", err)
+				}
+				opts.Password = string(key)
+			}
+			return storage.GetBackendWithOptions(opts)
+		})
+	defer closeRefs()
+
 	// Track if we found any variables
 	found := false
 
@@ -152,8 +188,31 @@ func runGet(cmd *cobra.Command, keys []string, environment string, export, quiet
 			return fmt.Errorf("failed to get %s: %w", key, err)
 		}
 
+		isFile := filesecret.IsFile(value)
+		if !raw && !isFile {
+			value, err = resolver.Resolve(key, value)
+			if err != nil {
+				return fmt.Errorf("failed to get %s: %w", key, err)
+			}
+		}
+
 		found = true
 
+		if toFile != "" {
+			if err := writeValueToFile(value, toFile); err != nil {
+				return fmt.Errorf("failed to write %s: %w", key, err)
+			}
+			ui.Success("Wrote %s to %s", key, toFile)
+			continue
+		}
+
+		if isFile && !raw {
+			value, err = describeFile(value)
+			if err != nil {
+				return fmt.Errorf("failed to get %s: %w", key, err)
+			}
+		}
+
 		// Format output based on flags
 		if quiet {
 			fmt.Fprintln(cmd.OutOrStdout(), value)
@@ -183,3 +242,26 @@ func escapeShellValue(value string) string {
 	value = strings.ReplaceAll(value, "`", "\\`")
 	return value
 }
+
+// writeValueToFile writes a value to path, decoding stored files
+func writeValueToFile(value, path string) error {
+	file := filesecret.File{Data: []byte(value)}
+	if filesecret.IsFile(value) {
+		var err error
+		if file, err = filesecret.Decode(value); err != nil {
+			return err
+		}
+	}
+
+	return file.WriteFile(path)
+}
+
+// describeFile returns what get prints for a stored file
+func describeFile(value string) (string, error) {
+	file, err := filesecret.Decode(value)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("<file %s, %d bytes; use --to-file to write it>", file.FileName("unnamed"), len(file.Data)), nil
+}
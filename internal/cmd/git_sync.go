@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"path/filepath"
@@ -46,7 +47,7 @@ encrypted before committing, ensuring secrets remain secure in version control.`
   # Force push (overwrites remote changes)
   vaultenv git push --force`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPush(message, force, environment, autoCommit)
+			return runPush(commandContext(cmd), message, force, environment, autoCommit)
 		},
 	}
 
@@ -86,7 +87,7 @@ handles decryption and merging of changes.`,
   # Pull specific environment
   vaultenv git pull --env production`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPull(autoMerge, strategy, environment)
+			return runPull(commandContext(cmd), autoMerge, strategy, environment)
 		},
 	}
 
@@ -100,7 +101,7 @@ handles decryption and merging of changes.`,
 	return cmd
 }
 
-func runPush(message string, force bool, environment string, autoCommit bool) error {
+func runPush(ctx context.Context, message string, force bool, environment string, autoCommit bool) error {
 	// Check if we're in a git repository
 	if err := checkGitRepo(); err != nil {
 		return fmt.Errorf("not in a git repository, run 'vaultenv git init' first")
@@ -159,7 +160,7 @@ func runPush(message string, force bool, environment string, autoCommit bool) er
 
 	// Push to remote
 	if err := ui.StartProgress("Pushing to remote", func() error {
-		return gitPush(force)
+		return gitPush(ctx, force)
 	}); err != nil {
 		return fmt.Errorf("failed to push: %w", err)
 	}
@@ -175,14 +176,16 @@ func runPush(message string, force bool, environment string, autoCommit bool) er
 	return nil
 }
 
-func runPull(autoMerge bool, strategy string, environment string) error {
+func runPull(ctx context.Context, autoMerge bool, strategy string, environment string) error {
 	// Check if we're in a git repository
 	if err := checkGitRepo(); err != nil {
 		return fmt.Errorf("not in a git repository")
 	}
 
 	// Fetch latest changes from remote
-	if err := ui.StartProgress("Fetching remote changes", gitFetch); err != nil {
+	if err := ui.StartProgress("Fetching remote changes", func() error {
+		return gitFetch(ctx)
+	}); err != nil {
 		return fmt.Errorf("failed to fetch: %w", err)
 	}
 
@@ -195,7 +198,9 @@ func runPull(autoMerge bool, strategy string, environment string) error {
 	}
 
 	// Pull changes
-	if err := ui.StartProgress("Pulling changes", gitPull); err != nil {
+	if err := ui.StartProgress("Pulling changes", func() error {
+		return gitPull(ctx)
+	}); err != nil {
 		// Check if it's a merge conflict
 		if strings.Contains(err.Error(), "conflict") {
 			return handleMergeConflicts(autoMerge, strategy, environment)
@@ -345,28 +350,28 @@ func generateCommitMessage(changes []VaultChange) string {
 		strings.Join(envList, ", "))
 }
 
-// Git operations
+// Git operations. The network operations are killed when ctx is cancelled.
 func gitCommit(message string) error {
 	cmd := exec.Command("git", "commit", "-m", message)
 	return cmd.Run()
 }
 
-func gitPush(force bool) error {
+func gitPush(ctx context.Context, force bool) error {
 	args := []string{"push"}
 	if force {
 		args = append(args, "--force")
 	}
-	cmd := exec.Command("git", args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
 	return cmd.Run()
 }
 
-func gitFetch() error {
-	cmd := exec.Command("git", "fetch")
+func gitFetch(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "git", "fetch")
 	return cmd.Run()
 }
 
-func gitPull() error {
-	cmd := exec.Command("git", "pull")
+func gitPull(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "git", "pull")
 	return cmd.Run()
 }
 
@@ -388,11 +393,7 @@ func handleMergeConflicts(autoMerge bool, strategy string, environment string) e
 	}
 
 	// Create storage backend
-	stor, err := storage.GetBackendWithOptions(storage.BackendOptions{
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-		Environment: environment,
-	})
+	stor, err := storage.GetBackendWithOptions(vaultBackendOptions(cfg, environment))
 	if err != nil {
 		return fmt.Errorf("failed to create storage: %w", err)
 	}
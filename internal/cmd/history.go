@@ -9,7 +9,6 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
@@ -96,15 +95,11 @@ func runHistory(key, environment string, limit int) error {
 	isTest := isTestEnvironment()
 
 	// Create backend options
-	opts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-	}
+	opts := vaultBackendOptions(cfg, environment)
 
 	// Handle authentication if not in test mode
 	if !isTest && cfg.Vault.IsEncrypted() {
-		ks, err := keystore.NewKeystore(cfg.Vault.Path)
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to initialize keystore: %w", err)
 		}
@@ -112,7 +107,7 @@ func runHistory(key, environment string, limit int) error {
 		pm := auth.NewPasswordManager(ks, cfg)
 
 		// Get or create encryption key
-		key, err := pm.GetOrCreateMasterKey(cfg.Project.ID)
+		key, err := pm.GetOrCreateDataKey(environment)
 		if err != nil {
 			return fmt.Errorf("failed to get encryption key: %w", err)
 		}
@@ -129,7 +124,7 @@ func runHistory(key, environment string, limit int) error {
 	defer store.Close()
 
 	// Check if backend supports history
-	historyBackend, ok := store.(storage.HistoryBackend)
+	historyBackend, ok := storage.AsHistoryBackend(store)
 	if !ok {
 		return fmt.Errorf("current storage backend (%s) does not support history", cfg.Vault.Type)
 	}
@@ -219,15 +214,11 @@ func runAudit(environment string, limit int, filterUser, filterAction string) er
 	isTest := isTestEnvironment()
 
 	// Create backend options
-	opts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-	}
+	opts := vaultBackendOptions(cfg, environment)
 
 	// Handle authentication if not in test mode
 	if !isTest && cfg.Vault.IsEncrypted() {
-		ks, err := keystore.NewKeystore(cfg.Vault.Path)
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to initialize keystore: %w", err)
 		}
@@ -235,7 +226,7 @@ func runAudit(environment string, limit int, filterUser, filterAction string) er
 		pm := auth.NewPasswordManager(ks, cfg)
 
 		// Get or create encryption key
-		key, err := pm.GetOrCreateMasterKey(cfg.Project.ID)
+		key, err := pm.GetOrCreateDataKey(environment)
 		if err != nil {
 			return fmt.Errorf("failed to get encryption key: %w", err)
 		}
@@ -252,7 +243,7 @@ func runAudit(environment string, limit int, filterUser, filterAction string) er
 	defer store.Close()
 
 	// Check if backend supports audit
-	historyBackend, ok := store.(storage.HistoryBackend)
+	historyBackend, ok := storage.AsHistoryBackend(store)
 	if !ok {
 		return fmt.Errorf("current storage backend (%s) does not support audit logging", cfg.Vault.Type)
 	}
@@ -322,15 +313,11 @@ func runRestore(key, environment string, version int, timestamp string, force bo
 	isTest := isTestEnvironment()
 
 	// Create backend options
-	opts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-	}
+	opts := vaultBackendOptions(cfg, environment)
 
 	// Handle authentication if not in test mode
 	if !isTest && cfg.Vault.IsEncrypted() {
-		ks, err := keystore.NewKeystore(cfg.Vault.Path)
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to initialize keystore: %w", err)
 		}
@@ -338,7 +325,7 @@ func runRestore(key, environment string, version int, timestamp string, force bo
 		pm := auth.NewPasswordManager(ks, cfg)
 
 		// Get or create encryption key
-		encKey, err := pm.GetOrCreateMasterKey(cfg.Project.ID)
+		encKey, err := pm.GetOrCreateDataKey(environment)
 		if err != nil {
 			return fmt.Errorf("failed to get encryption key: %w", err)
 		}
@@ -355,7 +342,7 @@ func runRestore(key, environment string, version int, timestamp string, force bo
 	defer store.Close()
 
 	// Check if backend supports history
-	historyBackend, ok := store.(storage.HistoryBackend)
+	historyBackend, ok := storage.AsHistoryBackend(store)
 	if !ok {
 		return fmt.Errorf("current storage backend (%s) does not support history", cfg.Vault.Type)
 	}
@@ -404,7 +391,7 @@ func runRestore(key, environment string, version int, timestamp string, force bo
 
 	// Check if the target entry is a DELETE operation
 	if targetEntry.ChangeType == "DELETE" {
-		return fmt.Errorf("cannot restore to a DELETE operation (version %d)", targetEntry.Version)
+		return fmt.Errorf("version %d deleted '%s'; use 'vaultenv undelete %s' to bring back the deleted value", targetEntry.Version, key, key)
 	}
 
 	// Get current value for comparison
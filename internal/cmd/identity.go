@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/identity"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+)
+
+func newIdentityCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "identity",
+		Short: "Manage the identity of this machine",
+		Long: `Manage the X25519 identity that unlocks vaults with recipients.
+
+The identity is kept in identity.txt in your configuration directory
+(VAULTENV_IDENTITY_FILE overrides the path) and never leaves this machine.
+Share its recipient, shown by 'identity show', with a teammate who can add
+it with 'vaultenv recipients add'. On machines without an identity file,
+such as CI runners, VAULTENV_IDENTITY holds the identity itself.`,
+	}
+
+	cmd.AddCommand(
+		newIdentityNewCommand(),
+		newIdentityShowCommand(),
+	)
+
+	return cmd
+}
+
+func newIdentityNewCommand() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "new",
+		Short: "Generate a new identity",
+		Long: `Generate a new X25519 identity for this machine and print its recipient.
+
+An existing identity is only replaced with --force: data keys wrapped for
+it cannot be unlocked by the new one.`,
+
+		Example: `  # Generate an identity and share the printed recipient
+  vaultenv identity new`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentityNew(force)
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "replace an existing identity")
+
+	return cmd
+}
+
+func newIdentityShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Print the recipient of this machine's identity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentityShow()
+		},
+	}
+}
+
+func newRecipientsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "Manage who can unlock the vault",
+		Long: `Manage the recipients the data keys of the vault are wrapped for.
+
+The data key of each environment is wrapped once for every recipient
+listed in .vaultenv/recipients.txt and stored in .vaultenv/recipient-keys/;
+commit both. Recipients unlock the vault with their own identity, so no
+shared password is needed. Adding or removing a recipient only rewraps the
+data keys; the values are not touched.
+
+The first recipient added switches a vault from passwords to recipients
+and must be your own, as shown by 'vaultenv identity show'.`,
+	}
+
+	cmd.AddCommand(
+		newRecipientsAddCommand(),
+		newRecipientsRemoveCommand(),
+		newRecipientsListCommand(),
+	)
+
+	return cmd
+}
+
+func newRecipientsAddCommand() *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:   "add RECIPIENT",
+		Short: "Wrap the data keys for another recipient",
+		Example: `  # Switch the vault to recipients, starting with yourself
+  vaultenv recipients add "$(vaultenv identity show)" --name alice
+
+  # Give a teammate access
+  vaultenv recipients add vaultenv1... --name bob`,
+
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRecipientsAdd(args[0], name)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "who the recipient belongs to")
+
+	return cmd
+}
+
+func newRecipientsRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove RECIPIENT|NAME",
+		Short: "Rewrap the data keys without a recipient",
+		Long: `Rewrap the data keys of the vault for every recipient but the given one.
+
+The removed recipient may have kept the data keys it could unlock. Run
+'vaultenv security rotate-keys' for every environment to re-encrypt the
+values with new data keys.`,
+		Aliases: []string{"rm"},
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRecipientsRemove(args[0])
+		},
+	}
+}
+
+func newRecipientsListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the recipients of the vault",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRecipientsList()
+		},
+	}
+}
+
+func runIdentityNew(force bool) error {
+	path, err := identity.DefaultPath()
+	if err != nil {
+		return err
+	}
+
+	id, err := identity.Generate()
+	if err != nil {
+		return err
+	}
+
+	if err := identity.Save(path, id, force); err != nil {
+		if errors.Is(err, identity.ErrIdentityExists) {
+			return fmt.Errorf("%w, use --force to replace it", err)
+		}
+		return err
+	}
+
+	ui.Success("Created identity %s", path)
+	ui.Info("Your recipient: %s", id.Recipient())
+	ui.Info("Keep the identity file private; share the recipient to be added with 'vaultenv recipients add'")
+	return nil
+}
+
+func runIdentityShow() error {
+	id, err := identity.Load()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(id.Recipient())
+	return nil
+}
+
+func runRecipientsAdd(recipient, name string) error {
+	r, err := identity.ParseRecipient(recipient)
+	if err != nil {
+		return err
+	}
+
+	return withRecipientsManager(func(cfg *config.Config, pm *auth.PasswordManager) error {
+		entries, err := pm.Recipients()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.AddRecipient(identity.Entry{Recipient: r, Name: name}); err != nil {
+			return fmt.Errorf("failed to add recipient: %w", err)
+		}
+
+		ui.Success("Added recipient %s", r)
+		if len(entries) == 0 {
+			ui.Info("The vault is now unlocked with identities instead of passwords")
+		}
+		ui.Info("Commit %s and %s", filepath.Join(cfg.Vault.Path, identity.RecipientsFile), filepath.Join(cfg.Vault.Path, identity.KeysDir))
+		return nil
+	})
+}
+
+func runRecipientsRemove(recipient string) error {
+	return withRecipientsManager(func(cfg *config.Config, pm *auth.PasswordManager) error {
+		entries, err := pm.Recipients()
+		if err != nil {
+			return err
+		}
+
+		r, err := findRecipient(entries, recipient)
+		if err != nil {
+			return err
+		}
+
+		if err := pm.RemoveRecipient(r); err != nil {
+			return fmt.Errorf("failed to remove recipient: %w", err)
+		}
+
+		ui.Success("Removed recipient %s", r)
+		ui.Warning("The removed recipient may have kept the data keys; run 'vaultenv security rotate-keys' for every environment to lock it out")
+		return nil
+	})
+}
+
+func runRecipientsList() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	entries, err := identity.ReadRecipients(cfg.Vault.Path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		ui.Info("The vault has no recipients, it is unlocked with passwords")
+		return nil
+	}
+
+	var own identity.Recipient
+	if id, err := identity.Load(); err == nil {
+		own = id.Recipient()
+	}
+
+	ui.Header("Recipients")
+	for _, e := range entries {
+		line := e.Recipient.String()
+		if e.Name != "" {
+			line += "  " + e.Name
+		}
+		if e.Recipient == own {
+			line += "  (you)"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// withRecipientsManager runs fn with the password manager of the vault
+func withRecipientsManager(fn func(*config.Config, *auth.PasswordManager) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ks, err := openVaultKeystore(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize keystore: %w", err)
+	}
+	defer ks.Close()
+
+	return fn(cfg, auth.NewPasswordManager(ks, cfg))
+}
+
+// findRecipient returns the recipient given as text or by name
+func findRecipient(entries []identity.Entry, s string) (identity.Recipient, error) {
+	if r, err := identity.ParseRecipient(s); err == nil {
+		return r, nil
+	}
+
+	var found []identity.Entry
+	for _, e := range entries {
+		if e.Name == s {
+			found = append(found, e)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return identity.Recipient{}, fmt.Errorf("%w: %s", auth.ErrRecipientNotFound, s)
+	case 1:
+		return found[0].Recipient, nil
+	default:
+		return identity.Recipient{}, fmt.Errorf("several recipients are named %s, remove one by its recipient", s)
+	}
+}
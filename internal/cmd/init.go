@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
 func newInitCommand() *cobra.Command {
@@ -142,7 +143,7 @@ security:
 
 # Storage settings
 storage:
-  # Backend type (file, git, or cloud)
+  # Backend type (file, sqlite, or git)
   type: file
   
   # File storage settings
@@ -165,13 +166,28 @@ sync:
 		return err
 	}
 
+	// Create the vault header with the random salt keys are derived with;
+	// an existing one is kept, as the vault can only be read with its salt
+	err = ui.StartProgress("Creating vault header", func() error {
+		_, err := storage.InitVaultHeader(configDir)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create vault header: %w", err)
+	}
+
 	// Create .gitignore
 	gitignoreContent := `# vaultenv files
 *.enc
 *.key
+*.lock
 .vaultenv/data/
 .vaultenv/keys/
 .vaultenv/tmp/
+.vaultenv/serve/
+.vaultenv/trash/
+.vaultenv/backups/
+*.sock
 
 # Local environment files
 .env
@@ -226,7 +242,7 @@ SMTP_PORT=587
 	fmt.Println("  1. Review .vaultenv/config.yaml")
 	fmt.Println("  2. Copy .env.example to .env and add your variables")
 	fmt.Println("  3. Run 'vaultenv-cli set KEY=VALUE' to store variables")
-	fmt.Println("  4. Commit .vaultenv/config.yaml and .env.example to git")
+	fmt.Println("  4. Commit .vaultenv/config.yaml, .vaultenv/vault.json and .env.example to git")
 
 	return nil
 }
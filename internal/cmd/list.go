@@ -1,17 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
@@ -21,6 +24,7 @@ func newListCommand() *cobra.Command {
 		environment string
 		showValues  bool
 		pattern     string
+		long        bool
 	)
 
 	cmd := &cobra.Command{
@@ -41,10 +45,13 @@ Use --values to also display the values.`,
   vaultenv-cli list --env production
 
   # Filter by pattern
-  vaultenv-cli list --pattern "API_*"`,
+  vaultenv-cli list --pattern "API_*"
+
+  # Show descriptions, tags and owners
+  vaultenv-cli list --long`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runList(cmd, environment, showValues, pattern)
+			return runList(cmd, environment, showValues, pattern, long)
 		},
 	}
 
@@ -55,6 +62,8 @@ Use --values to also display the values.`,
 		"show variable values (use with caution)")
 	cmd.Flags().StringVarP(&pattern, "pattern", "p", "",
 		"filter variables by pattern (supports wildcards)")
+	cmd.Flags().BoolVarP(&long, "long", "l", false,
+		"show description, tags, owner and last update of each variable")
 
 	// Register completion functions
 	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
@@ -63,7 +72,7 @@ Use --values to also display the values.`,
 	return cmd
 }
 
-func runList(cmd *cobra.Command, environment string, showValues bool, pattern string) error {
+func runList(cmd *cobra.Command, environment string, showValues bool, pattern string, long bool) error {
 	// Initialize storage options
 	storageOpts := storage.BackendOptions{
 		Environment: environment,
@@ -76,10 +85,14 @@ func runList(cmd *cobra.Command, environment string, showValues bool, pattern st
 		if err != nil {
 			return fmt.Errorf("failed to load configuration: %w", err)
 		}
+		storageOpts = vaultBackendOptions(cfg, environment)
+
+		// Remote vaults can only be read with the key
+		needsKey := vaultRequiresPassword(cfg)
 
 		// Check if the vault exists and might be encrypted
 		vaultPath := filepath.Join(".vaultenv", environment+".env")
-		if _, err := os.Stat(vaultPath); err == nil {
+		if _, err := os.Stat(vaultPath); err == nil && !needsKey {
 			// Vault exists, check if it's encrypted by trying to read it
 			tempStore, err := storage.GetBackend(environment)
 			if err != nil {
@@ -91,37 +104,28 @@ func runList(cmd *cobra.Command, environment string, showValues bool, pattern st
 			tempStore.Close()
 
 			// If we get an error that looks like encryption-related, set up authentication
-			if listErr != nil {
-				// Get project ID from config or use default
-				projectID := cfg.Project.ID
-				if projectID == "" {
-					projectID = cfg.Project.Name
-				}
-
-				// Initialize keystore
-				homeDir, err := os.UserHomeDir()
-				if err != nil {
-					return fmt.Errorf("failed to get home directory: %w", err)
-				}
-				dataDir := filepath.Join(homeDir, ".vaultenv", "data")
-
-				ks, err := keystore.NewKeystore(dataDir)
-				if err != nil {
-					return fmt.Errorf("failed to initialize keystore: %w", err)
-				}
-
-				// Create password manager
-				pm := auth.NewPasswordManager(ks, cfg)
-
-				// Get or create encryption key
-				key, err := pm.GetOrCreateMasterKey(projectID)
-				if err != nil {
-					return fmt.Errorf("failed to get encryption key: %w", err)
-				}
-
-				// Convert key to string for storage options
-				storageOpts.Password = string(key)
+			needsKey = listErr != nil
+		}
+
+		if needsKey {
+			// Initialize keystore
+			ks, err := openVaultKeystore(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to initialize keystore: %w", err)
+			}
+			defer ks.Close()
+
+			// Create password manager
+			pm := auth.NewPasswordManager(ks, cfg)
+
+			// Get or create the data key of the environment
+			key, err := pm.GetOrCreateDataKey(environment)
+			if err != nil {
+				return fmt.Errorf("failed to get encryption key: %w", err)
 			}
+
+			// Convert key to string for storage options
+			storageOpts.Password = string(key)
 		}
 	}
 
@@ -160,7 +164,16 @@ func runList(cmd *cobra.Command, environment string, showValues bool, pattern st
 	fmt.Fprintln(cmd.OutOrStdout())
 
 	// Display variables
-	if showValues {
+	if long {
+		if err := printLongList(cmd.OutOrStdout(), store, keys, showValues); err != nil {
+			return err
+		}
+	} else if showValues {
+		values, err := getListedValues(commandContext(cmd), store, keys)
+		if err != nil {
+			return err
+		}
+
 		// Show as table with values
 		maxKeyLen := 0
 		for _, key := range keys {
@@ -170,9 +183,8 @@ func runList(cmd *cobra.Command, environment string, showValues bool, pattern st
 		}
 
 		for _, key := range keys {
-			value, err := store.Get(key)
-			if err != nil {
-				ui.Warning("Failed to get %s: %v", key, err)
+			value, ok := values[key]
+			if !ok {
 				continue
 			}
 
@@ -197,6 +209,88 @@ func runList(cmd *cobra.Command, environment string, showValues bool, pattern st
 	return nil
 }
 
+// getListedValues reads the values of the listed variables in one go.
+// Variables that cannot be read are reported and left out.
+func getListedValues(ctx context.Context, store storage.Backend, keys []string) (map[string]string, error) {
+	values, err := storage.GetMany(ctx, store, keys)
+
+	var readErrs storage.ReadErrors
+	if errors.As(err, &readErrs) {
+		for _, key := range keys {
+			if err, failed := readErrs[key]; failed {
+				ui.Warning("Failed to get %s: %v", key, err)
+			}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read variables: %w", err)
+	}
+
+	return values, nil
+}
+
+// printLongList prints one row per variable with its metadata
+func printLongList(out io.Writer, store storage.Backend, keys []string, showValues bool) error {
+	mb, ok := storage.AsMetadataBackend(store)
+	if !ok {
+		return fmt.Errorf("storage backend does not support metadata, use list without --long")
+	}
+
+	var values map[string]string
+	if showValues {
+		var err error
+		if values, err = getListedValues(context.Background(), store, keys); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	header := "KEY\tDESCRIPTION\tTAGS\tOWNER\tUPDATED"
+	if showValues {
+		header += "\tVALUE"
+	}
+	fmt.Fprintln(w, header)
+
+	for _, key := range keys {
+		meta, err := mb.GetMetadata(key)
+		if err != nil {
+			ui.Warning("Failed to get metadata for %s: %v", key, err)
+			continue
+		}
+
+		updated := "-"
+		if !meta.UpdatedAt.IsZero() {
+			updated = meta.UpdatedAt.Local().Format("2006-01-02 15:04")
+		}
+
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", key,
+			orDash(meta.Description), orDash(strings.Join(meta.Tags, ",")), orDash(meta.Owner), updated)
+
+		if showValues {
+			value, ok := values[key]
+			if !ok {
+				continue
+			}
+			if len(value) > 50 {
+				value = value[:47] + "..."
+			}
+			row += "\t" + value
+		}
+
+		fmt.Fprintln(w, row)
+	}
+
+	return w.Flush()
+}
+
+// orDash returns a placeholder for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 // filterKeys filters keys by pattern (supports * wildcard)
 func filterKeys(keys []string, pattern string) []string {
 	filtered := []string{} // Initialize as empty slice, not nil
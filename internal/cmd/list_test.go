@@ -452,3 +452,29 @@ func isSecret(key string) bool {
 	}
 	return false
 }
+
+func TestPrintLongList(t *testing.T) {
+	store := storage.NewMemoryBackend()
+	store.Set("API_KEY", "secret123", false)
+	store.Set("LOG_LEVEL", "info", false)
+	store.SetMetadata("API_KEY", &storage.SecretMetadata{
+		Description: "Payments API key",
+		Tags:        []string{"payments", "external"},
+		Owner:       "billing-team",
+	})
+
+	var buf bytes.Buffer
+	if err := printLongList(&buf, store, []string{"API_KEY", "LOG_LEVEL"}, false); err != nil {
+		t.Fatalf("printLongList() error = %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"DESCRIPTION", "Payments API key", "payments,external", "billing-team", "LOG_LEVEL"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "secret123") {
+		t.Error("Values should only be shown with --values")
+	}
+}
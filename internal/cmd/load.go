@@ -3,12 +3,14 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/spf13/cobra"
 
 	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/dotenv"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
@@ -386,16 +388,25 @@ func importVariables(store storage.Backend, vars map[string]string, environment
 
 	ui.Info("Importing %d variables...", len(vars))
 
-	// Import each variable
-	imported := 0
+	// Import all variables in one transaction so a failure leaves the
+	// environment unchanged
+	tx, err := storage.BeginTx(store)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	for key, value := range vars {
-		if err := store.Set(key, value, true); err != nil { // true for encryption
+		if err := tx.Set(key, value, true); err != nil { // true for encryption
 			return fmt.Errorf("failed to set variable %s: %w", key, err)
 		}
-		imported++
 	}
 
-	ui.Success("Successfully imported %d variables to %s environment", imported, environment)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to import variables, no changes were made: %w", err)
+	}
+
+	ui.Success("Successfully imported %d variables to %s environment", len(vars), environment)
 	return nil
 }
 
@@ -424,6 +435,74 @@ func getStorageForEnvironment(cfg *config.Config, environment string) (storage.B
 	return storage.GetBackend(environment)
 }
 
+// remoteTokenEnv names the environment variable holding the bearer token
+// of cloud vaults, which is kept out of the committed configuration
+const remoteTokenEnv = "VAULTENV_REMOTE_TOKEN"
+
+// vaultBackendOptions returns the options for opening an environment of the
+// configured vault. Git vaults encrypt deterministically when
+// git.encryption_mode asks for it, so unchanged values keep their ciphertext.
+func vaultBackendOptions(cfg *config.Config, environment string) storage.BackendOptions {
+	return backendOptionsForType(cfg, cfg.Vault.Type, environment)
+}
+
+// backendOptionsForType returns the options for opening an environment with
+// another backend type than the configured one, as migrate does
+func backendOptionsForType(cfg *config.Config, vaultType, environment string) storage.BackendOptions {
+	var algorithm string
+	if cfg.Vault.IsEncrypted() {
+		algorithm = cfg.Vault.EncryptionAlgo
+	}
+
+	return storage.BackendOptions{
+		Environment:   environment,
+		Type:          vaultType,
+		BasePath:      cfg.Vault.Path,
+		Deterministic: vaultType == "git" && cfg.Git.UseDeterministicEncryption(),
+		Algorithm:     algorithm,
+		Remote: storage.RemoteOptions{
+			URL:           cfg.Sync.URL,
+			Token:         os.Getenv(remoteTokenEnv),
+			RetryAttempts: cfg.Sync.RetryAttempts,
+			RetryDelay:    cfg.Sync.RetryDelay,
+		},
+	}
+}
+
+// openVaultKeystore opens the keystore of the vault. set, get and list used
+// to keep the project key in ~/.vaultenv/data under the project ID or name;
+// a vault keystore without a project key takes that key over, so values
+// they encrypted still decrypt with the same password. Every command opens
+// the keystore through it, whichever runs first.
+func openVaultKeystore(cfg *config.Config) (*keystore.Keystore, error) {
+	ks, err := keystore.NewKeystore(cfg.Vault.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.IsPerEnvironmentPasswordsEnabled() {
+		if home, err := os.UserHomeDir(); err == nil {
+			legacyID := cfg.Project.ID
+			if legacyID == "" {
+				legacyID = cfg.Project.Name
+			}
+			if _, err := ks.ImportKey(filepath.Join(home, ".vaultenv", "data"), legacyID, cfg.Project.ID); err != nil {
+				ks.Close()
+				return nil, fmt.Errorf("failed to import key from ~/.vaultenv/data: %w", err)
+			}
+		}
+	}
+
+	return ks, nil
+}
+
+// vaultRequiresPassword reports whether the configured vault can only be
+// opened with the encryption key, as is the case for remote vaults
+func vaultRequiresPassword(cfg *config.Config) bool {
+	caps, err := storage.CapabilitiesOf(cfg.Vault.Type)
+	return err == nil && caps.Remote
+}
+
 // Add the load command to the root command
 func init() {
 	// This will be called from execute.go when adding commands
@@ -9,6 +9,8 @@ import (
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
@@ -451,3 +453,124 @@ func isValidKey(key string) bool {
 
 	return true
 }
+
+func TestOpenVaultKeystore_ImportsLegacyKey(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	// set, get and list kept the key under the project name when the
+	// project had no ID
+	legacy, err := keystore.NewKeystore(filepath.Join(home, ".vaultenv", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.StoreKey("my-app", &keystore.KeyEntry{ProjectID: "my-app", Salt: []byte("legacy-salt"), VerificationHash: "legacy-hash"})
+	legacy.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Project.Name = "my-app"
+	cfg.Project.ID = ""
+	cfg.Vault.Path = t.TempDir()
+
+	ks, err := openVaultKeystore(cfg)
+	if err != nil {
+		t.Fatalf("openVaultKeystore() error = %v", err)
+	}
+	defer ks.Close()
+
+	entry, err := ks.GetKey("")
+	if err != nil {
+		t.Fatalf("GetKey() error = %v, want the key of ~/.vaultenv/data", err)
+	}
+	if string(entry.Salt) != "legacy-salt" || entry.VerificationHash != "legacy-hash" {
+		t.Errorf("imported key = %+v", entry)
+	}
+}
+
+// Commands other than set, get and list take over the key as well when
+// they are the first to open the vault keystore
+func TestOpenVaultKeystore_OtherCommandsFirst(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := keystore.NewKeystore(filepath.Join(home, ".vaultenv", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.StoreKey("my-app-id", &keystore.KeyEntry{ProjectID: "my-app-id", Salt: []byte("legacy-salt"), VerificationHash: "legacy-hash"})
+	legacy.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Project.ID = "my-app-id"
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runSecurityLock(); err != nil {
+		t.Fatalf("runSecurityLock() error = %v", err)
+	}
+
+	ks, err := keystore.NewKeystore(cfg.Vault.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+
+	entry, err := ks.GetKey("my-app-id")
+	if err != nil {
+		t.Fatalf("GetKey() error = %v, want the key of ~/.vaultenv/data", err)
+	}
+	if string(entry.Salt) != "legacy-salt" {
+		t.Errorf("imported key = %+v", entry)
+	}
+}
+
+func TestImportVariablesIsAtomic(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "import_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The git backend rejects keys it cannot map to a file name
+	store, err := storage.NewGitBackend(tmpDir, "development")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+
+	vars := map[string]string{
+		"API_KEY":  "secret",
+		"DB_URL":   "postgres://localhost",
+		"BAD-NAME": "value",
+	}
+
+	if err := importVariables(store, vars, "development"); err == nil {
+		t.Fatal("importVariables() expected error")
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("List() after failed import = %v, want no variables", keys)
+	}
+
+	delete(vars, "BAD-NAME")
+	if err := importVariables(store, vars, "development"); err != nil {
+		t.Fatalf("importVariables() error = %v", err)
+	}
+
+	keys, _ = store.List()
+	if len(keys) != 2 {
+		t.Errorf("List() = %v, want 2 variables", keys)
+	}
+}
@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
@@ -45,8 +47,9 @@ func newMigrateCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&fromType, "from", "", "source storage type (file, sqlite, git)")
-	cmd.Flags().StringVar(&toType, "to", "", "destination storage type (file, sqlite, git)")
+	storageTypes := strings.Join(storage.Types(), ", ")
+	cmd.Flags().StringVar(&fromType, "from", "", "source storage type ("+storageTypes+")")
+	cmd.Flags().StringVar(&toType, "to", "", "destination storage type ("+storageTypes+")")
 	cmd.Flags().StringVarP(&environment, "env", "e", "development", "environment to migrate")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "skip confirmation prompt")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be migrated without making changes")
@@ -54,10 +57,20 @@ func newMigrateCommand() *cobra.Command {
 	cmd.MarkFlagRequired("from")
 	cmd.MarkFlagRequired("to")
 
+	cmd.RegisterFlagCompletionFunc("from", storageTypeCompletion)
+	cmd.RegisterFlagCompletionFunc("to", storageTypeCompletion)
+
 	return cmd
 }
 
 func runMigrate(fromType, toType, environment string, force, dryRun bool) error {
+	// Validate storage types
+	for _, t := range []string{fromType, toType} {
+		if !storage.IsRegistered(t) {
+			return fmt.Errorf("unknown storage type '%s' (available: %s)", t, strings.Join(storage.Types(), ", "))
+		}
+	}
+
 	// Validate migration path
 	if fromType == toType {
 		return fmt.Errorf("source and destination storage types must be different")
@@ -97,16 +110,12 @@ func runMigrate(fromType, toType, environment string, force, dryRun bool) error
 	isTest := isTestEnvironment()
 
 	// Create source backend
-	sourceOpts := storage.BackendOptions{
-		Environment: environment,
-		Type:        fromType,
-		BasePath:    cfg.Vault.Path,
-	}
+	sourceOpts := backendOptionsForType(cfg, fromType, environment)
 
 	// Handle authentication if not in test mode
 	var password string
 	if !isTest && cfg.Vault.IsEncrypted() {
-		ks, err := keystore.NewKeystore(cfg.Vault.Path)
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to initialize keystore: %w", err)
 		}
@@ -114,7 +123,7 @@ func runMigrate(fromType, toType, environment string, force, dryRun bool) error
 		pm := auth.NewPasswordManager(ks, cfg)
 
 		// Get or create encryption key
-		key, err := pm.GetOrCreateMasterKey(cfg.Project.ID)
+		key, err := pm.GetOrCreateDataKey(environment)
 		if err != nil {
 			return fmt.Errorf("failed to get encryption key: %w", err)
 		}
@@ -131,29 +140,25 @@ func runMigrate(fromType, toType, environment string, force, dryRun bool) error
 	}
 	defer source.Close()
 
-	// List all variables from source
+	// Read all variables from source
 	ui.Info("\nReading variables from %s storage...", fromType)
-	keys, err := source.List()
+	variables, err := storage.GetAll(context.Background(), source)
 	if err != nil {
-		return fmt.Errorf("failed to list variables: %w", err)
+		return fmt.Errorf("failed to read variables: %w", err)
 	}
 
-	if len(keys) == 0 {
+	if len(variables) == 0 {
 		ui.Warning("No variables found to migrate")
 		return nil
 	}
 
-	ui.Success("Found %d variables to migrate", len(keys))
+	ui.Success("Found %d variables to migrate", len(variables))
 
-	// Read all variables
-	variables := make(map[string]string)
-	for _, key := range keys {
-		value, err := source.Get(key)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", key, err)
-		}
-		variables[key] = value
+	keys := make([]string, 0, len(variables))
+	for key := range variables {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
 	if dryRun {
 		// Show what would be migrated
@@ -164,14 +169,14 @@ func runMigrate(fromType, toType, environment string, force, dryRun bool) error
 		return nil
 	}
 
-	// Create destination backend
-	destOpts := storage.BackendOptions{
-		Environment: environment,
-		Type:        toType,
-		BasePath:    cfg.Vault.Path,
-		Password:    password,
+	if err := autoSnapshot(cfg, fromType, "before migrate", []string{environment}); err != nil {
+		return err
 	}
 
+	// Create destination backend
+	destOpts := backendOptionsForType(cfg, toType, environment)
+	destOpts.Password = password
+
 	dest, err := storage.GetBackendWithOptions(destOpts)
 	if err != nil {
 		return fmt.Errorf("failed to create destination backend: %w", err)
@@ -182,11 +187,11 @@ func runMigrate(fromType, toType, environment string, force, dryRun bool) error
 	ui.Info("\nMigrating variables to %s storage...", toType)
 
 	migrated := 0
-	for key, value := range variables {
+	for _, key := range keys {
 		fmt.Printf("  Migrating %s...\n", key)
 
 		// Set in destination (encryption will be handled by the backend)
-		if err := dest.Set(key, value, false); err != nil {
+		if err := dest.Set(key, variables[key], false); err != nil {
 			return fmt.Errorf("failed to migrate %s: %w", key, err)
 		}
 
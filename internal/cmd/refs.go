@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/pkg/access"
+	"github.com/vaultenv/vaultenv-cli/pkg/reference"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+// openEnvironmentFunc opens the backend of another environment the same
+// way a command opened its own
+type openEnvironmentFunc func(environment string) (storage.Backend, error)
+
+// environmentStorage opens environments with getStorageForEnvironment, as
+// export does
+func environmentStorage(cfg *config.Config) openEnvironmentFunc {
+	return func(environment string) (storage.Backend, error) {
+		return getStorageForEnvironment(cfg, environment)
+	}
+}
+
+// newReferenceResolver returns a resolver for ${ref:...} references in the
+// values of environment, whose backend is home. Referenced environments
+// are opened with open on first use and closed by the returned function.
+func newReferenceResolver(ctx context.Context, cfg *config.Config, environment string,
+	home storage.Backend, open openEnvironmentFunc) (*reference.Resolver, func()) {
+
+	backends := map[string]storage.Backend{environment: home}
+	var opened []storage.Backend
+
+	lookup := func(env, key string) (string, error) {
+		backend, ok := backends[env]
+		if !ok {
+			if cfg != nil && !cfg.HasEnvironment(env) {
+				return "", fmt.Errorf("environment '%s' does not exist", env)
+			}
+
+			b, err := open(env)
+			if err != nil {
+				return "", fmt.Errorf("failed to open environment %s: %w", env, err)
+			}
+			backends[env] = b
+			if b != home {
+				opened = append(opened, b)
+			}
+			backend = b
+		}
+
+		return storage.WithContext(backend).GetContext(ctx, key)
+	}
+
+	closeAll := func() {
+		for _, b := range opened {
+			b.Close()
+		}
+	}
+
+	return reference.NewResolver(environment, lookup, checkEnvironmentAccess), closeAll
+}
+
+// resolveReferences returns vars, the variables of environment, with every
+// reference resolved
+func resolveReferences(ctx context.Context, cfg *config.Config, environment string,
+	home storage.Backend, open openEnvironmentFunc, vars map[string]string) (map[string]string, error) {
+
+	resolver, closeAll := newReferenceResolver(ctx, cfg, environment, home, open)
+	defer closeAll()
+
+	resolved, err := resolver.ResolveAll(vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve references: %w", err)
+	}
+
+	return resolved, nil
+}
+
+// checkEnvironmentAccess rejects references into an environment whose
+// access rules (see 'vaultenv env access') do not include the current
+// user. Environments without rules are open to everyone.
+func checkEnvironmentAccess(environment string) error {
+	ac := access.NewLocalAccessControl(filepath.Join(".vaultenv", "config.yaml"))
+
+	restricted, err := ac.HasRules(environment)
+	if err != nil {
+		return fmt.Errorf("failed to check access: %w", err)
+	}
+	if !restricted {
+		return nil
+	}
+
+	user := access.CurrentUser()
+	allowed, err := ac.HasAccess(user, environment)
+	if err != nil {
+		return fmt.Errorf("failed to check access: %w", err)
+	}
+	if !allowed {
+		return fmt.Errorf("user '%s' has no access to environment '%s'", user, environment)
+	}
+
+	return nil
+}
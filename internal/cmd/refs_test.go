@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/pkg/access"
+	"github.com/vaultenv/vaultenv-cli/pkg/reference"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func TestResolveReferences(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "vaultenv-refs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Environments["shared"] = config.EnvironmentConfig{}
+	cfg.Environments["restricted"] = config.EnvironmentConfig{}
+
+	stores := map[string]*storage.MemoryBackend{
+		"development": storage.NewMemoryBackend(),
+		"shared":      storage.NewMemoryBackend(),
+		"restricted":  storage.NewMemoryBackend(),
+	}
+	stores["shared"].Set("DB_HOST", "db.internal", false)
+	stores["restricted"].Set("API_TOKEN", "secret", false)
+
+	opened := 0
+	open := func(env string) (storage.Backend, error) {
+		opened++
+		return stores[env], nil
+	}
+
+	// Only the current user may use restricted
+	if err := os.MkdirAll(".vaultenv", 0755); err != nil {
+		t.Fatal(err)
+	}
+	ac := access.NewLocalAccessControl(filepath.Join(".vaultenv", "config.yaml"))
+	if err := ac.GrantAccess("someone-else", "restricted", access.AccessLevelRead); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "same and other environment",
+			vars: map[string]string{
+				"DB_PORT":      "5432",
+				"DATABASE_URL": "postgres://${ref:shared/DB_HOST}:${ref:DB_PORT}/app",
+			},
+			want: map[string]string{
+				"DB_PORT":      "5432",
+				"DATABASE_URL": "postgres://db.internal:5432/app",
+			},
+		},
+		{
+			name:    "unknown environment",
+			vars:    map[string]string{"URL": "${ref:qa/DB_HOST}"},
+			wantErr: "does not exist",
+		},
+		{
+			name:    "denied environment",
+			vars:    map[string]string{"TOKEN": "${ref:restricted/API_TOKEN}"},
+			wantErr: "has no access",
+		},
+		{
+			name:    "cycle",
+			vars:    map[string]string{"A": "${ref:B}", "B": "${ref:A}"},
+			wantErr: "reference cycle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveReferences(context.Background(), cfg, "development",
+				stores["development"], open, tt.vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveReferences() error = %v, want %q", err, tt.wantErr)
+				}
+				if tt.wantErr == "reference cycle" && !errors.Is(err, reference.ErrCycle) {
+					t.Errorf("error %v does not wrap ErrCycle", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveReferences() error = %v", err)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+
+	if opened > 2 {
+		t.Errorf("opened referenced environments %d times", opened)
+	}
+}
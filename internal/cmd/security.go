@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -11,8 +11,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
@@ -25,6 +25,8 @@ func newSecurityCommand() *cobra.Command {
 
 	cmd.AddCommand(
 		newSecurityRotateKeysCommand(),
+		newSecurityReencryptCommand(),
+		newSecurityTuneKDFCommand(),
 		newSecurityVerifyCommand(),
 		newSecurityReportCommand(),
 		newSecurityLockCommand(),
@@ -43,7 +45,11 @@ func newSecurityRotateKeysCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "rotate-keys",
 		Short: "Rotate encryption keys",
-		Long:  `Rotate encryption keys for enhanced security. This will re-encrypt all variables with new keys.`,
+		Long: `Rotate encryption keys for enhanced security. This will re-encrypt all variables with new keys.
+
+The new data key of the environment is stored wrapped by your password key,
+so the password stays the same. An interrupted rotation is completed or
+discarded the next time rotate-keys runs.`,
 
 		Example: `  # Rotate keys for current environment
   vaultenv security rotate-keys
@@ -65,6 +71,47 @@ func newSecurityRotateKeysCommand() *cobra.Command {
 	return cmd
 }
 
+func newSecurityReencryptCommand() *cobra.Command {
+	var (
+		algo   string
+		force  bool
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Re-encrypt all variables with another algorithm",
+		Long: `Re-encrypt the variables of every environment with the given algorithm
+and make it the configured vault.encryption_algo.
+
+Values record the algorithm they were encrypted with and are always
+decrypted with it, so the vault stays readable while values written under
+different algorithms are mixed, for example after an interrupted run.
+Running the command again converts the rest.
+
+Git vaults with deterministic encryption keep encrypting values
+deterministically with AES-256-GCM.`,
+
+		Example: `  # Switch to ChaCha20-Poly1305
+  vaultenv security reencrypt --algo chacha20-poly1305
+
+  # Show how many values would be converted
+  vaultenv security reencrypt --algo aes-gcm-256 --dry-run`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSecurityReencrypt(algo, force, dryRun)
+		},
+	}
+
+	cmd.Flags().StringVar(&algo, "algo", "", "algorithm to encrypt with (aes-gcm-256, chacha20-poly1305)")
+	cmd.Flags().BoolVar(&force, "force", false, "skip confirmation prompt")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show the values to re-encrypt without changing them")
+	cmd.MarkFlagRequired("algo")
+
+	return cmd
+}
+
 func newSecurityVerifyCommand() *cobra.Command {
 	var (
 		environment string
@@ -187,8 +234,7 @@ func runSecurityRotateKeys(environment string, force bool) error {
 	ui.Warning("Key rotation will:")
 	fmt.Println("  • Generate new encryption keys")
 	fmt.Println("  • Re-encrypt all variables with new keys")
-	fmt.Println("  • Invalidate any cached sessions")
-	fmt.Println("  • Require password re-entry")
+	fmt.Println("  • Keep the current password, which unlocks the new keys")
 	fmt.Println()
 
 	// Confirm rotation if not forced
@@ -202,95 +248,227 @@ func runSecurityRotateKeys(environment string, force bool) error {
 		}
 	}
 
+	if err := autoSnapshot(cfg, cfg.Vault.Type, "before rotate-keys", []string{environment}); err != nil {
+		return err
+	}
+
 	// Initialize keystore
-	ks, err := keystore.NewKeystore(cfg.Vault.Path)
+	ks, err := openVaultKeystore(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to initialize keystore: %w", err)
 	}
+	defer ks.Close()
 
 	// Initialize password manager
 	pm := auth.NewPasswordManager(ks, cfg)
 
-	// Get current encryption key for the environment
-	currentKey, err := pm.GetOrCreateEnvironmentKey(environment)
+	if err := resumeKeyRotation(cfg, pm, environment); err != nil {
+		return err
+	}
+
+	// Get current data key for the environment
+	currentKey, err := pm.GetOrCreateDataKey(environment)
 	if err != nil {
 		return fmt.Errorf("failed to get current encryption key: %w", err)
 	}
 
+	// Get storage backend with current encryption
+	store, err := openWithDataKey(cfg, environment, currentKey)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
 	ui.Info("Generating new encryption keys...")
 
-	// Generate new key
-	newKey := make([]byte, 32) // 256-bit key
-	if _, err := rand.Read(newKey); err != nil {
+	// The new data key is stored as pending until every value is
+	// re-encrypted, so an interrupted rotation never loses the key
+	newKey, err := pm.BeginDataKeyRotation(environment)
+	if err != nil {
 		return fmt.Errorf("failed to generate new key: %w", err)
 	}
 
-	// Get storage backend with current encryption
-	opts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-		Password:    string(currentKey),
+	newStore, err := openWithDataKey(cfg, environment, newKey)
+	if err != nil {
+		if abortErr := pm.AbortDataKeyRotation(environment); abortErr != nil {
+			ui.Warning("Failed to discard the new key: %v", abortErr)
+		}
+		return err
 	}
+	defer newStore.Close()
 
-	store, err := storage.GetBackendWithOptions(opts)
+	ui.Info("Re-encrypting variables, deleted variables and history...")
+
+	count, err := storage.RotateKey(store, newStore)
 	if err != nil {
-		return fmt.Errorf("failed to get storage backend: %w", err)
+		// Values already re-encrypted need the new key; it is kept for
+		// the next run to complete the rotation
+		if inUse, checkErr := storage.KeyInUse(newStore); checkErr != nil || inUse {
+			return fmt.Errorf("%w; both keys are kept, run rotate-keys again to complete the rotation", err)
+		}
+		if abortErr := pm.AbortDataKeyRotation(environment); abortErr != nil {
+			ui.Warning("Failed to discard the new key: %v", abortErr)
+		}
+		return err
+	}
+
+	// Snapshots keep values encrypted with the old key, which is discarded
+	if _, err := rotateSnapshots(cfg, pm, environment, store, newStore); err != nil {
+		return fmt.Errorf("%w; both keys are kept, run rotate-keys again to complete the rotation", err)
+	}
+
+	if err := pm.FinishDataKeyRotation(environment); err != nil {
+		return fmt.Errorf("failed to store the new key, run rotate-keys again to complete the rotation: %w", err)
 	}
-	defer store.Close()
 
-	// Get all variables
-	keys, err := store.List()
+	ui.Success("Encryption keys rotated successfully")
+	ui.Info("All %d variables have been re-encrypted with new keys", count)
+	ui.Info("Please test your application to ensure everything works correctly")
+
+	return nil
+}
+
+func runSecurityReencrypt(algo string, force, dryRun bool) error {
+	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to list variables: %w", err)
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if !cfg.Vault.IsEncrypted() {
+		return fmt.Errorf("encryption is not enabled for this project")
 	}
 
-	ui.Info("Re-encrypting %d variables...", len(keys))
+	algorithm, err := encryption.NormalizeAlgorithm(algo)
+	if err != nil || algorithm == encryption.AlgorithmAESGCMDeterministic {
+		return fmt.Errorf("unsupported encryption algorithm: %s", algo)
+	}
 
-	// Store all variables temporarily
-	variables := make(map[string]string)
-	for _, key := range keys {
-		value, err := store.Get(key)
+	ui.Header(fmt.Sprintf("Re-encrypting the vault with %s", algorithm))
+
+	if !force && !dryRun {
+		fmt.Printf("Re-encrypt all environments with %s? [y/N] ", algorithm)
+		var response string
+		fmt.Scanln(&response)
+		if strings.ToLower(response) != "y" {
+			ui.Info("Re-encryption cancelled")
+			return nil
+		}
+	}
+
+	environments := cfg.GetEnvironmentNames()
+	if !dryRun {
+		if err := autoSnapshot(cfg, cfg.Vault.Type, "before security reencrypt", environments); err != nil {
+			return err
+		}
+	}
+
+	var pm *auth.PasswordManager
+	if !isTestEnvironment() {
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to get variable %s: %w", key, err)
+			return fmt.Errorf("failed to initialize keystore: %w", err)
 		}
-		variables[key] = value
+		defer ks.Close()
+		pm = auth.NewPasswordManager(ks, cfg)
 	}
 
-	// Close the old backend
-	store.Close()
+	// Backends encrypt with the configured algorithm
+	cfg.Vault.EncryptionAlgo = algorithm
 
-	// Create new backend with new encryption key
-	newOpts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-		Password:    string(newKey),
+	total := 0
+	for _, env := range environments {
+		count, err := reencryptEnvironment(cfg, pm, env, dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt %s: %w", env, err)
+		}
+
+		if count > 0 {
+			ui.Info("%s: %d value(s) to re-encrypt", env, count)
+		}
+		total += count
+	}
+
+	if dryRun {
+		ui.Info("\n🔍 DRY RUN MODE - %d value(s) would be re-encrypted", total)
+		return nil
+	}
+
+	// Saved last: until then new values keep the previous algorithm, and
+	// the values converted so far are decrypted with the one they record
+	if err := saveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
 	}
 
-	newStore, err := storage.GetBackendWithOptions(newOpts)
+	ui.Success("Re-encrypted %d value(s) with %s", total, algorithm)
+	return nil
+}
+
+// openWithDataKey opens the storage of an environment encrypted with key
+func openWithDataKey(cfg *config.Config, environment string, key []byte) (storage.Backend, error) {
+	opts := vaultBackendOptions(cfg, environment)
+	opts.Password = string(key)
+
+	store, err := storage.GetBackendWithOptions(opts)
 	if err != nil {
-		return fmt.Errorf("failed to create new storage backend: %w", err)
+		return nil, fmt.Errorf("failed to get storage backend: %w", err)
 	}
-	defer newStore.Close()
 
-	// Re-encrypt all variables with new key
-	for key, value := range variables {
-		if err := newStore.Set(key, value, true); err != nil {
-			return fmt.Errorf("failed to re-encrypt variable %s: %w", key, err)
+	return store, nil
+}
+
+// resumeKeyRotation completes a rotation that was interrupted, re-encrypting
+// the values and snapshots still under the current key, or discards its key
+// if no value was re-encrypted with it yet. Both keys are kept while that is
+// unclear.
+func resumeKeyRotation(cfg *config.Config, pm *auth.PasswordManager, environment string) error {
+	pendingKey, err := pm.PendingDataKey(environment)
+	if errors.Is(err, auth.ErrNoPendingRotation) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check for an interrupted rotation: %w", err)
+	}
+
+	pendingStore, err := openWithDataKey(cfg, environment, pendingKey)
+	if err != nil {
+		return err
+	}
+	defer pendingStore.Close()
+
+	currentKey, err := pm.GetOrCreateDataKey(environment)
+	if err != nil {
+		return fmt.Errorf("failed to get current encryption key: %w", err)
+	}
+
+	store, err := openWithDataKey(cfg, environment, currentKey)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	inUse, err := storage.KeyInUse(pendingStore)
+	if err != nil {
+		return fmt.Errorf("failed to check the interrupted rotation, both keys are kept: %w", err)
+	}
+	if !inUse {
+		// Snapshots re-encrypted before the interruption go back to the
+		// current key
+		if _, err := rotateSnapshots(cfg, pm, environment, pendingStore, store); err != nil {
+			return fmt.Errorf("failed to discard the interrupted rotation, both keys are kept: %w", err)
 		}
+		return pm.AbortDataKeyRotation(environment)
 	}
 
-	// Update the environment key using password manager
-	// This requires implementing key rotation in the password manager
-	// For now, we'll clear the cache to force re-authentication
-	pm.ClearEnvironmentCache(environment)
+	ui.Info("Completing an interrupted key rotation")
 
-	ui.Success("Encryption keys rotated successfully")
-	ui.Info("All %d variables have been re-encrypted with new keys", len(variables))
-	ui.Info("Please test your application to ensure everything works correctly")
+	if _, err := storage.RotateKey(store, pendingStore); err != nil {
+		return fmt.Errorf("failed to complete the interrupted rotation, both keys are kept: %w", err)
+	}
+	if _, err := rotateSnapshots(cfg, pm, environment, store, pendingStore); err != nil {
+		return fmt.Errorf("failed to complete the interrupted rotation, both keys are kept: %w", err)
+	}
 
-	return nil
+	return pm.FinishDataKeyRotation(environment)
 }
 
 func runSecurityVerify(environment string, deep bool) error {
@@ -311,7 +489,7 @@ func runSecurityVerify(environment string, deep bool) error {
 	// Check encryption status
 	if cfg.Vault.IsEncrypted() {
 		ui.Success("✓ Encryption is enabled")
-		ui.Info("  Algorithm: AES-256-GCM")
+		ui.Info("  Algorithm: %s", cfg.Vault.EncryptionAlgo)
 		ui.Info("  Key derivation: Argon2id")
 	} else {
 		ui.Warning("⚠ Encryption is disabled")
@@ -319,10 +497,11 @@ func runSecurityVerify(environment string, deep bool) error {
 
 	// Check keystore
 	if cfg.Vault.IsEncrypted() {
-		_, err := keystore.NewKeystore(cfg.Vault.Path)
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
 			ui.Error("✗ Keystore verification failed: %v", err)
 		} else {
+			ks.Close()
 			ui.Success("✓ Keystore is accessible")
 		}
 	}
@@ -331,11 +510,7 @@ func runSecurityVerify(environment string, deep bool) error {
 	ui.Info("Storage backend: %s", cfg.Vault.Type)
 
 	// Create backend options for verification
-	opts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-	}
+	opts := vaultBackendOptions(cfg, environment)
 
 	// Get storage backend
 	store, err := storage.GetBackendWithOptions(opts)
@@ -400,10 +575,13 @@ func runSecurityReport(format, output string) error {
 	// Add encryption details
 	if cfg.Vault.IsEncrypted() {
 		report.EncryptionDetails = &EncryptionDetails{
-			Algorithm:     "AES-256-GCM",
+			Algorithm:     cfg.Vault.EncryptionAlgo,
 			KeyDerivation: "Argon2id",
 			KeyLength:     256,
 		}
+		if kdf, err := cfg.Vault.KeyDerivation.Params(); err == nil {
+			report.EncryptionDetails.KeyDerivation = kdf.String()
+		}
 	}
 
 	// Analyze each environment
@@ -416,11 +594,7 @@ func runSecurityReport(format, output string) error {
 		}
 
 		// Get variable count
-		opts := storage.BackendOptions{
-			Environment: envName,
-			Type:        cfg.Vault.Type,
-			BasePath:    cfg.Vault.Path,
-		}
+		opts := vaultBackendOptions(cfg, envName)
 
 		store, err := storage.GetBackendWithOptions(opts)
 		if err == nil {
@@ -453,10 +627,11 @@ func runSecurityLock() error {
 	}
 
 	// Initialize keystore
-	ks, err := keystore.NewKeystore(cfg.Vault.Path)
+	ks, err := openVaultKeystore(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to initialize keystore: %w", err)
 	}
+	defer ks.Close()
 
 	// Initialize password manager
 	pm := auth.NewPasswordManager(ks, cfg)
@@ -480,10 +655,11 @@ func runSecurityUnlock() error {
 	}
 
 	// Initialize keystore
-	ks, err := keystore.NewKeystore(cfg.Vault.Path)
+	ks, err := openVaultKeystore(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to initialize keystore: %w", err)
 	}
+	defer ks.Close()
 
 	// Initialize password manager
 	pm := auth.NewPasswordManager(ks, cfg)
@@ -494,7 +670,7 @@ func runSecurityUnlock() error {
 		ui.Info("Unlocking environment: %s", env)
 
 		// This will prompt for password and cache it
-		_, err := pm.GetOrCreateEnvironmentKey(env)
+		_, err := pm.GetOrCreateDataKey(env)
 		if err != nil {
 			ui.Error("Failed to unlock environment %s: %v", env, err)
 			continue
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
+)
+
+func newSecurityTuneKDFCommand() *cobra.Command {
+	var (
+		target      time.Duration
+		maxMemory   int
+		parallelism int
+		write       bool
+		force       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "tune-kdf",
+		Short: "Benchmark key derivation and recommend parameters",
+		Long: `Benchmark Argon2id on this machine and recommend the parameters that
+derive a key in about the target time: as much memory as allowed, then as
+many iterations as fit.
+
+Parameters are never recommended below the security floor, set with
+vault.key_derivation.min_iterations and min_memory (default 2 iterations
+and 19 MiB). With --write the parameters are saved to
+vault.key_derivation; keys derived with weaker parameters are upgraded the
+next time they are unlocked. Parameters cheaper than the configured ones
+are only saved with --force, since keys are never downgraded to them.`,
+
+		Example: `  # Recommend parameters for half a second per unlock
+  vaultenv security tune-kdf
+
+  # Tune a CI runner with little memory and save the result
+  vaultenv security tune-kdf --target 250ms --max-memory 64 --write`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSecurityTuneKDF(target, maxMemory, parallelism, write, force)
+		},
+	}
+
+	cmd.Flags().DurationVar(&target, "target", 500*time.Millisecond, "time one key derivation should take")
+	cmd.Flags().IntVar(&maxMemory, "max-memory", 256, "most memory to use in MiB")
+	cmd.Flags().IntVar(&parallelism, "parallelism", 0, "lanes to derive with (default: number of CPUs, at most 4)")
+	cmd.Flags().BoolVar(&write, "write", false, "save the parameters to vault.key_derivation")
+	cmd.Flags().BoolVar(&force, "force", false, "save the parameters even if they are cheaper than the configured ones")
+
+	return cmd
+}
+
+func runSecurityTuneKDF(target time.Duration, maxMemory, parallelism int, write, force bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if target <= 0 {
+		return fmt.Errorf("target must be positive")
+	}
+	if parallelism == 0 {
+		parallelism = min(runtime.NumCPU(), 4)
+	}
+	if parallelism < 1 || parallelism > math.MaxUint8 {
+		return fmt.Errorf("parallelism must be between 1 and %d", math.MaxUint8)
+	}
+
+	minIterations, minMemory := cfg.Vault.KeyDerivation.Floor()
+	minMemory = max(minMemory, 8*parallelism)
+	if maxMemory*1024 < minMemory {
+		return fmt.Errorf("--max-memory %d MiB is below the security floor of %d KiB", maxMemory, minMemory)
+	}
+
+	ui.Header("Benchmarking Argon2id key derivation")
+	ui.Info("Target: %s, %d CPU(s), security floor t=%d, m=%d KiB", target, runtime.NumCPU(), minIterations, minMemory)
+
+	params, elapsed := tuneArgon2(measureKDF, target, maxMemory*1024, parallelism, minIterations, minMemory)
+	if err := params.Validate(); err != nil {
+		return fmt.Errorf("failed to tune key derivation: %w", err)
+	}
+
+	fmt.Println()
+	ui.Info("Recommended: %s", params)
+	printKDFCost(params, elapsed)
+
+	if elapsed > target && int(params.Iterations) == minIterations && int(params.Memory) == minMemory {
+		ui.Warning("The security floor takes %s on this machine, longer than the target of %s", elapsed.Round(time.Millisecond), target)
+	}
+
+	configured, err := cfg.Vault.KeyDerivation.Params()
+	lowered := err == nil && lowersKDF(configured, params)
+	if lowered {
+		ui.Warning("These parameters are cheaper to attack than the configured %s", configured)
+	}
+
+	if !write {
+		ui.Info("\nRun with --write to save these parameters to vault.key_derivation")
+		return nil
+	}
+	if lowered && !force {
+		return fmt.Errorf("refusing to replace %s with weaker parameters; run with --force to save them anyway", configured)
+	}
+
+	cfg.Vault.KeyDerivation.Algorithm = params.Algorithm
+	cfg.Vault.KeyDerivation.Iterations = int(params.Iterations)
+	cfg.Vault.KeyDerivation.Memory = int(params.Memory)
+	cfg.Vault.KeyDerivation.Parallelism = int(params.Parallelism)
+	if err := saveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	ui.Success("Saved %s to vault.key_derivation", params)
+	ui.Info("Keys derived with weaker parameters are upgraded the next time they are unlocked")
+	return nil
+}
+
+// lowersKDF reports whether replacing the configured parameters with params
+// makes a guess cheaper: a weaker function, or a lower total cost with the
+// same one. It agrees with the key upgrades on unlock, see
+// encryption.KDFParams.Weaker.
+func lowersKDF(configured, params encryption.KDFParams) bool {
+	return params.Weaker(configured)
+}
+
+// tuneArgon2 finds Argon2id parameters that derive a key in about the
+// target time with measure. Memory is halved from maxMemory until the
+// fewest allowed iterations fit the target, then iterations are added
+// while they fit; neither goes below the floor. It returns the parameters
+// and the time they took.
+func tuneArgon2(measure func(encryption.KDFParams) time.Duration, target time.Duration, maxMemory, parallelism, minIterations, minMemory int) (encryption.KDFParams, time.Duration) {
+	params := encryption.KDFParams{
+		Algorithm:   encryption.KDFArgon2id,
+		Iterations:  1,
+		Memory:      uint32(max(maxMemory, minMemory)),
+		Parallelism: uint8(parallelism),
+	}
+
+	pass := measure(params)
+	for pass*time.Duration(minIterations) > target && int(params.Memory) > minMemory {
+		params.Memory = uint32(max(int(params.Memory)/2, minMemory))
+		pass = measure(params)
+	}
+
+	iterations := minIterations
+	if pass > 0 {
+		iterations = max(int(target/pass), minIterations)
+	}
+	params.Iterations = uint32(iterations)
+
+	return params, measure(params)
+}
+
+// measureKDF returns the time one key derivation takes on this machine
+func measureKDF(params encryption.KDFParams) time.Duration {
+	start := time.Now()
+	params.DeriveKey("vaultenv-benchmark", make([]byte, 32))
+	return time.Since(start)
+}
+
+// printKDFCost shows what the parameters cost a user unlocking the vault
+// and an attacker guessing its password
+func printKDFCost(params encryption.KDFParams, elapsed time.Duration) {
+	// Every guess takes the memory and the lanes of one derivation
+	guessesPerSecond := float64(runtime.NumCPU()) / float64(params.Parallelism) / elapsed.Seconds()
+	alphanumeric8 := math.Pow(62, 8)
+
+	ui.Info("  Unlock time:          %s", elapsed.Round(time.Millisecond))
+	ui.Info("  Memory per guess:     %d MiB", params.Memory/1024)
+	ui.Info("  Guesses per second:   ~%.1f on all CPUs of this machine", guessesPerSecond)
+	ui.Info("  8-char alphanumeric:  ~%s to try every password on this machine", formatCrackTime(alphanumeric8/guessesPerSecond))
+}
+
+// formatCrackTime formats a number of seconds in the largest fitting unit
+func formatCrackTime(seconds float64) string {
+	units := []struct {
+		name    string
+		seconds float64
+	}{
+		{"years", 365 * 24 * 3600},
+		{"days", 24 * 3600},
+		{"hours", 3600},
+		{"minutes", 60},
+	}
+
+	for _, unit := range units {
+		if seconds >= unit.seconds {
+			return fmt.Sprintf("%.0f %s", seconds/unit.seconds, unit.name)
+		}
+	}
+	return fmt.Sprintf("%.0f seconds", seconds)
+}
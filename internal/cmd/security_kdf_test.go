@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
+)
+
+func TestTuneArgon2(t *testing.T) {
+	// A machine taking 1ms per pass over 1 MiB
+	measure := func(p encryption.KDFParams) time.Duration {
+		return time.Duration(p.Iterations) * time.Duration(p.Memory/1024) * time.Millisecond
+	}
+
+	tests := []struct {
+		name           string
+		target         time.Duration
+		maxMemory      int
+		wantIterations uint32
+		wantMemory     uint32
+	}{
+		{"all memory, more iterations", 500 * time.Millisecond, 64 * 1024, 7, 64 * 1024},
+		{"less memory", 500 * time.Millisecond, 1024 * 1024, 3, 128 * 1024},
+		{"stops at the floor", 10 * time.Millisecond, 64 * 1024, 2, 19 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, elapsed := tuneArgon2(measure, tt.target, tt.maxMemory, 4, 2, 19*1024)
+			if params.Iterations != tt.wantIterations || params.Memory != tt.wantMemory || params.Parallelism != 4 {
+				t.Errorf("tuneArgon2() = %s, want t=%d, m=%d KiB", params, tt.wantIterations, tt.wantMemory)
+			}
+			if elapsed != measure(params) {
+				t.Errorf("tuneArgon2() elapsed = %s, want %s", elapsed, measure(params))
+			}
+		})
+	}
+}
+
+func TestSecurityTuneKDF_Write(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	// The floor is weaker than the default parameters
+	before, _ := config.Load()
+	if err := runSecurityTuneKDF(time.Millisecond, 32, 1, true, false); err == nil {
+		t.Fatal("runSecurityTuneKDF() lowered the parameters without --force")
+	}
+	if cfg, _ := config.Load(); cfg.Vault.KeyDerivation != before.Vault.KeyDerivation {
+		t.Fatalf("vault.key_derivation = %+v after a refused write, want %+v", cfg.Vault.KeyDerivation, before.Vault.KeyDerivation)
+	}
+
+	if err := runSecurityTuneKDF(time.Millisecond, 32, 1, true, true); err != nil {
+		t.Fatalf("runSecurityTuneKDF() error = %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	// Nothing fits a millisecond, so the floor is written
+	kdf := cfg.Vault.KeyDerivation
+	if kdf.Algorithm != "argon2id" || kdf.Iterations != 2 || kdf.Memory != 19*1024 || kdf.Parallelism != 1 {
+		t.Errorf("vault.key_derivation = %+v, want the security floor", kdf)
+	}
+
+	if err := runSecurityTuneKDF(time.Second, 16, 1, false, false); err == nil {
+		t.Error("runSecurityTuneKDF() accepted a memory limit below the floor")
+	}
+}
+
+func TestLowersKDF(t *testing.T) {
+	configured := encryption.DefaultKDFParams(encryption.KDFArgon2id)
+
+	tests := []struct {
+		name   string
+		params encryption.KDFParams
+		want   bool
+	}{
+		{"same", configured, false},
+		{"fewer iterations, more memory, costlier", encryption.KDFParams{Algorithm: encryption.KDFArgon2id, Iterations: 2, Memory: 256 * 1024, Parallelism: 4}, false},
+		{"fewer iterations, more memory, cheaper", encryption.KDFParams{Algorithm: encryption.KDFArgon2id, Iterations: 1, Memory: 128 * 1024, Parallelism: 4}, true},
+		{"security floor", encryption.KDFParams{Algorithm: encryption.KDFArgon2id, Iterations: 2, Memory: 19 * 1024, Parallelism: 1}, true},
+		{"weaker function", encryption.DefaultKDFParams(encryption.KDFPBKDF2), true},
+	}
+
+	for _, tt := range tests {
+		if got := lowersKDF(configured, tt.params); got != tt.want {
+			t.Errorf("%s: lowersKDF() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
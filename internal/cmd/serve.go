@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/server"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newServeCommand() *cobra.Command {
+	var (
+		socket     string
+		addr       string
+		allowWrite bool
+		auditLog   string
+		vaultAPI   bool
+		kvMount    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve variables to local processes over an authenticated API",
+		Long: `Unlock the vault once and serve its environments over a local HTTP API.
+
+The server listens on a Unix socket readable by the current user only, or on a
+loopback TCP address. Clients authenticate with tokens created by
+'vaultenv serve token add' and every request is written to the audit log.
+Write endpoints are disabled unless --allow-write is given.
+
+With --vault-api the server also speaks a subset of the HashiCorp Vault KV v2
+API: every environment is a secret of the mount and every variable a field of
+that secret. Reads, lists, writes and metadata are supported; versions come from
+the vault history where the backend keeps one.`,
+
+		Example: `  # Serve on the default Unix socket
+  vaultenv serve
+
+  # Serve on a loopback port
+  vaultenv serve --addr 127.0.0.1:8200
+
+  # Allow clients with write access to change variables
+  vaultenv serve --allow-write
+
+  # Serve the HashiCorp Vault KV v2 API for existing Vault clients
+  vaultenv serve --addr 127.0.0.1:8200 --vault-api
+  VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=$TOKEN vault kv get secret/development
+
+  # Read a variable through the socket
+  curl --unix-socket .vaultenv/serve.sock \
+    -H "Authorization: Bearer $TOKEN" \
+    http://vaultenv/v1/environments/development/variables/API_KEY`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd, socket, addr, allowWrite, auditLog, vaultAPI, kvMount)
+		},
+	}
+
+	cmd.Flags().StringVar(&socket, "socket", "", "Unix socket to listen on (default <vault path>/serve.sock)")
+	cmd.Flags().StringVar(&addr, "addr", "", "loopback TCP address to listen on instead of a socket")
+	cmd.Flags().BoolVar(&allowWrite, "allow-write", false, "enable write endpoints for clients with write access")
+	cmd.Flags().StringVar(&auditLog, "audit-log", "", "audit log file (default <vault path>/serve/audit.log)")
+	cmd.Flags().BoolVar(&vaultAPI, "vault-api", false, "also serve the HashiCorp Vault KV v2 API")
+	cmd.Flags().StringVar(&kvMount, "kv-mount", "secret", "mount path of the KV v2 API")
+
+	cmd.AddCommand(newServeTokenCommand())
+
+	return cmd
+}
+
+func newServeTokenCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage serve client tokens",
+		Long:  `Create, list, and revoke the tokens clients use to access 'vaultenv serve'.`,
+	}
+
+	cmd.AddCommand(
+		newServeTokenAddCommand(),
+		newServeTokenListCommand(),
+		newServeTokenRevokeCommand(),
+	)
+
+	return cmd
+}
+
+func newServeTokenAddCommand() *cobra.Command {
+	var (
+		environments []string
+		write        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Create a token for a client",
+		Long: `Create a token for a client. The token is shown once and only its hash is stored.
+Without --env the client may read every environment.`,
+
+		Example: `  # Token for a service that reads development
+  vaultenv serve token add api-server --env development
+
+  # Token that may also write
+  vaultenv serve token add deploy-tool --env staging --write`,
+
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServeTokenAdd(cmd, args[0], environments, write)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&environments, "env", "e", nil, "environments the client may access (default all)")
+	cmd.Flags().BoolVar(&write, "write", false, "allow the client to change variables")
+
+	return cmd
+}
+
+func newServeTokenListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List serve clients",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServeTokenList(cmd)
+		},
+	}
+}
+
+func newServeTokenRevokeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke NAME",
+		Short: "Revoke a client token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServeTokenRevoke(cmd, args[0])
+		},
+	}
+}
+
+func runServe(cmd *cobra.Command, socket, addr string, allowWrite bool, auditLog string, vaultAPI bool, kvMount string) error {
+	cfg, err := serveConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	if socket != "" && addr != "" {
+		return fmt.Errorf("--socket and --addr cannot be used together")
+	}
+
+	tokens, err := openServeTokens(cfg)
+	if err != nil {
+		return err
+	}
+	if len(tokens.List()) == 0 {
+		ui.Warning("No client tokens exist yet, create one with 'vaultenv serve token add NAME'")
+	}
+
+	if auditLog == "" {
+		auditLog = filepath.Join(cfg.Vault.Path, "serve", "audit.log")
+	}
+	audit, err := server.OpenAuditLog(auditLog)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+
+	// Unlock once; every environment is served with its data key
+	passwords, err := serveVaultPasswords(cfg)
+	if err != nil {
+		return err
+	}
+
+	if !vaultAPI {
+		kvMount = ""
+	}
+
+	srv, err := server.New(server.Options{
+		Environments: cfg.GetEnvironmentNames(),
+		Open: func(environment string) (storage.Backend, error) {
+			opts := vaultBackendOptions(cfg, environment)
+			opts.Password = passwords[environment]
+			return storage.GetBackendWithOptions(opts)
+		},
+		Tokens:     tokens,
+		Audit:      audit,
+		AllowWrite: allowWrite,
+		KVMount:    kvMount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	defer srv.Close()
+
+	var ln net.Listener
+	if addr != "" {
+		ln, err = server.ListenLoopback(addr)
+	} else {
+		if socket == "" {
+			socket = filepath.Join(cfg.Vault.Path, "serve.sock")
+		}
+		ln, err = server.ListenUnix(socket)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.Success("Serving %d environment(s) on %s", len(cfg.GetEnvironmentNames()), ln.Addr())
+	if allowWrite {
+		ui.Warning("Write endpoints are enabled")
+	}
+	if kvMount != "" {
+		ui.Info("Vault KV v2 API on mount %s/", kvMount)
+	}
+	ui.Info("Audit log: %s", auditLog)
+	ui.Info("Press Ctrl-C to stop")
+
+	if err := srv.Serve(commandContext(cmd), ln); err != nil {
+		return fmt.Errorf("server stopped: %w", err)
+	}
+
+	ui.Info("Server stopped")
+	return nil
+}
+
+// serveVaultPasswords unlocks the vault through the password manager, the
+// way the other commands do, and returns the keys used by the backends of
+// each environment. The server runs longer than keys stay cached, so all
+// environments are unlocked up front.
+func serveVaultPasswords(cfg *config.Config) (map[string]string, error) {
+	passwords := make(map[string]string)
+	if isTestEnvironment() || !(cfg.Vault.IsEncrypted() || vaultRequiresPassword(cfg)) {
+		return passwords, nil
+	}
+
+	ks, err := openVaultKeystore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize keystore: %w", err)
+	}
+	defer ks.Close()
+
+	pm := auth.NewPasswordManager(ks, cfg)
+
+	for _, env := range cfg.GetEnvironmentNames() {
+		key, err := pm.GetOrCreateDataKey(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get encryption key for %s: %w", env, err)
+		}
+		passwords[env] = string(key)
+	}
+
+	return passwords, nil
+}
+
+func runServeTokenAdd(cmd *cobra.Command, name string, environments []string, write bool) error {
+	cfg, err := serveConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	for _, env := range environments {
+		if !cfg.HasEnvironment(env) {
+			return fmt.Errorf("environment '%s' does not exist", env)
+		}
+	}
+
+	tokens, err := openServeTokens(cfg)
+	if err != nil {
+		return err
+	}
+
+	token, err := tokens.Add(name, environments, write)
+	if err != nil {
+		if errors.Is(err, server.ErrClientExists) {
+			return fmt.Errorf("client '%s' already has a token, revoke it first", name)
+		}
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	ui.Success("Created token for %s", name)
+	ui.Warning("Store this token now, it will not be shown again")
+	fmt.Fprintln(cmd.OutOrStdout(), token)
+
+	return nil
+}
+
+func runServeTokenList(cmd *cobra.Command) error {
+	cfg, err := serveConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := openServeTokens(cfg)
+	if err != nil {
+		return err
+	}
+
+	clients := tokens.List()
+	if len(clients) == 0 {
+		ui.Info("No serve clients")
+		return nil
+	}
+
+	ui.Header("Serve clients")
+	for _, c := range clients {
+		envs := "all environments"
+		if len(c.Environments) > 0 {
+			envs = strings.Join(c.Environments, ", ")
+		}
+		access := "read"
+		if c.Write {
+			access = "read-write"
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "  %s (%s): %s, created %s\n",
+			c.Name, access, envs, c.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	return nil
+}
+
+func runServeTokenRevoke(cmd *cobra.Command, name string) error {
+	cfg, err := serveConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := openServeTokens(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := tokens.Revoke(name); err != nil {
+		if errors.Is(err, server.ErrClientNotFound) {
+			return fmt.Errorf("client '%s' not found", name)
+		}
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	ui.Success("Revoked token for %s", name)
+	return nil
+}
+
+func serveConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg := GetConfig(cmd)
+	if cfg == nil {
+		return nil, fmt.Errorf("no configuration found, run 'vaultenv init' first")
+	}
+	return cfg, nil
+}
+
+func openServeTokens(cfg *config.Config) (*server.TokenStore, error) {
+	tokens, err := server.OpenTokenStore(filepath.Join(cfg.Vault.Path, "serve", "tokens.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token store: %w", err)
+	}
+	return tokens, nil
+}
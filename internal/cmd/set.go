@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -11,7 +9,6 @@ import (
 
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
@@ -21,6 +18,9 @@ func newSetCommand() *cobra.Command {
 		environment string
 		force       bool
 		encrypt     bool
+		description string
+		tags        []string
+		owner       string
 	)
 
 	cmd := &cobra.Command{
@@ -41,11 +41,29 @@ for non-sensitive values to improve performance.`,
   vaultenv-cli set API_KEY=prod-secret --env production
 
   # Set without encryption (only for non-sensitive data)
-  vaultenv-cli set LOG_LEVEL=debug --no-encrypt`,
+  vaultenv-cli set LOG_LEVEL=debug --no-encrypt
+
+  # Describe what a variable is for
+  vaultenv-cli set STRIPE_KEY=sk_live_xxx --description "Stripe live key" --tag payments --owner billing-team`,
 
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSet(args, environment, force, encrypt)
+			var update *metadataUpdate
+			if cmd.Flags().Changed("description") || cmd.Flags().Changed("tag") || cmd.Flags().Changed("owner") {
+				update = &metadataUpdate{}
+				if cmd.Flags().Changed("description") {
+					update.Description = &description
+				}
+				if cmd.Flags().Changed("tag") {
+					update.Tags = tags
+					update.SetTags = true
+				}
+				if cmd.Flags().Changed("owner") {
+					update.Owner = &owner
+				}
+			}
+
+			return runSet(args, environment, force, encrypt, update)
 		},
 	}
 
@@ -56,6 +74,12 @@ for non-sensitive values to improve performance.`,
 		"overwrite existing variables without confirmation")
 	cmd.Flags().BoolVar(&encrypt, "encrypt", true,
 		"encrypt values before storage")
+	cmd.Flags().StringVar(&description, "description", "",
+		"describe what the variable is for (stored unencrypted)")
+	cmd.Flags().StringSliceVar(&tags, "tag", nil,
+		"tag the variable, replacing existing tags (repeatable)")
+	cmd.Flags().StringVar(&owner, "owner", "",
+		"person or team responsible for the variable")
 
 	// Register completion functions for better UX
 	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
@@ -81,7 +105,7 @@ for non-sensitive values to improve performance.`,
 	return cmd
 }
 
-func runSet(args []string, environment string, force bool, encrypt bool) error {
+func runSet(args []string, environment string, force bool, encrypt bool, update *metadataUpdate) error {
 	// Parse KEY=VALUE pairs
 	vars, err := parseVariables(args)
 	if err != nil {
@@ -97,42 +121,9 @@ func runSet(args []string, environment string, force bool, encrypt bool) error {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Initialize storage options
-	storageOpts := storage.BackendOptions{
-		Environment: environment,
-	}
-
-	// If encryption is enabled and not in test environment, set up authentication
-	if encrypt && !isTestEnvironment() {
-		// Get project ID from config or use default
-		projectID := cfg.Project.ID
-		if projectID == "" {
-			projectID = cfg.Project.Name
-		}
-
-		// Initialize keystore
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get home directory: %w", err)
-		}
-		dataDir := filepath.Join(homeDir, ".vaultenv", "data")
-
-		ks, err := keystore.NewKeystore(dataDir)
-		if err != nil {
-			return fmt.Errorf("failed to initialize keystore: %w", err)
-		}
-
-		// Create password manager
-		pm := auth.NewPasswordManager(ks, cfg)
-
-		// Get or create encryption key
-		key, err := pm.GetOrCreateMasterKey(projectID)
-		if err != nil {
-			return fmt.Errorf("failed to get encryption key: %w", err)
-		}
-
-		// Convert key to string for storage options
-		storageOpts.Password = string(key)
+	storageOpts, err := setStorageOptions(cfg, environment, encrypt)
+	if err != nil {
+		return err
 	}
 
 	// Get storage backend with options
@@ -144,28 +135,14 @@ func runSet(args []string, environment string, force bool, encrypt bool) error {
 
 	// Process each variable
 	for key, value := range vars {
-		// Check if variable already exists
-		exists, err := store.Exists(key)
+		// Confirm overwrite if needed
+		overwrite, err := confirmOverwrite(store, key, force)
 		if err != nil {
-			return fmt.Errorf("failed to check variable: %w", err)
+			return err
 		}
-
-		// Confirm overwrite if needed
-		if exists && !force {
-			overwrite := false
-			prompt := &survey.Confirm{
-				Message: fmt.Sprintf("Variable %s already exists. Overwrite?", key),
-				Default: false,
-			}
-
-			if err := survey.AskOne(prompt, &overwrite); err != nil {
-				return err
-			}
-
-			if !overwrite {
-				ui.Info("Skipping %s", key)
-				continue
-			}
+		if !overwrite {
+			ui.Info("Skipping %s", key)
+			continue
 		}
 
 		// Store the variable
@@ -175,12 +152,109 @@ func runSet(args []string, environment string, force bool, encrypt bool) error {
 		if err != nil {
 			return fmt.Errorf("failed to set %s: %w", key, err)
 		}
+
+		// Store metadata given on the command line
+		if update != nil {
+			if err := update.apply(store, key); err != nil {
+				return fmt.Errorf("failed to set metadata for %s: %w", key, err)
+			}
+		}
 	}
 
 	ui.Success("Variables set successfully")
 	return nil
 }
 
+// confirmOverwrite reports whether a variable may be written, asking
+// before an existing one is replaced unless force is set
+func confirmOverwrite(store storage.Backend, key string, force bool) (bool, error) {
+	// Check if variable already exists
+	exists, err := store.Exists(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to check variable: %w", err)
+	}
+	if !exists || force {
+		return true, nil
+	}
+
+	overwrite := false
+	prompt := &survey.Confirm{
+		Message: fmt.Sprintf("Variable %s already exists. Overwrite?", key),
+		Default: false,
+	}
+
+	if err := survey.AskOne(prompt, &overwrite); err != nil {
+		return false, err
+	}
+
+	return overwrite, nil
+}
+
+// setStorageOptions returns the backend options for writing to an
+// environment, with the encryption key when values are encrypted
+func setStorageOptions(cfg *config.Config, environment string, encrypt bool) (storage.BackendOptions, error) {
+	// Initialize storage options
+	storageOpts := vaultBackendOptions(cfg, environment)
+
+	// If encryption is enabled and not in test environment, set up authentication
+	if (encrypt || vaultRequiresPassword(cfg)) && !isTestEnvironment() {
+		// Initialize keystore
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			return storageOpts, fmt.Errorf("failed to initialize keystore: %w", err)
+		}
+		defer ks.Close()
+
+		// Create password manager
+		pm := auth.NewPasswordManager(ks, cfg)
+
+		// Get or create the data key of the environment
+		key, err := pm.GetOrCreateDataKey(environment)
+		if err != nil {
+			return storageOpts, fmt.Errorf("failed to get encryption key: %w", err)
+		}
+
+		// Convert key to string for storage options
+		storageOpts.Password = string(key)
+	}
+
+	return storageOpts, nil
+}
+
+// metadataUpdate holds the metadata fields changed with set flags.
+// Nil fields are left as they are.
+type metadataUpdate struct {
+	Description *string
+	Tags        []string
+	SetTags     bool
+	Owner       *string
+}
+
+// apply merges the update into the stored metadata of a variable
+func (u *metadataUpdate) apply(store storage.Backend, key string) error {
+	mb, ok := storage.AsMetadataBackend(store)
+	if !ok {
+		return storage.ErrMetadataNotSupported
+	}
+
+	meta, err := mb.GetMetadata(key)
+	if err != nil {
+		return err
+	}
+
+	if u.Description != nil {
+		meta.Description = *u.Description
+	}
+	if u.SetTags {
+		meta.Tags = u.Tags
+	}
+	if u.Owner != nil {
+		meta.Owner = *u.Owner
+	}
+
+	return mb.SetMetadata(key, meta)
+}
+
 func parseVariables(args []string) (map[string]string, error) {
 	vars := make(map[string]string)
 
@@ -210,32 +284,5 @@ func parseVariables(args []string) (map[string]string, error) {
 }
 
 func isValidVariableName(name string) bool {
-	// Environment variable names should follow conventions
-	// Must start with letter or underscore
-	// Can contain letters, numbers, and underscores
-	if len(name) == 0 {
-		return false
-	}
-
-	for i, ch := range name {
-		if i == 0 {
-			if !isLetter(ch) && ch != '_' {
-				return false
-			}
-		} else {
-			if !isLetter(ch) && !isDigit(ch) && ch != '_' {
-				return false
-			}
-		}
-	}
-
-	return true
-}
-
-func isLetter(ch rune) bool {
-	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z')
-}
-
-func isDigit(ch rune) bool {
-	return ch >= '0' && ch <= '9'
+	return storage.IsValidVariableName(name)
 }
@@ -396,3 +396,44 @@ func TestSetCommandValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataUpdateApply(t *testing.T) {
+	store := storage.NewMemoryBackend()
+	store.Set("API_KEY", "secret", false)
+
+	description := "Payments API key"
+	owner := "billing-team"
+	update := &metadataUpdate{
+		Description: &description,
+		Tags:        []string{"payments"},
+		SetTags:     true,
+		Owner:       &owner,
+	}
+	if err := update.apply(store, "API_KEY"); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	// A later update only changes the given fields
+	newOwner := "platform-team"
+	if err := (&metadataUpdate{Owner: &newOwner}).apply(store, "API_KEY"); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	meta, err := store.GetMetadata("API_KEY")
+	if err != nil {
+		t.Fatalf("GetMetadata() error = %v", err)
+	}
+	if meta.Description != description {
+		t.Errorf("Description = %q, want %q", meta.Description, description)
+	}
+	if len(meta.Tags) != 1 || meta.Tags[0] != "payments" {
+		t.Errorf("Tags = %v, want [payments]", meta.Tags)
+	}
+	if meta.Owner != newOwner {
+		t.Errorf("Owner = %q, want %q", meta.Owner, newOwner)
+	}
+
+	if err := update.apply(store, "MISSING"); err == nil {
+		t.Error("apply() on missing variable should fail")
+	}
+}
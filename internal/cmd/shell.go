@@ -1,16 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/vaultenv/vaultenv-cli/internal/auth"
 	"github.com/vaultenv/vaultenv-cli/internal/config"
-	"github.com/vaultenv/vaultenv-cli/internal/keystore"
 	"github.com/vaultenv/vaultenv-cli/internal/ui"
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
@@ -39,7 +41,7 @@ func newShellCommand() *cobra.Command {
   vaultenv shell --shell fish | source`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runShell(environment, shell)
+			return runShell(commandContext(cmd), environment, shell)
 		},
 	}
 
@@ -57,7 +59,12 @@ func newRunCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "run -- COMMAND [ARGS...]",
 		Short: "Run command with environment variables",
-		Long:  `Run a command with environment variables loaded from VaultEnv.`,
+		Long: `Run a command with environment variables loaded from VaultEnv.
+
+Variables holding files stored with 'vaultenv set-file' are written to
+files readable only by you in a private temporary directory, and the
+variable is set to the path of the file. The directory is removed when
+the command exits.`,
 
 		Example: `  # Run npm start with development variables
   vaultenv run -- npm start
@@ -72,7 +79,7 @@ func newRunCommand() *cobra.Command {
 			if len(args) == 0 {
 				return fmt.Errorf("no command specified. Use -- before the command")
 			}
-			return runWithEnv(environment, args)
+			return runWithEnv(commandContext(cmd), environment, args)
 		},
 	}
 
@@ -83,7 +90,7 @@ func newRunCommand() *cobra.Command {
 
 // Implementation functions
 
-func runShell(environment, shellType string) error {
+func runShell(ctx context.Context, environment, shellType string) error {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -101,7 +108,7 @@ func runShell(environment, shellType string) error {
 	}
 
 	// Get environment variables
-	vars, err := getEnvironmentVariables(cfg, environment)
+	vars, err := getEnvironmentVariables(ctx, cfg, environment)
 	if err != nil {
 		return fmt.Errorf("failed to get environment variables: %w", err)
 	}
@@ -117,7 +124,7 @@ func runShell(environment, shellType string) error {
 	return nil
 }
 
-func runWithEnv(environment string, args []string) error {
+func runWithEnv(ctx context.Context, environment string, args []string) error {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -130,7 +137,7 @@ func runWithEnv(environment string, args []string) error {
 	}
 
 	// Get environment variables
-	vars, err := getEnvironmentVariables(cfg, environment)
+	vars, err := getEnvironmentVariables(ctx, cfg, environment)
 	if err != nil {
 		return fmt.Errorf("failed to get environment variables: %w", err)
 	}
@@ -140,6 +147,13 @@ func runWithEnv(environment string, args []string) error {
 		return fmt.Errorf("no command specified")
 	}
 
+	// Stored files are handed to the command as paths to private copies
+	cleanup, err := materializeFiles(vars)
+	if err != nil {
+		return fmt.Errorf("failed to write file variables: %w", err)
+	}
+	defer cleanup()
+
 	cmdName := args[0]
 	cmdArgs := args[1:]
 
@@ -158,9 +172,16 @@ func runWithEnv(environment string, args []string) error {
 	cmd.Stderr = os.Stderr
 
 	// Run command
-	err = cmd.Run()
+	err = cmd.Start()
+	if err == nil {
+		stop := forwardSignals(cmd.Process)
+		err = cmd.Wait()
+		stop()
+	}
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
+			// os.Exit skips deferred calls
+			cleanup()
 			os.Exit(exitError.ExitCode())
 		}
 		return fmt.Errorf("failed to run command: %w", err)
@@ -230,28 +251,26 @@ func generateShellCommands(vars map[string]string, shellType string) []string {
 	return commands
 }
 
-func getEnvironmentVariables(cfg *config.Config, environment string) (map[string]string, error) {
+func getEnvironmentVariables(ctx context.Context, cfg *config.Config, environment string) (map[string]string, error) {
 	// Check if we're in a test environment
 	isTest := isTestEnvironment()
 
 	// Create backend options
-	opts := storage.BackendOptions{
-		Environment: environment,
-		Type:        cfg.Vault.Type,
-		BasePath:    cfg.Vault.Path,
-	}
+	opts := vaultBackendOptions(cfg, environment)
 
 	// Handle authentication if not in test mode
+	var pm *auth.PasswordManager
 	if !isTest && cfg.Vault.IsEncrypted() {
-		ks, err := keystore.NewKeystore(cfg.Vault.Path)
+		ks, err := openVaultKeystore(cfg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize keystore: %w", err)
 		}
+		defer ks.Close()
 
-		pm := auth.NewPasswordManager(ks, cfg)
+		pm = auth.NewPasswordManager(ks, cfg)
 
-		// Get or create encryption key
-		key, err := pm.GetOrCreateMasterKey(cfg.Project.ID)
+		// Get or create the data key of the environment
+		key, err := pm.GetOrCreateDataKey(environment)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get encryption key: %w", err)
 		}
@@ -267,22 +286,34 @@ func getEnvironmentVariables(cfg *config.Config, environment string) (map[string
 	}
 	defer store.Close()
 
-	// Get all variable keys
-	keys, err := store.List()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list variables: %w", err)
-	}
-
-	// Get all variable values
-	vars := make(map[string]string)
-	for _, key := range keys {
-		value, err := store.Get(key)
-		if err != nil {
-			ui.Warning("Failed to get variable '%s': %v", key, err)
-			continue
+	// Read all variables at once; the ones that cannot be read are skipped
+	vars, err := storage.GetAll(ctx, store)
+	var readErrs storage.ReadErrors
+	if errors.As(err, &readErrs) {
+		failed := make([]string, 0, len(readErrs))
+		for key := range readErrs {
+			failed = append(failed, key)
+		}
+		sort.Strings(failed)
+		for _, key := range failed {
+			ui.Warning("Failed to get variable '%s': %v", key, readErrs[key])
 		}
-		vars[key] = value
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read variables: %w", err)
 	}
 
-	return vars, nil
+	// Referenced environments are opened with their own key
+	return resolveReferences(ctx, cfg, environment, store,
+		func(env string) (storage.Backend, error) {
+			envOpts := opts
+			envOpts.Environment = env
+			if pm != nil {
+				key, err := pm.GetOrCreateDataKey(env)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get encryption key: %w", err)
+				}
+				envOpts.Password = string(key)
+			}
+			return storage.GetBackendWithOptions(envOpts)
+		}, vars)
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -317,7 +318,7 @@ func TestGetEnvironmentVariables(t *testing.T) {
 				}()
 			}
 
-			vars, err := getEnvironmentVariables(cfg, tt.environment)
+			vars, err := getEnvironmentVariables(context.Background(), cfg, tt.environment)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -428,7 +429,7 @@ func TestRunShell(t *testing.T) {
 			r, w, _ := os.Pipe()
 			os.Stdout = w
 
-			err := runShell(tt.environment, tt.shellType)
+			err := runShell(context.Background(), tt.environment, tt.shellType)
 
 			// Restore stdout
 			w.Close()
@@ -552,7 +553,7 @@ func TestRunWithEnv(t *testing.T) {
 				defer tt.cleanup()
 			}
 
-			err := runWithEnv(tt.environment, tt.args)
+			err := runWithEnv(context.Background(), tt.environment, tt.args)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -930,7 +931,7 @@ func TestRunShellConfigLoadFailure(t *testing.T) {
 		}
 	}()
 
-	err = runShell("development", "bash")
+	err = runShell(context.Background(), "development", "bash")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to load config")
 }
@@ -976,7 +977,7 @@ func TestRunWithEnvLargeEnvironment(t *testing.T) {
 	}
 
 	// Run a simple command with large environment
-	err = runWithEnv("development", []string{"echo", "test"})
+	err = runWithEnv(context.Background(), "development", []string{"echo", "test"})
 	assert.NoError(t, err)
 }
 
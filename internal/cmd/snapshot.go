@@ -0,0 +1,539 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/snapshot"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "snapshot",
+		Aliases: []string{"snapshots"},
+		Short:   "Create and restore snapshots of environments",
+		Long: `Create, inspect and restore snapshots of the variables of one or
+all environments.
+
+Snapshots are encrypted with the snapshot key of the vault and
+checksummed, so damaged files are detected before anything is restored.
+They are kept in vault.backup_path and pruned after vault.backup_retention
+days. When vault.backup_enabled is set, a snapshot is taken automatically
+before 'env delete', 'migrate', 'security rotate-keys' and
+'batch import-all'.`,
+	}
+
+	cmd.AddCommand(
+		newSnapshotCreateCommand(),
+		newSnapshotListCommand(),
+		newSnapshotShowCommand(),
+		newSnapshotRestoreCommand(),
+		newSnapshotPruneCommand(),
+	)
+
+	return cmd
+}
+
+func newSnapshotCreateCommand() *cobra.Command {
+	var (
+		environments []string
+		reason       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Take a snapshot",
+		Long:  `Take a snapshot of the variables and metadata of one or all environments.`,
+
+		Example: `  # Snapshot every environment
+  vaultenv snapshot create
+
+  # Snapshot production before a manual change
+  vaultenv snapshot create --env production -m "before rotating the API token"`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshotCreate(environments, reason)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&environments, "env", "e", nil, "environments to snapshot (default all)")
+	cmd.Flags().StringVarP(&reason, "reason", "m", "manual", "note stored with the snapshot")
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func newSnapshotListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List snapshots",
+		Long:  `List the snapshots of the vault, newest first.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshotList()
+		},
+	}
+}
+
+func newSnapshotShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show ID",
+		Short: "Show the contents of a snapshot",
+		Long: `Verify a snapshot and list the variables it holds per environment.
+Values are not shown. ID may be a unique prefix or "latest".`,
+
+		Example: `  # Show the newest snapshot
+  vaultenv snapshot show latest`,
+
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshotShow(args[0])
+		},
+	}
+}
+
+func newSnapshotRestoreCommand() *cobra.Command {
+	var (
+		environments []string
+		force        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "restore ID",
+		Short: "Restore environments from a snapshot",
+		Long: `Replace the variables of the environments in a snapshot with the
+captured ones. Variables added since the snapshot are moved to the trash,
+and environments deleted since are created again. A snapshot of the
+current state is taken first when vault.backup_enabled is set.
+
+ID may be a unique prefix or "latest".`,
+
+		Example: `  # Restore everything from the newest snapshot
+  vaultenv snapshot restore latest
+
+  # Restore only production without confirmation
+  vaultenv snapshot restore 20240115T093000Z --env production --force`,
+
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshotRestore(args[0], environments, force)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&environments, "env", "e", nil, "environments to restore (default all in the snapshot)")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "skip confirmation prompt")
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func newSnapshotPruneCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "prune",
+		Short: "Remove expired snapshots",
+		Long: `Remove the snapshots older than vault.backup_retention days. The
+newest snapshot is always kept.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshotPrune()
+		},
+	}
+}
+
+func runSnapshotCreate(environments []string, reason string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if len(environments) == 0 {
+		environments = cfg.GetEnvironmentNames()
+	}
+	for _, env := range environments {
+		if !cfg.HasEnvironment(env) {
+			return fmt.Errorf("environment '%s' does not exist", env)
+		}
+	}
+
+	info, err := takeSnapshot(cfg, cfg.Vault.Type, reason, environments)
+	if err != nil {
+		return err
+	}
+
+	ui.Success("Created snapshot %s of %d variable(s) in %s",
+		info.ID, info.Variables, strings.Join(info.Environments, ", "))
+
+	pruneSnapshots(cfg)
+	return nil
+}
+
+func runSnapshotList() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	infos, err := snapshotStore(cfg, nil).List()
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if len(infos) == 0 {
+		ui.Info("No snapshots found")
+		return nil
+	}
+
+	ui.Header("Snapshots")
+
+	rows := make([][]string, 0, len(infos))
+	for _, info := range infos {
+		rows = append(rows, []string{
+			info.ID,
+			info.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			info.CreatedBy,
+			strings.Join(info.Environments, ", "),
+			fmt.Sprintf("%d", info.Variables),
+			info.Reason,
+		})
+	}
+	ui.Table([]string{"ID", "CREATED", "BY", "ENVIRONMENTS", "VARIABLES", "REASON"}, rows)
+
+	return nil
+}
+
+func runSnapshotShow(id string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	s, err := loadSnapshot(cfg, id)
+	if err != nil {
+		return err
+	}
+
+	ui.Header(fmt.Sprintf("Snapshot %s", s.Info.ID))
+	fmt.Printf("  Created:   %s by %s\n", s.Info.CreatedAt.Local().Format("2006-01-02 15:04:05"), s.Info.CreatedBy)
+	fmt.Printf("  Reason:    %s\n", s.Info.Reason)
+	fmt.Printf("  Vault:     %s\n", s.Info.VaultType)
+	fmt.Printf("  Encrypted: %t\n", s.Info.Encrypted)
+	fmt.Printf("  Checksum:  %s (verified)\n", s.Info.Checksum)
+
+	for _, env := range s.Info.Environments {
+		fmt.Println()
+		vars := s.Environments[env].Variables
+		ui.Info("%s (%d variables)", env, len(vars))
+
+		keys := make([]string, 0, len(vars))
+		for key := range vars {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  • %s\n", key)
+		}
+	}
+
+	return nil
+}
+
+func runSnapshotRestore(id string, environments []string, force bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	s, err := loadSnapshot(cfg, id)
+	if err != nil {
+		return err
+	}
+
+	if s.Info.VaultType != cfg.Vault.Type {
+		return fmt.Errorf("snapshot %s was taken of a %s vault, the vault is now %s; migrate back to %s storage first",
+			s.Info.ID, s.Info.VaultType, cfg.Vault.Type, s.Info.VaultType)
+	}
+
+	if len(environments) == 0 {
+		environments = s.Info.Environments
+	}
+	for _, env := range environments {
+		if _, ok := s.Environments[env]; !ok {
+			return fmt.Errorf("snapshot %s does not contain environment '%s'", s.Info.ID, env)
+		}
+	}
+
+	if !force && !ui.Confirm(fmt.Sprintf("Replace the variables of %s with snapshot %s?",
+		strings.Join(environments, ", "), s.Info.ID)) {
+		ui.Info("Restore cancelled")
+		return nil
+	}
+
+	// Keep the current state of the environments that still exist
+	var existing []string
+	for _, env := range environments {
+		if cfg.HasEnvironment(env) {
+			existing = append(existing, env)
+		}
+	}
+	if err := autoSnapshot(cfg, cfg.Vault.Type, "before snapshot restore", existing); err != nil {
+		return err
+	}
+
+	// Environments deleted since the snapshot are created again
+	created := false
+	for _, env := range environments {
+		if !cfg.HasEnvironment(env) {
+			cfg.SetEnvironmentConfig(env, config.EnvironmentConfig{
+				Description: fmt.Sprintf("Restored from snapshot %s", s.Info.ID),
+			})
+			created = true
+		}
+	}
+	if created {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config after creating environment: %w", err)
+		}
+	}
+
+	for _, env := range environments {
+		store, err := storage.GetBackendWithOptions(vaultBackendOptions(cfg, env))
+		if err != nil {
+			return fmt.Errorf("failed to get storage for %s: %w", env, err)
+		}
+
+		result, err := s.Restore(env, store)
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", env, err)
+		}
+
+		ui.Success("Restored %s: %d variable(s) set, %d removed", env, result.Set, result.Deleted)
+	}
+
+	return nil
+}
+
+func runSnapshotPrune() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Vault.BackupRetention <= 0 {
+		ui.Info("Snapshots are kept until they are removed, vault.backup_retention is 0")
+		return nil
+	}
+
+	pruned, err := snapshotStore(cfg, nil).Prune(snapshotCutoff(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to prune snapshots: %w", err)
+	}
+
+	ui.Success("Removed %d snapshot(s) older than %d days", len(pruned), cfg.Vault.BackupRetention)
+	return nil
+}
+
+// autoSnapshot takes a snapshot of environments before a destructive
+// command when vault.backup_enabled is set. A failed snapshot aborts the
+// command, so nothing is changed without a way back.
+func autoSnapshot(cfg *config.Config, vaultType, reason string, environments []string) error {
+	if !cfg.Vault.BackupEnabled || len(environments) == 0 {
+		return nil
+	}
+
+	info, err := takeSnapshot(cfg, vaultType, reason, environments)
+	if err != nil {
+		return fmt.Errorf("failed to take a snapshot %s: %w", reason, err)
+	}
+	ui.Info("Saved snapshot %s, undo with 'vaultenv snapshot restore %s'", info.ID, info.ID)
+
+	pruneSnapshots(cfg)
+	return nil
+}
+
+// takeSnapshot captures environments of a vault of the given type
+func takeSnapshot(cfg *config.Config, vaultType, reason string, environments []string) (*snapshot.Info, error) {
+	if caps, err := storage.CapabilitiesOf(vaultType); err == nil && caps.Remote {
+		return nil, fmt.Errorf("snapshots are not supported for %s vaults", vaultType)
+	}
+
+	key, err := snapshotKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Backends are opened without a password so values are captured as
+	// they are stored
+	s, err := snapshot.Capture(environments, func(env string) (storage.Backend, error) {
+		return storage.GetBackendWithOptions(backendOptionsForType(cfg, vaultType, env))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture snapshot: %w", err)
+	}
+
+	info, err := snapshotStore(cfg, key).Save(s, reason, vaultType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	return info, nil
+}
+
+// loadSnapshot resolves id and reads the snapshot, unlocking the vault
+// when the snapshot is encrypted
+func loadSnapshot(cfg *config.Config, id string) (*snapshot.Snapshot, error) {
+	info, err := snapshotStore(cfg, nil).Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var key, legacyKey []byte
+	if info.Encrypted {
+		if key, legacyKey, err = snapshotKeys(cfg, true); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := snapshotStore(cfg, key).WithLegacyKey(legacyKey).Load(info.ID)
+	if errors.Is(err, snapshot.ErrKeyRequired) {
+		if key != nil {
+			return nil, fmt.Errorf("snapshot %s was taken before the vault had a snapshot key and is encrypted for another password or identity", info.ID)
+		}
+		return nil, fmt.Errorf("snapshot %s is encrypted but the vault is not", info.ID)
+	}
+	return s, err
+}
+
+// pruneSnapshots removes snapshots past vault.backup_retention. Failing
+// to prune never fails the command that took the snapshot.
+func pruneSnapshots(cfg *config.Config) {
+	if cfg.Vault.BackupRetention <= 0 {
+		return
+	}
+
+	pruned, err := snapshotStore(cfg, nil).Prune(snapshotCutoff(cfg))
+	if err != nil {
+		ui.Warning("Failed to prune snapshots: %v", err)
+		return
+	}
+	if len(pruned) > 0 {
+		ui.Debug("Pruned %d snapshot(s) older than %d days", len(pruned), cfg.Vault.BackupRetention)
+	}
+}
+
+func snapshotCutoff(cfg *config.Config) time.Time {
+	return time.Now().AddDate(0, 0, -cfg.Vault.BackupRetention)
+}
+
+// snapshotStore returns the snapshots of the vault, kept in
+// vault.backup_path or the backups directory of the vault
+func snapshotStore(cfg *config.Config, key []byte) *snapshot.Store {
+	dir := cfg.Vault.BackupPath
+	if dir == "" {
+		dir = filepath.Join(cfg.Vault.Path, "backups")
+	}
+	return snapshot.NewStore(dir, key)
+}
+
+// snapshotKey returns the key snapshots are encrypted with, derived from
+// the snapshot key of the vault; nil when the vault is not encrypted
+func snapshotKey(cfg *config.Config) ([]byte, error) {
+	key, _, err := snapshotKeys(cfg, false)
+	return key, err
+}
+
+// rotateSnapshots re-encrypts the values of an environment captured by
+// snapshots from the data key of one backend to that of another, so the
+// snapshots still restore once the old key is discarded. Snapshots that
+// cannot be decrypted are left as they are, with a warning. It returns the
+// number of snapshots rewritten.
+func rotateSnapshots(cfg *config.Config, pm *auth.PasswordManager, environment string, from, to storage.Backend) (int, error) {
+	var key, legacyKey []byte
+	if !isTestEnvironment() && cfg.Vault.IsEncrypted() {
+		var err error
+		if key, legacyKey, err = unlockSnapshotKeys(pm, true); err != nil {
+			return 0, err
+		}
+	}
+
+	store := snapshotStore(cfg, key).WithLegacyKey(legacyKey)
+	infos, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, info := range infos {
+		if !slices.Contains(info.Environments, environment) {
+			continue
+		}
+
+		s, err := store.Load(info.ID)
+		if err != nil {
+			ui.Warning("Snapshot %s is not re-encrypted and will not restore '%s': %v", info.ID, environment, err)
+			continue
+		}
+
+		count, err := storage.RotateValues(from, to, s.Environments[environment].Variables)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to re-encrypt snapshot %s: %w", info.ID, err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		if err := store.Rewrite(s); err != nil {
+			return rewritten, fmt.Errorf("failed to re-encrypt snapshot %s: %w", info.ID, err)
+		}
+		rewritten++
+	}
+
+	return rewritten, nil
+}
+
+// snapshotKeys returns the snapshot key and, with legacy set, the key of
+// snapshots taken before the vault had one, derived from the password key
+// or, in vaults with recipients, the local identity. The legacy key is nil
+// if it cannot be unlocked; only those older snapshots need it.
+func snapshotKeys(cfg *config.Config, legacy bool) ([]byte, []byte, error) {
+	if isTestEnvironment() || !cfg.Vault.IsEncrypted() {
+		return nil, nil, nil
+	}
+
+	ks, err := openVaultKeystore(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize keystore: %w", err)
+	}
+	defer ks.Close()
+
+	return unlockSnapshotKeys(auth.NewPasswordManager(ks, cfg), legacy)
+}
+
+// unlockSnapshotKeys is snapshotKeys with the keys unlocked by pm
+func unlockSnapshotKeys(pm *auth.PasswordManager, legacy bool) ([]byte, []byte, error) {
+	key, err := pm.GetOrCreateSnapshotKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get snapshot key: %w", err)
+	}
+	if !legacy {
+		return snapshot.DeriveKey(key), nil, nil
+	}
+
+	localKey, err := pm.GetOrCreateLocalKey()
+	if err != nil {
+		ui.Debug("Failed to unlock the key of older snapshots: %v", err)
+		return snapshot.DeriveKey(key), nil, nil
+	}
+
+	return snapshot.DeriveKey(key), snapshot.DeriveKey(localKey), nil
+}
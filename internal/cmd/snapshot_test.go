@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/snapshot"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func TestSnapshotCreateAndRestore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "vaultenv-snapshot-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	backend, err := storage.NewFileBackend(tmpDir, "development")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	storage.SetTestBackend(backend)
+	defer storage.ResetTestBackend()
+
+	backend.Set("API_KEY", "secret", false)
+	backend.Set("DEBUG", "true", false)
+
+	if err := runSnapshotCreate([]string{"development"}, "manual"); err != nil {
+		t.Fatalf("runSnapshotCreate() error = %v", err)
+	}
+	if err := runSnapshotCreate([]string{"qa"}, "manual"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("runSnapshotCreate() for unknown environment error = %v", err)
+	}
+
+	cfg, _ := config.Load()
+	infos, err := snapshotStore(cfg, nil).List()
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("snapshots = %+v, %v", infos, err)
+	}
+	id := infos[0].ID
+
+	if err := runSnapshotList(); err != nil {
+		t.Errorf("runSnapshotList() error = %v", err)
+	}
+	if err := runSnapshotShow("latest"); err != nil {
+		t.Errorf("runSnapshotShow() error = %v", err)
+	}
+
+	backend.Set("API_KEY", "changed", false)
+	backend.Delete("DEBUG")
+	backend.Set("EXTRA", "value", false)
+
+	if err := runSnapshotRestore(id[:8], nil, true); err != nil {
+		t.Fatalf("runSnapshotRestore() error = %v", err)
+	}
+	if value, _ := backend.Get("API_KEY"); value != "secret" {
+		t.Errorf("API_KEY after restore = %q", value)
+	}
+	if value, _ := backend.Get("DEBUG"); value != "true" {
+		t.Errorf("DEBUG after restore = %q", value)
+	}
+	if exists, _ := backend.Exists("EXTRA"); exists {
+		t.Error("EXTRA still exists after restore")
+	}
+
+	// The state before the restore was kept as well
+	infos, _ = snapshotStore(cfg, nil).List()
+	if len(infos) != 2 || infos[0].Reason != "before snapshot restore" {
+		t.Fatalf("snapshots after restore = %+v", infos)
+	}
+	before, err := snapshotStore(cfg, nil).Load(infos[0].ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if before.Environments["development"].Variables["EXTRA"] != "value" {
+		t.Errorf("pre-restore snapshot = %+v", before.Environments["development"])
+	}
+
+	if err := runSnapshotShow("nonexistent"); !errors.Is(err, snapshot.ErrNotFound) {
+		t.Errorf("runSnapshotShow() of unknown snapshot error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAutoSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	backend, err := storage.NewFileBackend(tmpDir, "development")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	storage.SetTestBackend(backend)
+	defer storage.ResetTestBackend()
+
+	backend.Set("API_KEY", "secret", false)
+
+	cfg := config.DefaultConfig()
+	cfg.Vault.BackupPath = tmpDir + "/backups"
+
+	cfg.Vault.BackupEnabled = false
+	if err := autoSnapshot(cfg, cfg.Vault.Type, "before env delete", []string{"development"}); err != nil {
+		t.Fatalf("autoSnapshot() error = %v", err)
+	}
+	if infos, _ := snapshotStore(cfg, nil).List(); len(infos) != 0 {
+		t.Errorf("snapshot taken with backups disabled: %+v", infos)
+	}
+
+	cfg.Vault.BackupEnabled = true
+	if err := autoSnapshot(cfg, cfg.Vault.Type, "before env delete", []string{"development"}); err != nil {
+		t.Fatalf("autoSnapshot() error = %v", err)
+	}
+	infos, _ := snapshotStore(cfg, nil).List()
+	if len(infos) != 1 || infos[0].Reason != "before env delete" || infos[0].Variables != 1 {
+		t.Errorf("snapshots = %+v", infos)
+	}
+
+	if err := autoSnapshot(cfg, "cloud", "before migrate", []string{"development"}); err == nil {
+		t.Error("autoSnapshot() of a remote vault succeeded")
+	}
+}
+
+func TestRotateKeysKeepsSnapshotsRestorable(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("VAULTENV_TEST", "")
+	t.Setenv("VAULTENV_PASSWORD", "rotate-snapshot-password")
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// setValue stores a value encrypted with the current data key
+	setValue := func(value string) {
+		t.Helper()
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ks.Close()
+
+		key, err := auth.NewPasswordManager(ks, cfg).GetOrCreateDataKey("development")
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, err := openWithDataKey(cfg, "development", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+
+		if err := store.Set("API_KEY", value, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setValue("secret")
+	if err := runSecurityRotateKeys("development", true); err != nil {
+		t.Fatalf("runSecurityRotateKeys() error = %v", err)
+	}
+	setValue("changed")
+
+	infos, err := snapshotStore(cfg, nil).List()
+	if err != nil || len(infos) != 1 || infos[0].Reason != "before rotate-keys" {
+		t.Fatalf("snapshots = %+v, %v", infos, err)
+	}
+	if err := runSnapshotRestore(infos[0].ID, []string{"development"}, true); err != nil {
+		t.Fatalf("runSnapshotRestore() error = %v", err)
+	}
+
+	ks, err := openVaultKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+
+	value, err := readEnvironmentVariables(context.Background(), cfg, auth.NewPasswordManager(ks, cfg), "development")
+	if err != nil {
+		t.Fatalf("readEnvironmentVariables() after restore error = %v", err)
+	}
+	if value["API_KEY"] != "secret" {
+		t.Errorf("API_KEY after restore = %q, want secret", value["API_KEY"])
+	}
+}
@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newDeleteCommand() *cobra.Command {
+	var (
+		environment string
+		force       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:     "delete KEY [KEY...]",
+		Aliases: []string{"rm", "unset"},
+		Short:   "Delete variables",
+		Long: `Delete variables from an environment.
+
+Deleted variables are moved to the trash of the environment and can be
+brought back with 'vaultenv undelete' until they are purged. Variables
+are purged once they have been in the trash longer than
+vault.trash_retention (30 days by default).`,
+
+		Example: `  # Delete a variable
+  vaultenv delete OLD_API_KEY
+
+  # Delete several variables in production without confirmation
+  vaultenv delete LEGACY_URL LEGACY_TOKEN --env production --force`,
+
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDelete(args, environment, force)
+		},
+	}
+
+	cmd.Flags().StringVarP(&environment, "env", "e", "development", "environment to delete variables from")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "skip confirmation prompt")
+
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+	cmd.ValidArgsFunction = variableNameCompletion
+
+	return cmd
+}
+
+func newUndeleteCommand() *cobra.Command {
+	var environment string
+
+	cmd := &cobra.Command{
+		Use:   "undelete KEY [KEY...]",
+		Short: "Bring back deleted variables from the trash",
+		Long: `Move deleted variables from the trash back into the environment.
+
+A variable cannot be undeleted while a variable with the same name
+exists; delete or rename that one first.`,
+
+		Example: `  # Bring back a deleted variable
+  vaultenv undelete OLD_API_KEY
+
+  # Undelete in production
+  vaultenv undelete DATABASE_URL --env production`,
+
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUndelete(args, environment)
+		},
+	}
+
+	cmd.Flags().StringVarP(&environment, "env", "e", "development", "environment to undelete variables in")
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func newTrashCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "Manage deleted variables",
+		Long: `List and purge the variables deleted from an environment.
+
+Deleted variables stay in the trash for vault.trash_retention (30 days
+by default) and can be brought back with 'vaultenv undelete' until then.
+A retention of 0 keeps them until 'vaultenv trash purge --all'.`,
+	}
+
+	cmd.AddCommand(
+		newTrashListCommand(),
+		newTrashPurgeCommand(),
+	)
+
+	return cmd
+}
+
+func newTrashListCommand() *cobra.Command {
+	var environment string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List deleted variables",
+		Long:  `List the variables in the trash of an environment with when and by whom they were deleted.`,
+
+		Example: `  # List deleted variables
+  vaultenv trash list
+
+  # List deleted variables in production
+  vaultenv trash list --env production`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTrashList(environment)
+		},
+	}
+
+	cmd.Flags().StringVarP(&environment, "env", "e", "development", "environment to use")
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func newTrashPurgeCommand() *cobra.Command {
+	var (
+		environment string
+		all         bool
+		force       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Permanently remove deleted variables",
+		Long: `Permanently remove the variables that have been in the trash longer
+than vault.trash_retention. With --all the whole trash is emptied.`,
+
+		Example: `  # Remove variables past the retention period
+  vaultenv trash purge
+
+  # Empty the trash of production without confirmation
+  vaultenv trash purge --all --env production --force`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTrashPurge(environment, all, force)
+		},
+	}
+
+	cmd.Flags().StringVarP(&environment, "env", "e", "development", "environment to use")
+	cmd.Flags().BoolVar(&all, "all", false, "remove every deleted variable, not only expired ones")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "skip confirmation prompt")
+	cmd.RegisterFlagCompletionFunc("env", environmentCompletion)
+
+	return cmd
+}
+
+func runDelete(keys []string, environment string, force bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, _, err := openTrash(cfg, environment)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var existing []string
+	for _, key := range keys {
+		exists, err := store.Exists(key)
+		if err != nil {
+			return fmt.Errorf("failed to check variable: %w", err)
+		}
+		if !exists {
+			ui.Warning("Variable %s not found in %s", key, environment)
+			continue
+		}
+		existing = append(existing, key)
+	}
+
+	if len(existing) == 0 {
+		return nil
+	}
+
+	if !force && !ui.Confirm(fmt.Sprintf("Delete %d variable(s) from %s?", len(existing), environment)) {
+		ui.Info("Delete cancelled")
+		return nil
+	}
+
+	for _, key := range existing {
+		if err := store.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+		ui.Success("Deleted %s", key)
+	}
+
+	ui.Info("Deleted variables can be brought back with 'vaultenv undelete KEY --env %s'%s",
+		environment, retentionNote(cfg.Vault.TrashRetention))
+
+	return nil
+}
+
+func runUndelete(keys []string, environment string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, _, err := openTrash(cfg, environment)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, key := range keys {
+		err := store.Undelete(key)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return fmt.Errorf("variable %s is not in the trash of %s", key, environment)
+		case errors.Is(err, storage.ErrAlreadyExists):
+			return fmt.Errorf("cannot undelete %s: a variable with the same name exists in %s", key, environment)
+		case err != nil:
+			return fmt.Errorf("failed to undelete %s: %w", key, err)
+		}
+
+		ui.Success("Undeleted %s", key)
+	}
+
+	return nil
+}
+
+func runTrashList(environment string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, _, err := openTrash(cfg, environment)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	trash, err := store.ListTrash()
+	if err != nil {
+		return fmt.Errorf("failed to list trash: %w", err)
+	}
+
+	if len(trash) == 0 {
+		ui.Info("The trash of %s is empty", environment)
+		return nil
+	}
+
+	ui.Header(fmt.Sprintf("Deleted variables in %s", environment))
+
+	rows := make([][]string, 0, len(trash))
+	for _, t := range trash {
+		expires := "never"
+		if cfg.Vault.TrashRetention > 0 {
+			expires = t.DeletedAt.Add(cfg.Vault.TrashRetention).Local().Format("2006-01-02 15:04:05")
+		}
+		rows = append(rows, []string{
+			t.Key,
+			t.DeletedAt.Local().Format("2006-01-02 15:04:05"),
+			t.DeletedBy,
+			expires,
+		})
+	}
+	ui.Table([]string{"KEY", "DELETED", "BY", "PURGED AFTER"}, rows)
+
+	return nil
+}
+
+func runTrashPurge(environment string, all, force bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, expired, err := openTrash(cfg, environment)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if !all {
+		if cfg.Vault.TrashRetention <= 0 {
+			ui.Info("Deleted variables are kept until the trash is purged; use --all to empty the trash")
+			return nil
+		}
+
+		ui.Success("Permanently removed %d variable(s) deleted from %s more than %s ago",
+			expired, environment, retentionDays(cfg.Vault.TrashRetention))
+		return nil
+	}
+
+	trash, err := store.ListTrash()
+	if err != nil {
+		return fmt.Errorf("failed to list trash: %w", err)
+	}
+	if len(trash) == 0 {
+		ui.Info("The trash of %s is empty", environment)
+		return nil
+	}
+
+	if !force && !ui.Confirm(fmt.Sprintf("Permanently remove %d deleted variable(s) from %s?", len(trash), environment)) {
+		ui.Info("Purge cancelled")
+		return nil
+	}
+
+	// Everything deleted up to now; later deletes are not part of the listing
+	purged, err := store.PurgeTrash(time.Now().Add(time.Second))
+	if err != nil {
+		return fmt.Errorf("failed to purge trash: %w", err)
+	}
+
+	ui.Success("Permanently removed %d variable(s) from the trash of %s", purged, environment)
+	return nil
+}
+
+// openTrash opens the backend of an environment for the trash commands.
+// Variables that have been in the trash longer than vault.trash_retention
+// are purged first, so they can no longer be listed or undeleted; the
+// number of purged variables is returned.
+func openTrash(cfg *config.Config, environment string) (storage.TrashBackend, int, error) {
+	if !cfg.HasEnvironment(environment) {
+		return nil, 0, fmt.Errorf("environment '%s' does not exist", environment)
+	}
+
+	opts := vaultBackendOptions(cfg, environment)
+
+	if !isTestEnvironment() && cfg.Vault.IsEncrypted() {
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to initialize keystore: %w", err)
+		}
+
+		key, err := auth.NewPasswordManager(ks, cfg).GetOrCreateDataKey(environment)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get encryption key: %w", err)
+		}
+		opts.Password = string(key)
+	}
+
+	store, err := storage.GetBackendWithOptions(opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get storage backend: %w", err)
+	}
+
+	tb, ok := storage.AsTrashBackend(store)
+	if !ok {
+		store.Close()
+		return nil, 0, fmt.Errorf("current storage backend (%s) does not support a trash", cfg.Vault.Type)
+	}
+
+	if cfg.Vault.TrashRetention <= 0 {
+		return tb, 0, nil
+	}
+
+	purged, err := tb.PurgeTrash(time.Now().Add(-cfg.Vault.TrashRetention))
+	if err != nil {
+		store.Close()
+		return nil, 0, fmt.Errorf("failed to purge expired variables: %w", err)
+	}
+	if purged > 0 {
+		ui.Debug("Purged %d variable(s) deleted more than %s ago", purged, retentionDays(cfg.Vault.TrashRetention))
+	}
+
+	return tb, purged, nil
+}
+
+// retentionNote describes how long deleted variables are kept
+func retentionNote(retention time.Duration) string {
+	if retention <= 0 {
+		return " until the trash is purged"
+	}
+	return " for " + retentionDays(retention)
+}
+
+// retentionDays formats a retention period, in days when it is whole days
+func retentionDays(retention time.Duration) string {
+	if retention%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", retention/(24*time.Hour))
+	}
+	return retention.String()
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func TestDeleteAndUndelete(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "vaultenv-trash-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	backend, err := storage.NewFileBackend(tmpDir, "development")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	storage.SetTestBackend(backend)
+	defer storage.ResetTestBackend()
+
+	backend.Set("API_KEY", "secret", false)
+	backend.Set("DEBUG", "true", false)
+
+	if err := runDelete([]string{"API_KEY", "MISSING"}, "development", true); err != nil {
+		t.Fatalf("runDelete() error = %v", err)
+	}
+	if exists, _ := backend.Exists("API_KEY"); exists {
+		t.Fatal("API_KEY still exists after delete")
+	}
+	if trash, _ := backend.ListTrash(); len(trash) != 1 || trash[0].Key != "API_KEY" {
+		t.Fatalf("trash = %+v", trash)
+	}
+	if err := runTrashList("development"); err != nil {
+		t.Errorf("runTrashList() error = %v", err)
+	}
+
+	if err := runUndelete([]string{"API_KEY"}, "development"); err != nil {
+		t.Fatalf("runUndelete() error = %v", err)
+	}
+	if value, _ := backend.Get("API_KEY"); value != "secret" {
+		t.Errorf("API_KEY after undelete = %q", value)
+	}
+
+	if err := runUndelete([]string{"API_KEY"}, "development"); err == nil || !strings.Contains(err.Error(), "not in the trash") {
+		t.Errorf("runUndelete() of restored variable error = %v", err)
+	}
+
+	// Variables within the retention period are only removed with --all
+	runDelete([]string{"DEBUG"}, "development", true)
+	if err := runTrashPurge("development", false, true); err != nil {
+		t.Fatalf("runTrashPurge() error = %v", err)
+	}
+	if trash, _ := backend.ListTrash(); len(trash) != 1 {
+		t.Errorf("trash after purge of expired variables = %+v", trash)
+	}
+	if err := runTrashPurge("development", true, true); err != nil {
+		t.Fatalf("runTrashPurge(--all) error = %v", err)
+	}
+	if trash, _ := backend.ListTrash(); len(trash) != 0 {
+		t.Errorf("trash after purge --all = %+v", trash)
+	}
+
+	if err := runTrashList("qa"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("runTrashList() for unknown environment error = %v", err)
+	}
+
+	storage.SetTestBackend(storage.NewMemoryBackend())
+	if err := runTrashList("development"); err == nil || !strings.Contains(err.Error(), "does not support a trash") {
+		t.Errorf("runTrashList() on memory backend error = %v", err)
+	}
+}
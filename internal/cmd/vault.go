@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/vaultenv/vaultenv-cli/internal/auth"
+	"github.com/vaultenv/vaultenv-cli/internal/config"
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newVaultCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vault",
+		Short: "Manage the vault storage",
+		Long: `Manage the storage of the vault itself.
+
+Every vault records the version of its on-disk format. A newer vaultenv
+records the format of an older vault when it opens it, but refuses to
+open a vault whose migration rewrites data until 'vault upgrade' has
+migrated it. An older vaultenv refuses to open a vault written by a newer
+version.`,
+	}
+
+	cmd.AddCommand(newVaultUpgradeCommand())
+	cmd.AddCommand(newVaultRekeyCommand())
+
+	return cmd
+}
+
+func newVaultUpgradeCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade the vault to the current format",
+		Long: `Apply the format migrations the vault is missing, in order.
+
+Migrations that only record the format are applied when a vault is
+opened; commands refuse a vault with migrations that rewrite its data
+until this has run. Once upgraded, older versions
+of vaultenv can no longer open the vault, so upgrade every checkout of a
+git vault together. With --dry-run the pending migrations and the
+changes they would make are shown without changing anything.`,
+
+		Example: `  # Show what an upgrade would change
+  vaultenv vault upgrade --dry-run
+
+  # Upgrade the vault
+  vaultenv vault upgrade`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVaultUpgrade(dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show pending migrations without applying them")
+
+	return cmd
+}
+
+func runVaultUpgrade(dryRun bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	opts := vaultBackendOptions(cfg, "")
+
+	status, err := storage.InspectFormat(opts)
+	if errors.Is(err, storage.ErrFormatNotSupported) {
+		ui.Info("%s vaults are stored on the server and have no local format", cfg.Vault.Type)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect vault: %w", err)
+	}
+
+	if status.Version > status.Latest {
+		return fmt.Errorf("%w: %s vault format %d, this version supports up to %d; upgrade vaultenv",
+			storage.ErrFormatTooNew, cfg.Vault.Type, status.Version, status.Latest)
+	}
+
+	if len(status.Pending) == 0 {
+		ui.Success("Vault is up to date (%s format %d)", cfg.Vault.Type, status.Version)
+		return nil
+	}
+
+	ui.Header(fmt.Sprintf("Upgrading %s vault from format %d to %d", cfg.Vault.Type, status.Version, status.Latest))
+	for _, m := range status.Pending {
+		fmt.Printf("  %d: %s\n", m.Version, m.Description)
+		for _, change := range m.Changes {
+			fmt.Printf("     • %s\n", change)
+		}
+		if len(m.Changes) == 0 {
+			fmt.Println("     • nothing to change, the format version is recorded")
+		}
+	}
+
+	if dryRun {
+		ui.Info("\n🔍 DRY RUN MODE - No changes were made")
+		return nil
+	}
+
+	applied, err := storage.UpgradeFormat(opts)
+	if err != nil {
+		return fmt.Errorf("failed to upgrade vault: %w", err)
+	}
+
+	ui.Success("Applied %d migration(s), the vault is at format %d", len(applied), status.Latest)
+	return nil
+}
+
+func newVaultRekeyCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt values with the salt of the vault header",
+		Long: `Re-encrypt the values of every environment with a key derived with the
+random salt in the vault header (.vaultenv/vault.json).
+
+Vaults created before vault headers derive their key with a salt shared by
+every vaultenv vault, so vaults with the same password get the same key.
+rekey creates the header if the vault has none and re-encrypts the values
+still encrypted with the shared salt, or with another algorithm than
+vault.encryption_algo. Both kinds of values can be read until then, so an
+interrupted rekey is safely run again.
+
+Commit .vaultenv/vault.json afterwards; without it the vault cannot be
+decrypted.`,
+
+		Example: `  # Show how many values would be re-encrypted
+  vaultenv vault rekey --dry-run
+
+  # Re-encrypt them
+  vaultenv vault rekey`,
+
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVaultRekey(dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show the values to re-encrypt without changing them")
+
+	return cmd
+}
+
+func runVaultRekey(dryRun bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	environments := cfg.GetEnvironmentNames()
+
+	if !dryRun {
+		if err := autoSnapshot(cfg, cfg.Vault.Type, "before vault rekey", environments); err != nil {
+			return err
+		}
+
+		if _, err := storage.InitVaultHeader(cfg.Vault.Path); err != nil {
+			return fmt.Errorf("failed to create vault header: %w", err)
+		}
+	}
+
+	var pm *auth.PasswordManager
+	if !isTestEnvironment() && (cfg.Vault.IsEncrypted() || vaultRequiresPassword(cfg)) {
+		ks, err := openVaultKeystore(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize keystore: %w", err)
+		}
+		defer ks.Close()
+		pm = auth.NewPasswordManager(ks, cfg)
+	}
+
+	total := 0
+	for _, env := range environments {
+		count, err := reencryptEnvironment(cfg, pm, env, dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt %s: %w", env, err)
+		}
+
+		if count > 0 {
+			ui.Info("%s: %d value(s) to re-encrypt", env, count)
+		}
+		total += count
+	}
+
+	switch {
+	case dryRun:
+		ui.Info("\n🔍 DRY RUN MODE - %d value(s) would be re-encrypted", total)
+	case total == 0:
+		ui.Success("All values are encrypted with the salt of the vault header")
+	default:
+		ui.Success("Re-encrypted %d value(s); commit %s/%s", total, cfg.Vault.Path, storage.HeaderFile)
+	}
+
+	return nil
+}
+
+// reencryptEnvironment re-encrypts the values of an environment that are
+// not encrypted the way the configuration asks for, see storage.StaleKeys,
+// in one transaction and returns how many there were
+func reencryptEnvironment(cfg *config.Config, pm *auth.PasswordManager, environment string, dryRun bool) (int, error) {
+	opts := vaultBackendOptions(cfg, environment)
+	if pm != nil {
+		key, err := pm.GetOrCreateDataKey(environment)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get encryption key: %w", err)
+		}
+		opts.Password = string(key)
+	}
+
+	store, err := storage.GetBackendWithOptions(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get storage backend: %w", err)
+	}
+	defer store.Close()
+
+	keys, err := storage.StaleKeys(store)
+	if err != nil {
+		return 0, err
+	}
+	if dryRun || len(keys) == 0 {
+		return len(keys), nil
+	}
+
+	values, err := storage.GetMany(context.Background(), store, keys)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read variables: %w", err)
+	}
+
+	tx, err := storage.BeginTx(store)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range values {
+		if err := tx.Set(key, value, true); err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt variable %s: %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt variables, no changes were made: %w", err)
+	}
+
+	return len(values), nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func TestVaultUpgrade(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file vault written before formats were versioned
+	os.MkdirAll(filepath.Join(".vaultenv", "data"), 0755)
+	os.WriteFile(filepath.Join(".vaultenv", "data", "development.json"), []byte(`{"API_KEY":"secret"}`), 0644)
+	formatFile := filepath.Join(".vaultenv", "data", ".format")
+
+	if err := runVaultUpgrade(true); err != nil {
+		t.Fatalf("runVaultUpgrade(dry run) error = %v", err)
+	}
+	if _, err := os.Stat(formatFile); !os.IsNotExist(err) {
+		t.Fatal("dry run recorded the vault format")
+	}
+
+	if err := runVaultUpgrade(false); err != nil {
+		t.Fatalf("runVaultUpgrade() error = %v", err)
+	}
+	status, err := storage.InspectFormat(storage.BackendOptions{Type: "file", BasePath: ".vaultenv"})
+	if err != nil || status.Version != status.Latest {
+		t.Errorf("format after upgrade = %+v, %v", status, err)
+	}
+
+	// Running it again has nothing to do
+	if err := runVaultUpgrade(false); err != nil {
+		t.Errorf("runVaultUpgrade() on an up-to-date vault error = %v", err)
+	}
+
+	os.WriteFile(formatFile, []byte(`{"version": 99}`), 0644)
+	if err := runVaultUpgrade(true); err == nil {
+		t.Error("runVaultUpgrade() accepted a vault written by a newer version")
+	}
+}
+
+func TestVaultRekey(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalWd, _ := os.Getwd()
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULTENV_TEST", "1")
+	defer os.Unsetenv("VAULTENV_TEST")
+
+	headerFile := filepath.Join(".vaultenv", storage.HeaderFile)
+
+	if err := runVaultRekey(true); err != nil {
+		t.Fatalf("runVaultRekey(dry run) error = %v", err)
+	}
+	if _, err := os.Stat(headerFile); !os.IsNotExist(err) {
+		t.Fatal("dry run created the vault header")
+	}
+
+	if err := runVaultRekey(false); err != nil {
+		t.Fatalf("runVaultRekey() error = %v", err)
+	}
+	header, err := storage.ReadVaultHeader(".vaultenv")
+	if err != nil {
+		t.Fatalf("ReadVaultHeader() error = %v", err)
+	}
+
+	// The salt of an existing header is kept
+	if err := runVaultRekey(false); err != nil {
+		t.Fatalf("runVaultRekey() error = %v", err)
+	}
+	if again, _ := storage.ReadVaultHeader(".vaultenv"); string(again.KDF.Salt) != string(header.KDF.Salt) {
+		t.Error("runVaultRekey() replaced the vault header")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 	"gopkg.in/yaml.v3"
 )
 
@@ -38,14 +41,16 @@ type ProjectConfig struct {
 // VaultConfig defines vault storage settings
 type VaultConfig struct {
 	Path            string        `yaml:"path"`
-	Type            string        `yaml:"type"` // "file", "sqlite", or "cloud"
+	Type            string        `yaml:"type"` // registered storage backend, e.g. "file", "sqlite", "git" or "cloud"
 	EncryptionAlgo  string        `yaml:"encryption_algo"`
 	KeyDerivation   KDFConfig     `yaml:"key_derivation"`
 	AutoLock        bool          `yaml:"auto_lock"`
 	LockTimeout     time.Duration `yaml:"lock_timeout"`
-	BackupEnabled   bool          `yaml:"backup_enabled"`
-	BackupPath      string        `yaml:"backup_path,omitempty"`
-	BackupRetention int           `yaml:"backup_retention,omitempty"`
+	FileLockTimeout time.Duration `yaml:"file_lock_timeout,omitempty"` // how long writes wait for a vault locked by another process
+	BackupEnabled   bool          `yaml:"backup_enabled"`              // take a snapshot before destructive commands
+	BackupPath      string        `yaml:"backup_path,omitempty"`       // directory snapshots are kept in
+	BackupRetention int           `yaml:"backup_retention,omitempty"`  // days to keep snapshots, 0 keeps all of them
+	TrashRetention  time.Duration `yaml:"trash_retention,omitempty"`   // how long deleted variables can be undeleted, 0 keeps them until purged
 }
 
 // KDFConfig holds key derivation function settings
@@ -55,6 +60,40 @@ type KDFConfig struct {
 	Memory      int    `yaml:"memory,omitempty"`
 	Parallelism int    `yaml:"parallelism,omitempty"`
 	SaltLength  int    `yaml:"salt_length,omitempty"`
+
+	// Security floor for Argon2id: tuning never recommends fewer
+	// iterations or less memory (KiB) than this, see Floor
+	MinIterations int `yaml:"min_iterations,omitempty"`
+	MinMemory     int `yaml:"min_memory,omitempty"`
+}
+
+// Default Argon2id security floor, the weakest parameters OWASP recommends
+const (
+	DefaultKDFMinIterations = 2
+	DefaultKDFMinMemory     = 19 * 1024 // 19 MiB
+)
+
+// Floor returns the fewest Argon2id iterations and the least memory in
+// KiB keys may be derived with
+func (k KDFConfig) Floor() (iterations, memory int) {
+	iterations, memory = k.MinIterations, k.MinMemory
+	if iterations == 0 {
+		iterations = DefaultKDFMinIterations
+	}
+	if memory == 0 {
+		memory = DefaultKDFMinMemory
+	}
+	return iterations, memory
+}
+
+// Params returns the parameters new password keys are derived with. Unset
+// values take the defaults of the algorithm.
+func (k KDFConfig) Params() (encryption.KDFParams, error) {
+	algorithm := k.Algorithm
+	if algorithm == "" {
+		algorithm = encryption.KDFArgon2id
+	}
+	return encryption.NewKDFParams(algorithm, k.Iterations, k.Memory, k.Parallelism)
 }
 
 // SecurityConfig contains security-related settings
@@ -95,7 +134,7 @@ type EnvironmentConfig struct {
 // SyncConfig handles synchronization settings
 type SyncConfig struct {
 	Enabled       bool          `yaml:"enabled"`
-	URL           string        `yaml:"url,omitempty"`
+	URL           string        `yaml:"url,omitempty"` // server of cloud vaults, the token is read from VAULTENV_REMOTE_TOKEN
 	Interval      time.Duration `yaml:"interval"`
 	AutoSync      bool          `yaml:"auto_sync"`
 	ConflictMode  string        `yaml:"conflict_mode"` // "manual", "local", "remote"
@@ -180,7 +219,7 @@ func DefaultConfig() *Config {
 		Vault: VaultConfig{
 			Path:           ".vaultenv",
 			Type:           "file",
-			EncryptionAlgo: "aes-256-gcm",
+			EncryptionAlgo: encryption.AlgorithmAESGCM,
 			KeyDerivation: KDFConfig{
 				Algorithm:   "argon2id",
 				Iterations:  3,
@@ -190,9 +229,11 @@ func DefaultConfig() *Config {
 			},
 			AutoLock:        true,
 			LockTimeout:     15 * time.Minute,
+			FileLockTimeout: 10 * time.Second,
 			BackupEnabled:   true,
 			BackupPath:      ".vaultenv/backups",
 			BackupRetention: 7,
+			TrashRetention:  30 * 24 * time.Hour,
 		},
 		Security: SecurityConfig{
 			RequireMFA:       false,
@@ -407,17 +448,31 @@ func (c *Config) Validate() error {
 	}
 
 	// Validate vault settings
-	validTypes := map[string]bool{"file": true, "sqlite": true, "git": true, "cloud": true}
-	if !validTypes[c.Vault.Type] {
-		return fmt.Errorf("vault type must be 'file', 'sqlite', 'git', or 'cloud'")
+	if !storage.IsRegistered(c.Vault.Type) {
+		return fmt.Errorf("vault type must be one of: %s", strings.Join(storage.Types(), ", "))
 	}
 
-	// Validate encryption algorithm
-	validAlgos := map[string]bool{
-		"aes-256-gcm":       true,
-		"chacha20-poly1305": true,
+	if c.Vault.FileLockTimeout < 0 {
+		return fmt.Errorf("vault file lock timeout cannot be negative")
+	}
+	if c.Vault.TrashRetention < 0 {
+		return fmt.Errorf("vault trash retention cannot be negative")
+	}
+	if c.Vault.BackupRetention < 0 {
+		return fmt.Errorf("vault backup retention cannot be negative")
 	}
-	if !validAlgos[c.Vault.EncryptionAlgo] {
+
+	// Remote vaults are reached through the sync settings
+	if caps, _ := storage.CapabilitiesOf(c.Vault.Type); caps.Remote && c.Sync.URL == "" {
+		return fmt.Errorf("vault type %s requires sync.url", c.Vault.Type)
+	}
+	if c.Sync.RetryAttempts < 0 {
+		return fmt.Errorf("sync retry attempts cannot be negative")
+	}
+
+	// Validate encryption algorithm; "aes-256-gcm" is accepted for
+	// configurations written before the names were unified
+	if algo, err := encryption.NormalizeAlgorithm(c.Vault.EncryptionAlgo); err != nil || algo == encryption.AlgorithmAESGCMDeterministic {
 		return fmt.Errorf("unsupported encryption algorithm: %s", c.Vault.EncryptionAlgo)
 	}
 
@@ -430,6 +485,17 @@ func (c *Config) Validate() error {
 	if !validKDFs[c.Vault.KeyDerivation.Algorithm] {
 		return fmt.Errorf("unsupported KDF algorithm: %s", c.Vault.KeyDerivation.Algorithm)
 	}
+	kdf, err := c.Vault.KeyDerivation.Params()
+	if err != nil {
+		return fmt.Errorf("invalid key derivation settings: %w", err)
+	}
+	if c.Vault.KeyDerivation.MinIterations < 0 || c.Vault.KeyDerivation.MinMemory < 0 {
+		return fmt.Errorf("key derivation floor cannot be negative")
+	}
+	if minIterations, minMemory := c.Vault.KeyDerivation.Floor(); kdf.Algorithm == encryption.KDFArgon2id &&
+		(int(kdf.Iterations) < minIterations || int(kdf.Memory) < minMemory) {
+		return fmt.Errorf("key derivation parameters %s are below the security floor (t=%d, m=%d KiB)", kdf, minIterations, minMemory)
+	}
 
 	// Validate sync conflict mode
 	validConflictModes := map[string]bool{
@@ -548,6 +614,16 @@ func (v *VaultConfig) IsEncrypted() bool {
 	return v.EncryptionAlgo != "" && v.EncryptionAlgo != "none"
 }
 
+// UseDeterministicEncryption reports whether values in git vaults are
+// encrypted deterministically, falling back to the deprecated
+// deterministic_mode flag when encryption_mode is not set
+func (g *GitConfig) UseDeterministicEncryption() bool {
+	if g.EncryptionMode != "" {
+		return g.EncryptionMode == "deterministic"
+	}
+	return g.DeterministicMode
+}
+
 // GetEnvironmentNames returns a list of all configured environment names
 func (c *Config) GetEnvironmentNames() []string {
 	names := make([]string, 0, len(c.Environments))
@@ -32,8 +32,8 @@ func TestDefaultConfig(t *testing.T) {
 		t.Errorf("Vault.Type = %v, want 'file'", cfg.Vault.Type)
 	}
 
-	if cfg.Vault.EncryptionAlgo != "aes-256-gcm" {
-		t.Errorf("Vault.EncryptionAlgo = %v, want 'aes-256-gcm'", cfg.Vault.EncryptionAlgo)
+	if cfg.Vault.EncryptionAlgo != "aes-gcm-256" {
+		t.Errorf("Vault.EncryptionAlgo = %v, want 'aes-gcm-256'", cfg.Vault.EncryptionAlgo)
 	}
 
 	// Test KDF defaults
@@ -95,6 +95,22 @@ func TestConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "vault type must be",
 		},
+		{
+			name: "cloud_vault_without_url",
+			modify: func(c *Config) {
+				c.Vault.Type = "cloud"
+			},
+			wantErr: true,
+			errMsg:  "sync.url",
+		},
+		{
+			name: "cloud_vault",
+			modify: func(c *Config) {
+				c.Vault.Type = "cloud"
+				c.Sync.URL = "https://vault.example.com"
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid_encryption_algo",
 			modify: func(c *Config) {
@@ -103,6 +119,28 @@ func TestConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "unsupported encryption algorithm",
 		},
+		{
+			name: "legacy_encryption_algo_name",
+			modify: func(c *Config) {
+				c.Vault.EncryptionAlgo = "aes-256-gcm"
+			},
+			wantErr: false,
+		},
+		{
+			name: "chacha20_encryption_algo",
+			modify: func(c *Config) {
+				c.Vault.EncryptionAlgo = "chacha20-poly1305"
+			},
+			wantErr: false,
+		},
+		{
+			name: "deterministic_encryption_algo",
+			modify: func(c *Config) {
+				c.Vault.EncryptionAlgo = "aes-gcm-256-deterministic"
+			},
+			wantErr: true,
+			errMsg:  "unsupported encryption algorithm",
+		},
 		{
 			name: "invalid_kdf_algorithm",
 			modify: func(c *Config) {
@@ -111,6 +149,22 @@ func TestConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "unsupported KDF algorithm",
 		},
+		{
+			name: "pbkdf2_with_argon2_iterations",
+			modify: func(c *Config) {
+				c.Vault.KeyDerivation.Algorithm = "pbkdf2"
+			},
+			wantErr: true,
+			errMsg:  "invalid key derivation settings",
+		},
+		{
+			name: "kdf_below_security_floor",
+			modify: func(c *Config) {
+				c.Vault.KeyDerivation.Iterations = 1
+			},
+			wantErr: true,
+			errMsg:  "below the security floor",
+		},
 		{
 			name: "invalid_sync_conflict_mode",
 			modify: func(c *Config) {
@@ -531,6 +585,34 @@ func TestGitConfig(t *testing.T) {
 	}
 }
 
+func TestGitConfig_UseDeterministicEncryption(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		deterministic bool
+		want          bool
+	}{
+		{"deterministic", "deterministic", false, true},
+		{"random", "random", false, false},
+		{"random overrides legacy flag", "random", true, false},
+		{"legacy flag", "", true, true},
+		{"unset", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			git := GitConfig{
+				EncryptionMode:    tt.mode,
+				DeterministicMode: tt.deterministic,
+			}
+
+			if got := git.UseDeterministicEncryption(); got != tt.want {
+				t.Errorf("UseDeterministicEncryption() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUIConfig(t *testing.T) {
 	cfg := DefaultConfig()
 
@@ -0,0 +1,205 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// RecipientsFile lists the recipients of a vault, relative to the
+	// vault directory. It is committed with the vault.
+	RecipientsFile = "recipients.txt"
+
+	// KeysDir holds the data key of each environment wrapped for every
+	// recipient, relative to the vault directory. It is committed with
+	// the vault.
+	KeysDir = "recipient-keys"
+
+	// keyFileVersion is the version of the key file layout
+	keyFileVersion = 1
+)
+
+var (
+	ErrNoKeyFile     = errors.New("environment has no wrapped data key")
+	ErrKeyFileExists = errors.New("environment already has a wrapped data key")
+)
+
+// Entry is a recipient listed in the recipients file
+type Entry struct {
+	Recipient Recipient
+	Name      string // who the recipient belongs to, for people
+}
+
+// KeyFile holds the data key of an environment wrapped for every recipient
+type KeyFile struct {
+	Version     int      `json:"version"`
+	Environment string   `json:"environment"`
+	KeyVersion  int      `json:"key_version"` // Incremented by every rotation
+	Stanzas     []Stanza `json:"stanzas"`
+
+	// Pending is the wrapped key of a rotation that has not finished
+	// re-encrypting the environment
+	Pending []Stanza `json:"pending,omitempty"`
+}
+
+// ReadRecipients returns the recipients of the vault in vaultPath, none if
+// it has no recipients file. Each line holds a recipient and optionally a
+// name; lines starting with # are comments.
+func ReadRecipients(vaultPath string) ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(vaultPath, RecipientsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+
+	var entries []Entry
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		r, err := ParseRecipient(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", RecipientsFile, i+1, err)
+		}
+		entries = append(entries, Entry{Recipient: r, Name: strings.Join(fields[1:], " ")})
+	}
+
+	return entries, nil
+}
+
+// WriteRecipients replaces the recipients file of the vault in vaultPath
+func WriteRecipients(vaultPath string, entries []Entry) error {
+	var b strings.Builder
+	b.WriteString("# Recipients the data keys of this vault are wrapped for, one per line:\n")
+	b.WriteString("# recipient and an optional name. Change with 'vaultenv recipients'.\n")
+	for _, e := range entries {
+		b.WriteString(e.Recipient.String())
+		if e.Name != "" {
+			b.WriteString(" " + e.Name)
+		}
+		b.WriteString("\n")
+	}
+
+	return writeFile(filepath.Join(vaultPath, RecipientsFile), []byte(b.String()), true)
+}
+
+// Recipients returns the recipients of the entries
+func Recipients(entries []Entry) []Recipient {
+	recipients := make([]Recipient, len(entries))
+	for i, e := range entries {
+		recipients[i] = e.Recipient
+	}
+	return recipients
+}
+
+// ReadKeyFile returns the wrapped data key of an environment, or
+// ErrNoKeyFile
+func ReadKeyFile(vaultPath, environment string) (*KeyFile, error) {
+	path := keyFilePath(vaultPath, environment)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoKeyFile
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wrapped data key: %w", err)
+	}
+
+	var kf KeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key %s: %w", path, err)
+	}
+	if kf.Version > keyFileVersion {
+		return nil, fmt.Errorf("wrapped data key %s was written by a newer version of vaultenv", path)
+	}
+
+	return &kf, nil
+}
+
+// WriteKeyFile stores the wrapped data key of an environment
+func WriteKeyFile(vaultPath string, kf *KeyFile) error {
+	return writeKeyFile(vaultPath, kf, true)
+}
+
+// CreateKeyFile stores the first wrapped data key of an environment,
+// returning ErrKeyFileExists if another process stored one first
+func CreateKeyFile(vaultPath string, kf *KeyFile) error {
+	return writeKeyFile(vaultPath, kf, false)
+}
+
+func writeKeyFile(vaultPath string, kf *KeyFile, replace bool) error {
+	kf.Version = keyFileVersion
+
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal wrapped data key: %w", err)
+	}
+
+	return writeFile(keyFilePath(vaultPath, kf.Environment), append(data, '\n'), replace)
+}
+
+// ListKeyFiles returns the environments with a wrapped data key
+func ListKeyFiles(vaultPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(vaultPath, KeysDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	environments := make([]string, len(matches))
+	for i, match := range matches {
+		environments[i] = strings.TrimSuffix(filepath.Base(match), ".json")
+	}
+	return environments, nil
+}
+
+func keyFilePath(vaultPath, environment string) string {
+	return filepath.Join(vaultPath, KeysDir, environment+".json")
+}
+
+// writeFile writes a file through a temporary file, so readers never see
+// it half-written. Without replace an existing file is kept and
+// ErrKeyFileExists returned.
+func writeFile(path string, data []byte, replace bool) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if !replace {
+		if err := os.Link(tmp.Name(), path); err != nil {
+			if os.IsExist(err) {
+				return ErrKeyFileExists
+			}
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
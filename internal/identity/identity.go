@@ -0,0 +1,196 @@
+// Package identity implements X25519 identities and recipients.
+//
+// Every teammate has a private identity kept on their machine and shares
+// the recipient derived from it. The data key of each environment is
+// wrapped once per recipient listed in the recipients file of the vault,
+// which is committed with it, so the vault is unlocked with the local
+// identity instead of a shared password. The wrapping follows age: an
+// ephemeral X25519 key agreement per recipient, HKDF-SHA256 and
+// ChaCha20-Poly1305.
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// RecipientPrefix starts the text form of a recipient
+	RecipientPrefix = "vaultenv1"
+
+	// IdentityPrefix starts the text form of an identity
+	IdentityPrefix = "VAULTENV-SECRET-KEY-1"
+
+	// IdentityEnv holds an identity, for machines such as CI runners that
+	// cannot keep an identity file
+	IdentityEnv = "VAULTENV_IDENTITY"
+
+	// IdentityFileEnv overrides the path of the identity file
+	IdentityFileEnv = "VAULTENV_IDENTITY_FILE"
+)
+
+var (
+	ErrNoIdentity     = errors.New("no identity, run 'vaultenv identity new'")
+	ErrIdentityExists = errors.New("identity already exists")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Identity is a private X25519 key
+type Identity struct {
+	secret [curve25519.ScalarSize]byte
+}
+
+// Recipient is a public X25519 key data keys are wrapped for
+type Recipient struct {
+	public [curve25519.PointSize]byte
+}
+
+// Generate returns a new random identity
+func Generate() (*Identity, error) {
+	id := &Identity{}
+	if _, err := io.ReadFull(rand.Reader, id.secret[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate identity: %w", err)
+	}
+	return id, nil
+}
+
+// ParseIdentity parses the text form of an identity
+func ParseIdentity(s string) (*Identity, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, IdentityPrefix) {
+		return nil, fmt.Errorf("invalid identity: missing %s prefix", IdentityPrefix)
+	}
+
+	data, err := encoding.DecodeString(s[len(IdentityPrefix):])
+	if err != nil || len(data) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("invalid identity")
+	}
+
+	id := &Identity{}
+	copy(id.secret[:], data)
+	return id, nil
+}
+
+// String returns the text form of the identity. It is secret.
+func (id *Identity) String() string {
+	return IdentityPrefix + encoding.EncodeToString(id.secret[:])
+}
+
+// Recipient returns the recipient of the identity
+func (id *Identity) Recipient() Recipient {
+	var r Recipient
+	public, _ := curve25519.X25519(id.secret[:], curve25519.Basepoint)
+	copy(r.public[:], public)
+	return r
+}
+
+// Secret returns the private key of the identity, to derive local keys
+// from
+func (id *Identity) Secret() []byte {
+	return append([]byte(nil), id.secret[:]...)
+}
+
+// ParseRecipient parses the text form of a recipient
+func ParseRecipient(s string) (Recipient, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, RecipientPrefix) {
+		return Recipient{}, fmt.Errorf("invalid recipient %q: missing %s prefix", s, RecipientPrefix)
+	}
+
+	data, err := encoding.DecodeString(strings.ToUpper(s[len(RecipientPrefix):]))
+	if err != nil || len(data) != curve25519.PointSize {
+		return Recipient{}, fmt.Errorf("invalid recipient %q", s)
+	}
+
+	var r Recipient
+	copy(r.public[:], data)
+	return r, nil
+}
+
+// String returns the text form of the recipient
+func (r Recipient) String() string {
+	return RecipientPrefix + strings.ToLower(encoding.EncodeToString(r.public[:]))
+}
+
+// DefaultPath returns the path of the identity file, VAULTENV_IDENTITY_FILE
+// or identity.txt in the user configuration directory
+func DefaultPath() (string, error) {
+	if path := os.Getenv(IdentityFileEnv); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find configuration directory: %w", err)
+	}
+	return filepath.Join(dir, "vaultenv", "identity.txt"), nil
+}
+
+// Load returns the identity of this machine, taken from VAULTENV_IDENTITY
+// or read from the identity file
+func Load() (*Identity, error) {
+	if s := os.Getenv(IdentityEnv); s != "" {
+		return ParseIdentity(s)
+	}
+
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoIdentity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	// Comment lines carry the recipient for reference
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return ParseIdentity(line)
+		}
+	}
+	return nil, fmt.Errorf("invalid identity file %s", path)
+}
+
+// Save writes an identity to path, readable only by the user. An existing
+// identity is only replaced with force, as the data keys wrapped for it
+// cannot be unlocked without it.
+func Save(path string, id *Identity, force bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create identity directory: %w", err)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%w: %s", ErrIdentityExists, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write identity: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "# recipient: %s\n%s\n", id.Recipient(), id)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package identity
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIdentity_RoundTrip(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	parsed, err := ParseIdentity(id.String())
+	if err != nil || parsed.Recipient() != id.Recipient() {
+		t.Fatalf("ParseIdentity() = %v, %v", parsed, err)
+	}
+
+	r, err := ParseRecipient(id.Recipient().String())
+	if err != nil || r != id.Recipient() {
+		t.Fatalf("ParseRecipient() = %v, %v", r, err)
+	}
+	if !strings.HasPrefix(r.String(), RecipientPrefix) || strings.Contains(r.String(), id.String()[len(IdentityPrefix):]) {
+		t.Errorf("recipient %s", r)
+	}
+
+	for _, s := range []string{"", "vaultenv1abc", "age1qqqq", id.String()} {
+		if _, err := ParseRecipient(s); err == nil {
+			t.Errorf("ParseRecipient(%q) accepted an invalid recipient", s)
+		}
+	}
+	if _, err := ParseIdentity(r.String()); err == nil {
+		t.Error("ParseIdentity() accepted a recipient")
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	alice, _ := Generate()
+	bob, _ := Generate()
+	eve, _ := Generate()
+	dataKey := bytes.Repeat([]byte{7}, 32)
+
+	stanzas, err := Wrap(dataKey, []Recipient{alice.Recipient(), bob.Recipient()})
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if len(stanzas) != 2 || bytes.Contains(stanzas[0].WrappedKey, dataKey) {
+		t.Fatalf("Wrap() = %+v", stanzas)
+	}
+
+	for _, id := range []*Identity{alice, bob} {
+		if got, err := Unwrap(stanzas, id); err != nil || !bytes.Equal(got, dataKey) {
+			t.Errorf("Unwrap() = %x, %v", got, err)
+		}
+	}
+	if _, err := Unwrap(stanzas, eve); !errors.Is(err, ErrNotRecipient) {
+		t.Errorf("Unwrap() by another identity error = %v, want ErrNotRecipient", err)
+	}
+
+	// A stanza moved to another recipient does not open
+	stanzas[1].Recipient = alice.Recipient().String()
+	stanzas = stanzas[1:]
+	if _, err := Unwrap(stanzas, alice); err == nil {
+		t.Error("Unwrap() opened a stanza wrapped for another recipient")
+	}
+
+	if _, err := Wrap(dataKey, nil); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("Wrap() without recipients error = %v", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vaultenv", "identity.txt")
+	os.Setenv(IdentityFileEnv, path)
+	defer os.Unsetenv(IdentityFileEnv)
+
+	if _, err := Load(); !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("Load() without identity error = %v", err)
+	}
+
+	id, _ := Generate()
+	if err := Save(path, id, false); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("identity file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	other, _ := Generate()
+	if err := Save(path, other, false); !errors.Is(err, ErrIdentityExists) {
+		t.Errorf("Save() over an existing identity error = %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil || loaded.Recipient() != id.Recipient() {
+		t.Fatalf("Load() = %v, %v", loaded, err)
+	}
+
+	// The variable takes precedence over the file
+	os.Setenv(IdentityEnv, other.String())
+	defer os.Unsetenv(IdentityEnv)
+	if loaded, _ := Load(); loaded.Recipient() != other.Recipient() {
+		t.Error("Load() ignored VAULTENV_IDENTITY")
+	}
+}
+
+func TestRecipientsAndKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	alice, _ := Generate()
+	bob, _ := Generate()
+
+	if entries, err := ReadRecipients(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("ReadRecipients() without file = %v, %v", entries, err)
+	}
+
+	entries := []Entry{{Recipient: alice.Recipient(), Name: "alice"}, {Recipient: bob.Recipient()}}
+	if err := WriteRecipients(dir, entries); err != nil {
+		t.Fatalf("WriteRecipients() error = %v", err)
+	}
+	got, err := ReadRecipients(dir)
+	if err != nil || len(got) != 2 || got[0] != entries[0] || got[1] != entries[1] {
+		t.Fatalf("ReadRecipients() = %+v, %v", got, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, RecipientsFile), []byte("# comment\nnot-a-recipient\n"), 0644)
+	if _, err := ReadRecipients(dir); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadRecipients() of an invalid file error = %v", err)
+	}
+
+	if _, err := ReadKeyFile(dir, "production"); !errors.Is(err, ErrNoKeyFile) {
+		t.Fatalf("ReadKeyFile() without file error = %v", err)
+	}
+
+	stanzas, _ := Wrap(bytes.Repeat([]byte{1}, 32), Recipients(entries))
+	if err := CreateKeyFile(dir, &KeyFile{Environment: "production", KeyVersion: 1, Stanzas: stanzas}); err != nil {
+		t.Fatalf("CreateKeyFile() error = %v", err)
+	}
+	if err := CreateKeyFile(dir, &KeyFile{Environment: "production", KeyVersion: 1}); !errors.Is(err, ErrKeyFileExists) {
+		t.Errorf("CreateKeyFile() over an existing key error = %v", err)
+	}
+
+	kf, err := ReadKeyFile(dir, "production")
+	if err != nil || len(kf.Stanzas) != 2 || kf.Version != keyFileVersion {
+		t.Fatalf("ReadKeyFile() = %+v, %v", kf, err)
+	}
+
+	if envs, err := ListKeyFiles(dir); err != nil || len(envs) != 1 || envs[0] != "production" {
+		t.Errorf("ListKeyFiles() = %v, %v", envs, err)
+	}
+}
@@ -0,0 +1,122 @@
+package identity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// wrapInfo separates keys derived for wrapping from other uses of HKDF
+const wrapInfo = "vaultenv-x25519-wrap-v1"
+
+var (
+	ErrNotRecipient = errors.New("this identity is not a recipient")
+	ErrNoRecipients = errors.New("no recipients")
+)
+
+// Stanza is a data key wrapped for one recipient
+type Stanza struct {
+	Recipient  string `json:"recipient"`
+	Ephemeral  []byte `json:"ephemeral"`   // public key of the key agreement
+	WrappedKey []byte `json:"wrapped_key"` // ChaCha20-Poly1305, zero nonce
+}
+
+// Wrap wraps a data key once for every recipient
+func Wrap(dataKey []byte, recipients []Recipient) ([]Stanza, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	stanzas := make([]Stanza, 0, len(recipients))
+	for _, r := range recipients {
+		ephemeral := make([]byte, curve25519.ScalarSize)
+		if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+			return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+		}
+		share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+		if err != nil {
+			return nil, err
+		}
+
+		shared, err := curve25519.X25519(ephemeral, r.public[:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %s: %w", r, err)
+		}
+
+		wrapped, err := sealKey(shared, share, r.public[:], dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		stanzas = append(stanzas, Stanza{Recipient: r.String(), Ephemeral: share, WrappedKey: wrapped})
+	}
+
+	return stanzas, nil
+}
+
+// Unwrap returns the data key of the stanza wrapped for the identity
+func Unwrap(stanzas []Stanza, id *Identity) ([]byte, error) {
+	recipient := id.Recipient()
+
+	for _, s := range stanzas {
+		if s.Recipient != recipient.String() {
+			continue
+		}
+
+		shared, err := curve25519.X25519(id.secret[:], s.Ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wrapped key: %w", err)
+		}
+		return openKey(shared, s.Ephemeral, recipient.public[:], s.WrappedKey)
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// wrapKey derives the key a data key is wrapped with from the shared
+// secret, bound to both public keys of the agreement
+func wrapKey(shared, share, public []byte) ([]byte, error) {
+	salt := append(append([]byte(nil), share...), public...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(wrapInfo)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive wrapping key: %w", err)
+	}
+	return key, nil
+}
+
+func sealKey(shared, share, public, dataKey []byte) ([]byte, error) {
+	key, err := wrapKey(shared, share, public)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every wrapping key is used once, so a zero nonce is safe
+	return aead.Seal(nil, make([]byte, aead.NonceSize()), dataKey, nil), nil
+}
+
+func openKey(shared, share, public, wrapped []byte) ([]byte, error) {
+	key, err := wrapKey(shared, share, public)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,157 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
+)
+
+// DataKeyLen is the length of a data key in bytes
+const DataKeyLen = 32
+
+// ErrInvalidDataKey is returned when a data key cannot be unwrapped with
+// the given password key
+var ErrInvalidDataKey = errors.New("data key cannot be unlocked with this password")
+
+// GenerateDataKey returns a new random data key
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, DataKeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// WrapDataKey encrypts a data key with a password key
+func WrapDataKey(dataKey, passwordKey []byte) ([]byte, error) {
+	wrapped, err := encryption.NewAESGCMEncryptor().Encrypt(dataKey, passwordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// UnwrapDataKey decrypts a data key wrapped by WrapDataKey
+func UnwrapDataKey(wrapped, passwordKey []byte) ([]byte, error) {
+	dataKey, err := encryption.NewAESGCMEncryptor().Decrypt(wrapped, passwordKey)
+	if err != nil {
+		return nil, ErrInvalidDataKey
+	}
+	return dataKey, nil
+}
+
+// NewDataKeyEntry returns the entry of a data key wrapped with passwordKey
+func NewDataKeyEntry(projectID, environment string, dataKey, passwordKey []byte) (*DataKeyEntry, error) {
+	wrapped, err := WrapDataKey(dataKey, passwordKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKeyEntry{
+		ProjectID:   projectID,
+		Environment: environment,
+		WrappedKey:  wrapped,
+		Version:     1,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// RewrapDataKeys returns the data keys of the given environments wrapped
+// with newKey instead of oldKey, for storing together with the new
+// password key. Data keys wrapped with another password key are left out.
+// With adopt set, environments without a data key get oldKey itself as
+// their data key, as their values are still encrypted with it.
+func (ks *Keystore) RewrapDataKeys(projectID string, environments []string, oldKey, newKey []byte, adopt bool) ([]*DataKeyEntry, error) {
+	var entries []*DataKeyEntry
+	for _, environment := range environments {
+		entry, err := ks.GetDataKey(projectID, environment)
+		if errors.Is(err, ErrKeyNotFound) {
+			if !adopt {
+				continue
+			}
+			entry, err = NewDataKeyEntry(projectID, environment, oldKey, newKey)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dataKey, err := UnwrapDataKey(entry.WrappedKey, oldKey)
+		if err != nil {
+			// Unlocked by another password
+			continue
+		}
+		if entry.WrappedKey, err = WrapDataKey(dataKey, newKey); err != nil {
+			return nil, err
+		}
+
+		if entry.PendingKey != nil {
+			pending, err := UnwrapDataKey(entry.PendingKey, oldKey)
+			if err != nil {
+				return nil, err
+			}
+			if entry.PendingKey, err = WrapDataKey(pending, newKey); err != nil {
+				return nil, err
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// ReplaceKey stores the key of a project together with the data keys
+// rewrapped for it, so a password change never leaves data keys wrapped
+// with a password key that is no longer stored
+func (ks *Keystore) ReplaceKey(projectID string, entry *KeyEntry, dataKeys []*DataKeyEntry) error {
+	return ks.inTx(func(tx execer) error {
+		if err := storeKey(tx, projectID, entry); err != nil {
+			return err
+		}
+		return storeDataKeys(tx, dataKeys)
+	})
+}
+
+// ReplaceEnvironmentKey stores the key of an environment together with
+// the data keys rewrapped for it, see ReplaceKey
+func (ks *Keystore) ReplaceEnvironmentKey(projectID, environment string, entry *EnvironmentKeyEntry, dataKeys []*DataKeyEntry) error {
+	return ks.inTx(func(tx execer) error {
+		if err := storeEnvironmentKey(tx, projectID, environment, entry); err != nil {
+			return err
+		}
+		return storeDataKeys(tx, dataKeys)
+	})
+}
+
+func storeDataKeys(db execer, entries []*DataKeyEntry) error {
+	for _, entry := range entries {
+		if err := storeDataKey(db, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a database transaction
+func (ks *Keystore) inTx(fn func(tx execer) error) error {
+	tx, err := ks.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin keystore transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
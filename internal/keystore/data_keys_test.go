@@ -0,0 +1,123 @@
+package keystore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestKeystore_DataKeys(t *testing.T) {
+	ks, err := NewKeystore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+
+	passwordKey := bytes.Repeat([]byte{1}, 32)
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		t.Fatalf("GenerateDataKey() error = %v", err)
+	}
+
+	entry, err := NewDataKeyEntry("test-project", "production", dataKey, passwordKey)
+	if err != nil {
+		t.Fatalf("NewDataKeyEntry() error = %v", err)
+	}
+	if bytes.Contains(entry.WrappedKey, dataKey) {
+		t.Fatal("wrapped data key contains the data key")
+	}
+	if err := ks.StoreDataKey(entry); err != nil {
+		t.Fatalf("StoreDataKey() error = %v", err)
+	}
+
+	got, err := ks.GetDataKey("test-project", "production")
+	if err != nil {
+		t.Fatalf("GetDataKey() error = %v", err)
+	}
+	unwrapped, err := UnwrapDataKey(got.WrappedKey, passwordKey)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("UnwrapDataKey() = %x, %v", unwrapped, err)
+	}
+	if _, err := UnwrapDataKey(got.WrappedKey, bytes.Repeat([]byte{2}, 32)); err != ErrInvalidDataKey {
+		t.Errorf("UnwrapDataKey() with another key error = %v, want %v", err, ErrInvalidDataKey)
+	}
+
+	entries, err := ks.ListDataKeys("test-project")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("ListDataKeys() = %d entries, %v", len(entries), err)
+	}
+
+	if err := ks.DeleteDataKey("test-project", "production"); err != nil {
+		t.Fatalf("DeleteDataKey() error = %v", err)
+	}
+	if _, err := ks.GetDataKey("test-project", "production"); err != ErrKeyNotFound {
+		t.Errorf("GetDataKey() after delete error = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestKeystore_ReplaceKeyRewrapsDataKeys(t *testing.T) {
+	ks, err := NewKeystore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	otherKey := bytes.Repeat([]byte{3}, 32)
+
+	production, _ := GenerateDataKey()
+	entry, _ := NewDataKeyEntry("test-project", "production", production, oldKey)
+	ks.StoreDataKey(entry)
+
+	// Unlocked by an environment password, not the one being changed
+	staging, _ := GenerateDataKey()
+	entry, _ = NewDataKeyEntry("test-project", "staging", staging, otherKey)
+	ks.StoreDataKey(entry)
+
+	environments := []string{"development", "production", "staging"}
+	dataKeys, err := ks.RewrapDataKeys("test-project", environments, oldKey, newKey, true)
+	if err != nil {
+		t.Fatalf("RewrapDataKeys() error = %v", err)
+	}
+	if len(dataKeys) != 2 {
+		t.Fatalf("RewrapDataKeys() returned %d entries, want 2", len(dataKeys))
+	}
+
+	err = ks.ReplaceKey("test-project", &KeyEntry{
+		ProjectID:        "test-project",
+		Salt:             []byte("new-salt"),
+		VerificationHash: "new-hash",
+		CreatedAt:        time.Now(),
+		DataKeys:         true,
+	}, dataKeys)
+	if err != nil {
+		t.Fatalf("ReplaceKey() error = %v", err)
+	}
+
+	if key, err := ks.GetKey("test-project"); err != nil || key.VerificationHash != "new-hash" || !key.DataKeys {
+		t.Errorf("GetKey() = %+v, %v", key, err)
+	}
+
+	tests := []struct {
+		environment string
+		key         []byte
+		want        []byte
+	}{
+		{"production", newKey, production},
+		{"staging", otherKey, staging},
+		// Adopted: the old password key keeps decrypting existing values
+		{"development", newKey, oldKey},
+	}
+
+	for _, tt := range tests {
+		entry, err := ks.GetDataKey("test-project", tt.environment)
+		if err != nil {
+			t.Fatalf("GetDataKey(%s) error = %v", tt.environment, err)
+		}
+		got, err := UnwrapDataKey(entry.WrappedKey, tt.key)
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("data key of %s = %x, %v, want %x", tt.environment, got, err, tt.want)
+		}
+	}
+}
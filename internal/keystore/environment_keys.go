@@ -16,6 +16,7 @@ type EnvironmentKeyManager struct {
 	keystore  *Keystore
 	projectID string
 	encryptor encryption.Encryptor
+	kdf       encryption.KDFParams // parameters new keys are derived with
 }
 
 // NewEnvironmentKeyManager creates a new manager for environment-specific keys
@@ -24,9 +25,16 @@ func NewEnvironmentKeyManager(keystore *Keystore, projectID string) *Environment
 		keystore:  keystore,
 		projectID: projectID,
 		encryptor: encryption.NewAESGCMEncryptor(),
+		kdf:       encryption.DefaultKDFParams(encryption.KDFArgon2id),
 	}
 }
 
+// SetKDFParams sets the parameters new keys are derived with. Existing
+// keys derived with weaker parameters are upgraded on their next unlock.
+func (ekm *EnvironmentKeyManager) SetKDFParams(params encryption.KDFParams) {
+	ekm.kdf = params
+}
+
 // GetOrCreateEnvironmentKey retrieves or creates an encryption key for a specific environment
 // This method embodies the zero-knowledge principle - the key is derived from the user's
 // password and never stored in plaintext
@@ -38,7 +46,11 @@ func (ekm *EnvironmentKeyManager) GetOrCreateEnvironmentKey(environment, passwor
 	entry, err := ekm.retrieveEnvironmentKey(keyID)
 	if err == nil {
 		// Key exists, derive it from password and verify
-		return ekm.deriveAndVerifyKey(entry, password)
+		key, err := ekm.deriveAndVerifyKey(entry, password)
+		if err != nil {
+			return nil, err
+		}
+		return ekm.upgradeEnvironmentKey(entry, password, key), nil
 	}
 
 	// Key doesn't exist, create new one
@@ -56,21 +68,14 @@ func (ekm *EnvironmentKeyManager) retrieveEnvironmentKey(keyID string) (*Environ
 // deriveAndVerifyKey derives the encryption key from password and verifies it
 func (ekm *EnvironmentKeyManager) deriveAndVerifyKey(entry *EnvironmentKeyEntry, password string) ([]byte, error) {
 	// Derive key using stored parameters
-	key := ekm.deriveKey(password, entry.Salt, entry.Iterations, entry.Memory, entry.Parallelism)
-
-	// Verify the key by checking the verification hash
-	verificationData := append([]byte("vaultenv-verification"), key...)
-	verificationHash := base64.StdEncoding.EncodeToString(argon2.IDKey(
-		verificationData,
-		entry.Salt,
-		1, // Single iteration for verification
-		64*1024,
-		4,
-		32,
-	))
+	key, err := entry.KDF().DeriveKey(password, entry.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key for environment %s: %w", entry.Environment, err)
+	}
 
-	// Constant-time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(verificationHash), []byte(entry.VerificationHash)) != 1 {
+	// Verify the key by checking the verification hash, with a
+	// constant-time comparison to prevent timing attacks
+	if subtle.ConstantTimeCompare([]byte(verificationHash(key, entry.Salt)), []byte(entry.VerificationHash)) != 1 {
 		return nil, fmt.Errorf("invalid password for environment: %s", entry.Environment)
 	}
 
@@ -79,50 +84,80 @@ func (ekm *EnvironmentKeyManager) deriveAndVerifyKey(entry *EnvironmentKeyEntry,
 
 // createNewEnvironmentKey creates a new encryption key for an environment
 func (ekm *EnvironmentKeyManager) createNewEnvironmentKey(keyID, environment, password string) ([]byte, error) {
-	// Generate a new salt
-	salt, err := ekm.encryptor.GenerateSalt()
+	entry, key, err := ekm.newEnvironmentKeyEntry(environment, password, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate salt: %w", err)
+		return nil, err
 	}
 
-	// Derive key with strong parameters
-	iterations := uint32(3)
-	memory := uint32(64 * 1024) // 64MB
-	parallelism := uint8(4)
+	// Store the key entry
+	if err := ekm.storeEnvironmentKey(keyID, entry); err != nil {
+		return nil, fmt.Errorf("failed to store key entry: %w", err)
+	}
 
-	key := ekm.deriveKey(password, salt, iterations, memory, parallelism)
+	return key, nil
+}
 
-	// Create verification hash
-	verificationData := append([]byte("vaultenv-verification"), key...)
-	verificationHash := base64.StdEncoding.EncodeToString(argon2.IDKey(
-		verificationData,
-		salt,
-		1,
-		64*1024,
-		4,
-		32,
-	))
+// newEnvironmentKeyEntry derives a key for an environment from a password
+// with a new salt and the configured parameters
+func (ekm *EnvironmentKeyManager) newEnvironmentKeyEntry(environment, password string, createdAt time.Time) (*EnvironmentKeyEntry, []byte, error) {
+	salt, err := ekm.encryptor.GenerateSalt()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := ekm.kdf.DeriveKey(password, salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive key: %w", err)
+	}
 
-	// Create the key entry
 	entry := &EnvironmentKeyEntry{
 		ProjectID:        ekm.projectID,
 		Environment:      environment,
 		Salt:             salt,
-		VerificationHash: verificationHash,
-		CreatedAt:        time.Now(),
+		VerificationHash: verificationHash(key, salt),
+		CreatedAt:        createdAt,
 		UpdatedAt:        time.Now(),
-		Algorithm:        "argon2id",
-		Iterations:       iterations,
-		Memory:           memory,
-		Parallelism:      parallelism,
+		DataKeys:         true,
 	}
+	entry.SetKDF(ekm.kdf)
 
-	// Store the key entry
-	if err := ekm.storeEnvironmentKey(keyID, entry); err != nil {
-		return nil, fmt.Errorf("failed to store key entry: %w", err)
+	return entry, key, nil
+}
+
+// upgradeEnvironmentKey re-derives the key of an environment with the
+// configured parameters if they are stronger than the ones it was created
+// with, rewrapping its data key. It returns the key to use from now on; if
+// the upgrade fails the old key keeps working and the upgrade is retried
+// on the next unlock.
+func (ekm *EnvironmentKeyManager) upgradeEnvironmentKey(entry *EnvironmentKeyEntry, password string, key []byte) []byte {
+	if !entry.KDF().Weaker(ekm.kdf) {
+		return key
 	}
 
-	return key, nil
+	newEntry, newKey, err := ekm.newEnvironmentKeyEntry(entry.Environment, password, entry.CreatedAt)
+	if err == nil {
+		err = ekm.replaceEnvironmentKey(entry, newEntry, key, newKey)
+	}
+	if err != nil {
+		ui.Debug("Failed to upgrade key derivation of environment %s: %v", entry.Environment, err)
+		return key
+	}
+
+	ui.Debug("Upgraded key derivation of environment %s to %s", entry.Environment, ekm.kdf)
+	return newKey
+}
+
+// replaceEnvironmentKey stores a new key entry for an environment together
+// with its data key rewrapped from the old key to the new one
+func (ekm *EnvironmentKeyManager) replaceEnvironmentKey(oldEntry, newEntry *EnvironmentKeyEntry, oldKey, newKey []byte) error {
+	// Values of older environments are encrypted with the old password key,
+	// which becomes their data key
+	dataKeys, err := ekm.keystore.RewrapDataKeys(ekm.projectID, []string{newEntry.Environment}, oldKey, newKey, !oldEntry.DataKeys)
+	if err != nil {
+		return fmt.Errorf("failed to rewrap data key: %w", err)
+	}
+
+	return ekm.keystore.ReplaceEnvironmentKey(ekm.projectID, newEntry.Environment, newEntry, dataKeys)
 }
 
 // storeEnvironmentKey saves the key entry to the keystore
@@ -130,61 +165,42 @@ func (ekm *EnvironmentKeyManager) storeEnvironmentKey(keyID string, entry *Envir
 	return ekm.keystore.StoreEnvironmentKey(ekm.projectID, entry.Environment, entry)
 }
 
-// deriveKey derives an encryption key from a password using Argon2id
-func (ekm *EnvironmentKeyManager) deriveKey(password string, salt []byte, iterations, memory uint32, parallelism uint8) []byte {
-	return argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, 32)
+// verificationHash returns the hash a key is verified against
+func verificationHash(key, salt []byte) string {
+	verificationData := append([]byte("vaultenv-verification"), key...)
+	return base64.StdEncoding.EncodeToString(argon2.IDKey(
+		verificationData,
+		salt,
+		1, // Single iteration for verification
+		64*1024,
+		4,
+		32,
+	))
 }
 
-// ChangeEnvironmentPassword changes the password for a specific environment
+// ChangeEnvironmentPassword changes the password for a specific
+// environment. The data key of the environment is rewrapped with the new
+// password key; the values themselves are not touched.
 func (ekm *EnvironmentKeyManager) ChangeEnvironmentPassword(environment, oldPassword, newPassword string) error {
-	keyID := fmt.Sprintf("%s:%s", ekm.projectID, environment)
-
 	// Verify old password first
-	_, err := ekm.GetOrCreateEnvironmentKey(environment, oldPassword)
+	oldKey, err := ekm.GetOrCreateEnvironmentKey(environment, oldPassword)
 	if err != nil {
 		return fmt.Errorf("current password is incorrect: %w", err)
 	}
 
-	// Create new key with new password
-	salt, err := ekm.encryptor.GenerateSalt()
+	oldEntry, err := ekm.keystore.GetEnvironmentKey(ekm.projectID, environment)
 	if err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
+		return fmt.Errorf("failed to retrieve key: %w", err)
 	}
 
-	// Use same strong parameters
-	iterations := uint32(3)
-	memory := uint32(64 * 1024)
-	parallelism := uint8(4)
-
-	newKey := ekm.deriveKey(newPassword, salt, iterations, memory, parallelism)
-
-	// Create new verification hash
-	verificationData := append([]byte("vaultenv-verification"), newKey...)
-	verificationHash := base64.StdEncoding.EncodeToString(argon2.IDKey(
-		verificationData,
-		salt,
-		1,
-		64*1024,
-		4,
-		32,
-	))
-
-	// Update the key entry
-	entry := &EnvironmentKeyEntry{
-		ProjectID:        ekm.projectID,
-		Environment:      environment,
-		Salt:             salt,
-		VerificationHash: verificationHash,
-		CreatedAt:        time.Now(), // Keep original creation time if we had it
-		UpdatedAt:        time.Now(),
-		Algorithm:        "argon2id",
-		Iterations:       iterations,
-		Memory:           memory,
-		Parallelism:      parallelism,
+	// Create new key with new password
+	entry, newKey, err := ekm.newEnvironmentKeyEntry(environment, newPassword, oldEntry.CreatedAt)
+	if err != nil {
+		return err
 	}
 
 	// Store updated entry
-	return ekm.storeEnvironmentKey(keyID, entry)
+	return ekm.replaceEnvironmentKey(oldEntry, entry, oldKey, newKey)
 }
 
 // DeleteEnvironmentKey removes the key for a specific environment
@@ -231,6 +247,7 @@ func (ekm *EnvironmentKeyManager) CopyEnvironmentKey(sourceEnv, targetEnv, passw
 		Iterations:       sourceEntry.Iterations,
 		Memory:           sourceEntry.Memory,
 		Parallelism:      sourceEntry.Parallelism,
+		DataKeys:         sourceEntry.DataKeys,
 	}
 
 	// Store target entry
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
 )
 
 const (
@@ -29,6 +30,28 @@ type KeyEntry struct {
 	VerificationHash string    `json:"verification_hash"`
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+
+	// DataKeys is set for keys that only ever wrapped data keys. Values of
+	// older vaults are encrypted with the password key itself, which then
+	// becomes the first data key of each environment.
+	DataKeys bool `json:"data_keys,omitempty"`
+
+	// Key derivation parameters, unset for keys stored before they were
+	// recorded, see KDF
+	Algorithm   string `json:"algorithm,omitempty"`
+	Iterations  uint32 `json:"iterations,omitempty"`
+	Memory      uint32 `json:"memory,omitempty"`
+	Parallelism uint8  `json:"parallelism,omitempty"`
+}
+
+// KDF returns the parameters the key was derived with
+func (e *KeyEntry) KDF() encryption.KDFParams {
+	return kdfParams(e.Algorithm, e.Iterations, e.Memory, e.Parallelism)
+}
+
+// SetKDF records the parameters the key was derived with
+func (e *KeyEntry) SetKDF(p encryption.KDFParams) {
+	e.Algorithm, e.Iterations, e.Memory, e.Parallelism = p.Algorithm, p.Iterations, p.Memory, p.Parallelism
 }
 
 // EnvironmentKeyEntry represents a stored encryption key for a specific environment
@@ -43,6 +66,41 @@ type EnvironmentKeyEntry struct {
 	Iterations       uint32    `json:"iterations"`
 	Memory           uint32    `json:"memory"`
 	Parallelism      uint8     `json:"parallelism"`
+	DataKeys         bool      `json:"data_keys,omitempty"` // See KeyEntry
+}
+
+// KDF returns the parameters the key was derived with
+func (e *EnvironmentKeyEntry) KDF() encryption.KDFParams {
+	return kdfParams(e.Algorithm, e.Iterations, e.Memory, e.Parallelism)
+}
+
+// SetKDF records the parameters the key was derived with
+func (e *EnvironmentKeyEntry) SetKDF(p encryption.KDFParams) {
+	e.Algorithm, e.Iterations, e.Memory, e.Parallelism = p.Algorithm, p.Iterations, p.Memory, p.Parallelism
+}
+
+// kdfParams returns stored key derivation parameters. Keys stored without
+// them were derived with the Argon2id defaults.
+func kdfParams(algorithm string, iterations, memory uint32, parallelism uint8) encryption.KDFParams {
+	if algorithm == "" {
+		return encryption.DefaultKDFParams(encryption.KDFArgon2id)
+	}
+	return encryption.KDFParams{Algorithm: algorithm, Iterations: iterations, Memory: memory, Parallelism: parallelism}
+}
+
+// DataKeyEntry holds the data key of an environment, encrypted with the
+// password key that unlocks the environment
+type DataKeyEntry struct {
+	ProjectID   string    `json:"project_id"`
+	Environment string    `json:"environment"`
+	WrappedKey  []byte    `json:"wrapped_key"`
+	Version     int       `json:"version"` // Incremented by every rotation
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// PendingKey is the wrapped key of a rotation that has not finished
+	// re-encrypting the environment
+	PendingKey []byte `json:"pending_key,omitempty"`
 }
 
 // Keystore manages encryption keys
@@ -85,8 +143,17 @@ func (ks *Keystore) Close() error {
 	return ks.db.Close()
 }
 
+// execer runs statements on the database or within a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // StoreKey stores an encryption key for a project
 func (ks *Keystore) StoreKey(projectID string, entry *KeyEntry) error {
+	return storeKey(ks.db, projectID, entry)
+}
+
+func storeKey(db execer, projectID string, entry *KeyEntry) error {
 	entry.UpdatedAt = time.Now()
 
 	// Serialize entry to JSON
@@ -101,7 +168,7 @@ func (ks *Keystore) StoreKey(projectID string, entry *KeyEntry) error {
 		VALUES (?, ?, ?)
 	`
 
-	_, err = ks.db.Exec(query, projectID, data, entry.UpdatedAt)
+	_, err = db.Exec(query, projectID, data, entry.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to store key: %w", err)
 	}
@@ -130,6 +197,64 @@ func (ks *Keystore) GetKey(projectID string) (*KeyEntry, error) {
 	return &entry, nil
 }
 
+// ImportKey copies the key of project fromProjectID in the keystore in
+// dataDir to projectID in this keystore, unless this keystore already has a
+// key for projectID. The other keystore is only read, and nothing is copied
+// if it does not exist or has no such key. It reports whether a key was
+// copied.
+func (ks *Keystore) ImportKey(dataDir, fromProjectID, projectID string) (bool, error) {
+	if _, err := ks.GetKey(projectID); !errors.Is(err, ErrKeyNotFound) {
+		return false, err
+	}
+
+	dbPath := filepath.Join(dataDir, keystoreDBName)
+	if same, err := samePath(dbPath, ks.dbPath); err != nil || same {
+		return false, err
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return false, fmt.Errorf("failed to open keystore %s: %w", dbPath, err)
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.QueryRow(`SELECT data FROM keys WHERE project_id = ?`, fromProjectID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read keystore %s: %w", dbPath, err)
+	}
+
+	var entry KeyEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false, fmt.Errorf("failed to deserialize key entry: %w", err)
+	}
+	entry.ProjectID = projectID
+
+	if err := ks.StoreKey(projectID, &entry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// samePath reports whether two paths name the same file
+func samePath(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return absA == absB, nil
+}
+
 // DeleteKey removes an encryption key for a project
 func (ks *Keystore) DeleteKey(projectID string) error {
 	query := `DELETE FROM keys WHERE project_id = ?`
@@ -227,6 +352,9 @@ func (ks *Keystore) Restore(backupPath string) error {
 	return nil
 }
 
+// schemaVersion is the newest keystore schema, see initSchema
+const schemaVersion = 3
+
 // initSchema initializes the database schema
 func (ks *Keystore) initSchema() error {
 	// Create version table
@@ -253,6 +381,11 @@ func (ks *Keystore) initSchema() error {
 		currentVersion = int(version.Int64)
 	}
 
+	if currentVersion > schemaVersion {
+		return fmt.Errorf("keystore schema version %d was written by a newer version of vaultenv (this version supports up to %d)",
+			currentVersion, schemaVersion)
+	}
+
 	// Apply migrations
 	if currentVersion < 1 {
 		if err := ks.applyMigration1(); err != nil {
@@ -266,6 +399,12 @@ func (ks *Keystore) initSchema() error {
 		}
 	}
 
+	if currentVersion < 3 {
+		if err := ks.applyMigration3(); err != nil {
+			return fmt.Errorf("failed to apply migration 3: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -345,8 +484,42 @@ func (ks *Keystore) applyMigration2() error {
 	return tx.Commit()
 }
 
+// applyMigration3 adds the wrapped data keys of environments
+func (ks *Keystore) applyMigration3() error {
+	tx, err := ks.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	dataKeysTable := `
+		CREATE TABLE data_keys (
+			project_id TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			data BLOB NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (project_id, environment)
+		)
+	`
+
+	if _, err := tx.Exec(dataKeysTable); err != nil {
+		return err
+	}
+
+	// Record migration
+	if _, err := tx.Exec("INSERT INTO schema_version (version) VALUES (3)"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // StoreEnvironmentKey stores an encryption key for a specific environment
 func (ks *Keystore) StoreEnvironmentKey(projectID, environment string, entry *EnvironmentKeyEntry) error {
+	return storeEnvironmentKey(ks.db, projectID, environment, entry)
+}
+
+func storeEnvironmentKey(db execer, projectID, environment string, entry *EnvironmentKeyEntry) error {
 	entry.UpdatedAt = time.Now()
 
 	// Serialize entry to JSON
@@ -361,7 +534,7 @@ func (ks *Keystore) StoreEnvironmentKey(projectID, environment string, entry *En
 		VALUES (?, ?, ?, ?)
 	`
 
-	_, err = ks.db.Exec(query, projectID, environment, data, entry.UpdatedAt)
+	_, err = db.Exec(query, projectID, environment, data, entry.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to store environment key: %w", err)
 	}
@@ -436,3 +609,100 @@ func (ks *Keystore) ListEnvironments(projectID string) ([]string, error) {
 
 	return environments, nil
 }
+
+// StoreDataKey stores the wrapped data key of an environment, replacing
+// the previous one in a single write
+func (ks *Keystore) StoreDataKey(entry *DataKeyEntry) error {
+	return storeDataKey(ks.db, entry)
+}
+
+func storeDataKey(db execer, entry *DataKeyEntry) error {
+	entry.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize data key entry: %w", err)
+	}
+
+	query := `
+		INSERT OR REPLACE INTO data_keys (project_id, environment, data, updated_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	if _, err := db.Exec(query, entry.ProjectID, entry.Environment, data, entry.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to store data key: %w", err)
+	}
+
+	return nil
+}
+
+// GetDataKey retrieves the wrapped data key of an environment
+func (ks *Keystore) GetDataKey(projectID, environment string) (*DataKeyEntry, error) {
+	query := `SELECT data FROM data_keys WHERE project_id = ? AND environment = ?`
+
+	var data []byte
+	err := ks.db.QueryRow(query, projectID, environment).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get data key: %w", err)
+	}
+
+	var entry DataKeyEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to deserialize data key entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// ListDataKeys returns the wrapped data keys of a project
+func (ks *Keystore) ListDataKeys(projectID string) ([]*DataKeyEntry, error) {
+	query := `SELECT data FROM data_keys WHERE project_id = ? ORDER BY environment`
+
+	rows, err := ks.db.Query(query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list data keys: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*DataKeyEntry
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan data key: %w", err)
+		}
+
+		var entry DataKeyEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to deserialize data key entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate data keys: %w", err)
+	}
+
+	return entries, nil
+}
+
+// DeleteDataKey removes the data key of an environment
+func (ks *Keystore) DeleteDataKey(projectID, environment string) error {
+	result, err := ks.db.Exec(`DELETE FROM data_keys WHERE project_id = ? AND environment = ?`, projectID, environment)
+	if err != nil {
+		return fmt.Errorf("failed to delete data key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
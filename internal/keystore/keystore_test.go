@@ -127,6 +127,55 @@ func TestKeystore_GetKey_NotFound(t *testing.T) {
 	}
 }
 
+func TestKeystore_ImportKey(t *testing.T) {
+	legacyDir := t.TempDir()
+	legacy, err := NewKeystore(legacyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.StoreKey("my-app", &KeyEntry{ProjectID: "my-app", Salt: []byte("legacy-salt"), VerificationHash: "legacy-hash"})
+	legacy.Close()
+
+	ks, err := NewKeystore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+
+	// Missing keystores and keys copy nothing
+	emptyDir := t.TempDir()
+	if copied, err := ks.ImportKey(emptyDir, "my-app", "proj-1"); err != nil || copied {
+		t.Errorf("ImportKey(missing keystore) = %v, %v", copied, err)
+	}
+	if _, err := os.Stat(filepath.Join(emptyDir, keystoreDBName)); !os.IsNotExist(err) {
+		t.Error("ImportKey() created the keystore it imports from")
+	}
+	if copied, err := ks.ImportKey(legacyDir, "other-app", "proj-1"); err != nil || copied {
+		t.Errorf("ImportKey(missing key) = %v, %v", copied, err)
+	}
+
+	copied, err := ks.ImportKey(legacyDir, "my-app", "proj-1")
+	if err != nil || !copied {
+		t.Fatalf("ImportKey() = %v, %v, want copied", copied, err)
+	}
+	entry, err := ks.GetKey("proj-1")
+	if err != nil {
+		t.Fatalf("GetKey() error = %v", err)
+	}
+	if string(entry.Salt) != "legacy-salt" || entry.VerificationHash != "legacy-hash" || entry.ProjectID != "proj-1" {
+		t.Errorf("imported key = %+v", entry)
+	}
+
+	// An existing key is never replaced
+	ks.StoreKey("proj-2", &KeyEntry{ProjectID: "proj-2", Salt: []byte("own-salt")})
+	if copied, err := ks.ImportKey(legacyDir, "my-app", "proj-2"); err != nil || copied {
+		t.Errorf("ImportKey(existing key) = %v, %v", copied, err)
+	}
+	if entry, _ := ks.GetKey("proj-2"); string(entry.Salt) != "own-salt" {
+		t.Errorf("ImportKey() replaced an existing key: %+v", entry)
+	}
+}
+
 func TestKeystore_DeleteKey(t *testing.T) {
 	tmpDir, err := ioutil.TempDir("", "keystore_test")
 	if err != nil {
@@ -487,13 +536,13 @@ func TestKeystore_Schema(t *testing.T) {
 		t.Fatalf("Failed to query schema version: %v", err)
 	}
 
-	// Should have migrations 1 and 2 applied
-	if version != 2 {
-		t.Errorf("Schema version = %d, want 2", version)
+	// Should have migrations 1 to 3 applied
+	if version != 3 {
+		t.Errorf("Schema version = %d, want 3", version)
 	}
 
 	// Verify tables exist
-	tables := []string{"keys", "environment_keys", "schema_version"}
+	tables := []string{"keys", "environment_keys", "data_keys", "schema_version"}
 	for _, table := range tables {
 		var count int
 		query := fmt.Sprintf("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='%s'", table)
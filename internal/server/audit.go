@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one request to the serve API. Values are never logged.
+type AuditEntry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Client      string    `json:"client,omitempty"`
+	Remote      string    `json:"remote,omitempty"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Action      string    `json:"action,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Key         string    `json:"key,omitempty"`
+	Status      int       `json:"status"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// AuditLog appends audit entries as JSON lines
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// NewAuditLog writes audit entries to w
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// OpenAuditLog appends audit entries to the file at path, which is created
+// readable by the owner only
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &AuditLog{w: file, c: file}, nil
+}
+
+// Record appends an entry to the log
+func (a *AuditLog) Record(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying file
+func (a *AuditLog) Close() error {
+	if a.c == nil {
+		return nil
+	}
+	return a.c.Close()
+}
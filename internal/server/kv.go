@@ -0,0 +1,499 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+// The KV v2 view maps every environment to a secret of the mount and every
+// variable to a field of that secret, so `GET /v1/secret/data/production`
+// returns all production variables. With a HistoryBackend each recorded
+// change of a variable is a version of the secret; other backends only
+// have the current version.
+
+// validateKVMount rejects mounts that would shadow the native API
+func validateKVMount(mount string) error {
+	if strings.Contains(mount, "/") || mount == "environments" || mount == "sys" {
+		return fmt.Errorf("invalid KV mount %q", mount)
+	}
+	return nil
+}
+
+func (s *Server) registerKV(mount string) {
+	prefix := "/v1/" + mount
+
+	s.mux.HandleFunc("GET "+prefix+"/data/{env}", s.handleKVRead)
+	s.mux.HandleFunc("PUT "+prefix+"/data/{env}", s.handleKVWrite)
+	s.mux.HandleFunc("POST "+prefix+"/data/{env}", s.handleKVWrite)
+	s.mux.HandleFunc("GET "+prefix+"/metadata/{env}", s.handleKVMetadata)
+	s.mux.HandleFunc("GET "+prefix+"/metadata", s.handleKVList)
+	s.mux.HandleFunc("GET "+prefix+"/metadata/{$}", s.handleKVList)
+	s.mux.HandleFunc("LIST "+prefix+"/metadata", s.handleKVList)
+	s.mux.HandleFunc("LIST "+prefix+"/metadata/{$}", s.handleKVList)
+
+	// Vault clients look up the KV version of a mount before using it
+	s.mux.HandleFunc("GET /v1/sys/internal/ui/mounts/{path...}", s.handleKVMount)
+}
+
+// isKVPath reports whether a request targets the KV v2 API
+func (s *Server) isKVPath(path string) bool {
+	if s.opts.KVMount == "" {
+		return false
+	}
+	return strings.HasPrefix(path, "/v1/"+s.opts.KVMount+"/") || strings.HasPrefix(path, "/v1/sys/")
+}
+
+// kvResponse is the envelope of every Vault response
+type kvResponse struct {
+	RequestID     string      `json:"request_id"`
+	LeaseID       string      `json:"lease_id"`
+	Renewable     bool        `json:"renewable"`
+	LeaseDuration int         `json:"lease_duration"`
+	Data          interface{} `json:"data"`
+	WrapInfo      interface{} `json:"wrap_info"`
+	Warnings      []string    `json:"warnings"`
+	Auth          interface{} `json:"auth"`
+}
+
+// kvVersionMetadata describes one version of a secret
+type kvVersionMetadata struct {
+	CreatedTime    string            `json:"created_time"`
+	CustomMetadata map[string]string `json:"custom_metadata"`
+	DeletionTime   string            `json:"deletion_time"`
+	Destroyed      bool              `json:"destroyed"`
+	Version        int               `json:"version"`
+}
+
+// kvChange is one recorded change of a variable
+type kvChange struct {
+	id      int64
+	key     string
+	value   string
+	deleted bool
+	at      time.Time
+}
+
+// kvSecret is the KV v2 view of an environment
+type kvSecret struct {
+	// versions holds the creation time of every version, oldest first
+	versions []time.Time
+
+	// changes replays older versions; nil without history
+	changes []kvChange
+}
+
+// current returns the number of the latest version, 0 if the secret
+// does not exist
+func (k *kvSecret) current() int {
+	return len(k.versions)
+}
+
+// data returns the variables as they were at a version
+func (k *kvSecret) data(version int) map[string]string {
+	vars := make(map[string]string)
+	for _, c := range k.changes[:version] {
+		if c.deleted {
+			delete(vars, c.key)
+		} else {
+			vars[c.key] = c.value
+		}
+	}
+	return vars
+}
+
+func (s *Server) handleKVRead(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.kvBackend(w, r, "KV_READ", false)
+	if !ok {
+		return
+	}
+
+	vars, err := readAll(r.Context(), backend)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+
+	secret, err := loadKVSecret(backend, vars)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+
+	version := secret.current()
+	if v := r.URL.Query().Get("version"); v != "" && v != "0" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			req.audit.Error = "invalid version"
+			writeKVError(w, http.StatusBadRequest, "invalid version "+v)
+			return
+		}
+		version = n
+	}
+
+	if version == 0 || version > secret.current() {
+		req.audit.Error = "version not found"
+		writeKVError(w, http.StatusNotFound)
+		return
+	}
+	if version < secret.current() {
+		if secret.changes == nil {
+			req.audit.Error = "version not found"
+			writeKVError(w, http.StatusNotFound)
+			return
+		}
+		vars = secret.data(version)
+	}
+
+	writeKVResponse(w, http.StatusOK, map[string]interface{}{
+		"data":     vars,
+		"metadata": secret.versionMetadata(version),
+	})
+}
+
+func (s *Server) handleKVWrite(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.kvBackend(w, r, "KV_WRITE", true)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Data    map[string]json.RawMessage `json:"data"`
+		Options struct {
+			CAS *int `json:"cas"`
+		} `json:"options"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxValueSize)).Decode(&body); err != nil || body.Data == nil {
+		req.audit.Error = "invalid request body"
+		writeKVError(w, http.StatusBadRequest, "no data provided")
+		return
+	}
+	for key := range body.Data {
+		if !storage.IsValidVariableName(key) {
+			req.audit.Error = "invalid variable name"
+			writeKVError(w, http.StatusBadRequest, fmt.Sprintf("%v: %s", storage.ErrInvalidName, key))
+			return
+		}
+	}
+
+	// The environment must not change between the check-and-set and the
+	// commit
+	defer s.lockEnvironment(r.PathValue("env"))()
+
+	vars, err := readAll(r.Context(), backend)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+
+	if body.Options.CAS != nil {
+		secret, err := loadKVSecret(backend, vars)
+		if err != nil {
+			s.kvFail(w, req, err)
+			return
+		}
+		if *body.Options.CAS != secret.current() {
+			req.audit.Error = "check-and-set mismatch"
+			writeKVError(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+			return
+		}
+	}
+
+	// A write replaces the secret, so variables missing from the body are
+	// deleted. Unchanged variables are left alone to keep their history.
+	tx, err := storage.BeginTx(backend)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+	keys := make([]string, 0, len(body.Data))
+	for key := range body.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := kvFieldValue(body.Data[key])
+		if current, exists := vars[key]; exists && current == value {
+			continue
+		}
+		if err := tx.Set(key, value, true); err != nil {
+			tx.Rollback()
+			s.kvFail(w, req, err)
+			return
+		}
+	}
+	for key := range vars {
+		if _, keep := body.Data[key]; !keep {
+			if err := tx.Delete(key); err != nil {
+				tx.Rollback()
+				s.kvFail(w, req, err)
+				return
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+
+	written := make(map[string]string, len(body.Data))
+	for key, raw := range body.Data {
+		written[key] = kvFieldValue(raw)
+	}
+	secret, err := loadKVSecret(backend, written)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+
+	writeKVResponse(w, http.StatusOK, secret.versionMetadata(secret.current()))
+}
+
+func (s *Server) handleKVMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("list") == "true" {
+		// Environments are secrets, not folders
+		requestFrom(r).audit.Action = "KV_LIST"
+		writeKVError(w, http.StatusNotFound)
+		return
+	}
+
+	backend, req, ok := s.kvBackend(w, r, "KV_METADATA", false)
+	if !ok {
+		return
+	}
+
+	vars, err := readAll(r.Context(), backend)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+
+	secret, err := loadKVSecret(backend, vars)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return
+	}
+	if secret.current() == 0 {
+		req.audit.Error = "secret not found"
+		writeKVError(w, http.StatusNotFound)
+		return
+	}
+
+	versions := make(map[string]interface{}, len(secret.versions))
+	for i := range secret.versions {
+		m := secret.versionMetadata(i + 1)
+		versions[strconv.Itoa(i+1)] = map[string]interface{}{
+			"created_time":  m.CreatedTime,
+			"deletion_time": m.DeletionTime,
+			"destroyed":     m.Destroyed,
+		}
+	}
+
+	writeKVResponse(w, http.StatusOK, map[string]interface{}{
+		"cas_required":         false,
+		"created_time":         kvTime(secret.versions[0]),
+		"current_version":      secret.current(),
+		"custom_metadata":      nil,
+		"delete_version_after": "0s",
+		"max_versions":         0,
+		"oldest_version":       1,
+		"updated_time":         kvTime(secret.versions[secret.current()-1]),
+		"versions":             versions,
+	})
+}
+
+func (s *Server) handleKVList(w http.ResponseWriter, r *http.Request) {
+	req := requestFrom(r)
+	req.audit.Action = "KV_LIST"
+
+	if r.Method == http.MethodGet && r.URL.Query().Get("list") != "true" {
+		req.audit.Error = "unsupported path"
+		writeKVError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	keys := []string{}
+	for env := range s.environments {
+		if req.client.CanRead(env) {
+			keys = append(keys, env)
+		}
+	}
+	if len(keys) == 0 {
+		writeKVError(w, http.StatusNotFound)
+		return
+	}
+	sort.Strings(keys)
+
+	writeKVResponse(w, http.StatusOK, map[string][]string{"keys": keys})
+}
+
+func (s *Server) handleKVMount(w http.ResponseWriter, r *http.Request) {
+	req := requestFrom(r)
+	req.audit.Action = "KV_MOUNT"
+
+	path := r.PathValue("path")
+	if path != s.opts.KVMount && !strings.HasPrefix(path, s.opts.KVMount+"/") {
+		req.audit.Error = "unknown mount"
+		writeKVError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	writeKVResponse(w, http.StatusOK, map[string]interface{}{
+		"path":    s.opts.KVMount + "/",
+		"type":    "kv",
+		"options": map[string]string{"version": "2"},
+	})
+}
+
+// kvBackend is environmentBackend with Vault errors
+func (s *Server) kvBackend(w http.ResponseWriter, r *http.Request, action string, write bool) (storage.Backend, *request, bool) {
+	req := requestFrom(r)
+	req.audit.Action = action
+
+	env := r.PathValue("env")
+	req.audit.Environment = env
+
+	if status, message := s.access(req, env, write); status != 0 {
+		if status == http.StatusNotFound {
+			writeKVError(w, status)
+		} else {
+			writeKVError(w, status, "permission denied", message)
+		}
+		return nil, req, false
+	}
+
+	backend, err := s.backend(env)
+	if err != nil {
+		s.kvFail(w, req, err)
+		return nil, req, false
+	}
+
+	return backend, req, true
+}
+
+// kvFail answers a KV request that failed in the storage layer
+func (s *Server) kvFail(w http.ResponseWriter, req *request, err error) {
+	req.audit.Error = err.Error()
+
+	switch {
+	case errors.Is(err, storage.ErrInvalidName):
+		writeKVError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeKVError(w, http.StatusServiceUnavailable, "request cancelled")
+	default:
+		writeKVError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// loadKVSecret builds the versions of an environment whose current
+// variables are vars
+func loadKVSecret(backend storage.Backend, vars map[string]string) (*kvSecret, error) {
+	hb, ok := storage.AsHistoryBackend(backend)
+	if !ok {
+		if len(vars) == 0 {
+			return &kvSecret{}, nil
+		}
+		return &kvSecret{versions: []time.Time{{}}}, nil
+	}
+
+	changes, err := kvChanges(hb)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &kvSecret{changes: changes}
+	for _, c := range changes {
+		secret.versions = append(secret.versions, c.at)
+	}
+
+	return secret, nil
+}
+
+// kvChanges returns every recorded change of an environment, oldest first
+func kvChanges(hb storage.HistoryBackend) ([]kvChange, error) {
+	history, err := hb.GetEnvironmentHistory(math.MaxInt32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+
+	changes := make([]kvChange, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		changes = append(changes, kvChange{
+			id:      h.ID,
+			key:     h.Key,
+			value:   h.Value,
+			deleted: h.ChangeType == "DELETE",
+			at:      h.ChangedAt,
+		})
+	}
+
+	return changes, nil
+}
+
+func (k *kvSecret) versionMetadata(version int) kvVersionMetadata {
+	if version == 0 {
+		return kvVersionMetadata{}
+	}
+	return kvVersionMetadata{
+		CreatedTime: kvTime(k.versions[version-1]),
+		Version:     version,
+	}
+}
+
+// readAll returns the current variables of an environment
+func readAll(ctx context.Context, backend storage.Backend) (map[string]string, error) {
+	return storage.GetAll(ctx, backend)
+}
+
+// kvFieldValue converts a secret field to a variable value. Strings are
+// stored as they are, other JSON values as their JSON text.
+func kvFieldValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func kvTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func writeKVResponse(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, status, kvResponse{
+		RequestID: newRequestID(),
+		Data:      data,
+	})
+}
+
+// writeKVError writes a Vault error. Vault answers a missing secret with
+// an empty error list.
+func writeKVError(w http.ResponseWriter, status int, messages ...string) {
+	if messages == nil {
+		messages = []string{}
+	}
+	writeJSON(w, status, map[string][]string{"errors": messages})
+}
+
+// newRequestID returns a random UUID for the response envelope
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
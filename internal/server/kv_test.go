@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+type kvTestResponse struct {
+	Data struct {
+		Data     map[string]string `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+		Keys           []string                   `json:"keys"`
+		Version        int                        `json:"version"`
+		CurrentVersion int                        `json:"current_version"`
+		Versions       map[string]json.RawMessage `json:"versions"`
+		Type           string                     `json:"type"`
+		Options        map[string]string          `json:"options"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func newKVTestServer(t *testing.T, open func(env string) (storage.Backend, error)) (*Server, string) {
+	t.Helper()
+
+	tokens, err := OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("OpenTokenStore() error = %v", err)
+	}
+	token, err := tokens.Add("tool", nil, true)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	srv, err := New(Options{
+		Environments: []string{"development", "production"},
+		Open:         open,
+		Tokens:       tokens,
+		Audit:        NewAuditLog(&bytes.Buffer{}),
+		AllowWrite:   true,
+		KVMount:      "secret",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	return srv, token
+}
+
+func kvDo(t *testing.T, srv *Server, method, path, token, body string) (int, kvTestResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	var resp kvTestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: invalid response %q", method, path, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestKV_ReadWriteList(t *testing.T) {
+	backends := map[string]*storage.MemoryBackend{
+		"development": storage.NewMemoryBackend(),
+		"production":  storage.NewMemoryBackend(),
+	}
+	backends["development"].Set("API_KEY", "dev-key", false)
+	srv, token := newKVTestServer(t, func(env string) (storage.Backend, error) {
+		return backends[env], nil
+	})
+
+	status, resp := kvDo(t, srv, http.MethodGet, "/v1/secret/data/development", token, "")
+	if status != http.StatusOK || resp.Data.Data["API_KEY"] != "dev-key" || resp.Data.Metadata.Version != 1 {
+		t.Errorf("read = %d %+v", status, resp)
+	}
+
+	// An environment without variables is a missing secret
+	if status, resp := kvDo(t, srv, http.MethodGet, "/v1/secret/data/production", token, ""); status != http.StatusNotFound || len(resp.Errors) != 0 {
+		t.Errorf("read empty environment = %d %+v", status, resp)
+	}
+
+	status, _ = kvDo(t, srv, http.MethodPost, "/v1/secret/data/development", token,
+		`{"data":{"DATABASE_URL":"postgres://db","PORT":8080}}`)
+	if status != http.StatusOK {
+		t.Fatalf("write status = %d", status)
+	}
+
+	// A write replaces the secret
+	vars, _ := readAll(context.Background(), backends["development"])
+	if len(vars) != 2 || vars["DATABASE_URL"] != "postgres://db" || vars["PORT"] != "8080" {
+		t.Errorf("variables after write = %v", vars)
+	}
+
+	for _, method := range []string{"LIST", http.MethodGet} {
+		path := "/v1/secret/metadata/"
+		if method == http.MethodGet {
+			path += "?list=true"
+		}
+		status, resp := kvDo(t, srv, method, path, token, "")
+		if status != http.StatusOK || strings.Join(resp.Data.Keys, ",") != "development,production" {
+			t.Errorf("%s list = %d %v", method, status, resp.Data.Keys)
+		}
+	}
+
+	status, resp = kvDo(t, srv, http.MethodGet, "/v1/sys/internal/ui/mounts/secret/data/development", token, "")
+	if status != http.StatusOK || resp.Data.Type != "kv" || resp.Data.Options["version"] != "2" {
+		t.Errorf("mount lookup = %d %+v", status, resp.Data)
+	}
+}
+
+func TestKV_Errors(t *testing.T) {
+	srv, token := newKVTestServer(t, func(env string) (storage.Backend, error) {
+		return storage.NewMemoryBackend(), nil
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"missing token", http.MethodGet, "/v1/secret/data/development", "", "", http.StatusForbidden},
+		{"unknown environment", http.MethodGet, "/v1/secret/data/staging", token, "", http.StatusNotFound},
+		{"old version without history", http.MethodGet, "/v1/secret/data/development?version=3", token, "", http.StatusNotFound},
+		{"write without data", http.MethodPut, "/v1/secret/data/development", token, `{}`, http.StatusBadRequest},
+		{"invalid variable name", http.MethodPut, "/v1/secret/data/development", token, `{"data":{"1-BAD":"x"}}`, http.StatusBadRequest},
+		{"cas mismatch", http.MethodPut, "/v1/secret/data/development", token, `{"data":{"A":"1"},"options":{"cas":2}}`, http.StatusBadRequest},
+		{"unknown mount", http.MethodGet, "/v1/sys/internal/ui/mounts/kv/data/x", token, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := kvDo(t, srv, tt.method, tt.path, tt.token, tt.body)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if resp.Errors == nil {
+				t.Error("response has no errors list")
+			}
+		})
+	}
+}
+
+func TestKV_VersionsFromHistory(t *testing.T) {
+	dir := t.TempDir()
+	srv, token := newKVTestServer(t, func(env string) (storage.Backend, error) {
+		return storage.NewSQLiteBackend(dir, env)
+	})
+
+	writes := []string{
+		`{"data":{"A":"1","B":"1"}}`,             // versions 1-2
+		`{"data":{"A":"2","B":"1"}}`,             // version 3
+		`{"data":{"A":"2"},"options":{"cas":3}}`, // version 4 deletes B
+	}
+	for i, body := range writes {
+		status, resp := kvDo(t, srv, http.MethodPut, "/v1/secret/data/development", token, body)
+		if status != http.StatusOK {
+			t.Fatalf("write %d status = %d %v", i, status, resp.Errors)
+		}
+	}
+
+	status, resp := kvDo(t, srv, http.MethodGet, "/v1/secret/metadata/development", token, "")
+	if status != http.StatusOK || resp.Data.CurrentVersion != 4 || len(resp.Data.Versions) != 4 {
+		t.Fatalf("metadata = %d %+v", status, resp.Data)
+	}
+
+	tests := []struct {
+		version string
+		want    map[string]string
+	}{
+		{"", map[string]string{"A": "2"}},
+		{"2", map[string]string{"A": "1", "B": "1"}},
+		{"3", map[string]string{"A": "2", "B": "1"}},
+		{"4", map[string]string{"A": "2"}},
+	}
+
+	for _, tt := range tests {
+		path := "/v1/secret/data/development"
+		if tt.version != "" {
+			path += "?version=" + tt.version
+		}
+
+		status, resp := kvDo(t, srv, http.MethodGet, path, token, "")
+		if status != http.StatusOK {
+			t.Errorf("version %q: status = %d", tt.version, status)
+			continue
+		}
+		if len(resp.Data.Data) != len(tt.want) {
+			t.Errorf("version %q: data = %v, want %v", tt.version, resp.Data.Data, tt.want)
+		}
+		for k, v := range tt.want {
+			if resp.Data.Data[k] != v {
+				t.Errorf("version %q: %s = %q, want %q", tt.version, k, resp.Data.Data[k], v)
+			}
+		}
+	}
+
+	// A stale check-and-set is rejected
+	if status, _ := kvDo(t, srv, http.MethodPut, "/v1/secret/data/development", token, `{"data":{"A":"3"},"options":{"cas":3}}`); status != http.StatusBadRequest {
+		t.Errorf("stale cas status = %d, want 400", status)
+	}
+}
+
+func TestKV_ConcurrentCAS(t *testing.T) {
+	dir := t.TempDir()
+	srv, token := newKVTestServer(t, func(env string) (storage.Backend, error) {
+		backend, err := storage.NewSQLiteBackend(dir, env)
+		if err != nil {
+			return nil, err
+		}
+		// Decryption keeps the writers busy between check and commit
+		return storage.NewEncryptedBackend(backend, "test-password")
+	})
+
+	if status, resp := kvDo(t, srv, http.MethodPut, "/v1/secret/data/development", token, `{"data":{"A":"0"}}`); status != http.StatusOK {
+		t.Fatalf("initial write status = %d %v", status, resp.Errors)
+	}
+
+	// Writers that all saw version 1 race; only one may win
+	const writers = 4
+	statuses := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"data":{"A":"%d"},"options":{"cas":1}}`, i+1)
+			req := httptest.NewRequest(http.MethodPut, "/v1/secret/data/development", strings.NewReader(body))
+			req.Header.Set("X-Vault-Token", token)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			statuses <- rec.Code
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d check-and-set writes succeeded, want 1", succeeded)
+	}
+
+	_, resp := kvDo(t, srv, http.MethodGet, "/v1/secret/metadata/development", token, "")
+	if resp.Data.CurrentVersion != 2 {
+		t.Errorf("current_version = %d, want 2", resp.Data.CurrentVersion)
+	}
+}
+
+func TestNew_InvalidKVMount(t *testing.T) {
+	for _, mount := range []string{"environments", "sys", "a/b"} {
+		_, err := New(Options{
+			Open:    func(string) (storage.Backend, error) { return nil, nil },
+			Tokens:  &TokenStore{clients: map[string]*Client{}},
+			Audit:   NewAuditLog(&bytes.Buffer{}),
+			KVMount: mount,
+		})
+		if err == nil {
+			t.Errorf("New() accepted mount %q", mount)
+		}
+	}
+}
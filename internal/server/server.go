@@ -0,0 +1,457 @@
+// Package server implements the local secrets API behind `vaultenv serve`.
+// The vault is unlocked once when the server starts; clients authenticate
+// with per-client tokens and every request is written to an audit log.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/internal/ui"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+// maxValueSize limits the body of a write request
+const maxValueSize = 1 << 20
+
+// Options configures a Server
+type Options struct {
+	// Environments that may be served
+	Environments []string
+
+	// Open returns the unlocked backend of an environment. It is called
+	// once per environment; the server closes the backends on Close.
+	Open func(environment string) (storage.Backend, error)
+
+	// Tokens authenticates clients
+	Tokens *TokenStore
+
+	// Audit receives an entry for every request
+	Audit *AuditLog
+
+	// AllowWrite enables the write endpoints for clients with write access
+	AllowWrite bool
+
+	// KVMount also serves the HashiCorp Vault KV v2 API on this mount when
+	// set, with every environment as a secret of the mount
+	KVMount string
+}
+
+// Server serves the variables of a vault over HTTP
+type Server struct {
+	opts         Options
+	environments map[string]bool
+	mux          *http.ServeMux
+
+	mu       sync.Mutex
+	backends map[string]storage.Backend
+
+	// writeLocks serialize the writes to an environment so a KV
+	// check-and-set sees no change between its check and its commit
+	writeLocks map[string]*sync.Mutex
+}
+
+// requestKey is the context key of the per-request state
+type requestKey struct{}
+
+// request is the state of an authenticated request
+type request struct {
+	client *Client
+	audit  *AuditEntry
+}
+
+// New creates a server
+func New(opts Options) (*Server, error) {
+	if opts.Open == nil {
+		return nil, fmt.Errorf("open function cannot be nil")
+	}
+	if opts.Tokens == nil {
+		return nil, fmt.Errorf("token store cannot be nil")
+	}
+	if opts.Audit == nil {
+		return nil, fmt.Errorf("audit log cannot be nil")
+	}
+	if opts.KVMount != "" {
+		if err := validateKVMount(opts.KVMount); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Server{
+		opts:         opts,
+		environments: make(map[string]bool),
+		mux:          http.NewServeMux(),
+		backends:     make(map[string]storage.Backend),
+		writeLocks:   make(map[string]*sync.Mutex),
+	}
+	for _, env := range opts.Environments {
+		s.environments[env] = true
+	}
+
+	s.mux.HandleFunc("GET /v1/environments", s.handleListEnvironments)
+	s.mux.HandleFunc("GET /v1/environments/{env}", s.handleReadEnvironment)
+	s.mux.HandleFunc("GET /v1/environments/{env}/variables", s.handleListVariables)
+	s.mux.HandleFunc("GET /v1/environments/{env}/variables/{key}", s.handleGetVariable)
+	s.mux.HandleFunc("PUT /v1/environments/{env}/variables/{key}", s.handleSetVariable)
+	s.mux.HandleFunc("DELETE /v1/environments/{env}/variables/{key}", s.handleDeleteVariable)
+
+	if opts.KVMount != "" {
+		s.registerKV(opts.KVMount)
+	}
+
+	return s, nil
+}
+
+// ServeHTTP authenticates the request, dispatches it and audits the result
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	entry := &AuditEntry{
+		Timestamp: time.Now().UTC(),
+		Remote:    r.RemoteAddr,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}
+
+	defer func() {
+		entry.Status = rec.status
+		entry.Success = rec.status < 400
+		if err := s.opts.Audit.Record(*entry); err != nil {
+			ui.Warning("Failed to write audit log: %v", err)
+		}
+	}()
+
+	client, ok := s.opts.Tokens.Authenticate(requestToken(r))
+	if !ok {
+		entry.Error = "invalid token"
+		if s.isKVPath(r.URL.Path) {
+			writeKVError(rec, http.StatusForbidden, "permission denied")
+		} else {
+			writeError(rec, http.StatusUnauthorized, "missing or invalid token")
+		}
+		return
+	}
+	entry.Client = client.Name
+
+	ctx := context.WithValue(r.Context(), requestKey{}, &request{client: client, audit: entry})
+	s.mux.ServeHTTP(rec, r.WithContext(ctx))
+}
+
+// Serve accepts connections on ln until ctx is cancelled, then shuts
+// down gracefully
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// Close closes the backends opened by the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for env, backend := range s.backends {
+		if err := backend.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.backends, env)
+	}
+
+	return firstErr
+}
+
+func (s *Server) handleListEnvironments(w http.ResponseWriter, r *http.Request) {
+	req := requestFrom(r)
+	req.audit.Action = "LIST_ENVIRONMENTS"
+
+	envs := []string{}
+	for env := range s.environments {
+		if req.client.CanRead(env) {
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+
+	writeJSON(w, http.StatusOK, map[string][]string{"environments": envs})
+}
+
+func (s *Server) handleReadEnvironment(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.readBackend(w, r, "READ_ENVIRONMENT")
+	if !ok {
+		return
+	}
+
+	vars, err := readAll(r.Context(), backend)
+	if err != nil {
+		s.fail(w, req, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"environment": req.audit.Environment,
+		"variables":   vars,
+	})
+}
+
+func (s *Server) handleListVariables(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.readBackend(w, r, "LIST")
+	if !ok {
+		return
+	}
+
+	keys, err := storage.WithContext(backend).ListContext(r.Context())
+	if err != nil {
+		s.fail(w, req, err)
+		return
+	}
+	sort.Strings(keys)
+
+	writeJSON(w, http.StatusOK, map[string][]string{"keys": keys})
+}
+
+func (s *Server) handleGetVariable(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.readBackend(w, r, "GET")
+	if !ok {
+		return
+	}
+
+	key := r.PathValue("key")
+	req.audit.Key = key
+
+	value, err := storage.WithContext(backend).GetContext(r.Context(), key)
+	if err != nil {
+		s.fail(w, req, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"key": key, "value": value})
+}
+
+func (s *Server) handleSetVariable(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.writeBackend(w, r, "SET")
+	if !ok {
+		return
+	}
+
+	key := r.PathValue("key")
+	req.audit.Key = key
+
+	if !storage.IsValidVariableName(key) {
+		req.audit.Error = "invalid variable name"
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%v: %s", storage.ErrInvalidName, key))
+		return
+	}
+
+	var body struct {
+		Value *string `json:"value"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxValueSize)).Decode(&body); err != nil || body.Value == nil {
+		req.audit.Error = "invalid request body"
+		writeError(w, http.StatusBadRequest, `request body must be {"value": "..."}`)
+		return
+	}
+
+	defer s.lockEnvironment(r.PathValue("env"))()
+
+	if err := storage.WithContext(backend).SetContext(r.Context(), key, *body.Value, true); err != nil {
+		s.fail(w, req, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeleteVariable(w http.ResponseWriter, r *http.Request) {
+	backend, req, ok := s.writeBackend(w, r, "DELETE")
+	if !ok {
+		return
+	}
+
+	key := r.PathValue("key")
+	req.audit.Key = key
+
+	defer s.lockEnvironment(r.PathValue("env"))()
+
+	cb := storage.WithContext(backend)
+	exists, err := cb.ExistsContext(r.Context(), key)
+	if err == nil && !exists {
+		err = storage.ErrNotFound
+	}
+	if err == nil {
+		err = cb.DeleteContext(r.Context(), key)
+	}
+	if err != nil {
+		s.fail(w, req, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readBackend checks that the client may read the environment of the
+// request and returns its backend
+func (s *Server) readBackend(w http.ResponseWriter, r *http.Request, action string) (storage.Backend, *request, bool) {
+	return s.environmentBackend(w, r, action, false)
+}
+
+// writeBackend is readBackend for requests that change the environment
+func (s *Server) writeBackend(w http.ResponseWriter, r *http.Request, action string) (storage.Backend, *request, bool) {
+	return s.environmentBackend(w, r, action, true)
+}
+
+func (s *Server) environmentBackend(w http.ResponseWriter, r *http.Request, action string, write bool) (storage.Backend, *request, bool) {
+	req := requestFrom(r)
+	req.audit.Action = action
+
+	env := r.PathValue("env")
+	req.audit.Environment = env
+
+	if status, message := s.access(req, env, write); status != 0 {
+		writeError(w, status, message)
+		return nil, req, false
+	}
+
+	backend, err := s.backend(env)
+	if err != nil {
+		s.fail(w, req, err)
+		return nil, req, false
+	}
+
+	return backend, req, true
+}
+
+// access checks that the client of a request may use an environment. It
+// returns the status and message of the refusal, or 0 if access is granted.
+func (s *Server) access(req *request, env string, write bool) (int, string) {
+	if !s.environments[env] {
+		req.audit.Error = "unknown environment"
+		return http.StatusNotFound, fmt.Sprintf("environment %s not found", env)
+	}
+	if !req.client.CanRead(env) {
+		req.audit.Error = "access denied"
+		return http.StatusForbidden, fmt.Sprintf("client %s has no access to %s", req.client.Name, env)
+	}
+
+	if !write {
+		return 0, ""
+	}
+
+	if !s.opts.AllowWrite {
+		req.audit.Error = "writes disabled"
+		return http.StatusForbidden, "writes are disabled, start the server with --allow-write"
+	}
+	if !req.client.CanWrite(env) {
+		req.audit.Error = "write access denied"
+		return http.StatusForbidden, fmt.Sprintf("client %s may not write to %s", req.client.Name, env)
+	}
+
+	return 0, ""
+}
+
+// backend returns the cached backend of an environment, opening it on
+// first use
+func (s *Server) backend(env string) (storage.Backend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if backend, ok := s.backends[env]; ok {
+		return backend, nil
+	}
+
+	backend, err := s.opts.Open(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", env, err)
+	}
+	s.backends[env] = backend
+
+	return backend, nil
+}
+
+// lockEnvironment takes the write lock of an environment and returns the
+// function that releases it
+func (s *Server) lockEnvironment(env string) func() {
+	s.mu.Lock()
+	lock, ok := s.writeLocks[env]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.writeLocks[env] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// fail answers a request that failed in the storage layer
+func (s *Server) fail(w http.ResponseWriter, req *request, err error) {
+	req.audit.Error = err.Error()
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, http.StatusNotFound, "variable not found")
+	case errors.Is(err, storage.ErrInvalidName):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, "request cancelled")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// requestToken returns the bearer token of a request, or the
+// X-Vault-Token header sent by HashiCorp Vault clients
+func requestToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-Vault-Token"))
+}
+
+func requestFrom(r *http.Request) *request {
+	return r.Context().Value(requestKey{}).(*request)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// statusRecorder remembers the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
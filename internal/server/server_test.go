@@ -0,0 +1,411 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+type testServer struct {
+	server   *Server
+	backends map[string]*storage.MemoryBackend
+	audit    *bytes.Buffer
+	tokens   *TokenStore
+}
+
+func newTestServer(t *testing.T, allowWrite bool) *testServer {
+	t.Helper()
+
+	tokens, err := OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("OpenTokenStore() error = %v", err)
+	}
+
+	ts := &testServer{
+		backends: map[string]*storage.MemoryBackend{
+			"development": storage.NewMemoryBackend(),
+			"production":  storage.NewMemoryBackend(),
+		},
+		audit:  &bytes.Buffer{},
+		tokens: tokens,
+	}
+	ts.backends["development"].Set("API_KEY", "dev-key", false)
+	ts.backends["development"].Set("DATABASE_URL", "postgres://localhost/dev", false)
+	ts.backends["production"].Set("API_KEY", "prod-key", false)
+
+	ts.server, err = New(Options{
+		Environments: []string{"development", "production"},
+		Open: func(environment string) (storage.Backend, error) {
+			return ts.backends[environment], nil
+		},
+		Tokens:     tokens,
+		Audit:      NewAuditLog(ts.audit),
+		AllowWrite: allowWrite,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return ts
+}
+
+func (ts *testServer) token(t *testing.T, name string, envs []string, write bool) string {
+	t.Helper()
+
+	token, err := ts.tokens.Add(name, envs, write)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	return token
+}
+
+func (ts *testServer) do(method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, req)
+	return rec
+}
+
+func (ts *testServer) entries(t *testing.T) []AuditEntry {
+	t.Helper()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(bytes.NewReader(ts.audit.Bytes()))
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestServer_Authentication(t *testing.T) {
+	ts := newTestServer(t, false)
+	ts.token(t, "app", nil, false)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing token", ""},
+		{"unknown token", "vst_0000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do(http.MethodGet, "/v1/environments", tt.token, "")
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+
+	entries := ts.entries(t)
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Success || entry.Status != http.StatusUnauthorized {
+			t.Errorf("unauthorized request audited as %+v", entry)
+		}
+	}
+}
+
+func TestServer_TokenRevokedWhileRunning(t *testing.T) {
+	ts := newTestServer(t, false)
+	token := ts.token(t, "app", nil, false)
+
+	if rec := ts.do(http.MethodGet, "/v1/environments", token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// serve token revoke runs in another process with its own store
+	other, err := OpenTokenStore(ts.tokens.path)
+	if err != nil {
+		t.Fatalf("OpenTokenStore() error = %v", err)
+	}
+	if err := other.Revoke("app"); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if rec := ts.do(http.MethodGet, "/v1/environments", token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status with a revoked token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	added, err := other.Add("ci", nil, false)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if rec := ts.do(http.MethodGet, "/v1/environments", added, ""); rec.Code != http.StatusOK {
+		t.Errorf("status with a token added by another process = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// No token is accepted while the store cannot be read
+	os.WriteFile(ts.tokens.path, []byte("{"), 0600)
+	if rec := ts.do(http.MethodGet, "/v1/environments", added, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status with a damaged token store = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestServer_Read(t *testing.T) {
+	ts := newTestServer(t, false)
+	token := ts.token(t, "app", nil, false)
+
+	rec := ts.do(http.MethodGet, "/v1/environments", token, "")
+	var envs struct {
+		Environments []string `json:"environments"`
+	}
+	json.NewDecoder(rec.Body).Decode(&envs)
+	if rec.Code != http.StatusOK || strings.Join(envs.Environments, ",") != "development,production" {
+		t.Errorf("list environments = %d %v", rec.Code, envs.Environments)
+	}
+
+	rec = ts.do(http.MethodGet, "/v1/environments/development/variables", token, "")
+	var keys struct {
+		Keys []string `json:"keys"`
+	}
+	json.NewDecoder(rec.Body).Decode(&keys)
+	if rec.Code != http.StatusOK || strings.Join(keys.Keys, ",") != "API_KEY,DATABASE_URL" {
+		t.Errorf("list variables = %d %v", rec.Code, keys.Keys)
+	}
+
+	rec = ts.do(http.MethodGet, "/v1/environments/development/variables/API_KEY", token, "")
+	var value struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	json.NewDecoder(rec.Body).Decode(&value)
+	if rec.Code != http.StatusOK || value.Value != "dev-key" {
+		t.Errorf("get variable = %d %+v", rec.Code, value)
+	}
+
+	rec = ts.do(http.MethodGet, "/v1/environments/development", token, "")
+	var env struct {
+		Environment string            `json:"environment"`
+		Variables   map[string]string `json:"variables"`
+	}
+	json.NewDecoder(rec.Body).Decode(&env)
+	if rec.Code != http.StatusOK || len(env.Variables) != 2 || env.Variables["DATABASE_URL"] != "postgres://localhost/dev" {
+		t.Errorf("read environment = %d %+v", rec.Code, env)
+	}
+
+	if rec := ts.do(http.MethodHead, "/v1/environments/development/variables/API_KEY", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("HEAD existing = %d, want 200", rec.Code)
+	}
+	if rec := ts.do(http.MethodGet, "/v1/environments/development/variables/MISSING", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing = %d, want 404", rec.Code)
+	}
+	if rec := ts.do(http.MethodGet, "/v1/environments/staging/variables", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown environment = %d, want 404", rec.Code)
+	}
+}
+
+func TestServer_EnvironmentRestriction(t *testing.T) {
+	ts := newTestServer(t, false)
+	token := ts.token(t, "dev-only", []string{"development"}, false)
+
+	rec := ts.do(http.MethodGet, "/v1/environments", token, "")
+	var envs struct {
+		Environments []string `json:"environments"`
+	}
+	json.NewDecoder(rec.Body).Decode(&envs)
+	if len(envs.Environments) != 1 || envs.Environments[0] != "development" {
+		t.Errorf("environments = %v, want [development]", envs.Environments)
+	}
+
+	rec = ts.do(http.MethodGet, "/v1/environments/production/variables/API_KEY", token, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if strings.Contains(rec.Body.String(), "prod-key") {
+		t.Error("forbidden response leaked the value")
+	}
+}
+
+func TestServer_Write(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowWrite bool
+		write      bool
+		wantStatus int
+	}{
+		{"writes disabled", false, true, http.StatusForbidden},
+		{"read-only client", true, false, http.StatusForbidden},
+		{"write client", true, true, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, tt.allowWrite)
+			token := ts.token(t, "tool", nil, tt.write)
+
+			rec := ts.do(http.MethodPut, "/v1/environments/development/variables/NEW_KEY", token, `{"value":"new"}`)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("PUT status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			got, err := ts.backends["development"].Get("NEW_KEY")
+			if tt.wantStatus == http.StatusNoContent {
+				if err != nil || got != "new" {
+					t.Errorf("stored value = %q, %v", got, err)
+				}
+			} else if err == nil {
+				t.Error("rejected write changed the backend")
+			}
+
+			rec = ts.do(http.MethodDelete, "/v1/environments/development/variables/API_KEY", token, "")
+			if rec.Code != tt.wantStatus {
+				t.Errorf("DELETE status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServer_InvalidWriteBody(t *testing.T) {
+	ts := newTestServer(t, true)
+	token := ts.token(t, "tool", nil, true)
+
+	for _, body := range []string{"", "not json", `{"other":"x"}`} {
+		rec := ts.do(http.MethodPut, "/v1/environments/development/variables/KEY", token, body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("body %q: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	for _, key := range []string{"1KEY", "MY-KEY", "KEY%2Fx"} {
+		rec := ts.do(http.MethodPut, "/v1/environments/development/variables/"+key, token, `{"value":"x"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("key %q: status = %d, want 400", key, rec.Code)
+		}
+	}
+	if keys, _ := ts.backends["development"].List(); len(keys) != 2 {
+		t.Errorf("invalid keys were stored: %v", keys)
+	}
+}
+
+func TestServer_AuditNeverLogsValues(t *testing.T) {
+	ts := newTestServer(t, true)
+	token := ts.token(t, "tool", nil, true)
+
+	ts.do(http.MethodGet, "/v1/environments/development/variables/API_KEY", token, "")
+	ts.do(http.MethodPut, "/v1/environments/development/variables/SECRET", token, `{"value":"top-secret"}`)
+
+	if strings.Contains(ts.audit.String(), "dev-key") || strings.Contains(ts.audit.String(), "top-secret") {
+		t.Fatalf("audit log contains a value: %s", ts.audit.String())
+	}
+
+	entries := ts.entries(t)
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+
+	want := []struct{ action, key string }{{"GET", "API_KEY"}, {"SET", "SECRET"}}
+	for i, entry := range entries {
+		if entry.Client != "tool" || entry.Environment != "development" ||
+			entry.Action != want[i].action || entry.Key != want[i].key || !entry.Success {
+			t.Errorf("entry %d = %+v", i, entry)
+		}
+	}
+}
+
+func TestServer_ServeUnixSocket(t *testing.T) {
+	ts := newTestServer(t, false)
+	token := ts.token(t, "app", nil, false)
+
+	dir, err := os.MkdirTemp("", "vaultenv-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "serve.sock")
+
+	ln, err := ListenUnix(socket)
+	if err != nil {
+		t.Fatalf("ListenUnix() error = %v", err)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+
+	if _, err := ListenUnix(socket); err == nil {
+		t.Error("second ListenUnix() on a live socket should fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ts.server.Serve(ctx, ln) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://vaultenv/v1/environments/production/variables/API_KEY", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not stop after cancel")
+	}
+}
+
+func TestListenLoopback(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1:0", false},
+		{"localhost:0", false},
+		{"0.0.0.0:0", true},
+		{":0", true},
+		{"192.0.2.1:0", true},
+		{"no-port", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			ln, err := ListenLoopback(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListenLoopback(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+			if ln != nil {
+				ln.Close()
+			}
+		})
+	}
+}
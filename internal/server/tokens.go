@@ -0,0 +1,262 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// tokenPrefix marks serve tokens so they are easy to recognise in logs
+// and secret scanners
+const tokenPrefix = "vst_"
+
+var (
+	ErrClientExists   = errors.New("client already has a token")
+	ErrClientNotFound = errors.New("client not found")
+)
+
+// Client is a consumer of the serve API. Only a hash of its token is stored.
+type Client struct {
+	Name         string    `json:"name"`
+	TokenHash    string    `json:"token_hash"`
+	Environments []string  `json:"environments,omitempty"` // Empty allows every environment
+	Write        bool      `json:"write"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CanRead reports whether the client may read an environment
+func (c *Client) CanRead(environment string) bool {
+	if len(c.Environments) == 0 {
+		return true
+	}
+
+	for _, env := range c.Environments {
+		if env == environment {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanWrite reports whether the client may change an environment
+func (c *Client) CanWrite(environment string) bool {
+	return c.Write && c.CanRead(environment)
+}
+
+// TokenStore keeps the clients allowed to use the serve API in a JSON file.
+// The file is read again whenever it changes, so tokens added or revoked
+// by another process take effect in a running server.
+type TokenStore struct {
+	path string
+
+	mu      sync.RWMutex
+	clients map[string]*Client
+	loaded  os.FileInfo // The file the clients were read from, nil if missing
+}
+
+// OpenTokenStore loads the token store at path. A missing file is an
+// empty store.
+func OpenTokenStore(path string) (*TokenStore, error) {
+	ts := &TokenStore{path: path}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if err := ts.reload(); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// reload reads the file again if it changed since it was loaded. The
+// store is written by renaming a new file over it, so a change is a
+// different file; the modification time and size catch editors that
+// rewrite it in place.
+func (ts *TokenStore) reload() error {
+	info, err := os.Stat(ts.path)
+	if os.IsNotExist(err) {
+		if ts.clients == nil || ts.loaded != nil {
+			ts.clients = make(map[string]*Client)
+			ts.loaded = nil
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+	if ts.loaded != nil && os.SameFile(ts.loaded, info) &&
+		ts.loaded.ModTime().Equal(info.ModTime()) && ts.loaded.Size() == info.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(ts.path)
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	var clients []*Client
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return fmt.Errorf("failed to parse token store: %w", err)
+	}
+
+	ts.clients = make(map[string]*Client, len(clients))
+	for _, c := range clients {
+		ts.clients[c.Name] = c
+	}
+	ts.loaded = info
+
+	return nil
+}
+
+// Add creates a client and returns its token, which is not stored and
+// cannot be shown again
+func (ts *TokenStore) Add(name string, environments []string, write bool) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("client name cannot be empty")
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ts.reload(); err != nil {
+		return "", err
+	}
+	if _, exists := ts.clients[name]; exists {
+		return "", fmt.Errorf("%w: %s", ErrClientExists, name)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := tokenPrefix + hex.EncodeToString(raw)
+
+	ts.clients[name] = &Client{
+		Name:         name,
+		TokenHash:    hashToken(token),
+		Environments: environments,
+		Write:        write,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err := ts.save(); err != nil {
+		delete(ts.clients, name)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Revoke removes a client so its token stops working
+func (ts *TokenStore) Revoke(name string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ts.reload(); err != nil {
+		return err
+	}
+	client, exists := ts.clients[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, name)
+	}
+
+	delete(ts.clients, name)
+	if err := ts.save(); err != nil {
+		ts.clients[name] = client
+		return err
+	}
+
+	return nil
+}
+
+// List returns the clients sorted by name
+func (ts *TokenStore) List() []Client {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	clients := make([]Client, 0, len(ts.clients))
+	for _, c := range ts.clients {
+		clients = append(clients, *c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+
+	return clients
+}
+
+// Authenticate returns the client owning a token. The store is reloaded
+// first if its file changed; no token is accepted while it cannot be read.
+func (ts *TokenStore) Authenticate(token string) (*Client, bool) {
+	if token == "" {
+		return nil, false
+	}
+	hash := []byte(hashToken(token))
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ts.reload(); err != nil {
+		return nil, false
+	}
+
+	var found *Client
+	for _, c := range ts.clients {
+		// Compare every entry in constant time so timing reveals nothing
+		if subtle.ConstantTimeCompare(hash, []byte(c.TokenHash)) == 1 {
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+
+	client := *found
+	return &client, true
+}
+
+// save writes the store readable by the owner only
+func (ts *TokenStore) save() error {
+	clients := make([]*Client, 0, len(ts.clients))
+	for _, c := range ts.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+
+	data, err := json.MarshalIndent(clients, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal token store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0700); err != nil {
+		return fmt.Errorf("failed to create token store directory: %w", err)
+	}
+
+	tmpPath := ts.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmpPath, ts.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save token store: %w", err)
+	}
+
+	if info, err := os.Stat(ts.path); err == nil {
+		ts.loaded = info
+	}
+
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
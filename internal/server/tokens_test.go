@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serve", "tokens.json")
+
+	ts, err := OpenTokenStore(path)
+	if err != nil {
+		t.Fatalf("OpenTokenStore() error = %v", err)
+	}
+
+	token, err := ts.Add("app", []string{"development"}, false)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if !strings.HasPrefix(token, tokenPrefix) {
+		t.Errorf("token %q lacks prefix %q", token, tokenPrefix)
+	}
+
+	if _, err := ts.Add("app", nil, true); !errors.Is(err, ErrClientExists) {
+		t.Errorf("duplicate Add() error = %v, want ErrClientExists", err)
+	}
+
+	// The file holds the hash only and is private
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Error("token store contains the plain token")
+	}
+	info, _ := os.Stat(path)
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token store permissions = %o, want 600", perm)
+	}
+
+	// A reopened store authenticates the same token
+	reopened, err := OpenTokenStore(path)
+	if err != nil {
+		t.Fatalf("OpenTokenStore() error = %v", err)
+	}
+	client, ok := reopened.Authenticate(token)
+	if !ok || client.Name != "app" {
+		t.Fatalf("Authenticate() = %v, %v", client, ok)
+	}
+	if !client.CanRead("development") || client.CanRead("production") || client.CanWrite("development") {
+		t.Errorf("unexpected permissions for %+v", client)
+	}
+
+	if _, ok := reopened.Authenticate(token + "x"); ok {
+		t.Error("Authenticate() accepted a wrong token")
+	}
+
+	if err := reopened.Revoke("app"); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, ok := reopened.Authenticate(token); ok {
+		t.Error("revoked token still authenticates")
+	}
+	if err := reopened.Revoke("app"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("second Revoke() error = %v, want ErrClientNotFound", err)
+	}
+	if len(reopened.List()) != 0 {
+		t.Errorf("List() = %v, want empty", reopened.List())
+	}
+}
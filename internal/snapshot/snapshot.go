@@ -0,0 +1,505 @@
+// Package snapshot captures and restores the variables of a vault.
+//
+// A snapshot holds the stored form of every variable of one or more
+// environments together with their metadata. Values of encrypted vaults
+// are kept as the ciphertext the backend holds, and the snapshot itself is
+// encrypted with a key derived from the snapshot key of the vault. Every
+// snapshot file carries a SHA-256 checksum of its payload, so damaged
+// files are detected before anything is restored.
+package snapshot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/access"
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+// format is the version of the snapshot file layout. Snapshots of format 1
+// are encrypted with the legacy key, see Store.WithLegacyKey.
+const format = 2
+
+// fileExt is the extension of snapshot files
+const fileExt = ".snapshot"
+
+var (
+	ErrNotFound    = errors.New("snapshot not found")
+	ErrAmbiguous   = errors.New("snapshot id is ambiguous")
+	ErrChecksum    = errors.New("snapshot checksum mismatch, the file is damaged")
+	ErrKeyRequired = errors.New("snapshot is encrypted, the vault key is required")
+)
+
+// Info describes a snapshot. It is stored unencrypted so snapshots can be
+// listed without unlocking the vault.
+type Info struct {
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedBy    string    `json:"created_by"`
+	Reason       string    `json:"reason"`
+	VaultType    string    `json:"vault_type"`
+	Environments []string  `json:"environments"`
+	Variables    int       `json:"variables"`
+	Encrypted    bool      `json:"encrypted"`
+	Checksum     string    `json:"checksum"` // sha256 of the stored payload
+}
+
+// Snapshot is the captured state of one or more environments
+type Snapshot struct {
+	Info         Info                    `json:"-"`
+	Environments map[string]*Environment `json:"environments"`
+}
+
+// Environment holds the stored variables of an environment
+type Environment struct {
+	Variables map[string]string                  `json:"variables"`
+	Metadata  map[string]*storage.SecretMetadata `json:"metadata,omitempty"`
+}
+
+// OpenFunc opens the backend of an environment. Backends should be opened
+// without a password, so values are captured and restored in their stored
+// form.
+type OpenFunc func(environment string) (storage.Backend, error)
+
+// payload is the part of a snapshot file that is encrypted
+type payload struct {
+	ID           string                  `json:"id"` // Binds the payload to its header
+	Environments map[string]*Environment `json:"environments"`
+}
+
+// snapshotFile is the on-disk form of a snapshot
+type snapshotFile struct {
+	Format  int    `json:"format"`
+	Info    Info   `json:"info"`
+	Payload []byte `json:"payload"`
+}
+
+// DeriveKey derives the key snapshots are encrypted with from a vault key
+func DeriveKey(vaultKey []byte) []byte {
+	mac := hmac.New(sha256.New, vaultKey)
+	mac.Write([]byte("vaultenv-snapshot-v1"))
+	return mac.Sum(nil)
+}
+
+// Capture reads the variables of the given environments
+func Capture(environments []string, open OpenFunc) (*Snapshot, error) {
+	s := &Snapshot{Environments: make(map[string]*Environment, len(environments))}
+
+	for _, env := range environments {
+		backend, err := open(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", env, err)
+		}
+
+		captured, err := captureEnvironment(backend)
+		backend.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", env, err)
+		}
+
+		s.Environments[env] = captured
+		s.Info.Variables += len(captured.Variables)
+	}
+
+	s.Info.Environments = sortedKeys(s.Environments)
+	return s, nil
+}
+
+func captureEnvironment(backend storage.Backend) (*Environment, error) {
+	variables, err := storage.GetAll(context.Background(), backend)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &Environment{Variables: variables}
+
+	mb, ok := storage.AsMetadataBackend(backend)
+	if !ok {
+		return env, nil
+	}
+
+	for key := range variables {
+		meta, err := mb.GetMetadata(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metadata of %s: %w", key, err)
+		}
+		if meta.Description != "" || len(meta.Tags) > 0 || meta.Owner != "" || meta.Source != "" {
+			if env.Metadata == nil {
+				env.Metadata = make(map[string]*storage.SecretMetadata)
+			}
+			env.Metadata[key] = meta
+		}
+	}
+
+	return env, nil
+}
+
+// RestoreResult counts the changes made by Restore
+type RestoreResult struct {
+	Set     int
+	Deleted int
+}
+
+// Restore replaces the variables of an environment with the captured ones
+// in a single transaction. Variables that were added since the snapshot
+// are deleted, unchanged ones are left alone.
+func (s *Snapshot) Restore(environment string, backend storage.Backend) (RestoreResult, error) {
+	var result RestoreResult
+
+	captured, ok := s.Environments[environment]
+	if !ok {
+		return result, fmt.Errorf("snapshot %s does not contain environment '%s'", s.Info.ID, environment)
+	}
+
+	keys, err := backend.List()
+	if err != nil {
+		return result, fmt.Errorf("failed to list variables: %w", err)
+	}
+
+	tx, err := storage.BeginTx(backend)
+	if err != nil {
+		return result, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		current[key] = true
+		if _, keep := captured.Variables[key]; keep {
+			continue
+		}
+		if err := tx.Delete(key); err != nil {
+			return result, fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+		result.Deleted++
+	}
+
+	for _, key := range sortedKeys(captured.Variables) {
+		value := captured.Variables[key]
+		if current[key] {
+			if existing, err := backend.Get(key); err == nil && existing == value {
+				continue
+			}
+		}
+		if err := tx.Set(key, value, false); err != nil {
+			return result, fmt.Errorf("failed to restore %s: %w", key, err)
+		}
+		result.Set++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return RestoreResult{}, fmt.Errorf("failed to restore variables, no changes were made: %w", err)
+	}
+
+	if mb, ok := storage.AsMetadataBackend(backend); ok {
+		for key, meta := range captured.Metadata {
+			if err := mb.SetMetadata(key, meta); err != nil {
+				return result, fmt.Errorf("failed to restore metadata of %s: %w", key, err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Store keeps snapshot files in a directory
+type Store struct {
+	dir       string
+	key       []byte // nil stores snapshots unencrypted
+	legacyKey []byte // decrypts snapshots of format 1
+}
+
+// NewStore returns the snapshots kept in dir. Snapshots are encrypted with
+// key, see DeriveKey; a nil key stores them unencrypted, which is only
+// meant for vaults without encryption.
+func NewStore(dir string, key []byte) *Store {
+	return &Store{dir: dir, key: key}
+}
+
+// WithLegacyKey sets the key snapshots of format 1 are decrypted with.
+// They were encrypted with a key derived from the password key or the
+// local identity of whoever took them, not from the snapshot key.
+func (st *Store) WithLegacyKey(key []byte) *Store {
+	st.legacyKey = key
+	return st
+}
+
+// Save writes a snapshot and fills in its ID, creation details and checksum
+func (st *Store) Save(s *Snapshot, reason, vaultType string) (*Info, error) {
+	if err := os.MkdirAll(st.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot id: %w", err)
+	}
+
+	s.Info.ID = now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+	s.Info.CreatedAt = now
+	s.Info.CreatedBy = access.CurrentUser()
+	s.Info.Reason = reason
+	s.Info.VaultType = vaultType
+	s.Info.Environments = sortedKeys(s.Environments)
+
+	if err := st.write(s); err != nil {
+		return nil, err
+	}
+
+	info := s.Info
+	return &info, nil
+}
+
+// Rewrite replaces a loaded snapshot with its changed variables, keeping
+// its ID and creation details. It is encrypted with the key of the store.
+func (st *Store) Rewrite(s *Snapshot) error {
+	if _, err := st.readFile(s.Info.ID); err != nil {
+		return err
+	}
+	return st.write(s)
+}
+
+// write encrypts a snapshot and writes it in place, replacing an existing
+// file atomically
+func (st *Store) write(s *Snapshot) error {
+	s.Info.Encrypted = st.key != nil
+
+	data, err := json.Marshal(payload{ID: s.Info.ID, Environments: s.Environments})
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	if st.key != nil {
+		data, err = encryption.DefaultEncryptor().Encrypt(data, st.key)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt snapshot: %w", err)
+		}
+	}
+	s.Info.Checksum = checksum(data)
+
+	content, err := json.MarshalIndent(snapshotFile{Format: format, Info: s.Info, Payload: data}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	path := st.path(s.Info.ID)
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, content, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the snapshots, newest first. Damaged files are skipped.
+func (st *Store) List() ([]Info, error) {
+	entries, err := os.ReadDir(st.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	var infos []Info
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExt) {
+			continue
+		}
+
+		f, err := st.readFile(strings.TrimSuffix(entry.Name(), fileExt))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, f.Info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].CreatedAt.After(infos[j].CreatedAt)
+		}
+		return infos[i].ID > infos[j].ID
+	})
+	return infos, nil
+}
+
+// Resolve returns the info of the snapshot with the given id, a unique
+// prefix of it, or "latest" for the newest snapshot
+func (st *Store) Resolve(id string) (*Info, error) {
+	infos, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == "latest" {
+		if len(infos) == 0 {
+			return nil, ErrNotFound
+		}
+		return &infos[0], nil
+	}
+
+	var match *Info
+	for i := range infos {
+		if infos[i].ID == id {
+			return &infos[i], nil
+		}
+		if strings.HasPrefix(infos[i].ID, id) {
+			if match != nil {
+				return nil, fmt.Errorf("%w: %s", ErrAmbiguous, id)
+			}
+			match = &infos[i]
+		}
+	}
+
+	if match == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return match, nil
+}
+
+// Verify checks the checksum of a snapshot without decrypting it
+func (st *Store) Verify(id string) error {
+	_, err := st.readVerified(id)
+	return err
+}
+
+// Load reads, verifies and decrypts a snapshot
+func (st *Store) Load(id string) (*Snapshot, error) {
+	f, err := st.readVerified(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data := f.Payload
+	if f.Info.Encrypted {
+		key := st.key
+		if f.Format < 2 {
+			key = st.legacyKey
+		}
+		if key == nil {
+			return nil, ErrKeyRequired
+		}
+		data, err = encryption.DefaultEncryptor().Decrypt(data, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt snapshot %s: %w", id, err)
+		}
+	}
+
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", id, err)
+	}
+	if p.ID != f.Info.ID {
+		return nil, fmt.Errorf("%w: payload belongs to snapshot %s", ErrChecksum, p.ID)
+	}
+
+	return &Snapshot{Info: f.Info, Environments: p.Environments}, nil
+}
+
+// Delete removes a snapshot
+func (st *Store) Delete(id string) error {
+	if err := os.Remove(st.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes the snapshots taken before the given time. The newest
+// snapshot is always kept.
+func (st *Store) Prune(before time.Time) ([]Info, error) {
+	infos, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Info
+	for i, info := range infos {
+		if i == 0 || !info.CreatedAt.Before(before) {
+			continue
+		}
+		if err := st.Delete(info.ID); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, info)
+	}
+
+	return pruned, nil
+}
+
+func (st *Store) path(id string) string {
+	return filepath.Join(st.dir, id+fileExt)
+}
+
+func (st *Store) readFile(id string) (*snapshotFile, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	data, err := os.ReadFile(st.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var f snapshotFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrChecksum, err)
+	}
+	if f.Format > format {
+		return nil, fmt.Errorf("snapshot %s was written by a newer version of vaultenv", id)
+	}
+	if f.Info.ID != id {
+		return nil, fmt.Errorf("%w: file %s holds snapshot %s", ErrChecksum, id, f.Info.ID)
+	}
+
+	return &f, nil
+}
+
+func (st *Store) readVerified(id string) (*snapshotFile, error) {
+	f, err := st.readFile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(checksum(f.Payload)), []byte(f.Info.Checksum)) {
+		return nil, ErrChecksum
+	}
+
+	return f, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
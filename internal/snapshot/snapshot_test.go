@@ -0,0 +1,290 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/storage"
+)
+
+func newTestBackends(t *testing.T) (map[string]storage.Backend, OpenFunc) {
+	t.Helper()
+
+	dir := t.TempDir()
+	backends := make(map[string]storage.Backend)
+	open := func(env string) (storage.Backend, error) {
+		return storage.NewFileBackend(dir, env)
+	}
+
+	for _, env := range []string{"development", "production"} {
+		b, err := open(env)
+		if err != nil {
+			t.Fatalf("NewFileBackend() error = %v", err)
+		}
+		backends[env] = b
+	}
+
+	return backends, open
+}
+
+func TestCaptureAndRestore(t *testing.T) {
+	backends, open := newTestBackends(t)
+
+	dev := backends["development"]
+	dev.Set("API_URL", "http://localhost", false)
+	dev.Set("DEBUG", "true", false)
+	dev.(storage.MetadataBackend).SetMetadata("API_URL", &storage.SecretMetadata{Description: "API endpoint"})
+	backends["production"].Set("API_URL", "https://api.example.com", false)
+
+	s, err := Capture([]string{"development", "production"}, open)
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	if s.Info.Variables != 3 || len(s.Info.Environments) != 2 {
+		t.Errorf("Capture() info = %+v", s.Info)
+	}
+
+	dev.Set("API_URL", "http://changed", false)
+	dev.Delete("DEBUG")
+	dev.Set("NEW_KEY", "value", false)
+	dev.(storage.MetadataBackend).SetMetadata("API_URL", &storage.SecretMetadata{Description: "changed"})
+
+	result, err := s.Restore("development", dev)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if result.Set != 2 || result.Deleted != 1 {
+		t.Errorf("Restore() = %+v, want 2 set and 1 deleted", result)
+	}
+
+	keys, _ := dev.List()
+	if len(keys) != 2 {
+		t.Errorf("List() after restore = %v", keys)
+	}
+	if value, _ := dev.Get("API_URL"); value != "http://localhost" {
+		t.Errorf("Get(API_URL) = %q", value)
+	}
+	if value, _ := dev.Get("DEBUG"); value != "true" {
+		t.Errorf("Get(DEBUG) = %q", value)
+	}
+	if meta, _ := dev.(storage.MetadataBackend).GetMetadata("API_URL"); meta.Description != "API endpoint" {
+		t.Errorf("GetMetadata(API_URL) = %+v", meta)
+	}
+
+	// Variables removed by the restore can still be undeleted
+	if trash, _ := dev.(storage.TrashBackend).ListTrash(); len(trash) == 0 || trash[0].Key != "NEW_KEY" {
+		t.Errorf("ListTrash() after restore = %+v", trash)
+	}
+
+	if _, err := s.Restore("staging", dev); err == nil {
+		t.Error("Restore() of environment not in snapshot succeeded")
+	}
+}
+
+func TestStore(t *testing.T) {
+	backends, open := newTestBackends(t)
+	backends["development"].Set("API_KEY", "secret", false)
+
+	dir := t.TempDir()
+	key := DeriveKey([]byte("0123456789abcdef0123456789abcdef"))
+	store := NewStore(dir, key)
+
+	s, err := Capture([]string{"development"}, open)
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	info, err := store.Save(s, "manual", "file")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if !info.Encrypted || info.Checksum == "" || info.CreatedBy == "" {
+		t.Errorf("Save() info = %+v", info)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, info.ID+fileExt))
+	if err != nil {
+		t.Fatalf("snapshot file not written: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("snapshot file contains the plaintext value")
+	}
+	if stat, _ := os.Stat(filepath.Join(dir, info.ID+fileExt)); stat.Mode().Perm() != 0600 {
+		t.Errorf("snapshot file mode = %v, want 0600", stat.Mode().Perm())
+	}
+
+	loaded, err := store.Load(info.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Environments["development"].Variables["API_KEY"] != "secret" || loaded.Info.Reason != "manual" {
+		t.Errorf("Load() = %+v", loaded)
+	}
+
+	if _, err := NewStore(dir, nil).Load(info.ID); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Load() without key error = %v, want ErrKeyRequired", err)
+	}
+	if _, err := NewStore(dir, DeriveKey([]byte("wrong"))).Load(info.ID); err == nil {
+		t.Error("Load() with wrong key succeeded")
+	}
+
+	resolved, err := store.Resolve(info.ID[:10])
+	if err != nil || resolved.ID != info.ID {
+		t.Errorf("Resolve(prefix) = %+v, %v", resolved, err)
+	}
+	if resolved, err := store.Resolve("latest"); err != nil || resolved.ID != info.ID {
+		t.Errorf("Resolve(latest) = %+v, %v", resolved, err)
+	}
+	if _, err := store.Resolve("1999"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_LegacyFormat(t *testing.T) {
+	backends, open := newTestBackends(t)
+	backends["development"].Set("API_KEY", "secret", false)
+
+	dir := t.TempDir()
+	legacyKey := DeriveKey([]byte("legacy"))
+
+	s, err := Capture([]string{"development"}, open)
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	info, err := NewStore(dir, legacyKey).Save(s, "manual", "file")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Rewrite the file as a snapshot of format 1
+	path := filepath.Join(dir, info.ID+fileExt)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `"format": 2`, `"format": 1`, 1))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(dir, DeriveKey([]byte("snapshot")))
+	if _, err := store.Load(info.ID); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Load() without legacy key error = %v, want ErrKeyRequired", err)
+	}
+
+	loaded, err := store.WithLegacyKey(legacyKey).Load(info.ID)
+	if err != nil {
+		t.Fatalf("Load() with legacy key error = %v", err)
+	}
+	if loaded.Environments["development"].Variables["API_KEY"] != "secret" {
+		t.Errorf("Load() = %+v", loaded)
+	}
+}
+
+func TestStore_Rewrite(t *testing.T) {
+	backends, open := newTestBackends(t)
+	backends["development"].Set("API_KEY", "secret", false)
+
+	store := NewStore(t.TempDir(), DeriveKey([]byte("snapshot")))
+
+	s, err := Capture([]string{"development"}, open)
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	info, err := store.Save(s, "manual", "file")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := store.Load(info.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	loaded.Environments["development"].Variables["API_KEY"] = "rotated"
+	if err := store.Rewrite(loaded); err != nil {
+		t.Fatalf("Rewrite() error = %v", err)
+	}
+
+	rewritten, err := store.Load(info.ID)
+	if err != nil {
+		t.Fatalf("Load() after Rewrite() error = %v", err)
+	}
+	if rewritten.Environments["development"].Variables["API_KEY"] != "rotated" {
+		t.Errorf("Load() after Rewrite() = %+v", rewritten.Environments["development"])
+	}
+	if !rewritten.Info.CreatedAt.Equal(info.CreatedAt) || rewritten.Info.Reason != "manual" {
+		t.Errorf("Rewrite() changed the snapshot info: %+v", rewritten.Info)
+	}
+
+	missing := &Snapshot{Info: Info{ID: "20000101T000000Z-000000"}}
+	if err := store.Rewrite(missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rewrite() of an unknown snapshot error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_DetectsDamage(t *testing.T) {
+	_, open := newTestBackends(t)
+
+	dir := t.TempDir()
+	store := NewStore(dir, nil)
+
+	s, _ := Capture([]string{"development"}, open)
+	info, err := store.Save(s, "manual", "file")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	path := filepath.Join(dir, info.ID+fileExt)
+	data, _ := os.ReadFile(path)
+
+	var f snapshotFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("snapshot file is not JSON: %v", err)
+	}
+	f.Payload[len(f.Payload)-2] ^= 0xff
+	data, _ = json.Marshal(f)
+	os.WriteFile(path, data, 0600)
+
+	if err := store.Verify(info.ID); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Verify() of damaged snapshot error = %v, want ErrChecksum", err)
+	}
+	if _, err := store.Load(info.ID); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Load() of damaged snapshot error = %v, want ErrChecksum", err)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	_, open := newTestBackends(t)
+	store := NewStore(t.TempDir(), nil)
+
+	for i := 0; i < 3; i++ {
+		s, _ := Capture([]string{"development"}, open)
+		if _, err := store.Save(s, "manual", "file"); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	if pruned, err := store.Prune(time.Now().Add(-time.Hour)); err != nil || len(pruned) != 0 {
+		t.Errorf("Prune(an hour ago) = %v, %v", pruned, err)
+	}
+
+	// The newest snapshot survives even when everything is expired
+	pruned, err := store.Prune(time.Now().Add(time.Hour))
+	if err != nil || len(pruned) != 2 {
+		t.Fatalf("Prune(future) = %v, %v", pruned, err)
+	}
+
+	remaining, _ := store.List()
+	if len(remaining) != 1 {
+		t.Fatalf("List() after prune = %+v", remaining)
+	}
+	latest, _ := store.Resolve("latest")
+	if remaining[0].ID != latest.ID {
+		t.Errorf("Prune() kept %s, want the newest snapshot", remaining[0].ID)
+	}
+}
@@ -93,14 +93,17 @@ func (gcd *GitConflictDetector) parseConflictFile(path string) (*Conflict, error
 	defer file.Close()
 
 	// Extract environment and variable from path
-	// Expected: .vaultenv/git/<environment>/<namespace>/<variable>.env
+	// Expected: .vaultenv/git/<environment>/<variable>.env
 	parts := strings.Split(path, string(os.PathSeparator))
 	if len(parts) < 4 {
 		return nil, fmt.Errorf("invalid path structure: %s", path)
 	}
 
 	environment := parts[2]
-	variable := strings.TrimSuffix(filepath.Base(path), ".env")
+	variable, err := storage.GitPathToKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid variable file: %w", err)
+	}
 
 	// Parse conflict sections
 	var (
@@ -189,6 +189,19 @@ func (l *LocalAccessControl) RevokeAccess(user, environment string) error {
 	return l.saveAccessConfig(config)
 }
 
+// HasRules reports whether access rules exist for an environment.
+// HasAccess denies everyone on an environment without rules, so callers
+// that only enforce configured restrictions check this first.
+func (l *LocalAccessControl) HasRules(environment string) (bool, error) {
+	config, err := l.loadAccessConfig()
+	if err != nil {
+		return false, err
+	}
+
+	_, exists := config.Environments[environment]
+	return exists, nil
+}
+
 // ListAccess lists users with access to an environment
 func (l *LocalAccessControl) ListAccess(environment string) ([]AccessEntry, error) {
 	config, err := l.loadAccessConfig()
@@ -252,6 +265,11 @@ func (l *LocalAccessControl) getUserRoles(user string) []string {
 	return []string{}
 }
 
+// CurrentUser returns the user access is checked for
+func CurrentUser() string {
+	return getCurrentUser()
+}
+
 // Helper functions
 
 func getCurrentUser() string {
@@ -32,7 +32,7 @@ func NewAESGCMEncryptor() *AESGCMEncryptor {
 
 // Algorithm returns the algorithm identifier
 func (e *AESGCMEncryptor) Algorithm() string {
-	return "aes-gcm-256"
+	return AlgorithmAESGCM
 }
 
 // GenerateSalt creates a cryptographically secure random salt
@@ -1,47 +1,113 @@
 package encryption
 
-import "errors"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
 
-// ChaChaEncryptor implements ChaCha20-Poly1305 encryption
-// This is a stub implementation for now
-type ChaChaEncryptor struct{}
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChaChaEncryptor implements ChaCha20-Poly1305 encryption. It is faster
+// than AES-GCM on machines without AES instructions.
+type ChaChaEncryptor struct {
+	// Key derivation parameters, the same as AESGCMEncryptor so a vault
+	// derives the same keys whichever algorithm encrypts its values
+	iterations uint32
+	memory     uint32
+	threads    uint8
+	keyLength  uint32
+}
 
 // NewChaChaEncryptor creates a new ChaCha20-Poly1305 encryptor
 func NewChaChaEncryptor() *ChaChaEncryptor {
-	return &ChaChaEncryptor{}
+	return &ChaChaEncryptor{
+		iterations: 3,
+		memory:     64 * 1024,
+		threads:    4,
+		keyLength:  chacha20poly1305.KeySize,
+	}
 }
 
 // Algorithm returns the algorithm identifier
 func (e *ChaChaEncryptor) Algorithm() string {
-	return "chacha20-poly1305"
+	return AlgorithmChaCha20Poly1305
 }
 
 // GenerateSalt creates a cryptographically secure random salt
 func (e *ChaChaEncryptor) GenerateSalt() ([]byte, error) {
-	return nil, errors.New("ChaCha20-Poly1305 not yet implemented")
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
 }
 
-// GenerateKey derives an encryption key from a password
+// GenerateKey derives an encryption key from a password using Argon2id
 func (e *ChaChaEncryptor) GenerateKey(password string, salt []byte) []byte {
-	return nil
+	return argon2.IDKey([]byte(password), salt, e.iterations, e.memory, e.threads, e.keyLength)
 }
 
 // Encrypt encrypts plaintext using ChaCha20-Poly1305
 func (e *ChaChaEncryptor) Encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	return nil, errors.New("ChaCha20-Poly1305 not yet implemented")
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// Prepend nonce to ciphertext for storage, as AESGCMEncryptor does
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
 }
 
 // Decrypt decrypts ciphertext encrypted with ChaCha20-Poly1305
 func (e *ChaChaEncryptor) Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
-	return nil, errors.New("ChaCha20-Poly1305 not yet implemented")
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, ErrInvalidData
+	}
+
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
 }
 
 // EncryptString encrypts a string and returns base64-encoded result
 func (e *ChaChaEncryptor) EncryptString(plaintext string, key []byte) (string, error) {
-	return "", errors.New("ChaCha20-Poly1305 not yet implemented")
+	ciphertext, err := e.Encrypt([]byte(plaintext), key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
 // DecryptString decrypts a base64-encoded string
 func (e *ChaChaEncryptor) DecryptString(ciphertext string, key []byte) (string, error) {
-	return "", errors.New("ChaCha20-Poly1305 not yet implemented")
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64: %w", err)
+	}
+
+	plaintext, err := e.Decrypt(data, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
 }
@@ -1,7 +1,7 @@
 package encryption
 
 import (
-	"strings"
+	"bytes"
 	"testing"
 )
 
@@ -12,68 +12,72 @@ func TestChaChaEncryptor_Algorithm(t *testing.T) {
 	}
 }
 
-func TestChaChaEncryptor_NotImplemented(t *testing.T) {
+func TestChaChaEncryptor_EncryptDecrypt(t *testing.T) {
 	enc := NewChaChaEncryptor()
-	key := make([]byte, 32)
 
-	// Test all methods return not implemented error
-	tests := []struct {
-		name string
-		fn   func() error
-	}{
-		{
-			name: "GenerateSalt",
-			fn: func() error {
-				_, err := enc.GenerateSalt()
-				return err
-			},
-		},
-		{
-			name: "Encrypt",
-			fn: func() error {
-				_, err := enc.Encrypt([]byte("test"), key)
-				return err
-			},
-		},
-		{
-			name: "Decrypt",
-			fn: func() error {
-				_, err := enc.Decrypt([]byte("test"), key)
-				return err
-			},
-		},
-		{
-			name: "EncryptString",
-			fn: func() error {
-				_, err := enc.EncryptString("test", key)
-				return err
-			},
-		},
-		{
-			name: "DecryptString",
-			fn: func() error {
-				_, err := enc.DecryptString("test", key)
-				return err
-			},
-		},
+	salt, err := enc.GenerateSalt()
+	if err != nil {
+		t.Fatalf("GenerateSalt() error = %v", err)
 	}
+	key := enc.GenerateKey("test-password", salt)
+	if len(key) != 32 {
+		t.Fatalf("GenerateKey() length = %d, want 32", len(key))
+	}
+
+	plaintext := []byte("secret value\x00with binary")
+	ciphertext, err := enc.Encrypt(plaintext, key)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Error("ciphertext contains the plaintext")
+	}
+
+	again, _ := enc.Encrypt(plaintext, key)
+	if bytes.Equal(ciphertext, again) {
+		t.Error("Encrypt() produced identical ciphertext twice")
+	}
+
+	decrypted, err := enc.Decrypt(ciphertext, key)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt() = %q, %v", decrypted, err)
+	}
+
+	wrongKey := enc.GenerateKey("wrong-password", salt)
+	if _, err := enc.Decrypt(ciphertext, wrongKey); err != ErrDecryptionFailed {
+		t.Errorf("Decrypt() with wrong key error = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if _, err := enc.Decrypt([]byte("short"), key); err != ErrInvalidData {
+		t.Errorf("Decrypt() of short data error = %v, want %v", err, ErrInvalidData)
+	}
+	if _, err := enc.Encrypt(plaintext, []byte("short key")); err != ErrInvalidKey {
+		t.Errorf("Encrypt() with short key error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestChaChaEncryptor_SameKeysAsAESGCM(t *testing.T) {
+	salt := []byte("0123456789abcdef0123456789abcdef")
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.fn()
-			if err == nil || !strings.Contains(err.Error(), "not yet implemented") {
-				t.Errorf("%s() error = %v, want not implemented error", tt.name, err)
-			}
-		})
+	// Vaults derive the same keys whichever algorithm is configured
+	if !bytes.Equal(NewChaChaEncryptor().GenerateKey("password", salt), NewAESGCMEncryptor().GenerateKey("password", salt)) {
+		t.Error("ChaCha20-Poly1305 and AES-GCM derive different keys")
 	}
 }
 
-func TestChaChaEncryptor_GenerateKey(t *testing.T) {
-	enc := NewChaChaEncryptor()
+func TestNormalizeAlgorithm(t *testing.T) {
+	tests := map[string]string{
+		"aes-gcm-256":       AlgorithmAESGCM,
+		"aes-256-gcm":       AlgorithmAESGCM,
+		"chacha20-poly1305": AlgorithmChaCha20Poly1305,
+	}
+
+	for name, want := range tests {
+		if got, err := NormalizeAlgorithm(name); err != nil || got != want {
+			t.Errorf("NormalizeAlgorithm(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
 
-	// GenerateKey returns nil (stub implementation)
-	key := enc.GenerateKey("password", []byte("salt"))
-	if key != nil {
-		t.Errorf("GenerateKey() = %v, want nil", key)
+	if _, err := NormalizeAlgorithm("rot13"); err == nil {
+		t.Error("NormalizeAlgorithm() accepted an unknown algorithm")
 	}
 }
@@ -105,7 +105,7 @@ func (d *DeterministicEncryptor) DecryptString(ciphertext string, key []byte) (s
 
 // Algorithm returns the encryption algorithm name
 func (d *DeterministicEncryptor) Algorithm() string {
-	return "aes-gcm-256-deterministic"
+	return AlgorithmAESGCMDeterministic
 }
 
 // GenerateKey derives an encryption key from a password using the base encryptor
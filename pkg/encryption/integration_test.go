@@ -16,6 +16,7 @@ func TestNewEncryptor(t *testing.T) {
 		{"aes-gcm-256", "*encryption.AESGCMEncryptor", false},
 		{"aes-gcm-256-deterministic", "*encryption.DeterministicEncryptor", false},
 		{"chacha20-poly1305", "*encryption.ChaChaEncryptor", false},
+		{"aes-256-gcm", "*encryption.AESGCMEncryptor", false},
 		{"unknown-algorithm", "", true},
 		{"", "", true},
 	}
@@ -81,11 +82,6 @@ func TestEncryptor_Interface(t *testing.T) {
 			_ = enc.Algorithm()
 			_ = enc.GenerateKey("password", []byte("salt"))
 
-			// Skip further tests for unimplemented ChaCha
-			if enc.Algorithm() == "chacha20-poly1305" {
-				return
-			}
-
 			// Test full encryption cycle
 			salt, err := enc.GenerateSalt()
 			if err != nil {
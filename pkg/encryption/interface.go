@@ -2,8 +2,21 @@ package encryption
 
 import (
 	"errors"
+	"fmt"
 )
 
+// Algorithm identifiers, as recorded with every encrypted value
+const (
+	AlgorithmAESGCM              = "aes-gcm-256"
+	AlgorithmAESGCMDeterministic = "aes-gcm-256-deterministic"
+	AlgorithmChaCha20Poly1305    = "chacha20-poly1305"
+)
+
+// algorithmAliases maps other accepted spellings to algorithm identifiers
+var algorithmAliases = map[string]string{
+	"aes-256-gcm": AlgorithmAESGCM,
+}
+
 // Common errors
 var (
 	ErrInvalidKey       = errors.New("invalid encryption key")
@@ -52,17 +65,35 @@ type EncryptedData struct {
 	Ciphertext []byte   `json:"ciphertext"`
 }
 
+// NormalizeAlgorithm returns the identifier of an algorithm name, which
+// may be an alias such as "aes-256-gcm"
+func NormalizeAlgorithm(algorithm string) (string, error) {
+	if canonical, ok := algorithmAliases[algorithm]; ok {
+		return canonical, nil
+	}
+
+	switch algorithm {
+	case AlgorithmAESGCM, AlgorithmAESGCMDeterministic, AlgorithmChaCha20Poly1305:
+		return algorithm, nil
+	}
+
+	return "", fmt.Errorf("unsupported algorithm: %s", algorithm)
+}
+
 // Factory creates an encryptor based on algorithm name
 func NewEncryptor(algorithm string) (Encryptor, error) {
+	algorithm, err := NormalizeAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
 	switch algorithm {
-	case "aes-gcm-256":
-		return NewAESGCMEncryptor(), nil
-	case "aes-gcm-256-deterministic":
+	case AlgorithmAESGCMDeterministic:
 		return NewDeterministicEncryptor(), nil
-	case "chacha20-poly1305":
+	case AlgorithmChaCha20Poly1305:
 		return NewChaChaEncryptor(), nil
 	default:
-		return nil, errors.New("unsupported algorithm: " + algorithm)
+		return NewAESGCMEncryptor(), nil
 	}
 }
 
@@ -0,0 +1,167 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions password keys can be derived with
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+	KDFPBKDF2   = "pbkdf2"
+)
+
+// minPBKDF2Iterations is the fewest iterations PBKDF2 is accepted with;
+// unlike the other functions it has no memory cost to make up for them
+const minPBKDF2Iterations = 100000
+
+// kdfStrength orders the key derivation functions by their resistance to
+// brute force on dedicated hardware
+var kdfStrength = map[string]int{
+	KDFPBKDF2:   1,
+	KDFScrypt:   2,
+	KDFArgon2id: 3,
+}
+
+// KDFParams are the parameters a password key is derived with.
+//
+// For Argon2id Iterations is the time cost, Memory the memory in KiB and
+// Parallelism the number of lanes. For scrypt Memory is the cost N (with
+// r = 8 it is also the memory in KiB) and Parallelism is p. PBKDF2-SHA256
+// only uses Iterations.
+type KDFParams struct {
+	Algorithm   string
+	Iterations  uint32
+	Memory      uint32
+	Parallelism uint8
+}
+
+// DefaultKDFParams returns the default parameters of a key derivation
+// function. The Argon2id defaults are the parameters every key was derived
+// with before they were configurable.
+func DefaultKDFParams(algorithm string) KDFParams {
+	switch algorithm {
+	case KDFScrypt:
+		return KDFParams{Algorithm: KDFScrypt, Memory: 32 * 1024, Parallelism: 1}
+	case KDFPBKDF2:
+		return KDFParams{Algorithm: KDFPBKDF2, Iterations: 600000}
+	default:
+		return KDFParams{Algorithm: KDFArgon2id, Iterations: 3, Memory: 64 * 1024, Parallelism: 4}
+	}
+}
+
+// NewKDFParams returns validated parameters for a key derivation function.
+// Zero values take the defaults of the function and parameters the
+// function does not use are dropped.
+func NewKDFParams(algorithm string, iterations, memory, parallelism int) (KDFParams, error) {
+	if _, ok := kdfStrength[algorithm]; !ok {
+		return KDFParams{}, fmt.Errorf("unsupported key derivation algorithm: %s", algorithm)
+	}
+	if iterations < 0 || iterations > math.MaxUint32 || memory < 0 || memory > math.MaxUint32 || parallelism < 0 || parallelism > math.MaxUint8 {
+		return KDFParams{}, fmt.Errorf("key derivation parameters out of range")
+	}
+
+	p := DefaultKDFParams(algorithm)
+	if iterations > 0 && p.Iterations > 0 {
+		p.Iterations = uint32(iterations)
+	}
+	if memory > 0 && p.Memory > 0 {
+		p.Memory = uint32(memory)
+	}
+	if parallelism > 0 && p.Parallelism > 0 {
+		p.Parallelism = uint8(parallelism)
+	}
+
+	if err := p.Validate(); err != nil {
+		return KDFParams{}, err
+	}
+	return p, nil
+}
+
+// Validate checks that the parameters can derive a key
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		if p.Iterations == 0 || p.Parallelism == 0 {
+			return fmt.Errorf("argon2id needs at least one iteration and one lane")
+		}
+		if p.Memory < 8*uint32(p.Parallelism) {
+			return fmt.Errorf("argon2id needs at least 8 KiB of memory per lane")
+		}
+	case KDFScrypt:
+		if p.Memory < 2 || p.Memory&(p.Memory-1) != 0 {
+			return fmt.Errorf("scrypt memory cost must be a power of two, got %d", p.Memory)
+		}
+		if p.Parallelism == 0 {
+			return fmt.Errorf("scrypt parallelism must be at least 1")
+		}
+	case KDFPBKDF2:
+		if p.Iterations < minPBKDF2Iterations {
+			return fmt.Errorf("pbkdf2 needs at least %d iterations, got %d", minPBKDF2Iterations, p.Iterations)
+		}
+	default:
+		return fmt.Errorf("unsupported key derivation algorithm: %s", p.Algorithm)
+	}
+	return nil
+}
+
+// DeriveKey derives a 256-bit key from a password
+func (p KDFParams) DeriveKey(password string, salt []byte) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch p.Algorithm {
+	case KDFScrypt:
+		return scrypt.Key([]byte(password), salt, int(p.Memory), 8, int(p.Parallelism), 32)
+	case KDFPBKDF2:
+		return pbkdf2.Key([]byte(password), salt, int(p.Iterations), 32, sha256.New), nil
+	default:
+		return argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, 32), nil
+	}
+}
+
+// Weaker reports whether keys derived with p should be upgraded to q:
+// q uses a stronger function, or the same function at a higher total
+// cost, so trading passes for memory counts when it costs more overall.
+// Parallelism is not compared, it follows the machine rather than the
+// cost of an attack.
+func (p KDFParams) Weaker(q KDFParams) bool {
+	if p.Algorithm != q.Algorithm {
+		return kdfStrength[p.Algorithm] < kdfStrength[q.Algorithm]
+	}
+
+	return p.cost() < q.cost()
+}
+
+// cost is the work of one guess with the parameters, comparable between
+// parameters of the same function: time times memory for Argon2id, N for
+// scrypt and the iterations for PBKDF2
+func (p KDFParams) cost() uint64 {
+	switch p.Algorithm {
+	case KDFScrypt:
+		return uint64(p.Memory)
+	case KDFPBKDF2:
+		return uint64(p.Iterations)
+	default:
+		return uint64(p.Iterations) * uint64(p.Memory)
+	}
+}
+
+// String describes the parameters, e.g. "argon2id (t=3, m=65536 KiB, p=4)"
+func (p KDFParams) String() string {
+	switch p.Algorithm {
+	case KDFScrypt:
+		return fmt.Sprintf("scrypt (N=%d, r=8, p=%d)", p.Memory, p.Parallelism)
+	case KDFPBKDF2:
+		return fmt.Sprintf("pbkdf2-sha256 (%d iterations)", p.Iterations)
+	default:
+		return fmt.Sprintf("%s (t=%d, m=%d KiB, p=%d)", p.Algorithm, p.Iterations, p.Memory, p.Parallelism)
+	}
+}
@@ -0,0 +1,106 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewKDFParams(t *testing.T) {
+	tests := []struct {
+		name                            string
+		algorithm                       string
+		iterations, memory, parallelism int
+		want                            KDFParams
+		wantErr                         bool
+	}{
+		{"argon2id defaults", KDFArgon2id, 0, 0, 0, KDFParams{KDFArgon2id, 3, 64 * 1024, 4}, false},
+		{"argon2id", KDFArgon2id, 4, 128 * 1024, 2, KDFParams{KDFArgon2id, 4, 128 * 1024, 2}, false},
+		{"scrypt ignores iterations", KDFScrypt, 3, 65536, 2, KDFParams{KDFScrypt, 0, 65536, 2}, false},
+		{"pbkdf2 ignores memory", KDFPBKDF2, 200000, 65536, 4, KDFParams{KDFPBKDF2, 200000, 0, 0}, false},
+		{"pbkdf2 with argon2 iterations", KDFPBKDF2, 3, 0, 0, KDFParams{}, true},
+		{"scrypt cost not a power of two", KDFScrypt, 0, 60000, 0, KDFParams{}, true},
+		{"argon2id too little memory", KDFArgon2id, 1, 16, 4, KDFParams{}, true},
+		{"negative", KDFArgon2id, -1, 0, 0, KDFParams{}, true},
+		{"unknown", "md5", 0, 0, 0, KDFParams{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewKDFParams(tt.algorithm, tt.iterations, tt.memory, tt.parallelism)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewKDFParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewKDFParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKDFParams_DeriveKey(t *testing.T) {
+	salt := []byte("0123456789abcdef0123456789abcdef")
+	params := []KDFParams{
+		{KDFArgon2id, 1, 1024, 1},
+		{KDFScrypt, 0, 1024, 1},
+		{KDFPBKDF2, 100000, 0, 0},
+	}
+
+	// The defaults derive the keys of vaults from before configurable
+	// parameters
+	want := NewAESGCMEncryptor().GenerateKey("password", salt)
+	if got, err := DefaultKDFParams(KDFArgon2id).DeriveKey("password", salt); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("DeriveKey() with the defaults = %x, %v, want %x", got, err, want)
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range params {
+		key, err := p.DeriveKey("password", salt)
+		if err != nil || len(key) != 32 {
+			t.Fatalf("%s: DeriveKey() = %d bytes, %v", p, len(key), err)
+		}
+		again, _ := p.DeriveKey("password", salt)
+		if !bytes.Equal(key, again) {
+			t.Errorf("%s: DeriveKey() not deterministic", p)
+		}
+		if seen[string(key)] {
+			t.Errorf("%s: derives the same key as another function", p)
+		}
+		seen[string(key)] = true
+	}
+
+	if _, err := (KDFParams{Algorithm: KDFScrypt, Memory: 1000, Parallelism: 1}).DeriveKey("password", salt); err == nil {
+		t.Error("DeriveKey() accepted invalid parameters")
+	}
+}
+
+func TestKDFParams_Weaker(t *testing.T) {
+	base := KDFParams{KDFArgon2id, 3, 64 * 1024, 4}
+
+	tests := []struct {
+		name string
+		q    KDFParams
+		want bool
+	}{
+		{"same", base, false},
+		{"more iterations", KDFParams{KDFArgon2id, 4, 64 * 1024, 4}, true},
+		{"more memory", KDFParams{KDFArgon2id, 3, 128 * 1024, 4}, true},
+		{"fewer iterations", KDFParams{KDFArgon2id, 2, 64 * 1024, 4}, false},
+		{"more memory fewer iterations, costlier", KDFParams{KDFArgon2id, 2, 256 * 1024, 4}, true},
+		{"more memory fewer iterations, cheaper", KDFParams{KDFArgon2id, 1, 128 * 1024, 4}, false},
+		{"more memory fewer iterations, same cost", KDFParams{KDFArgon2id, 1, 192 * 1024, 4}, false},
+		{"more iterations less memory, costlier", KDFParams{KDFArgon2id, 8, 32 * 1024, 4}, true},
+		{"more iterations less memory, cheaper", KDFParams{KDFArgon2id, 4, 32 * 1024, 4}, false},
+		{"other parallelism", KDFParams{KDFArgon2id, 3, 64 * 1024, 1}, false},
+		{"weaker function", KDFParams{KDFPBKDF2, 1000000, 0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		if got := base.Weaker(tt.q); got != tt.want {
+			t.Errorf("%s: Weaker() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !(KDFParams{KDFPBKDF2, 600000, 0, 0}).Weaker(base) {
+		t.Error("pbkdf2 is not weaker than argon2id")
+	}
+}
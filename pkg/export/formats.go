@@ -21,10 +21,18 @@ type Exporter interface {
 
 // ExporterOptions contains common options for all exporters
 type ExporterOptions struct {
-	SortKeys     bool                   // Sort keys alphabetically
-	IncludeEmpty bool                   // Include empty values
-	ShowComments bool                   // Include comments where supported
-	TemplateData map[string]interface{} // Additional template data
+	SortKeys     bool                        // Sort keys alphabetically
+	IncludeEmpty bool                        // Include empty values
+	ShowComments bool                        // Include comments where supported
+	TemplateData map[string]interface{}      // Additional template data
+	Metadata     map[string]VariableMetadata // Optional per-variable metadata
+}
+
+// VariableMetadata describes a variable in exported output
+type VariableMetadata struct {
+	Description string
+	Tags        []string
+	Owner       string
 }
 
 // DotEnvExporter exports in standard .env format
@@ -66,6 +74,10 @@ func (d *DotEnvExporter) Export(vars map[string]string, w io.Writer) error {
 	for _, key := range keys {
 		value := vars[key]
 
+		if d.Options.ShowComments {
+			writeMetadataComments(w, d.Options.Metadata[key])
+		}
+
 		// Handle special characters in values
 		if d.needsQuoting(value) || d.QuoteValues {
 			value = strconv.Quote(value)
@@ -186,7 +198,27 @@ func (y *YAMLExporter) Export(vars map[string]string, w io.Writer) error {
 	encoder := yaml.NewEncoder(w)
 	defer encoder.Close()
 
-	return encoder.Encode(vars)
+	if !y.Options.ShowComments || len(y.Options.Metadata) == 0 {
+		return encoder.Encode(vars)
+	}
+
+	// Build the document by hand so metadata can be attached as comments
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range getSortedKeys(vars, true) {
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+		if comment := metadataComment(y.Options.Metadata[key]); comment != "" {
+			keyNode.HeadComment = comment
+		}
+
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(vars[key]); err != nil {
+			return err
+		}
+
+		doc.Content = append(doc.Content, keyNode, valueNode)
+	}
+
+	return encoder.Encode(doc)
 }
 
 func (y *YAMLExporter) FileExtension() string {
@@ -237,6 +269,11 @@ func (s *ShellExporter) Export(vars map[string]string, w io.Writer) error {
 
 	for _, key := range keys {
 		value := vars[key]
+
+		if s.Options.ShowComments {
+			writeMetadataComments(w, s.Options.Metadata[key])
+		}
+
 		// Properly escape for shell
 		escaped := shellEscape(value)
 
@@ -293,6 +330,11 @@ func (d *DockerExporter) Export(vars map[string]string, w io.Writer) error {
 
 	for _, key := range keys {
 		value := vars[key]
+
+		if d.Options.ShowComments {
+			writeMetadataComments(w, d.Options.Metadata[key])
+		}
+
 		// Docker ENV instruction format
 		fmt.Fprintf(w, "ENV %s=%s\n", key, dockerEscape(value))
 	}
@@ -343,6 +385,7 @@ func (t *TemplateExporter) Export(vars map[string]string, w io.Writer) error {
 		"Variables": vars,
 		"Keys":      getSortedKeys(vars, t.Options.SortKeys),
 		"Timestamp": getCurrentTimestamp(),
+		"Metadata":  t.Options.Metadata,
 	}
 
 	// Add any additional template data
@@ -417,6 +460,33 @@ func getSortedKeys(vars map[string]string, shouldSort bool) []string {
 	return keys
 }
 
+// metadataComment renders metadata as comment text, one line per field
+func metadataComment(meta VariableMetadata) string {
+	// Comments must stay on a single line each
+	oneLine := func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	var lines []string
+	if meta.Description != "" {
+		lines = append(lines, "# "+oneLine(meta.Description))
+	}
+	if len(meta.Tags) > 0 {
+		lines = append(lines, "# Tags: "+oneLine(strings.Join(meta.Tags, ", ")))
+	}
+	if meta.Owner != "" {
+		lines = append(lines, "# Owner: "+oneLine(meta.Owner))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeMetadataComments writes metadata comments above a variable
+func writeMetadataComments(w io.Writer, meta VariableMetadata) {
+	if comment := metadataComment(meta); comment != "" {
+		fmt.Fprintln(w, comment)
+	}
+}
+
 // shellEscape properly escapes a value for shell scripts
 func shellEscape(value string) string {
 	// Use single quotes to avoid most shell interpretation
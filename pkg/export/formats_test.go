@@ -413,6 +413,94 @@ Variables:
 	}
 }
 
+func TestExporterMetadataComments(t *testing.T) {
+	vars := map[string]string{
+		"API_KEY":   "secret123",
+		"LOG_LEVEL": "debug",
+	}
+	metadata := map[string]VariableMetadata{
+		"API_KEY": {
+			Description: "Payments API key\nrotated monthly",
+			Tags:        []string{"payments", "external"},
+			Owner:       "billing-team",
+		},
+	}
+
+	wantLines := []string{
+		"# Payments API key rotated monthly",
+		"# Tags: payments, external",
+		"# Owner: billing-team",
+	}
+
+	dotenv := NewDotEnvExporter()
+	yamlExp := NewYAMLExporter()
+	shell := NewShellExporter()
+	docker := NewDockerExporter()
+
+	exporters := []struct {
+		name     string
+		exporter Exporter
+		options  *ExporterOptions
+	}{
+		{"dotenv", dotenv, &dotenv.Options},
+		{"yaml", yamlExp, &yamlExp.Options},
+		{"shell", shell, &shell.Options},
+		{"docker", docker, &docker.Options},
+	}
+
+	for _, tt := range exporters {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.ShowComments = true
+			tt.options.Metadata = metadata
+
+			var buf bytes.Buffer
+			if err := tt.exporter.Export(vars, &buf); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			output := buf.String()
+
+			for _, line := range wantLines {
+				if !strings.Contains(output, line) {
+					t.Errorf("Output missing %q:\n%s", line, output)
+				}
+			}
+
+			// Comments must come before the variable they describe
+			if strings.Index(output, wantLines[0]) > strings.Index(output, "API_KEY") {
+				t.Errorf("Metadata comment should precede API_KEY:\n%s", output)
+			}
+
+			// Without comments no metadata is written
+			tt.options.ShowComments = false
+			buf.Reset()
+			if err := tt.exporter.Export(vars, &buf); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			if strings.Contains(buf.String(), "billing-team") {
+				t.Errorf("Metadata written without comments:\n%s", buf.String())
+			}
+		})
+	}
+
+	// YAML with comments must still decode to the same variables
+	y := NewYAMLExporter()
+	y.Options.ShowComments = true
+	y.Options.Metadata = metadata
+
+	var buf bytes.Buffer
+	if err := y.Export(vars, &buf); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	var decoded map[string]string
+	if err := yaml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to parse YAML output: %v", err)
+	}
+	if decoded["API_KEY"] != "secret123" || decoded["LOG_LEVEL"] != "debug" {
+		t.Errorf("Decoded YAML = %v, want original variables", decoded)
+	}
+}
+
 func TestExporterFactory(t *testing.T) {
 	factory := NewExporterFactory()
 
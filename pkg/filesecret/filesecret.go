@@ -0,0 +1,143 @@
+// Package filesecret stores the contents of files such as certificates
+// and private keys as variable values.
+//
+// A file is kept as a single line of text:
+//
+//	vaultenv-file:v1;name=tls.crt;base64,<contents>
+//
+// Values in this form pass through every storage backend unchanged,
+// whatever bytes the file holds, and are told apart from ordinary values
+// by their prefix.
+package filesecret
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix starts every encoded file
+const Prefix = "vaultenv-file:v1;"
+
+// MaxSize is the largest file that can be stored. Encoding and encryption
+// grow a value, so this stays well below the storage value limit.
+const MaxSize = 1 << 20
+
+// ErrTooLarge is returned for files larger than MaxSize
+var ErrTooLarge = fmt.Errorf("file exceeds the maximum size of %d bytes", MaxSize)
+
+// ErrInvalid is returned for values that start with Prefix but cannot be decoded
+var ErrInvalid = errors.New("invalid file value")
+
+// File is a file stored in a variable
+type File struct {
+	Name string // Base name of the original file, used when it is written out
+	Data []byte
+}
+
+// IsFile reports whether a value holds an encoded file
+func IsFile(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encode returns the value form of a file
+func Encode(f File) (string, error) {
+	if len(f.Data) > MaxSize {
+		return "", ErrTooLarge
+	}
+
+	return Prefix + "name=" + url.PathEscape(f.Name) + ";base64," +
+		base64.StdEncoding.EncodeToString(f.Data), nil
+}
+
+// Decode parses a value produced by Encode
+func Decode(value string) (File, error) {
+	if !IsFile(value) {
+		return File{}, fmt.Errorf("%w: missing %q prefix", ErrInvalid, Prefix)
+	}
+
+	params, data, found := strings.Cut(strings.TrimPrefix(value, Prefix), ";base64,")
+	if !found {
+		return File{}, fmt.Errorf("%w: missing contents", ErrInvalid)
+	}
+
+	var f File
+	for _, param := range strings.Split(params, ";") {
+		name, val, _ := strings.Cut(param, "=")
+		if name != "name" {
+			// Unknown parameters are left for newer versions
+			continue
+		}
+
+		unescaped, err := url.PathUnescape(val)
+		if err != nil {
+			return File{}, fmt.Errorf("%w: bad name: %v", ErrInvalid, err)
+		}
+		f.Name = unescaped
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return File{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	f.Data = decoded
+
+	return f, nil
+}
+
+// ReadFile reads a file to store, refusing files larger than MaxSize
+// without reading them whole
+func ReadFile(path string) (File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxSize+1))
+	if err != nil {
+		return File{}, err
+	}
+	if len(data) > MaxSize {
+		return File{}, fmt.Errorf("%s: %w", path, ErrTooLarge)
+	}
+
+	return File{Name: filepath.Base(path), Data: data}, nil
+}
+
+// FileName returns the name to write a file under, falling back to
+// fallback when the stored name is missing or not a plain file name
+func (f File) FileName(fallback string) string {
+	name := f.Name
+	if name == "" || name == "." || name == ".." || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) {
+		return fallback
+	}
+
+	return name
+}
+
+// WriteFile writes the contents to path, readable by the owner only
+func (f File) WriteFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// An existing file keeps its mode when it is truncated
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+
+	if _, err := file.Write(f.Data); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,115 @@
+package filesecret
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	binary := []byte{0x00, 0xff, '\n', '\r', 0x1b, '=', ';'}
+
+	tests := []struct {
+		name string
+		file File
+	}{
+		{"binary", File{Name: "key.der", Data: binary}},
+		{"text with trailing newlines", File{Name: "tls.crt", Data: []byte("-----BEGIN CERTIFICATE-----\nMIIB\n\n\n")}},
+		{"name needing escapes", File{Name: "my cert;v=2.pem", Data: []byte("x")}},
+		{"empty", File{Name: "empty", Data: []byte{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := Encode(tt.file)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !IsFile(value) || strings.ContainsAny(value, "\n\r\x00") {
+				t.Fatalf("Encode() = %q, want a single line with the file prefix", value)
+			}
+
+			got, err := Decode(value)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got.Name != tt.file.Name || !bytes.Equal(got.Data, tt.file.Data) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.file)
+			}
+		})
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, value := range []string{
+		"plain value",
+		Prefix + "name=x",
+		Prefix + "name=x;base64,not base64!",
+		Prefix + "name=%zz;base64,",
+	} {
+		if _, err := Decode(value); err == nil {
+			t.Errorf("Decode(%q) succeeded", value)
+		}
+	}
+
+	if IsFile("plain value") {
+		t.Error("IsFile() accepted a plain value")
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	if _, err := Encode(File{Data: make([]byte, MaxSize+1)}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Encode() of an oversized file error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "big.bin")
+	os.WriteFile(path, make([]byte, MaxSize+1), 0644)
+	if _, err := ReadFile(path); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("ReadFile() of an oversized file error = %v", err)
+	}
+
+	os.WriteFile(path, make([]byte, MaxSize), 0644)
+	if f, err := ReadFile(path); err != nil || len(f.Data) != MaxSize || f.Name != "big.bin" {
+		t.Errorf("ReadFile() of a file at the limit = %d bytes, %v", len(f.Data), err)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"tls.crt":      "tls.crt",
+		"":             "KEY",
+		"..":           "KEY",
+		"../etc/passw": "KEY",
+		`dir\key.pem`:  "KEY",
+	}
+
+	for name, want := range tests {
+		if got := (File{Name: name}).FileName("KEY"); got != want {
+			t.Errorf("FileName() of %q = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.pem")
+	os.WriteFile(path, []byte("previous, longer contents"), 0644)
+
+	if err := (File{Data: []byte("secret")}).WriteFile(path); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "secret" {
+		t.Errorf("file contents = %q", data)
+	}
+
+	// Windows only knows read-only files
+	info, _ := os.Stat(path)
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
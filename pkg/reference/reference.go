@@ -0,0 +1,234 @@
+// Package reference resolves references between stored secrets.
+//
+// A value may contain ${ref:KEY} to include another variable of the same
+// environment, or ${ref:ENV/KEY} to include a variable of another
+// environment. $${ref:...} stands for the literal text ${ref:...}.
+// References are resolved when values are read, not when they are stored,
+// so changing DB_HOST changes every value that references it.
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrCycle is returned when references form a loop
+var ErrCycle = errors.New("reference cycle")
+
+// ErrInvalid is returned for a malformed reference
+var ErrInvalid = errors.New("invalid reference")
+
+// refPattern matches ${ref:...}, optionally escaped with a second $
+var refPattern = regexp.MustCompile(`\$?\$\{ref:([^}]*)\}`)
+
+// LookupFunc returns the stored value of a variable
+type LookupFunc func(environment, key string) (string, error)
+
+// AuthorizeFunc reports whether references into an environment are allowed
+type AuthorizeFunc func(environment string) error
+
+// Ref is a reference to a variable
+type Ref struct {
+	Environment string // Empty for the environment of the referencing value
+	Key         string
+}
+
+// String returns the reference as it is written in a value
+func (r Ref) String() string {
+	if r.Environment == "" {
+		return "${ref:" + r.Key + "}"
+	}
+	return "${ref:" + r.Environment + "/" + r.Key + "}"
+}
+
+// CycleError describes a reference loop
+type CycleError struct {
+	Chain []string // ENV/KEY names, the first and last are the same
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCycle, strings.Join(e.Chain, " -> "))
+}
+
+func (e *CycleError) Unwrap() error {
+	return ErrCycle
+}
+
+// Contains reports whether a value holds at least one reference
+func Contains(value string) bool {
+	for _, m := range refPattern.FindAllString(value, -1) {
+		if !strings.HasPrefix(m, "$$") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse returns the references in a value
+func Parse(value string) ([]Ref, error) {
+	var refs []Ref
+	for _, m := range refPattern.FindAllStringSubmatch(value, -1) {
+		if strings.HasPrefix(m[0], "$$") {
+			continue
+		}
+		ref, err := parseRef(m[1])
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func parseRef(s string) (Ref, error) {
+	env, key, found := strings.Cut(s, "/")
+	if !found {
+		env, key = "", s
+	}
+
+	if key == "" || strings.Contains(key, "/") || (found && env == "") {
+		return Ref{}, fmt.Errorf("%w: ${ref:%s}", ErrInvalid, s)
+	}
+
+	return Ref{Environment: env, Key: key}, nil
+}
+
+// Resolver resolves the references in the values of one environment.
+// Resolved values are cached, so a Resolver should not outlive a command.
+type Resolver struct {
+	environment string
+	lookup      LookupFunc
+	authorize   AuthorizeFunc
+
+	raw        map[string]string
+	resolved   map[string]string
+	authorized map[string]error
+	stack      []string
+}
+
+// NewResolver creates a resolver for the values of environment. authorize
+// is called once for every other environment a value references and may
+// be nil to allow all of them.
+func NewResolver(environment string, lookup LookupFunc, authorize AuthorizeFunc) *Resolver {
+	return &Resolver{
+		environment: environment,
+		lookup:      lookup,
+		authorize:   authorize,
+		raw:         make(map[string]string),
+		resolved:    make(map[string]string),
+		authorized:  make(map[string]error),
+	}
+}
+
+// Resolve returns value, read from key, with every reference replaced
+func (r *Resolver) Resolve(key, value string) (string, error) {
+	return r.resolve(r.environment, key, value)
+}
+
+// ResolveAll resolves every value of vars, which holds the variables of
+// the resolver's environment
+func (r *Resolver) ResolveAll(vars map[string]string) (map[string]string, error) {
+	for key, value := range vars {
+		r.raw[r.environment+"/"+key] = value
+	}
+
+	result := make(map[string]string, len(vars))
+	for key, value := range vars {
+		resolved, err := r.Resolve(key, value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = resolved
+	}
+	return result, nil
+}
+
+func (r *Resolver) resolve(env, key, value string) (string, error) {
+	name := env + "/" + key
+	if resolved, ok := r.resolved[name]; ok {
+		return resolved, nil
+	}
+
+	for i, n := range r.stack {
+		if n == name {
+			chain := append(append([]string{}, r.stack[i:]...), name)
+			return "", &CycleError{Chain: chain}
+		}
+	}
+
+	r.stack = append(r.stack, name)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	var firstErr error
+	resolved := refPattern.ReplaceAllStringFunc(value, func(m string) string {
+		if firstErr != nil {
+			return m
+		}
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+
+		ref, err := parseRef(m[len("${ref:") : len(m)-1])
+		if err != nil {
+			firstErr = fmt.Errorf("%s: %w", key, err)
+			return m
+		}
+
+		target, err := r.value(env, ref)
+		if err != nil {
+			firstErr = err
+			return m
+		}
+		return target
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	r.resolved[name] = resolved
+	return resolved, nil
+}
+
+// value returns the resolved value a reference found in env points to
+func (r *Resolver) value(env string, ref Ref) (string, error) {
+	targetEnv := ref.Environment
+	if targetEnv == "" {
+		targetEnv = env
+	}
+
+	if err := r.checkAccess(targetEnv); err != nil {
+		return "", fmt.Errorf("cannot resolve %s: %w", ref, err)
+	}
+
+	name := targetEnv + "/" + ref.Key
+	if resolved, ok := r.resolved[name]; ok {
+		return resolved, nil
+	}
+
+	raw, ok := r.raw[name]
+	if !ok {
+		var err error
+		raw, err = r.lookup(targetEnv, ref.Key)
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve %s: %w", ref, err)
+		}
+		r.raw[name] = raw
+	}
+
+	return r.resolve(targetEnv, ref.Key, raw)
+}
+
+func (r *Resolver) checkAccess(env string) error {
+	if env == r.environment || r.authorize == nil {
+		return nil
+	}
+
+	err, checked := r.authorized[env]
+	if !checked {
+		err = r.authorize(env)
+		r.authorized[env] = err
+	}
+	return err
+}
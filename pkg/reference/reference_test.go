@@ -0,0 +1,156 @@
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// vault maps ENV/KEY to stored values
+type vault map[string]string
+
+func (v vault) lookup(env, key string) (string, error) {
+	value, ok := v[env+"/"+key]
+	if !ok {
+		return "", fmt.Errorf("%s not found", key)
+	}
+	return value, nil
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []Ref
+		wantErr bool
+	}{
+		{"plain", nil, false},
+		{"${ref:DB_HOST}", []Ref{{Key: "DB_HOST"}}, false},
+		{"postgres://${ref:shared/DB_HOST}:${ref:PORT}/app", []Ref{{"shared", "DB_HOST"}, {"", "PORT"}}, false},
+		{"$${ref:DB_HOST}", nil, false},
+		{"${DB_HOST}", nil, false},
+		{"${ref:}", nil, true},
+		{"${ref:/KEY}", nil, true},
+		{"${ref:a/b/c}", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+			if Contains(tt.value) != (len(tt.want) > 0 || tt.wantErr) {
+				t.Errorf("Contains() = %v", Contains(tt.value))
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	v := vault{
+		"development/DB_HOST":  "localhost",
+		"development/DB_PORT":  "5432",
+		"development/DB_ADDR":  "${ref:DB_HOST}:${ref:DB_PORT}",
+		"shared/REGISTRY":      "registry.example.com",
+		"shared/IMAGE":         "${ref:REGISTRY}/app",
+		"development/EMPTY":    "",
+		"development/LOOP_A":   "${ref:LOOP_B}",
+		"development/LOOP_B":   "${ref:LOOP_A}",
+		"development/SELF":     "x${ref:SELF}",
+		"development/CROSS_A":  "${ref:shared/CROSS_B}",
+		"shared/CROSS_B":       "${ref:development/CROSS_A}",
+		"restricted/API_TOKEN": "secret",
+	}
+
+	tests := []struct {
+		name      string
+		value     string
+		want      string
+		wantErr   error
+		wantChain []string
+	}{
+		{"plain value", "value", "value", nil, nil},
+		{"same environment", "postgres://${ref:DB_HOST}/app", "postgres://localhost/app", nil, nil},
+		{"nested", "${ref:DB_ADDR}", "localhost:5432", nil, nil},
+		{"other environment resolves in its own environment", "${ref:shared/IMAGE}", "registry.example.com/app", nil, nil},
+		{"empty target", "[${ref:EMPTY}]", "[]", nil, nil},
+		{"escaped", "$${ref:DB_HOST}", "${ref:DB_HOST}", nil, nil},
+		{"cycle", "${ref:LOOP_A}", "", ErrCycle, []string{"development/LOOP_A", "development/LOOP_B", "development/LOOP_A"}},
+		{"self reference", "${ref:SELF}", "", ErrCycle, nil},
+		{"cross environment cycle", "${ref:CROSS_A}", "", ErrCycle, nil},
+		{"invalid", "${ref:a/b/c}", "", ErrInvalid, nil},
+		{"denied environment", "${ref:restricted/API_TOKEN}", "", errDenied, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewResolver("development", v.lookup, func(env string) error {
+				if env == "restricted" {
+					return errDenied
+				}
+				return nil
+			})
+
+			got, err := r.Resolve("VALUE", tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+				}
+				var cycle *CycleError
+				if tt.wantChain != nil && (!errors.As(err, &cycle) || !reflect.DeepEqual(cycle.Chain, tt.wantChain)) {
+					t.Errorf("cycle = %v, want %v", cycle, tt.wantChain)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var errDenied = errors.New("access denied")
+
+func TestResolver_MissingReference(t *testing.T) {
+	r := NewResolver("development", vault{}.lookup, nil)
+
+	if _, err := r.Resolve("URL", "${ref:MISSING}"); err == nil {
+		t.Fatal("Resolve() should fail for a missing variable")
+	}
+}
+
+func TestResolver_ResolveAll(t *testing.T) {
+	v := vault{"development/HOST": "db", "shared/PORT": "5432"}
+	calls := 0
+	r := NewResolver("development", func(env, key string) (string, error) {
+		calls++
+		return v.lookup(env, key)
+	}, nil)
+
+	got, err := r.ResolveAll(map[string]string{
+		"HOST": "db",
+		"URL":  "${ref:HOST}:${ref:shared/PORT}",
+		"URL2": "${ref:HOST}:${ref:shared/PORT}",
+	})
+	if err != nil {
+		t.Fatalf("ResolveAll() error = %v", err)
+	}
+
+	want := map[string]string{"HOST": "db", "URL": "db:5432", "URL2": "db:5432"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveAll() = %v, want %v", got, want)
+	}
+
+	// Variables of the environment are not looked up again and other
+	// targets only once
+	if calls != 1 {
+		t.Errorf("lookup called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BulkBackend extends Backend with reads of many variables at once, so
+// reading an environment costs one file read or query instead of one per
+// variable. Use GetAll and GetMany, which fall back to List and Get for
+// backends without bulk reads.
+type BulkBackend interface {
+	Backend
+
+	// GetAll returns every variable of the environment
+	GetAll() (map[string]string, error)
+
+	// GetMany returns the given variables. Keys that do not exist are
+	// left out of the result.
+	GetMany(keys []string) (map[string]string, error)
+}
+
+// ReadErrors is returned together with the variables that could be read
+// when some of them could not, keyed by variable
+type ReadErrors map[string]error
+
+func (e ReadErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	messages := make([]string, 0, len(keys))
+	for _, key := range keys {
+		messages = append(messages, fmt.Sprintf("%s: %v", key, e[key]))
+	}
+
+	return fmt.Sprintf("failed to read %d variable(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+// GetAll returns every variable of a backend, stopping when ctx is done.
+// If some variables cannot be read, the others are returned with a
+// ReadErrors error.
+func GetAll(ctx context.Context, backend Backend) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if bb, ok := backend.(BulkBackend); ok {
+		return bb.GetAll()
+	}
+
+	keys, err := WithContext(backend).ListContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return getEach(ctx, backend, keys)
+}
+
+// GetMany returns the given variables of a backend the same way as
+// GetAll. Keys that do not exist are left out of the result.
+func GetMany(ctx context.Context, backend Backend, keys []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if bb, ok := backend.(BulkBackend); ok {
+		return bb.GetMany(keys)
+	}
+
+	return getEach(ctx, backend, keys)
+}
+
+// getEach reads variables one by one for backends without bulk reads
+func getEach(ctx context.Context, backend Backend, keys []string) (map[string]string, error) {
+	cb := WithContext(backend)
+
+	result := make(map[string]string, len(keys))
+	failed := make(ReadErrors)
+	for _, key := range keys {
+		value, err := cb.GetContext(ctx, key)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+		result[key] = value
+	}
+
+	if len(failed) > 0 {
+		return result, failed
+	}
+
+	return result, nil
+}
+
+// pickKeys returns the entries of data for the given keys that exist
+func pickKeys(data map[string]string, keys []string) map[string]string {
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if value, ok := data[key]; ok {
+			result[key] = value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGetAllAndGetMany(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newBackends := map[string]func() (Backend, error){
+		"memory": func() (Backend, error) { return NewMemoryBackend(), nil },
+		"file":   func() (Backend, error) { return NewFileBackend(tmpDir, "file") },
+		"sqlite": func() (Backend, error) { return NewSQLiteBackend(tmpDir, "sqlite") },
+		"git":    func() (Backend, error) { return NewGitBackend(tmpDir, "git") },
+		"plain":  func() (Backend, error) { return &plainBackend{NewMemoryBackend()}, nil },
+		"encrypted": func() (Backend, error) {
+			return NewEncryptedBackend(NewMemoryBackend(), "test-password")
+		},
+	}
+
+	want := map[string]string{"API_KEY": "secret", "DEBUG": "true", "EMPTY": ""}
+
+	for name, newBackend := range newBackends {
+		t.Run(name, func(t *testing.T) {
+			backend, err := newBackend()
+			if err != nil {
+				t.Fatalf("failed to create backend: %v", err)
+			}
+			defer backend.Close()
+
+			if all, err := GetAll(context.Background(), backend); err != nil || len(all) != 0 {
+				t.Errorf("GetAll() of an empty environment = %v, %v", all, err)
+			}
+
+			for key, value := range want {
+				if err := backend.Set(key, value, true); err != nil {
+					t.Fatalf("Set() error = %v", err)
+				}
+			}
+
+			all, err := GetAll(context.Background(), backend)
+			if err != nil || !reflect.DeepEqual(all, want) {
+				t.Errorf("GetAll() = %v, %v, want %v", all, err, want)
+			}
+
+			many, err := GetMany(context.Background(), backend, []string{"DEBUG", "MISSING", "API_KEY"})
+			if err != nil || !reflect.DeepEqual(many, map[string]string{"DEBUG": "true", "API_KEY": "secret"}) {
+				t.Errorf("GetMany() = %v, %v", many, err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if _, err := GetAll(ctx, backend); !errors.Is(err, context.Canceled) {
+				t.Errorf("GetAll() with a cancelled context error = %v", err)
+			}
+		})
+	}
+}
+
+func TestGetMany_SQLiteBatches(t *testing.T) {
+	backend, err := NewSQLiteBackend(t.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer backend.Close()
+
+	tx, _ := backend.Begin()
+	keys := make([]string, 0, 2*sqliteMaxVariables+1)
+	for i := 0; i < cap(keys); i++ {
+		key := fmt.Sprintf("KEY_%04d", i)
+		keys = append(keys, key)
+		tx.Set(key, key, false)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	values, err := backend.GetMany(keys)
+	if err != nil || len(values) != len(keys) || values["KEY_1000"] != "KEY_1000" {
+		t.Errorf("GetMany() returned %d values, %v", len(values), err)
+	}
+}
+
+func TestGetAll_ReportsUndecryptableValues(t *testing.T) {
+	memory := NewMemoryBackend()
+
+	other, _ := NewEncryptedBackend(memory, "other-password")
+	other.Set("FOREIGN", "secret", true)
+
+	backend, _ := NewEncryptedBackend(memory, "test-password")
+	backend.Set("API_KEY", "secret", true)
+
+	all, err := GetAll(context.Background(), backend)
+
+	var readErrs ReadErrors
+	if !errors.As(err, &readErrs) || len(readErrs) != 1 || readErrs["FOREIGN"] == nil {
+		t.Fatalf("GetAll() error = %v, want a read error for FOREIGN", err)
+	}
+	if !reflect.DeepEqual(all, map[string]string{"API_KEY": "secret"}) {
+		t.Errorf("GetAll() = %v, want the readable values", all)
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+)
+
+// ContextBackend is the context-aware form of Backend. Every call takes a
+// context so callers can cancel long-running work or give it a deadline.
+// Backends that talk to a remote service implement it natively, local
+// backends are adapted with WithContext.
+type ContextBackend interface {
+	// SetContext stores a variable with optional encryption
+	SetContext(ctx context.Context, key, value string, encrypt bool) error
+
+	// GetContext retrieves a variable value
+	GetContext(ctx context.Context, key string) (string, error)
+
+	// ExistsContext checks if a variable exists
+	ExistsContext(ctx context.Context, key string) (bool, error)
+
+	// DeleteContext removes a variable
+	DeleteContext(ctx context.Context, key string) error
+
+	// ListContext returns all variable names
+	ListContext(ctx context.Context) ([]string, error)
+
+	// Close closes the storage backend
+	Close() error
+}
+
+// WithContext returns the context-aware view of a backend. Backends that
+// implement ContextBackend are returned as they are; for the others every
+// call checks the context before it reaches the backend, so a cancelled
+// context stops a sequence of calls at the next one.
+func WithContext(backend Backend) ContextBackend {
+	if cb, ok := backend.(ContextBackend); ok {
+		return cb
+	}
+
+	return &contextAdapter{backend: backend}
+}
+
+// contextAdapter adapts a Backend to ContextBackend
+type contextAdapter struct {
+	backend Backend
+}
+
+// SetContext stores a variable unless the context is done
+func (a *contextAdapter) SetContext(ctx context.Context, key, value string, encrypt bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.backend.Set(key, value, encrypt)
+}
+
+// GetContext retrieves a variable unless the context is done
+func (a *contextAdapter) GetContext(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return a.backend.Get(key)
+}
+
+// ExistsContext checks a variable unless the context is done
+func (a *contextAdapter) ExistsContext(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return a.backend.Exists(key)
+}
+
+// DeleteContext removes a variable unless the context is done
+func (a *contextAdapter) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.backend.Delete(key)
+}
+
+// ListContext returns all variable names unless the context is done
+func (a *contextAdapter) ListContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.backend.List()
+}
+
+// Close closes the adapted backend
+func (a *contextAdapter) Close() error {
+	return a.backend.Close()
+}
+
+// Unwrap returns the adapted backend
+func (a *contextAdapter) Unwrap() Backend {
+	return a.backend
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithContext(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.Set("API_KEY", "secret", false)
+
+	cb := WithContext(backend)
+	ctx := context.Background()
+
+	value, err := cb.GetContext(ctx, "API_KEY")
+	if err != nil || value != "secret" {
+		t.Errorf("GetContext() = %q, %v, want %q", value, err, "secret")
+	}
+	if err := cb.SetContext(ctx, "DB_URL", "postgres://localhost", false); err != nil {
+		t.Errorf("SetContext() error = %v", err)
+	}
+	if keys, err := cb.ListContext(ctx); err != nil || len(keys) != 2 {
+		t.Errorf("ListContext() = %v, %v, want 2 keys", keys, err)
+	}
+
+	// A cancelled context stops calls before they reach the backend
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := cb.GetContext(cancelled, "API_KEY"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetContext() error = %v, want %v", err, context.Canceled)
+	}
+	if err := cb.SetContext(cancelled, "OTHER", "value", false); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetContext() error = %v, want %v", err, context.Canceled)
+	}
+	if err := cb.DeleteContext(cancelled, "API_KEY"); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteContext() error = %v, want %v", err, context.Canceled)
+	}
+	if exists, _ := backend.Exists("OTHER"); exists {
+		t.Error("SetContext() wrote with a cancelled context")
+	}
+	if exists, _ := backend.Exists("API_KEY"); !exists {
+		t.Error("DeleteContext() deleted with a cancelled context")
+	}
+}
+
+func TestEncryptedBackend_ContextBackend(t *testing.T) {
+	encBackend, err := NewEncryptedBackend(NewMemoryBackend(), "test-password")
+	if err != nil {
+		t.Fatalf("NewEncryptedBackend() error = %v", err)
+	}
+
+	// The encrypted backend is context-aware itself
+	cb := WithContext(encBackend)
+	if cb != ContextBackend(encBackend) {
+		t.Error("WithContext() wrapped a backend that implements ContextBackend")
+	}
+
+	ctx := context.Background()
+	if err := cb.SetContext(ctx, "API_KEY", "secret", true); err != nil {
+		t.Fatalf("SetContext() error = %v", err)
+	}
+	value, err := cb.GetContext(ctx, "API_KEY")
+	if err != nil || value != "secret" {
+		t.Errorf("GetContext() = %q, %v, want %q", value, err, "secret")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := cb.GetContext(cancelled, "API_KEY"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetContext() error = %v, want %v", err, context.Canceled)
+	}
+	if err := cb.SetContext(cancelled, "API_KEY", "changed", true); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetContext() error = %v, want %v", err, context.Canceled)
+	}
+	if value, _ := encBackend.Get("API_KEY"); value != "secret" {
+		t.Errorf("Get() = %q after cancelled SetContext(), want %q", value, "secret")
+	}
+}
@@ -1,9 +1,14 @@
 package storage
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
@@ -22,70 +27,150 @@ type EncryptedValue struct {
 
 // EncryptedBackend wraps any storage backend with transparent encryption
 type EncryptedBackend struct {
-	backend   Backend
-	encryptor encryption.Encryptor
-	key       []byte
+	backend       Backend
+	encryptor     encryption.Encryptor
+	key           []byte
+	alwaysEncrypt bool // Encrypt values even when the caller asks for plain text
+
+	// header is the vault header the key was derived with, nil for vaults
+	// without one. Values written before the vault had a header are
+	// decrypted with the legacy key, derived from password when needed.
+	header     *VaultHeader
+	password   string
+	legacyOnce sync.Once
+	legacyKey  []byte
 }
 
-// NewEncryptedBackend creates a new encrypted storage backend
+// NewEncryptedBackend creates a new encrypted storage backend for a vault
+// without a header, see NewEncryptedBackendWithHeader
 func NewEncryptedBackend(backend Backend, password string) (*EncryptedBackend, error) {
+	// Use default encryptor (AES-GCM-256)
+	return newEncryptedBackend(backend, password, encryption.DefaultEncryptor(), nil)
+}
+
+// NewEncryptedBackendWithEncryptor creates an encrypted backend with a specific encryptor
+func NewEncryptedBackendWithEncryptor(backend Backend, password string, encryptor encryption.Encryptor) (*EncryptedBackend, error) {
+	return newEncryptedBackend(backend, password, encryptor, nil)
+}
+
+// NewEncryptedBackendWithHeader creates an encrypted backend deriving its
+// key with the salt and parameters of a vault header
+func NewEncryptedBackendWithHeader(backend Backend, password string, header *VaultHeader) (*EncryptedBackend, error) {
+	if header == nil {
+		return nil, fmt.Errorf("header cannot be nil")
+	}
+	return newEncryptedBackend(backend, password, encryption.DefaultEncryptor(), header)
+}
+
+func newEncryptedBackend(backend Backend, password string, encryptor encryption.Encryptor, header *VaultHeader) (*EncryptedBackend, error) {
 	if backend == nil {
 		return nil, fmt.Errorf("backend cannot be nil")
 	}
 	if password == "" {
 		return nil, fmt.Errorf("password cannot be empty")
 	}
+	if encryptor == nil {
+		return nil, fmt.Errorf("encryptor cannot be nil")
+	}
 
-	// Use default encryptor (AES-GCM-256)
-	encryptor := encryption.DefaultEncryptor()
+	e := &EncryptedBackend{
+		backend:   backend,
+		encryptor: encryptor,
+		header:    header,
+		password:  password,
+	}
+
+	key, err := e.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	e.key = key
 
-	// For the master key, we use a fixed salt derived from the password itself
-	// This ensures consistent key derivation across instances
-	masterSalt := []byte("vaultenv-master-salt-v1")
+	return e, nil
+}
 
-	// Derive key from password
-	key := encryptor.GenerateKey(password, masterSalt)
+// deriveKey derives the master key from a password, with the vault header
+// when there is one
+func (e *EncryptedBackend) deriveKey(password string) ([]byte, error) {
+	if e.header != nil {
+		return e.header.DeriveKey(password)
+	}
 
-	return &EncryptedBackend{
-		backend:   backend,
-		encryptor: encryptor,
-		key:       key,
-	}, nil
+	// Vaults without a header share a fixed salt
+	return e.encryptor.GenerateKey(password, legacyMasterSalt), nil
 }
 
-// NewEncryptedBackendWithEncryptor creates an encrypted backend with a specific encryptor
-func NewEncryptedBackendWithEncryptor(backend Backend, password string, encryptor encryption.Encryptor) (*EncryptedBackend, error) {
-	if backend == nil {
-		return nil, fmt.Errorf("backend cannot be nil")
+// valueVersion returns the EncryptedValue version the backend writes
+func (e *EncryptedBackend) valueVersion() int {
+	if e.header != nil {
+		return headerValueVersion
 	}
-	if password == "" {
-		return nil, fmt.Errorf("password cannot be empty")
+	return legacyValueVersion
+}
+
+// masterKey returns the key values of the given version are encrypted with
+func (e *EncryptedBackend) masterKey(version int) ([]byte, error) {
+	if version >= headerValueVersion {
+		if e.header == nil {
+			return nil, fmt.Errorf("value is encrypted with the key of the vault header, but %w", ErrNoVaultHeader)
+		}
+		return e.key, nil
 	}
-	if encryptor == nil {
-		return nil, fmt.Errorf("encryptor cannot be nil")
+	if e.header == nil {
+		return e.key, nil
 	}
 
-	// For the master key, we use a fixed salt derived from the password itself
-	// This ensures consistent key derivation across instances
-	masterSalt := []byte("vaultenv-master-salt-v1")
+	e.legacyOnce.Do(func() {
+		e.legacyKey = e.encryptor.GenerateKey(e.password, legacyMasterSalt)
+	})
+	return e.legacyKey, nil
+}
+
+// SetContext encrypts and stores a variable unless the context is done
+func (e *EncryptedBackend) SetContext(ctx context.Context, key, value string, encrypt bool) error {
+	return e.setContext(ctx, key, value, encrypt, e.encodeValue)
+}
 
-	// Derive key from password
-	key := encryptor.GenerateKey(password, masterSalt)
+// setContext stores a value encoded by encode, checking the context
+// around the key derivation
+func (e *EncryptedBackend) setContext(ctx context.Context, key, value string, encrypt bool,
+	encode func(key, value string, encrypt bool) (string, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return &EncryptedBackend{
-		backend:   backend,
-		encryptor: encryptor,
-		key:       key,
-	}, nil
+	data, err := encode(key, value, encrypt)
+	if err != nil {
+		return err
+	}
+
+	return WithContext(e.backend).SetContext(ctx, key, data, false)
 }
 
 // Set stores a variable with optional encryption
 func (e *EncryptedBackend) Set(key, value string, encrypt bool) error {
-	if !encrypt {
+	data, err := e.encodeValue(key, value, encrypt)
+	if err != nil {
+		return err
+	}
+
+	// Store in backend
+	return e.backend.Set(key, data, false)
+}
+
+// encodeValue turns a value into the JSON form kept by the wrapped backend
+func (e *EncryptedBackend) encodeValue(key, value string, encrypt bool) (string, error) {
+	// Checked before the slow key derivation; the wrapped backend checks
+	// the encoded value again
+	if err := checkValue(value); err != nil {
+		return "", err
+	}
+
+	if !encrypt && !e.alwaysEncrypt {
 		// Store as plain text with metadata indicating it's not encrypted
 		ev := EncryptedValue{
 			Algorithm:   e.encryptor.Algorithm(),
-			Version:     1,
+			Version:     e.valueVersion(),
 			IsEncrypted: false,
 			Ciphertext:  value, // Store plaintext in ciphertext field
 			CreatedAt:   time.Now().Unix(),
@@ -94,16 +179,16 @@ func (e *EncryptedBackend) Set(key, value string, encrypt bool) error {
 		// Marshal to JSON
 		data, err := json.Marshal(ev)
 		if err != nil {
-			return fmt.Errorf("failed to marshal value: %w", err)
+			return "", fmt.Errorf("failed to marshal value: %w", err)
 		}
 
-		return e.backend.Set(key, string(data), false)
+		return string(data), nil
 	}
 
 	// Generate new salt for this value
 	salt, err := e.encryptor.GenerateSalt()
 	if err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
+		return "", fmt.Errorf("failed to generate salt: %w", err)
 	}
 
 	// Derive key for this specific value
@@ -112,13 +197,13 @@ func (e *EncryptedBackend) Set(key, value string, encrypt bool) error {
 	// Encrypt the value
 	ciphertext, err := e.encryptor.Encrypt([]byte(value), valueKey)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt value: %w", err)
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
 	}
 
 	// Create encrypted value with metadata
 	ev := EncryptedValue{
 		Algorithm:   e.encryptor.Algorithm(),
-		Version:     1,
+		Version:     e.valueVersion(),
 		Salt:        base64.StdEncoding.EncodeToString(salt),
 		Ciphertext:  base64.StdEncoding.EncodeToString(ciphertext),
 		IsEncrypted: true,
@@ -128,11 +213,24 @@ func (e *EncryptedBackend) Set(key, value string, encrypt bool) error {
 	// Marshal to JSON
 	data, err := json.Marshal(ev)
 	if err != nil {
-		return fmt.Errorf("failed to marshal encrypted value: %w", err)
+		return "", fmt.Errorf("failed to marshal encrypted value: %w", err)
 	}
 
-	// Store in backend
-	return e.backend.Set(key, string(data), false)
+	return string(data), nil
+}
+
+// GetContext retrieves and decrypts a variable unless the context is done
+func (e *EncryptedBackend) GetContext(ctx context.Context, key string) (string, error) {
+	data, err := WithContext(e.backend).GetContext(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return e.decrypt(data)
 }
 
 // Get retrieves and decrypts a variable value
@@ -143,6 +241,86 @@ func (e *EncryptedBackend) Get(key string) (string, error) {
 		return "", err
 	}
 
+	return e.decrypt(data)
+}
+
+// GetAll reads every variable from the underlying backend in one go and
+// decrypts the values in parallel
+func (e *EncryptedBackend) GetAll() (map[string]string, error) {
+	data, err := GetAll(context.Background(), e.backend)
+	return e.decryptAll(data, err)
+}
+
+// GetMany reads the given variables from the underlying backend in one go
+// and decrypts the values in parallel
+func (e *EncryptedBackend) GetMany(keys []string) (map[string]string, error) {
+	data, err := GetMany(context.Background(), e.backend, keys)
+	return e.decryptAll(data, err)
+}
+
+// maxDecryptWorkers bounds the values decrypted at the same time. Each
+// key derivation takes 64 MB with the default Argon2id parameters.
+const maxDecryptWorkers = 4
+
+// decryptAll decrypts values read in bulk in parallel. Every value has its
+// own salt, so the key derivation dominates and is worth spreading out.
+// readErr is the error of the bulk read; values that could not be read or
+// decrypted are reported together in a ReadErrors error.
+func (e *EncryptedBackend) decryptAll(data map[string]string, readErr error) (map[string]string, error) {
+	failed := make(ReadErrors)
+	if readErr != nil {
+		var readErrs ReadErrors
+		if !errors.As(readErr, &readErrs) {
+			return nil, readErr
+		}
+		for key, err := range readErrs {
+			failed[key] = err
+		}
+	}
+
+	type job struct{ key, value string }
+
+	jobs := make(chan job)
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = make(map[string]string, len(data))
+	)
+
+	workers := min(runtime.NumCPU(), maxDecryptWorkers, len(data))
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				value, err := e.decrypt(j.value)
+
+				mu.Lock()
+				if err != nil {
+					failed[j.key] = err
+				} else {
+					result[j.key] = value
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for key, value := range data {
+		jobs <- job{key, value}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return result, failed
+	}
+
+	return result, nil
+}
+
+// decrypt turns a stored value back into plaintext
+func (e *EncryptedBackend) decrypt(data string) (string, error) {
 	// Try to unmarshal as encrypted value
 	var ev EncryptedValue
 	if err := json.Unmarshal([]byte(data), &ev); err != nil {
@@ -177,8 +355,13 @@ func (e *EncryptedBackend) Get(key string) (string, error) {
 		}
 	}
 
+	masterKey, err := e.masterKey(ev.Version)
+	if err != nil {
+		return "", err
+	}
+
 	// Derive key for this specific value
-	valueKey := encryptor.GenerateKey(string(e.key), salt)
+	valueKey := encryptor.GenerateKey(string(masterKey), salt)
 
 	// Decrypt
 	plaintext, err := encryptor.Decrypt(ciphertext, valueKey)
@@ -189,6 +372,47 @@ func (e *EncryptedBackend) Get(key string) (string, error) {
 	return string(plaintext), nil
 }
 
+// StaleKeys returns the variables of an encrypted backend whose values are
+// not encrypted the way the backend encrypts new values: with a key
+// derived without the vault header, or with another algorithm. Writing
+// them again brings them up to date. Other backends have none.
+func StaleKeys(b Backend) ([]string, error) {
+	sb, ok := b.(interface{ staleKeys() ([]string, error) })
+	if !ok {
+		return nil, nil
+	}
+	return sb.staleKeys()
+}
+
+// staleKeys returns the variables not encrypted the way Set encrypts
+// them, see StaleKeys
+func (e *EncryptedBackend) staleKeys() ([]string, error) {
+	return e.staleKeysFor(e.encryptor.Algorithm())
+}
+
+// staleKeysFor returns the variables encrypted with another algorithm or
+// an older key than the backend writes
+func (e *EncryptedBackend) staleKeysFor(algorithm string) ([]string, error) {
+	data, err := GetAll(context.Background(), e.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, value := range data {
+		var ev EncryptedValue
+		if err := json.Unmarshal([]byte(value), &ev); err != nil || !ev.IsEncrypted {
+			continue
+		}
+		if ev.Version < e.valueVersion() || ev.Algorithm != algorithm {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
 // Exists checks if a variable exists
 func (e *EncryptedBackend) Exists(key string) (bool, error) {
 	return e.backend.Exists(key)
@@ -204,11 +428,224 @@ func (e *EncryptedBackend) List() ([]string, error) {
 	return e.backend.List()
 }
 
+// ExistsContext checks if a variable exists unless the context is done
+func (e *EncryptedBackend) ExistsContext(ctx context.Context, key string) (bool, error) {
+	return WithContext(e.backend).ExistsContext(ctx, key)
+}
+
+// DeleteContext removes a variable unless the context is done
+func (e *EncryptedBackend) DeleteContext(ctx context.Context, key string) error {
+	return WithContext(e.backend).DeleteContext(ctx, key)
+}
+
+// ListContext returns all variable names unless the context is done
+func (e *EncryptedBackend) ListContext(ctx context.Context) ([]string, error) {
+	return WithContext(e.backend).ListContext(ctx)
+}
+
 // Close closes the storage backend
 func (e *EncryptedBackend) Close() error {
 	return e.backend.Close()
 }
 
+// Unwrap returns the underlying storage backend
+func (e *EncryptedBackend) Unwrap() Backend {
+	return e.backend
+}
+
+// GetHistory returns the decrypted history of a variable when the
+// underlying backend keeps history
+func (e *EncryptedBackend) GetHistory(key string, limit int) ([]SecretHistory, error) {
+	hb, ok := e.backend.(HistoryBackend)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+
+	history, err := hb.GetHistory(key, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range history {
+		value, err := e.decrypt(history[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt version %d of %s: %w", history[i].Version, key, err)
+		}
+		history[i].Value = value
+	}
+
+	return history, nil
+}
+
+// GetEnvironmentHistory returns the decrypted history of the environment
+// when the underlying backend keeps history
+func (e *EncryptedBackend) GetEnvironmentHistory(limit int) ([]SecretHistory, error) {
+	hb, ok := e.backend.(HistoryBackend)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+
+	history, err := hb.GetEnvironmentHistory(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range history {
+		value, err := e.decrypt(history[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt version %d of %s: %w", history[i].Version, history[i].Key, err)
+		}
+		history[i].Value = value
+	}
+
+	return history, nil
+}
+
+// GetAuditLog returns the audit log of the underlying backend
+func (e *EncryptedBackend) GetAuditLog(limit int) ([]AuditEntry, error) {
+	hb, ok := e.backend.(HistoryBackend)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+
+	return hb.GetAuditLog(limit)
+}
+
+// GetMetadata returns the metadata kept by the underlying backend.
+// Metadata is not encrypted.
+func (e *EncryptedBackend) GetMetadata(key string) (*SecretMetadata, error) {
+	mb, ok := e.backend.(MetadataBackend)
+	if !ok {
+		return nil, ErrMetadataNotSupported
+	}
+
+	return mb.GetMetadata(key)
+}
+
+// SetMetadata stores metadata in the underlying backend
+func (e *EncryptedBackend) SetMetadata(key string, metadata *SecretMetadata) error {
+	mb, ok := e.backend.(MetadataBackend)
+	if !ok {
+		return ErrMetadataNotSupported
+	}
+
+	return mb.SetMetadata(key, metadata)
+}
+
+// ListTrash returns the decrypted trash of the underlying backend
+func (e *EncryptedBackend) ListTrash() ([]TrashedSecret, error) {
+	tb, ok := e.backend.(TrashBackend)
+	if !ok {
+		return nil, ErrTrashNotSupported
+	}
+
+	trash, err := tb.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trash {
+		value, err := e.decrypt(trash[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt deleted %s: %w", trash[i].Key, err)
+		}
+		trash[i].Value = value
+	}
+
+	return trash, nil
+}
+
+// Undelete moves a variable back from the trash of the underlying
+// backend. The value is restored as it was stored, still encrypted.
+func (e *EncryptedBackend) Undelete(key string) error {
+	tb, ok := e.backend.(TrashBackend)
+	if !ok {
+		return ErrTrashNotSupported
+	}
+
+	return tb.Undelete(key)
+}
+
+// PurgeTrash purges the trash of the underlying backend
+func (e *EncryptedBackend) PurgeTrash(before time.Time) (int, error) {
+	tb, ok := e.backend.(TrashBackend)
+	if !ok {
+		return 0, ErrTrashNotSupported
+	}
+
+	return tb.PurgeTrash(before)
+}
+
+// Check checks the underlying backend and reports the values, including
+// deleted ones in the trash, that cannot be decrypted with the vault key.
+// Such values cannot be repaired; they have to be set again.
+func (e *EncryptedBackend) Check(repair bool) ([]Problem, error) {
+	cb, ok := e.backend.(CheckBackend)
+	if !ok {
+		return nil, ErrCheckNotSupported
+	}
+
+	problems, err := cb.Check(repair)
+	if err != nil {
+		return problems, err
+	}
+
+	// Damaged storage was reported above
+	keys, err := e.backend.List()
+	if err != nil {
+		return problems, nil
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		data, err := e.backend.Get(key)
+		if err != nil {
+			continue
+		}
+		if _, err := e.decrypt(data); err != nil {
+			problems = append(problems, Problem{
+				Kind:    ProblemUndecryptable,
+				Path:    key,
+				Message: fmt.Sprintf("%v; set the variable again", err),
+			})
+		}
+	}
+
+	if tb, ok := e.backend.(TrashBackend); ok {
+		trash, err := tb.ListTrash()
+		if err != nil {
+			return problems, nil
+		}
+		for _, entry := range trash {
+			if _, err := e.decrypt(entry.Value); err != nil {
+				problems = append(problems, Problem{
+					Kind:    ProblemUndecryptable,
+					Path:    "trash/" + entry.Key,
+					Message: fmt.Sprintf("%v; purge it from the trash", err),
+				})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// Begin starts a transaction on the underlying backend. Values are
+// encrypted when they are staged.
+func (e *EncryptedBackend) Begin() (Tx, error) {
+	tb, ok := e.backend.(TransactionalBackend)
+	if !ok {
+		return nil, ErrTransactionsNotSupported
+	}
+
+	tx, err := tb.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedTx{tx: tx, encode: e.encodeValue}, nil
+}
+
 // UpdatePassword changes the encryption password for all encrypted values
 func (e *EncryptedBackend) UpdatePassword(oldPassword, newPassword string) error {
 	if oldPassword == "" || newPassword == "" {
@@ -252,9 +689,10 @@ func (e *EncryptedBackend) UpdatePassword(oldPassword, newPassword string) error
 		valuesToReencrypt[key] = value
 	}
 
-	// Use the same fixed master salt for key derivation
-	masterSalt := []byte("vaultenv-master-salt-v1")
-	newKey := e.encryptor.GenerateKey(newPassword, masterSalt)
+	newKey, err := e.deriveKey(newPassword)
+	if err != nil {
+		return err
+	}
 
 	// Store old key for rollback
 	oldKey := e.key
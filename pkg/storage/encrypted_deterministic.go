@@ -1,10 +1,10 @@
 package storage
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
 )
@@ -18,8 +18,15 @@ type DeterministicEncryptedBackend struct {
 
 // NewDeterministicEncryptedBackend creates a new encrypted backend with optional deterministic mode
 func NewDeterministicEncryptedBackend(backend Backend, password string, useDeterministic bool) (*DeterministicEncryptedBackend, error) {
+	return newDeterministicEncryptedBackend(backend, password, encryption.DefaultEncryptor(), useDeterministic, nil)
+}
+
+// newDeterministicEncryptedBackend creates the backend with the key derived
+// from a vault header, or the legacy key when header is nil. encryptor
+// encrypts the values that are not encrypted deterministically.
+func newDeterministicEncryptedBackend(backend Backend, password string, encryptor encryption.Encryptor, useDeterministic bool, header *VaultHeader) (*DeterministicEncryptedBackend, error) {
 	// Create base encrypted backend
-	base, err := NewEncryptedBackend(backend, password)
+	base, err := newEncryptedBackend(backend, password, encryptor, header)
 	if err != nil {
 		return nil, err
 	}
@@ -39,14 +46,62 @@ func NewDeterministicEncryptedBackend(backend Backend, password string, useDeter
 
 // Set stores a variable with encryption (deterministic if enabled)
 func (d *DeterministicEncryptedBackend) Set(key, value string, encrypt bool) error {
-	if !encrypt {
-		// Use base implementation for unencrypted values
-		return d.EncryptedBackend.Set(key, value, false)
+	data, err := d.encodeValue(key, value, encrypt)
+	if err != nil {
+		return err
+	}
+
+	// Store in backend
+	return d.backend.Set(key, data, false)
+}
+
+// SetContext stores a variable like Set unless the context is done
+func (d *DeterministicEncryptedBackend) SetContext(ctx context.Context, key, value string, encrypt bool) error {
+	return d.setContext(ctx, key, value, encrypt, d.encodeValue)
+}
+
+// Begin starts a transaction on the underlying backend, encrypting
+// staged values the same way as Set
+func (d *DeterministicEncryptedBackend) Begin() (Tx, error) {
+	tb, ok := d.backend.(TransactionalBackend)
+	if !ok {
+		return nil, ErrTransactionsNotSupported
+	}
+
+	tx, err := tb.Begin()
+	if err != nil {
+		return nil, err
 	}
 
+	return &encryptedTx{tx: tx, encode: d.encodeValue}, nil
+}
+
+// encodeValue turns a value into the JSON form kept by the wrapped backend
+func (d *DeterministicEncryptedBackend) encodeValue(key, value string, encrypt bool) (string, error) {
 	if !d.useDeterministic {
 		// Use base implementation for regular encryption
-		return d.EncryptedBackend.Set(key, value, true)
+		return d.EncryptedBackend.encodeValue(key, value, encrypt)
+	}
+	if err := checkValue(value); err != nil {
+		return "", err
+	}
+
+	if !encrypt {
+		// Store as plain text; the creation time is left out so that
+		// rewriting an unchanged value produces the same bytes
+		ev := EncryptedValue{
+			Algorithm:   d.encryptor.Algorithm(),
+			Version:     d.valueVersion(),
+			IsEncrypted: false,
+			Ciphertext:  value,
+		}
+
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal value: %w", err)
+		}
+
+		return string(data), nil
 	}
 
 	// Use deterministic encryption
@@ -63,27 +118,34 @@ func (d *DeterministicEncryptedBackend) Set(key, value string, encrypt bool) err
 	// Encrypt the value deterministically
 	ciphertext, err := d.deterministicEncryptor.EncryptDeterministic([]byte(value), valueKey, context)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt value: %w", err)
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
 	}
 
 	// Create encrypted value with metadata
 	ev := EncryptedValue{
 		Algorithm:   d.deterministicEncryptor.Algorithm(),
-		Version:     1,
+		Version:     d.valueVersion(),
 		Salt:        base64.StdEncoding.EncodeToString(salt),
 		Ciphertext:  base64.StdEncoding.EncodeToString(ciphertext),
 		IsEncrypted: true,
-		CreatedAt:   time.Now().Unix(),
 	}
 
 	// Marshal to JSON
 	data, err := json.Marshal(ev)
 	if err != nil {
-		return fmt.Errorf("failed to marshal encrypted value: %w", err)
+		return "", fmt.Errorf("failed to marshal encrypted value: %w", err)
 	}
 
-	// Store in backend
-	return d.backend.Set(key, string(data), false)
+	return string(data), nil
+}
+
+// staleKeys returns the variables not encrypted the way Set encrypts
+// them, see StaleKeys
+func (d *DeterministicEncryptedBackend) staleKeys() ([]string, error) {
+	if !d.useDeterministic {
+		return d.EncryptedBackend.staleKeys()
+	}
+	return d.staleKeysFor(d.deterministicEncryptor.Algorithm())
 }
 
 // SetWithEnvironment stores a variable with environment-specific context for deterministic encryption
@@ -112,11 +174,10 @@ func (d *DeterministicEncryptedBackend) SetWithEnvironment(environment, key, val
 	// Create encrypted value with metadata
 	ev := EncryptedValue{
 		Algorithm:   d.deterministicEncryptor.Algorithm(),
-		Version:     1,
+		Version:     d.valueVersion(),
 		Salt:        base64.StdEncoding.EncodeToString(salt),
 		Ciphertext:  base64.StdEncoding.EncodeToString(ciphertext),
 		IsEncrypted: true,
-		CreatedAt:   time.Now().Unix(),
 	}
 
 	// Marshal to JSON
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
 
@@ -379,6 +383,51 @@ func TestEncryptedBackend_AlgorithmMigration(t *testing.T) {
 	}
 }
 
+func TestEncryptedBackend_ConfiguredAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	opts := BackendOptions{Environment: "test", Type: "file", BasePath: dir, Password: "test-password"}
+
+	aesStore, err := GetBackendWithOptions(opts)
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	aesStore.Set("OLD", "old-value", true)
+	aesStore.Close()
+
+	opts.Algorithm = "chacha20-poly1305"
+	store, err := GetBackendWithOptions(opts)
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	defer store.Close()
+	store.Set("NEW", "new-value", true)
+
+	raw, _ := NewFileBackend(dir, "test")
+	for key, want := range map[string]string{"OLD": "aes-gcm-256", "NEW": "chacha20-poly1305"} {
+		data, _ := raw.Get(key)
+		var ev EncryptedValue
+		json.Unmarshal([]byte(data), &ev)
+		if ev.Algorithm != want {
+			t.Errorf("%s algorithm = %q, want %q", key, ev.Algorithm, want)
+		}
+	}
+
+	// Values of both algorithms are read during a switch
+	values, err := GetAll(context.Background(), store)
+	if err != nil || values["OLD"] != "old-value" || values["NEW"] != "new-value" {
+		t.Errorf("GetAll() = %v, %v", values, err)
+	}
+
+	if keys, err := StaleKeys(store); err != nil || len(keys) != 1 || keys[0] != "OLD" {
+		t.Errorf("StaleKeys() = %v, %v, want [OLD]", keys, err)
+	}
+
+	opts.Algorithm = "rot13"
+	if _, err := GetBackendWithOptions(opts); err == nil {
+		t.Error("GetBackendWithOptions() accepted an unknown algorithm")
+	}
+}
+
 func TestEncryptedBackend_Close(t *testing.T) {
 	memBackend := NewMemoryBackend()
 	encBackend, _ := NewEncryptedBackend(memBackend, "test-password")
@@ -419,6 +468,91 @@ func TestEncryptedBackend_Metadata(t *testing.T) {
 	}
 }
 
+func TestEncryptedBackend_History(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted_history_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sqliteBackend, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+
+	encBackend, _ := NewEncryptedBackend(sqliteBackend, "test-password")
+	defer encBackend.Close()
+
+	encBackend.Set("HISTORY_KEY", "first-secret", true)
+	encBackend.Set("HISTORY_KEY", "second-secret", true)
+	encBackend.Delete("HISTORY_KEY")
+
+	historyBackend, ok := AsHistoryBackend(encBackend)
+	if !ok {
+		t.Fatal("AsHistoryBackend() = false, want true for encrypted SQLite backend")
+	}
+
+	history, err := historyBackend.GetHistory("HISTORY_KEY", 10)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("GetHistory() returned %d entries, want 3", len(history))
+	}
+
+	expectedValues := []string{"second-secret", "second-secret", "first-secret"}
+	for i, h := range history {
+		if h.Value != expectedValues[i] {
+			t.Errorf("History[%d].Value = %v, want %v", i, h.Value, expectedValues[i])
+		}
+	}
+
+	// Raw history must stay encrypted
+	rawHistory, _ := sqliteBackend.GetHistory("HISTORY_KEY", 10)
+	for i, h := range rawHistory {
+		if strings.Contains(h.Value, "-secret") {
+			t.Errorf("Raw history[%d] contains plaintext: %v", i, h.Value)
+		}
+	}
+
+	encBackend.Set("OTHER_KEY", "other-secret", true)
+
+	envHistory, err := historyBackend.GetEnvironmentHistory(10)
+	if err != nil {
+		t.Fatalf("GetEnvironmentHistory() error = %v", err)
+	}
+	if len(envHistory) != 4 {
+		t.Fatalf("GetEnvironmentHistory() returned %d entries, want 4", len(envHistory))
+	}
+	if envHistory[0].Key != "OTHER_KEY" || envHistory[0].Value != "other-secret" {
+		t.Errorf("GetEnvironmentHistory()[0] = %s=%s, want OTHER_KEY=other-secret", envHistory[0].Key, envHistory[0].Value)
+	}
+	if envHistory[3].Key != "HISTORY_KEY" || envHistory[3].Value != "first-secret" {
+		t.Errorf("GetEnvironmentHistory()[3] = %s=%s, want HISTORY_KEY=first-secret", envHistory[3].Key, envHistory[3].Value)
+	}
+
+	if _, err := historyBackend.GetAuditLog(10); err != nil {
+		t.Errorf("GetAuditLog() error = %v", err)
+	}
+}
+
+func TestEncryptedBackend_HistoryNotSupported(t *testing.T) {
+	encBackend, _ := NewEncryptedBackend(NewMemoryBackend(), "test-password")
+
+	if _, ok := AsHistoryBackend(encBackend); ok {
+		t.Error("AsHistoryBackend() = true, want false for encrypted memory backend")
+	}
+
+	if _, err := encBackend.GetHistory("KEY", 10); !errors.Is(err, ErrHistoryNotSupported) {
+		t.Errorf("GetHistory() error = %v, want %v", err, ErrHistoryNotSupported)
+	}
+
+	if _, err := encBackend.GetAuditLog(10); !errors.Is(err, ErrHistoryNotSupported) {
+		t.Errorf("GetAuditLog() error = %v, want %v", err, ErrHistoryNotSupported)
+	}
+}
+
 func BenchmarkEncryptedBackend_SetEncrypted(b *testing.B) {
 	memBackend := NewMemoryBackend()
 	encBackend, _ := NewEncryptedBackend(memBackend, "benchmark-password")
@@ -3,14 +3,25 @@ package storage_test
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/vaultenv/vaultenv-cli/pkg/storage"
 )
 
 // ExampleBackend demonstrates basic usage of the storage backend
 func ExampleBackend() {
+	// Keep the vault in a temporary directory
+	dir, err := os.MkdirTemp("", "vaultenv-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
 	// Get a backend for the "development" environment
-	backend, err := storage.GetBackend("development")
+	backend, err := storage.GetBackendWithOptions(storage.BackendOptions{
+		Environment: "development",
+		BasePath:    dir,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
 // FileBackend implements persistent file-based storage
 type FileBackend struct {
-	mu       sync.RWMutex
-	basePath string
-	env      string
+	mu          sync.RWMutex
+	basePath    string
+	env         string
+	lockTimeout time.Duration // How long to wait for other processes, 0 uses the default
 }
 
 // NewFileBackend creates a new file-based storage backend
@@ -23,17 +26,90 @@ func NewFileBackend(basePath, environment string) (*FileBackend, error) {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
+	if err := openFormat("file", newFileFormat(basePath)); err != nil {
+		return nil, err
+	}
+
 	return &FileBackend{
 		basePath: basePath,
 		env:      environment,
 	}, nil
 }
 
+// fileFormat is the on-disk format of file vaults, recorded in data/.format
+type fileFormat struct {
+	path string
+}
+
+func newFileFormat(basePath string) *fileFormat {
+	return &fileFormat{path: filepath.Join(basePath, "data", ".format")}
+}
+
+func (f *fileFormat) version() (int, error) {
+	return readFormatFile(f.path)
+}
+
+// empty reports whether no environment has a data file yet
+func (f *fileFormat) empty() (bool, error) {
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (f *fileFormat) migrations() []formatMigration {
+	return []formatMigration{
+		{
+			version:     1,
+			description: "record the vault format",
+			plan: func() ([]string, error) {
+				return []string{"write " + f.path}, nil
+			},
+			apply: func() error {
+				return writeFormatFile(f.path, 1)
+			},
+			markerOnly: true,
+		},
+	}
+}
+
 // getDataFile returns the path to the data file for this environment
 func (f *FileBackend) getDataFile() string {
 	return filepath.Join(f.basePath, "data", f.env+".json")
 }
 
+// getLockFile returns the path to the lock file guarding writes to this environment
+func (f *FileBackend) getLockFile() string {
+	return filepath.Join(f.basePath, "data", f.env+".lock")
+}
+
+// lock takes the in-process write lock and the advisory file lock shared
+// with other processes; the returned function releases both
+func (f *FileBackend) lock() (func(), error) {
+	f.mu.Lock()
+
+	fl, err := acquireLock(f.getLockFile(), f.lockTimeout)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		fl.release()
+		f.mu.Unlock()
+	}, nil
+}
+
 // loadData loads the data from disk
 func (f *FileBackend) loadData() (map[string]string, error) {
 	dataFile := f.getDataFile()
@@ -65,22 +141,59 @@ func (f *FileBackend) loadData() (map[string]string, error) {
 
 // saveData saves the data to disk
 func (f *FileBackend) saveData(data map[string]string) error {
+	return writeJSONFile(f.getDataFile(), data)
+}
+
+// getMetadataFile returns the path to the metadata file for this environment
+func (f *FileBackend) getMetadataFile() string {
+	return filepath.Join(f.basePath, "metadata", f.env+".json")
+}
+
+// loadMetadata loads the metadata from disk
+func (f *FileBackend) loadMetadata() (map[string]*SecretMetadata, error) {
+	result := make(map[string]*SecretMetadata)
+
+	data, err := os.ReadFile(f.getMetadataFile())
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	return result, nil
+}
+
+// saveMetadata saves the metadata to disk
+func (f *FileBackend) saveMetadata(metadata map[string]*SecretMetadata) error {
+	if err := os.MkdirAll(filepath.Dir(f.getMetadataFile()), 0755); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	return writeJSONFile(f.getMetadataFile(), metadata)
+}
+
+// writeJSONFile writes v as indented JSON through a temporary file
+func writeJSONFile(path string, v interface{}) error {
 	// Marshal the data
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+	jsonData, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
 	// Write to a temporary file first
-	dataFile := f.getDataFile()
-	tempFile := dataFile + ".tmp"
+	tempFile := path + ".tmp"
 
 	if err := os.WriteFile(tempFile, jsonData, 0644); err != nil {
 		return fmt.Errorf("failed to write temporary file: %w", err)
 	}
 
 	// Rename temporary file to actual file (atomic operation)
-	if err := os.Rename(tempFile, dataFile); err != nil {
+	if err := os.Rename(tempFile, path); err != nil {
 		// Clean up temp file if rename fails
 		os.Remove(tempFile)
 		return fmt.Errorf("failed to save data file: %w", err)
@@ -91,8 +204,15 @@ func (f *FileBackend) saveData(data map[string]string) error {
 
 // Set stores a variable
 func (f *FileBackend) Set(key, value string, encrypt bool) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Load current data
 	data, err := f.loadData()
@@ -104,7 +224,24 @@ func (f *FileBackend) Set(key, value string, encrypt bool) error {
 	data[key] = value
 
 	// Save data back to disk
-	return f.saveData(data)
+	if err := f.saveData(data); err != nil {
+		return err
+	}
+
+	// Record who changed the variable and when
+	metadata, err := f.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	meta, ok := metadata[key]
+	if !ok {
+		meta = &SecretMetadata{}
+		metadata[key] = meta
+	}
+	meta.touch(time.Now().UTC())
+
+	return f.saveMetadata(metadata)
 }
 
 // Get retrieves a variable
@@ -143,8 +280,21 @@ func (f *FileBackend) Exists(key string) (bool, error) {
 
 // Delete removes a variable
 func (f *FileBackend) Delete(key string) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	return f.remove(key, true)
+}
+
+// purge removes a variable without keeping it in the trash
+func (f *FileBackend) purge(key string) error {
+	return f.remove(key, false)
+}
+
+// remove deletes a variable, moving it to the trash when trash is set
+func (f *FileBackend) remove(key string, trash bool) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Load current data
 	data, err := f.loadData()
@@ -152,11 +302,132 @@ func (f *FileBackend) Delete(key string) error {
 		return err
 	}
 
+	value, exists := data[key]
+	if !exists {
+		return nil
+	}
+
+	metadata, err := f.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	// Keep the variable in the trash until it is purged
+	if trash {
+		if err := f.trash().add(key, value, metadata[key], time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+
 	// Delete the key
 	delete(data, key)
 
 	// Save data back to disk
-	return f.saveData(data)
+	if err := f.saveData(data); err != nil {
+		return err
+	}
+
+	// Drop the metadata along with the variable
+	if _, ok := metadata[key]; !ok {
+		return nil
+	}
+	delete(metadata, key)
+
+	return f.saveMetadata(metadata)
+}
+
+// trash returns the trash of this environment
+func (f *FileBackend) trash() *trashFile {
+	return newTrashFile(f.basePath, f.env)
+}
+
+// ListTrash returns the deleted variables, most recently deleted first
+func (f *FileBackend) ListTrash() ([]TrashedSecret, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.trash().list()
+}
+
+// archivedValues returns the stored values of the trash
+func (f *FileBackend) archivedValues() ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.trash().values()
+}
+
+// rewriteArchive rewrites the stored values of the trash
+func (f *FileBackend) rewriteArchive(rewrite func(key, value string) (string, error)) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return f.trash().rewrite(rewrite)
+}
+
+// Undelete moves a variable from the trash back into the environment
+func (f *FileBackend) Undelete(key string) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	trash, err := f.trash().load()
+	if err != nil {
+		return err
+	}
+
+	entry, ok := trash[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	data, err := f.loadData()
+	if err != nil {
+		return err
+	}
+	if _, exists := data[key]; exists {
+		return ErrAlreadyExists
+	}
+
+	data[key] = entry.Value
+	if err := f.saveData(data); err != nil {
+		return err
+	}
+
+	metadata, err := f.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	meta := entry.Metadata
+	if meta == nil {
+		meta = &SecretMetadata{}
+	}
+	meta.touch(time.Now().UTC())
+	metadata[key] = meta
+
+	if err := f.saveMetadata(metadata); err != nil {
+		return err
+	}
+
+	delete(trash, key)
+	return f.trash().save(trash)
+}
+
+// PurgeTrash permanently removes the variables deleted before the given time
+func (f *FileBackend) PurgeTrash(before time.Time) (int, error) {
+	unlock, err := f.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return f.trash().purge(before)
 }
 
 // List returns all variable names
@@ -178,6 +449,212 @@ func (f *FileBackend) List() ([]string, error) {
 	return keys, nil
 }
 
+// GetAll returns every variable with a single read of the data file
+func (f *FileBackend) GetAll() (map[string]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.loadData()
+}
+
+// GetMany returns the given variables that exist with a single read of
+// the data file
+func (f *FileBackend) GetMany(keys []string) (map[string]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := f.loadData()
+	if err != nil {
+		return nil, err
+	}
+
+	return pickKeys(data, keys), nil
+}
+
+// GetMetadata returns the metadata of a variable
+func (f *FileBackend) GetMetadata(key string) (*SecretMetadata, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := f.loadData()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, exists := data[key]; !exists {
+		return nil, ErrNotFound
+	}
+
+	metadata, err := f.loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	if meta, ok := metadata[key]; ok {
+		return meta, nil
+	}
+
+	return &SecretMetadata{}, nil
+}
+
+// SetMetadata replaces the user-provided metadata of a variable
+func (f *FileBackend) SetMetadata(key string, metadata *SecretMetadata) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := f.loadData()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := data[key]; !exists {
+		return ErrNotFound
+	}
+
+	all, err := f.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	meta, ok := all[key]
+	if !ok {
+		meta = &SecretMetadata{}
+		all[key] = meta
+	}
+	meta.mergeUserFields(metadata)
+
+	return f.saveMetadata(all)
+}
+
+// Begin starts a transaction. All changes are written to the data file
+// with a single rename on commit.
+func (f *FileBackend) Begin() (Tx, error) {
+	return newBufferedTx(f.commit), nil
+}
+
+// commit applies the changes of a transaction
+func (f *FileBackend) commit(ops []txOp) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := f.loadData()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := f.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	trash, err := f.trash().load()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	trashed := false
+	for _, op := range ops {
+		if op.delete {
+			if value, exists := data[op.key]; exists {
+				trash[op.key] = &TrashedSecret{
+					Key:       op.key,
+					Value:     value,
+					Metadata:  metadata[op.key],
+					DeletedAt: now,
+					DeletedBy: getCurrentUser(),
+				}
+				trashed = true
+			}
+			delete(data, op.key)
+			delete(metadata, op.key)
+			continue
+		}
+
+		data[op.key] = op.value
+
+		meta, ok := metadata[op.key]
+		if !ok {
+			meta = &SecretMetadata{}
+			metadata[op.key] = meta
+		}
+		meta.touch(now)
+	}
+
+	if trashed {
+		if err := f.trash().save(trash); err != nil {
+			return err
+		}
+	}
+
+	if err := f.saveData(data); err != nil {
+		return err
+	}
+
+	return f.saveMetadata(metadata)
+}
+
+// Check reports damaged data files, temporary files left by interrupted
+// writes and metadata of variables that no longer exist
+func (f *FileBackend) Check(repair bool) ([]Problem, error) {
+	unlock, err := f.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var problems []Problem
+	problems = append(problems, checkJSONFile(f.env, f.getDataFile(), decodeJSON(&map[string]string{}), repair)...)
+	problems = append(problems, checkJSONFile(f.env, f.getMetadataFile(), decodeJSON(&map[string]*SecretMetadata{}), repair)...)
+	problems = append(problems, checkJSONFile(f.env, f.trash().path, decodeJSON(&map[string]*TrashedSecret{}), repair)...)
+
+	data, err := f.loadData()
+	if err != nil {
+		return problems, nil
+	}
+	metadata, err := f.loadMetadata()
+	if err != nil {
+		return problems, nil
+	}
+
+	var orphaned []string
+	for key := range metadata {
+		if _, exists := data[key]; !exists {
+			orphaned = append(orphaned, key)
+		}
+	}
+	sort.Strings(orphaned)
+
+	for _, key := range orphaned {
+		p := Problem{
+			Environment: f.env,
+			Kind:        ProblemOrphanedMetadata,
+			Path:        key,
+			Message:     "metadata of a variable that does not exist",
+			Repair:      "remove the metadata",
+		}
+		if repair {
+			delete(metadata, key)
+			p.Repaired = true
+		}
+		problems = append(problems, p)
+	}
+
+	if repair && len(orphaned) > 0 {
+		if err := f.saveMetadata(metadata); err != nil {
+			return problems, err
+		}
+	}
+
+	return problems, nil
+}
+
 // Close closes the backend (no-op for file backend)
 func (f *FileBackend) Close() error {
 	return nil
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrFormatTooNew is returned when a vault was written by a newer version
+// of vaultenv than the running one
+var ErrFormatTooNew = errors.New("vault was written by a newer version of vaultenv")
+
+// ErrFormatOutdated is returned when a vault was written in an older format
+// than the running version uses and reaching the current one rewrites its
+// data. Such vaults are only migrated by UpgradeFormat.
+var ErrFormatOutdated = errors.New("vault format is outdated")
+
+// ErrFormatNotSupported is returned for backends without an on-disk format
+var ErrFormatNotSupported = errors.New("storage backend has no versioned format")
+
+// Migration is one step in the on-disk format of a backend. Each backend
+// numbers its steps from 1; a vault records the last step applied to it.
+type Migration struct {
+	Version     int
+	Description string
+	Changes     []string // What applying the step would change, filled in by InspectFormat
+}
+
+// FormatStatus describes the on-disk format of a vault
+type FormatStatus struct {
+	Type    string
+	Version int // 0 for vaults written before formats were versioned
+	Latest  int // newest format this version of vaultenv writes
+	Pending []Migration
+}
+
+// formatMigration is a Migration with the code that plans and applies it
+type formatMigration struct {
+	version     int
+	description string
+
+	// plan describes the changes the step would make without making them
+	plan func() ([]string, error)
+
+	// apply makes the changes and records the new version
+	apply func() error
+
+	// markerOnly is set for steps that only record the format and leave
+	// the data as it is, so older versions of vaultenv still read it
+	markerOnly bool
+}
+
+// vaultFormat is the versioned on-disk layout of one backend type
+type vaultFormat interface {
+	// version returns the format recorded in the vault
+	version() (int, error)
+
+	// migrations returns every step of the format in order
+	migrations() []formatMigration
+
+	// empty reports whether the vault holds no variables yet
+	empty() (bool, error)
+}
+
+// latestFormat returns the version reached after all migrations
+func latestFormat(f vaultFormat) int {
+	migrations := f.migrations()
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// checkFormat returns the recorded version, refusing vaults written by a
+// newer version of vaultenv
+func checkFormat(typ string, f vaultFormat) (int, error) {
+	current, err := f.version()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read vault format: %w", err)
+	}
+
+	if latest := latestFormat(f); current > latest {
+		return 0, fmt.Errorf("%w: %s vault format %d, this version supports up to %d; upgrade vaultenv to open it",
+			ErrFormatTooNew, typ, current, latest)
+	}
+
+	return current, nil
+}
+
+// openFormat checks the format of a vault a backend opens. A new vault is
+// created in the latest format, and steps that only record the format are
+// applied to existing vaults. An existing vault with steps that rewrite
+// its data is refused rather than migrated, so opening it never locks out
+// older versions of vaultenv behind the user's back.
+func openFormat(typ string, f vaultFormat) error {
+	current, err := checkFormat(typ, f)
+	if err != nil {
+		return err
+	}
+
+	latest := latestFormat(f)
+	if current == latest {
+		return nil
+	}
+
+	markerOnly := true
+	for _, m := range f.migrations() {
+		if m.version > current && !m.markerOnly {
+			markerOnly = false
+		}
+	}
+
+	empty, err := f.empty()
+	if err != nil {
+		return fmt.Errorf("failed to read vault format: %w", err)
+	}
+	if !empty && !markerOnly {
+		// Another process may have created the vault since its format was
+		// read; the format is recorded before anything else is written
+		if current, err = checkFormat(typ, f); err != nil {
+			return err
+		}
+		if current == latest {
+			return nil
+		}
+		return fmt.Errorf("%w: %s vault format %d, this version uses %d; run 'vaultenv vault upgrade' to migrate it",
+			ErrFormatOutdated, typ, current, latest)
+	}
+
+	_, err = upgradeFormat(typ, f)
+	return err
+}
+
+// upgradeFormat applies the pending migrations of a vault in order and
+// returns the ones that were applied
+func upgradeFormat(typ string, f vaultFormat) ([]Migration, error) {
+	current, err := checkFormat(typ, f)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range f.migrations() {
+		if m.version <= current {
+			continue
+		}
+		if err := m.apply(); err != nil {
+			return applied, fmt.Errorf("failed to upgrade %s vault to format %d (%s): %w", typ, m.version, m.description, err)
+		}
+		applied = append(applied, Migration{Version: m.version, Description: m.description})
+	}
+
+	return applied, nil
+}
+
+// formatOf returns the on-disk format of the vault the options point to.
+// The returned function releases it.
+func formatOf(opts BackendOptions, readOnly bool) (vaultFormat, func(), error) {
+	basePath := opts.BasePath
+	if basePath == "" {
+		basePath = ".vaultenv"
+	}
+
+	switch opts.Type {
+	case "file":
+		return newFileFormat(basePath), func() {}, nil
+	case "git":
+		return newGitFormat(basePath), func() {}, nil
+	case "sqlite":
+		f, err := openSQLiteFormat(basePath, readOnly)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, f.close, nil
+	}
+
+	if !IsRegistered(opts.Type) {
+		return nil, nil, fmt.Errorf("unsupported backend type: %s", opts.Type)
+	}
+	return nil, nil, ErrFormatNotSupported
+}
+
+// InspectFormat reports the format of a vault and the migrations a newer
+// format would apply, without changing the vault
+func InspectFormat(opts BackendOptions) (*FormatStatus, error) {
+	if opts.Type == "" {
+		opts.Type = "file"
+	}
+
+	f, closeFormat, err := formatOf(opts, true)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFormat()
+
+	current, err := f.version()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault format: %w", err)
+	}
+
+	status := &FormatStatus{Type: opts.Type, Version: current, Latest: latestFormat(f)}
+	for _, m := range f.migrations() {
+		if m.version <= current {
+			continue
+		}
+
+		changes, err := m.plan()
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan format %d: %w", m.version, err)
+		}
+		status.Pending = append(status.Pending, Migration{Version: m.version, Description: m.description, Changes: changes})
+	}
+
+	return status, nil
+}
+
+// UpgradeFormat applies the pending migrations of a vault. Backends refuse
+// to open a vault with pending migrations that rewrite its data, so this
+// is the only way to apply those.
+func UpgradeFormat(opts BackendOptions) ([]Migration, error) {
+	if opts.Type == "" {
+		opts.Type = "file"
+	}
+
+	f, closeFormat, err := formatOf(opts, false)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFormat()
+
+	return upgradeFormat(opts.Type, f)
+}
+
+// formatFile is the marker file the file and git backends record their
+// format in
+type formatFile struct {
+	Version int `json:"version"`
+}
+
+// readFormatFile returns the version in a marker file, 0 if there is none
+func readFormatFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var f formatFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return 0, fmt.Errorf("invalid format file %s: %w", path, err)
+	}
+
+	return f.Version, nil
+}
+
+// writeFormatFile records a version in a marker file. Processes opening
+// the same new vault may write it at the same time, so each one writes
+// its own temporary file.
+func writeFormatFile(path string, version int) error {
+	data, err := json.MarshalIndent(formatFile{Version: version}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write format file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write format file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write format file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write format file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
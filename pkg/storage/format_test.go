@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormat_NewVaultsRecordLatest(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	file, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	file.Close()
+
+	git, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+	git.Close()
+
+	sqlite, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	sqlite.Close()
+
+	for _, typ := range []string{"file", "git", "sqlite"} {
+		status, err := InspectFormat(BackendOptions{Type: typ, BasePath: tmpDir})
+		if err != nil {
+			t.Fatalf("InspectFormat(%s) error = %v", typ, err)
+		}
+		if status.Version != status.Latest || status.Latest == 0 || len(status.Pending) != 0 {
+			t.Errorf("InspectFormat(%s) = %+v, want latest format and nothing pending", typ, status)
+		}
+	}
+
+	if _, err := InspectFormat(BackendOptions{Type: "cloud"}); !errors.Is(err, ErrFormatNotSupported) {
+		t.Errorf("InspectFormat(cloud) error = %v, want ErrFormatNotSupported", err)
+	}
+}
+
+func TestFormat_RefusesNewerVaults(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(tmpDir, "data"), 0755)
+	writeFormatFile(filepath.Join(tmpDir, "data", ".format"), 99)
+	if _, err := NewFileBackend(tmpDir, "test"); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("NewFileBackend() error = %v, want ErrFormatTooNew", err)
+	}
+
+	writeFormatFile(filepath.Join(tmpDir, "git", ".format"), 99)
+	if _, err := NewGitBackend(tmpDir, "test"); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("NewGitBackend() error = %v, want ErrFormatTooNew", err)
+	}
+
+	backend, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	backend.db.Exec("INSERT INTO schema_version (version) VALUES (99)")
+	backend.Close()
+
+	if _, err := NewSQLiteBackend(tmpDir, "test"); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("NewSQLiteBackend() error = %v, want ErrFormatTooNew", err)
+	}
+	if _, err := UpgradeFormat(BackendOptions{Type: "sqlite", BasePath: tmpDir}); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("UpgradeFormat() error = %v, want ErrFormatTooNew", err)
+	}
+}
+
+func TestFormat_UpgradesUnversionedSQLite(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A database written before the schema was versioned, without the
+	// metadata columns and the trash
+	db, err := sql.Open("sqlite3", filepath.Join(tmpDir, "vaultenv.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE secrets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			environment TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			created_by TEXT,
+			updated_by TEXT,
+			version INTEGER DEFAULT 1,
+			UNIQUE(environment, key)
+		);
+		CREATE TABLE secret_history (id INTEGER PRIMARY KEY AUTOINCREMENT, secret_id INTEGER NOT NULL,
+			environment TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL, version INTEGER NOT NULL,
+			changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, changed_by TEXT, change_type TEXT NOT NULL);
+		CREATE TABLE audit_log (id INTEGER PRIMARY KEY AUTOINCREMENT, timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			environment TEXT NOT NULL, action TEXT NOT NULL, key TEXT, user TEXT, ip_address TEXT,
+			user_agent TEXT, success BOOLEAN DEFAULT TRUE, error_message TEXT);
+		INSERT INTO secrets (environment, key, value) VALUES ('test', 'API_KEY', 'secret');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := InspectFormat(BackendOptions{Type: "sqlite", BasePath: tmpDir})
+	if err != nil {
+		t.Fatalf("InspectFormat() error = %v", err)
+	}
+	if status.Version != 0 || len(status.Pending) != 3 {
+		t.Fatalf("InspectFormat() = %+v", status)
+	}
+
+	var changes []string
+	for _, m := range status.Pending {
+		changes = append(changes, m.Changes...)
+	}
+	want := []string{
+		"add column secrets.description", "add column secrets.tags", "add column secrets.owner",
+		"add column secrets.source", "create table trash",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("planned changes = %v, want %v", changes, want)
+	}
+
+	// Inspecting changes nothing
+	if status, _ := InspectFormat(BackendOptions{Type: "sqlite", BasePath: tmpDir}); status.Version != 0 {
+		t.Errorf("InspectFormat() upgraded the vault to %d", status.Version)
+	}
+
+	applied, err := UpgradeFormat(BackendOptions{Type: "sqlite", BasePath: tmpDir})
+	if err != nil || len(applied) != 3 {
+		t.Fatalf("UpgradeFormat() = %+v, %v", applied, err)
+	}
+
+	backend, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer backend.Close()
+
+	if value, err := backend.Get("API_KEY"); err != nil || value != "secret" {
+		t.Errorf("Get() after upgrade = %q, %v", value, err)
+	}
+	if err := backend.SetMetadata("API_KEY", &SecretMetadata{Owner: "billing"}); err != nil {
+		t.Errorf("SetMetadata() after upgrade error = %v", err)
+	}
+	if err := backend.Delete("API_KEY"); err != nil {
+		t.Errorf("Delete() after upgrade error = %v", err)
+	}
+}
+
+func TestFormat_PlansGitLayoutMigration(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	envDir := filepath.Join(tmpDir, "git", "production")
+	os.MkdirAll(filepath.Join(envDir, "aws"), 0755)
+	os.WriteFile(filepath.Join(envDir, "aws", "access_key.env"), []byte("# Variable: AWS_ACCESS_KEY\n\nAKIA\n"), 0644)
+
+	status, err := InspectFormat(BackendOptions{Type: "git", BasePath: tmpDir})
+	if err != nil {
+		t.Fatalf("InspectFormat() error = %v", err)
+	}
+	if len(status.Pending) != 1 {
+		t.Fatalf("InspectFormat() = %+v", status)
+	}
+	if want := []string{"rename production/aws/access_key.env to AWS_ACCESS_KEY.env"}; !reflect.DeepEqual(status.Pending[0].Changes, want) {
+		t.Errorf("planned changes = %v, want %v", status.Pending[0].Changes, want)
+	}
+	if _, err := os.Stat(filepath.Join(envDir, "aws", "access_key.env")); err != nil {
+		t.Error("InspectFormat() changed the vault")
+	}
+
+	// Opening any environment is refused until the vault is upgraded
+	if _, err := NewGitBackend(tmpDir, "development"); !errors.Is(err, ErrFormatOutdated) {
+		t.Fatalf("NewGitBackend() error = %v, want ErrFormatOutdated", err)
+	}
+	if _, err := os.Stat(filepath.Join(envDir, "aws", "access_key.env")); err != nil {
+		t.Error("NewGitBackend() changed the vault")
+	}
+
+	if _, err := UpgradeFormat(BackendOptions{Type: "git", BasePath: tmpDir}); err != nil {
+		t.Fatalf("UpgradeFormat() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(envDir, "AWS_ACCESS_KEY.env")); err != nil {
+		t.Errorf("production was not migrated: %v", err)
+	}
+	if _, err := NewGitBackend(tmpDir, "development"); err != nil {
+		t.Fatalf("NewGitBackend() after upgrade error = %v", err)
+	}
+}
+
+func TestFormat_RecordsMarkerOnOpen(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A file vault written before formats were versioned only lacks the
+	// marker, which is written when it is opened
+	os.MkdirAll(filepath.Join(tmpDir, "data"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "data", "test.json"), []byte(`{"API_KEY":"secret"}`), 0600)
+
+	backend, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	if value, err := backend.Get("API_KEY"); err != nil || value != "secret" {
+		t.Errorf("Get() = %q, %v", value, err)
+	}
+
+	status, err := InspectFormat(BackendOptions{Type: "file", BasePath: tmpDir})
+	if err != nil {
+		t.Fatalf("InspectFormat() error = %v", err)
+	}
+	if status.Version != status.Latest || len(status.Pending) != 0 {
+		t.Errorf("InspectFormat() after open = %+v, want the latest format", status)
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrCheckNotSupported is returned by backends that cannot check their storage
+var ErrCheckNotSupported = errors.New("storage backend does not support checks")
+
+// Kinds of problems reported by Check
+const (
+	ProblemCorruptData      = "corrupt-data"      // A data file or the database cannot be read
+	ProblemTempFile         = "temp-file"         // A write was interrupted and left a temporary file
+	ProblemOrphanedHistory  = "orphaned-history"  // History points to a secret that no longer exists
+	ProblemOrphanedFile     = "orphaned-file"     // A file in the vault does not belong to any variable
+	ProblemOrphanedMetadata = "orphaned-metadata" // Metadata is kept for a variable that does not exist
+	ProblemUndecryptable    = "undecryptable"     // An encrypted value cannot be decrypted with the vault key
+)
+
+// Problem is an inconsistency found in the storage of an environment
+type Problem struct {
+	Environment string // Empty if the backend does not know its environment
+	Kind        string
+	Path        string // File, table row or key the problem was found in
+	Message     string
+	Repair      string // What --repair does about it, empty if it cannot be repaired safely
+	Repaired    bool
+}
+
+// CheckBackend is implemented by backends that can check their storage
+// for inconsistencies left by crashes or manual edits
+type CheckBackend interface {
+	Backend
+
+	// Check reports the problems found in the storage of the environment.
+	// With repair set, the problems that can be repaired without losing
+	// data are repaired and marked as such.
+	Check(repair bool) ([]Problem, error)
+}
+
+// AsCheckBackend returns the check view of a backend, checking wrapped
+// backends the same way as AsHistoryBackend.
+func AsCheckBackend(backend Backend) (CheckBackend, bool) {
+	cb, ok := backend.(CheckBackend)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := innermostBackend(backend).(CheckBackend); !ok {
+		return nil, false
+	}
+
+	return cb, true
+}
+
+// checkJSONFile checks a JSON file written by writeJSONFile and the
+// temporary file an interrupted write leaves next to it. decode parses
+// the content and reports whether it is valid.
+func checkJSONFile(environment, path string, decode func([]byte) error, repair bool) []Problem {
+	var problems []Problem
+
+	mainErr := readJSONFile(path, decode)
+	tmpPath := path + ".tmp"
+	tmpErr := readJSONFile(tmpPath, decode)
+
+	if _, err := os.Stat(tmpPath); err == nil {
+		p := Problem{Environment: environment, Kind: ProblemTempFile, Path: tmpPath}
+
+		switch {
+		case mainErr == nil || tmpErr != nil:
+			// The rename never happened; the data file holds the last
+			// complete write
+			p.Message = "leftover temporary file of an interrupted write"
+			p.Repair = "remove it"
+			if repair {
+				p.Repaired = os.Remove(tmpPath) == nil
+			}
+		default:
+			// The data file is damaged but the interrupted write is complete
+			p.Message = fmt.Sprintf("complete write of %s that was never renamed into place", path)
+			p.Repair = "rename it over the damaged file"
+			if repair {
+				if p.Repaired = os.Rename(tmpPath, path) == nil; p.Repaired {
+					mainErr = nil
+				}
+			}
+		}
+
+		problems = append(problems, p)
+	}
+
+	if mainErr != nil && !os.IsNotExist(mainErr) {
+		problems = append(problems, Problem{
+			Environment: environment,
+			Kind:        ProblemCorruptData,
+			Path:        path,
+			Message:     fmt.Sprintf("%v; restore it with vaultenv snapshot restore", mainErr),
+		})
+	}
+
+	return problems
+}
+
+// readJSONFile reads and decodes a file, treating an empty file as valid
+// the same way the backends do
+func readJSONFile(path string, decode func([]byte) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := decode(data); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return nil
+}
+
+// decodeJSON returns a decode function for checkJSONFile unmarshaling into v
+func decodeJSON(v interface{}) func([]byte) error {
+	return func(data []byte) error {
+		return json.Unmarshal(data, v)
+	}
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// problemKinds returns the kinds of the problems in order
+func problemKinds(problems []Problem) []string {
+	var kinds []string
+	for _, p := range problems {
+		kinds = append(kinds, p.Kind)
+	}
+	return kinds
+}
+
+func TestCheck_FileBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backend, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	backend.Set("API_KEY", "secret", false)
+	backend.Set("DEBUG", "true", false)
+
+	// A write interrupted before the rename, and metadata left behind by
+	// an edit of the data file
+	dataFile := filepath.Join(tmpDir, "data", "test.json")
+	os.WriteFile(dataFile+".tmp", []byte(`{"API_KEY": "sec`), 0644)
+	os.WriteFile(dataFile, []byte(`{"API_KEY": "secret"}`), 0644)
+
+	problems, err := backend.Check(false)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(problems) != 2 || problems[0].Kind != ProblemTempFile || problems[1].Kind != ProblemOrphanedMetadata {
+		t.Fatalf("Check() = %+v, want a temp file and orphaned metadata", problems)
+	}
+	if problems[1].Path != "DEBUG" || problems[1].Repaired {
+		t.Errorf("orphaned metadata = %+v", problems[1])
+	}
+
+	if problems, err = backend.Check(true); err != nil || len(problems) != 2 || !problems[0].Repaired || !problems[1].Repaired {
+		t.Fatalf("Check(repair) = %+v, %v", problems, err)
+	}
+	if problems, err = backend.Check(false); err != nil || len(problems) != 0 {
+		t.Errorf("Check() after repair = %+v, %v", problems, err)
+	}
+
+	// A damaged data file next to the complete write that never replaced it
+	os.WriteFile(dataFile, []byte(`{"API_KEY": "sec`), 0644)
+	os.WriteFile(dataFile+".tmp", []byte(`{"API_KEY": "rotated"}`), 0644)
+
+	if problems, err = backend.Check(true); err != nil || len(problems) != 1 || !problems[0].Repaired {
+		t.Fatalf("Check(repair) = %+v, %v", problems, err)
+	}
+	if value, err := backend.Get("API_KEY"); err != nil || value != "rotated" {
+		t.Errorf("Get() after repair = %q, %v", value, err)
+	}
+
+	// Without a complete write the damage cannot be repaired
+	os.WriteFile(dataFile, []byte(`{"API_KEY": "sec`), 0644)
+
+	problems, err = backend.Check(true)
+	if err != nil || len(problems) != 1 || problems[0].Kind != ProblemCorruptData || problems[0].Repaired || problems[0].Repair != "" {
+		t.Errorf("Check(repair) of a damaged data file = %+v, %v", problems, err)
+	}
+}
+
+func TestCheck_GitBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backend, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+	backend.Set("API_KEY", "secret", false)
+
+	envDir := filepath.Join(tmpDir, "git", "test")
+	os.WriteFile(filepath.Join(envDir, ".gitkeep"), nil, 0644)
+	os.WriteFile(filepath.Join(envDir, "notes.txt"), []byte("todo"), 0644)
+	os.MkdirAll(filepath.Join(envDir, "db"), 0755)
+	os.WriteFile(filepath.Join(envDir, "db", "url.env"), []byte("# Variable: DB_URL\n\npostgres://\n"), 0644)
+	os.WriteFile(filepath.Join(envDir, "DEBUG.env"),
+		[]byte("# Variable: DEBUG\n\n<<<<<<< HEAD\ntrue\n=======\nfalse\n>>>>>>> main\n"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "git", ".test.tx-123"), 0755)
+
+	problems, err := backend.Check(false)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	want := []string{ProblemTempFile, ProblemCorruptData, ProblemOrphanedFile, ProblemOrphanedFile}
+	if got := problemKinds(problems); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Check() = %+v, want %v", problems, want)
+	}
+
+	if _, err := backend.Check(true); err != nil {
+		t.Fatalf("Check(repair) error = %v", err)
+	}
+	if value, err := backend.Get("DB_URL"); err != nil || value != "postgres://" {
+		t.Errorf("Get(DB_URL) after repair = %q, %v", value, err)
+	}
+	if _, err := os.Stat(filepath.Join(envDir, "db")); !os.IsNotExist(err) {
+		t.Error("Check(repair) kept the empty directory")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "git", ".test.tx-123")); !os.IsNotExist(err) {
+		t.Error("Check(repair) kept the staging directory")
+	}
+
+	// The conflict and the unknown file are left to the user
+	if problems, _ = backend.Check(false); len(problems) != 2 {
+		t.Errorf("Check() after repair = %+v", problems)
+	}
+}
+
+func TestCheck_GitBackendRestoresInterruptedSwap(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backend, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+	backend.Set("API_KEY", "secret", false)
+
+	// The process died after moving the environment aside
+	envDir := filepath.Join(tmpDir, "git", "test")
+	os.Rename(envDir, filepath.Join(tmpDir, "git", ".test.tx-123.old"))
+	os.MkdirAll(envDir, 0755)
+
+	problems, err := backend.Check(true)
+	if err != nil || len(problems) != 1 || !problems[0].Repaired {
+		t.Fatalf("Check(repair) = %+v, %v", problems, err)
+	}
+	if value, err := backend.Get("API_KEY"); err != nil || value != "secret" {
+		t.Errorf("Get() after repair = %q, %v", value, err)
+	}
+}
+
+func TestCheck_SQLiteBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backend, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer backend.Close()
+
+	backend.Set("API_KEY", "v1", false)
+	backend.Set("API_KEY", "v2", false)
+	backend.Set("DEBUG", "true", false)
+	backend.Delete("DEBUG")
+
+	if problems, err := backend.Check(false); err != nil || len(problems) != 0 {
+		t.Fatalf("Check() of a consistent vault = %+v, %v", problems, err)
+	}
+
+	// Removing the row directly leaves the history pointing nowhere
+	backend.db.Exec("DELETE FROM secrets WHERE key = 'API_KEY'")
+
+	problems, err := backend.Check(false)
+	if err != nil || len(problems) != 1 || problems[0].Kind != ProblemOrphanedHistory {
+		t.Fatalf("Check() = %+v, %v", problems, err)
+	}
+
+	if problems, err = backend.Check(true); err != nil || len(problems) != 1 || !problems[0].Repaired {
+		t.Fatalf("Check(repair) = %+v, %v", problems, err)
+	}
+	if problems, err = backend.Check(false); err != nil || len(problems) != 0 {
+		t.Errorf("Check() after repair = %+v, %v", problems, err)
+	}
+
+	// The last value can be brought back from the trash
+	if err := backend.Undelete("API_KEY"); err != nil {
+		t.Fatalf("Undelete() error = %v", err)
+	}
+	if value, err := backend.Get("API_KEY"); err != nil || value != "v2" {
+		t.Errorf("Get() after undelete = %q, %v", value, err)
+	}
+}
+
+func TestCheck_EncryptedBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	file, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+
+	other, _ := NewEncryptedBackend(file, "other-password")
+	other.Set("FOREIGN", "secret", true)
+
+	backend, _ := NewEncryptedBackend(file, "password")
+	backend.Set("API_KEY", "secret", true)
+
+	problems, err := backend.Check(false)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(problems) != 1 || problems[0].Kind != ProblemUndecryptable || problems[0].Path != "FOREIGN" || problems[0].Repair != "" {
+		t.Errorf("Check() = %+v, want FOREIGN undecryptable", problems)
+	}
+
+	if _, ok := AsCheckBackend(backend); !ok {
+		t.Error("AsCheckBackend() rejected an encrypted file backend")
+	}
+	if _, ok := AsCheckBackend(NewMemoryBackend()); ok {
+		t.Error("AsCheckBackend() accepted the memory backend")
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,6 +12,8 @@ import (
 type GitBackend struct {
 	basePath    string
 	environment string
+	dir         string        // Directory holding the variable files of the environment
+	lockTimeout time.Duration // How long to wait for other processes, 0 uses the default
 }
 
 func NewGitBackend(basePath, environment string) (*GitBackend, error) {
@@ -20,28 +23,162 @@ func NewGitBackend(basePath, environment string) (*GitBackend, error) {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	return &GitBackend{
+	backend := &GitBackend{
 		basePath:    basePath,
 		environment: environment,
-	}, nil
+		dir:         envPath,
+	}
+
+	if err := openFormat("git", newGitFormat(basePath)); err != nil {
+		return nil, err
+	}
+
+	return backend, nil
+}
+
+// gitFormat is the on-disk format of git vaults, recorded in git/.format
+// so it is committed together with the variables
+type gitFormat struct {
+	basePath string
+	path     string
+}
+
+func newGitFormat(basePath string) *gitFormat {
+	return &gitFormat{basePath: basePath, path: filepath.Join(basePath, "git", ".format")}
+}
+
+func (f *gitFormat) version() (int, error) {
+	return readFormatFile(f.path)
+}
+
+// empty reports whether no environment directory has files yet
+func (f *gitFormat) empty() (bool, error) {
+	backends, err := f.environments()
+	if err != nil {
+		return false, err
+	}
+
+	for _, g := range backends {
+		entries, err := os.ReadDir(g.dir)
+		if err != nil {
+			return false, fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), ".") {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (f *gitFormat) migrations() []formatMigration {
+	return []formatMigration{
+		{
+			version:     1,
+			description: "name variable files after their key",
+			plan:        f.planKeyNamedFiles,
+			apply: func() error {
+				backends, err := f.environments()
+				if err != nil {
+					return err
+				}
+				for _, g := range backends {
+					if err := g.migrateLegacyLayout(); err != nil {
+						return fmt.Errorf("failed to migrate variable files of %s: %w", g.environment, err)
+					}
+				}
+				return writeFormatFile(f.path, 1)
+			},
+		},
+	}
+}
+
+// planKeyNamedFiles lists the files migrateLegacyLayout would rename
+func (f *gitFormat) planKeyNamedFiles() ([]string, error) {
+	backends, err := f.environments()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, g := range backends {
+		legacy, err := g.findLegacyFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, relPath := range legacy {
+			key, err := g.legacyFileKey(relPath)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, fmt.Sprintf("rename %s/%s to %s%s",
+				g.environment, filepath.ToSlash(relPath), encodeGitKey(key), gitKeyExt))
+		}
+	}
+
+	return changes, nil
+}
+
+// environments returns a backend for every environment directory of the vault
+func (f *gitFormat) environments() ([]*GitBackend, error) {
+	gitDir := filepath.Join(f.basePath, "git")
+
+	entries, err := os.ReadDir(gitDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var backends []*GitBackend
+	for _, entry := range entries {
+		// Lock files and staging directories start with a dot
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		backends = append(backends, &GitBackend{
+			basePath:    f.basePath,
+			environment: entry.Name(),
+			dir:         filepath.Join(gitDir, entry.Name()),
+		})
+	}
+
+	return backends, nil
 }
 
 func (g *GitBackend) Set(key, value string, encrypt bool) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	return g.set(key, value)
+}
+
+// set writes a variable file without taking the lock
+func (g *GitBackend) set(key, value string) error {
 	// Validate key name for filesystem
 	if err := g.validateKey(key); err != nil {
 		return err
 	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
 
 	// Create file path
 	filePath := g.getFilePath(key)
 
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	// Keep metadata from the previous version of the file
+	meta, err := g.readMetadata(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read file: %w", err)
 	}
 
 	// Write value to file
-	content := g.formatContent(key, value)
+	content := g.formatContent(key, value, meta)
 
 	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
@@ -51,6 +188,17 @@ func (g *GitBackend) Set(key, value string, encrypt bool) error {
 }
 
 func (g *GitBackend) Get(key string) (string, error) {
+	fl, err := g.rlock()
+	if err != nil {
+		return "", err
+	}
+	defer fl.release()
+
+	return g.get(key)
+}
+
+// get reads a variable file without taking the lock
+func (g *GitBackend) get(key string) (string, error) {
 	filePath := g.getFilePath(key)
 
 	data, err := os.ReadFile(filePath)
@@ -65,6 +213,43 @@ func (g *GitBackend) Get(key string) (string, error) {
 }
 
 func (g *GitBackend) Delete(key string) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	entry, err := g.trashEntry(key, time.Now().UTC())
+	if err != nil || entry == nil {
+		return err
+	}
+
+	// Keep the variable in the trash until it is purged
+	trash, err := g.trash().load()
+	if err != nil {
+		return err
+	}
+	trash[key] = entry
+	if err := g.trash().save(trash); err != nil {
+		return err
+	}
+
+	return g.delete(key)
+}
+
+// purge removes a variable without keeping it in the trash
+func (g *GitBackend) purge(key string) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	return g.delete(key)
+}
+
+// delete removes a variable file without taking the lock
+func (g *GitBackend) delete(key string) error {
 	filePath := g.getFilePath(key)
 
 	if err := os.Remove(filePath); err != nil {
@@ -75,48 +260,96 @@ func (g *GitBackend) Delete(key string) error {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
-	// Clean up empty directories
-	dir := filepath.Dir(filePath)
-	envPath := filepath.Join(g.basePath, "git", g.environment)
+	return nil
+}
 
-	for dir != envPath && dir != "/" && dir != "." {
-		entries, err := os.ReadDir(dir)
-		if err != nil || len(entries) > 0 {
-			break
-		}
-		os.Remove(dir)
-		dir = filepath.Dir(dir)
+func (g *GitBackend) List() ([]string, error) {
+	fl, err := g.rlock()
+	if err != nil {
+		return nil, err
 	}
+	defer fl.release()
 
-	return nil
+	return g.list()
 }
 
-func (g *GitBackend) List() ([]string, error) {
+// list reads the environment directory without taking the lock
+func (g *GitBackend) list() ([]string, error) {
 	var keys []string
 
-	envPath := filepath.Join(g.basePath, "git", g.environment)
+	entries, err := os.ReadDir(g.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
 
-	err := filepath.Walk(envPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
 		}
 
-		if !info.IsDir() && strings.HasSuffix(path, ".env") {
-			// Convert file path back to key name
-			relPath, _ := filepath.Rel(envPath, path)
-			key := g.filePathToKey(relPath)
-			keys = append(keys, key)
+		// Files that are not variables, such as .gitkeep, are skipped
+		key, err := GitPathToKey(entry.Name())
+		if err != nil {
+			continue
 		}
+		keys = append(keys, key)
+	}
 
-		return nil
-	})
+	return keys, nil
+}
+
+// GetAll returns every variable, reading the directory once
+func (g *GitBackend) GetAll() (map[string]string, error) {
+	fl, err := g.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	keys, err := g.list()
+	if err != nil {
+		return nil, err
+	}
+
+	return g.getMany(keys)
+}
+
+// GetMany returns the given variables that exist
+func (g *GitBackend) GetMany(keys []string) (map[string]string, error) {
+	fl, err := g.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	return g.getMany(keys)
+}
+
+func (g *GitBackend) getMany(keys []string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := g.get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
 
-	return keys, err
+	return result, nil
 }
 
 func (g *GitBackend) Exists(key string) (bool, error) {
+	fl, err := g.rlock()
+	if err != nil {
+		return false, err
+	}
+	defer fl.release()
+
 	filePath := g.getFilePath(key)
-	_, err := os.Stat(filePath)
+	_, err = os.Stat(filePath)
 
 	if err == nil {
 		return true, nil
@@ -134,6 +367,475 @@ func (g *GitBackend) Close() error {
 	return nil
 }
 
+// GetMetadata returns the metadata stored in the header of a variable file
+func (g *GitBackend) GetMetadata(key string) (*SecretMetadata, error) {
+	fl, err := g.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	filePath := g.getFilePath(key)
+
+	meta, err := g.readMetadata(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Git keeps the full history; the file only knows its last change
+	if info, err := os.Stat(filePath); err == nil {
+		meta.UpdatedAt = info.ModTime().UTC()
+	}
+
+	return meta, nil
+}
+
+// SetMetadata rewrites the header of a variable file with new metadata
+func (g *GitBackend) SetMetadata(key string, metadata *SecretMetadata) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	filePath := g.getFilePath(key)
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	value, err := g.parseContent(string(data))
+	if err != nil {
+		return err
+	}
+
+	meta := &SecretMetadata{}
+	meta.mergeUserFields(metadata)
+
+	content := g.formatContent(key, value, meta)
+
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// Begin starts a transaction. Changes are applied to a copy of the
+// environment directory which replaces the original on commit.
+func (g *GitBackend) Begin() (Tx, error) {
+	return newBufferedTx(g.commit), nil
+}
+
+// commit applies the changes of a transaction in a staging directory
+// and swaps it in place of the environment directory
+func (g *GitBackend) commit(ops []txOp) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	staging, err := os.MkdirTemp(filepath.Dir(g.dir), "."+g.environment+".tx-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := copyDir(g.dir, staging); err != nil {
+		return fmt.Errorf("failed to prepare staging directory: %w", err)
+	}
+
+	stage := &GitBackend{
+		basePath:    g.basePath,
+		environment: g.environment,
+		dir:         staging,
+	}
+
+	var trashed []*TrashedSecret
+	now := time.Now().UTC()
+	for _, op := range ops {
+		if op.delete {
+			var entry *TrashedSecret
+			if entry, err = stage.trashEntry(op.key, now); err == nil {
+				if entry != nil {
+					trashed = append(trashed, entry)
+				}
+				err = stage.delete(op.key)
+			}
+		} else {
+			err = stage.set(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(trashed) > 0 {
+		trash, err := g.trash().load()
+		if err != nil {
+			return err
+		}
+		for _, entry := range trashed {
+			trash[entry.Key] = entry
+		}
+		if err := g.trash().save(trash); err != nil {
+			return err
+		}
+	}
+
+	return g.swapDir(staging)
+}
+
+// trash returns the trash of this environment. It lives outside the
+// environment directory, so deleted variables are not committed.
+func (g *GitBackend) trash() *trashFile {
+	return newTrashFile(g.basePath, g.environment)
+}
+
+// trashEntry reads a variable file into a trash entry, or returns nil if
+// the variable does not exist
+func (g *GitBackend) trashEntry(key string, now time.Time) (*TrashedSecret, error) {
+	filePath := g.getFilePath(key)
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	value, err := g.parseContent(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := g.readMetadata(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return &TrashedSecret{
+		Key:       key,
+		Value:     value,
+		Metadata:  meta,
+		DeletedAt: now,
+		DeletedBy: getCurrentUser(),
+	}, nil
+}
+
+// ListTrash returns the deleted variables, most recently deleted first
+func (g *GitBackend) ListTrash() ([]TrashedSecret, error) {
+	return g.trash().list()
+}
+
+// archivedValues returns the stored values of the trash
+func (g *GitBackend) archivedValues() ([]string, error) {
+	return g.trash().values()
+}
+
+// rewriteArchive rewrites the stored values of the trash
+func (g *GitBackend) rewriteArchive(rewrite func(key, value string) (string, error)) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	return g.trash().rewrite(rewrite)
+}
+
+// Undelete writes a variable from the trash back to its file
+func (g *GitBackend) Undelete(key string) error {
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	trash, err := g.trash().load()
+	if err != nil {
+		return err
+	}
+
+	entry, ok := trash[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	filePath := g.getFilePath(key)
+	if _, err := os.Stat(filePath); err == nil {
+		return ErrAlreadyExists
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to check file: %w", err)
+	}
+
+	content := g.formatContent(key, entry.Value, entry.Metadata)
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	delete(trash, key)
+	return g.trash().save(trash)
+}
+
+// PurgeTrash permanently removes the variables deleted before the given time
+func (g *GitBackend) PurgeTrash(before time.Time) (int, error) {
+	fl, err := g.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer fl.release()
+
+	return g.trash().purge(before)
+}
+
+// Check reports staging directories left by interrupted transactions,
+// files in the environment directory that hold no variable, variable
+// files with unresolved merge conflicts and a damaged trash file
+func (g *GitBackend) Check(repair bool) ([]Problem, error) {
+	fl, err := g.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	problems, err := g.checkStaging(repair)
+	if err != nil {
+		return problems, err
+	}
+
+	files, err := g.checkFiles(repair)
+	problems = append(problems, files...)
+	if err != nil {
+		return problems, err
+	}
+
+	problems = append(problems, checkJSONFile(g.environment, g.trash().path, decodeJSON(&map[string]*TrashedSecret{}), repair)...)
+
+	return problems, nil
+}
+
+// checkStaging reports the staging directories of transactions and
+// migrations that were interrupted. If the process died between the two
+// renames of swapDir, the environment directory is restored from the
+// directory it kept.
+func (g *GitBackend) checkStaging(repair bool) ([]Problem, error) {
+	gitDir := filepath.Dir(g.dir)
+
+	entries, err := os.ReadDir(gitDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var problems []Problem
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() ||
+			!(strings.HasPrefix(name, "."+g.environment+".tx-") || strings.HasPrefix(name, "."+g.environment+".migrate-")) {
+			continue
+		}
+		path := filepath.Join(gitDir, name)
+
+		p := Problem{
+			Environment: g.environment,
+			Kind:        ProblemTempFile,
+			Path:        path,
+			Message:     "staging directory of an interrupted transaction",
+			Repair:      "remove it",
+		}
+
+		if strings.HasSuffix(name, ".old") {
+			current, err := os.ReadDir(g.dir)
+			if err != nil && !os.IsNotExist(err) {
+				return problems, fmt.Errorf("failed to read directory: %w", err)
+			}
+			if len(current) == 0 {
+				p.Message = "environment directory moved aside by an interrupted transaction"
+				p.Repair = "move it back"
+				if repair {
+					os.Remove(g.dir)
+					p.Repaired = os.Rename(path, g.dir) == nil
+				}
+				problems = append(problems, p)
+				continue
+			}
+		}
+
+		if repair {
+			p.Repaired = os.RemoveAll(path) == nil
+		}
+		problems = append(problems, p)
+	}
+
+	return problems, nil
+}
+
+// checkFiles reports the files of the environment directory that are not
+// variable files. Files whose "# Variable:" header names a key are moved
+// back to the file name of that key on repair.
+func (g *GitBackend) checkFiles(repair bool) ([]Problem, error) {
+	var problems []Problem
+	var dirs []string
+
+	err := filepath.Walk(g.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == g.dir {
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		relPath, err := filepath.Rel(g.dir, path)
+		if err != nil {
+			return err
+		}
+		topLevel := !strings.Contains(relPath, string(os.PathSeparator))
+
+		if topLevel && relPath == ".gitkeep" {
+			return nil
+		}
+
+		if _, err := GitPathToKey(relPath); err == nil && topLevel {
+			if conflicted, err := hasConflictMarkers(path); err != nil {
+				return err
+			} else if conflicted {
+				problems = append(problems, Problem{
+					Environment: g.environment,
+					Kind:        ProblemCorruptData,
+					Path:        path,
+					Message:     "unresolved merge conflict; resolve it and commit the file",
+				})
+			}
+			return nil
+		}
+
+		p := Problem{
+			Environment: g.environment,
+			Kind:        ProblemOrphanedFile,
+			Path:        path,
+			Message:     "file does not belong to any variable",
+		}
+
+		if key := g.headerKey(path); key != "" && strings.HasSuffix(relPath, gitKeyExt) {
+			target := g.getFilePath(key)
+			if _, err := os.Stat(target); os.IsNotExist(err) {
+				p.Message = fmt.Sprintf("file of %s is not named after its key", key)
+				p.Repair = "rename it to " + filepath.Base(target)
+				if repair {
+					p.Repaired = os.Rename(path, target) == nil
+				}
+			} else {
+				p.Message = fmt.Sprintf("file of %s, which is also stored in %s", key, filepath.Base(target))
+			}
+		}
+
+		problems = append(problems, p)
+		return nil
+	})
+	if err != nil {
+		return problems, fmt.Errorf("failed to scan %s: %w", g.dir, err)
+	}
+
+	if repair {
+		for _, dir := range dirs {
+			removeEmptyDirs(dir)
+		}
+	}
+
+	return problems, nil
+}
+
+// hasConflictMarkers reports whether a file contains the markers git
+// leaves in files with merge conflicts
+func hasConflictMarkers(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// swapDir replaces the environment directory with a staging directory,
+// keeping the old one until the swap succeeded
+func (g *GitBackend) swapDir(staging string) error {
+	old := staging + ".old"
+	if err := os.Rename(g.dir, old); err != nil {
+		return fmt.Errorf("failed to replace environment directory: %w", err)
+	}
+	if err := os.Rename(staging, g.dir); err != nil {
+		os.Rename(old, g.dir)
+		return fmt.Errorf("failed to replace environment directory: %w", err)
+	}
+
+	return os.RemoveAll(old)
+}
+
+// copyDir copies the files below src into dst, keeping modification times
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// lock takes the advisory file lock shared with other processes. The lock
+// file lives next to the environment directory so it survives the
+// directory swap of a transaction.
+func (g *GitBackend) lock() (*fileLock, error) {
+	return acquireLock(g.lockPath(), g.lockTimeout)
+}
+
+// rlock takes the lock for reading. Readers wait for a transaction to
+// finish swapping the environment directory, during which it is missing.
+func (g *GitBackend) rlock() (*fileLock, error) {
+	return acquireSharedLock(g.lockPath(), g.lockTimeout)
+}
+
+func (g *GitBackend) lockPath() string {
+	return filepath.Join(g.basePath, "git", "."+g.environment+".lock")
+}
+
 // Helper methods
 
 func (g *GitBackend) validateKey(key string) error {
@@ -161,23 +863,76 @@ func (g *GitBackend) validateKey(key string) error {
 }
 
 func (g *GitBackend) getFilePath(key string) string {
-	// Use subdirectories for namespacing (e.g., AWS_ACCESS_KEY -> aws/access_key.env)
-	parts := strings.Split(strings.ToLower(key), "_")
+	// File names keep the case of the key, see encodeGitKey
+	return filepath.Join(g.dir, encodeGitKey(key)+gitKeyExt)
+}
+
+func (g *GitBackend) formatContent(key, value string, meta *SecretMetadata) string {
+	// Format for Git readability and diff-ability. Nothing time dependent
+	// is written, so an unchanged value produces an unchanged file.
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Variable: %s\n# Environment: %s\n", key, g.environment)
 
-	if len(parts) > 1 {
-		dir := parts[0]
-		name := strings.Join(parts[1:], "_")
-		return filepath.Join(g.basePath, "git", g.environment, dir, name+".env")
+	if meta != nil {
+		if meta.Description != "" {
+			fmt.Fprintf(&b, "# Description: %s\n", headerValue(meta.Description))
+		}
+		if len(meta.Tags) > 0 {
+			fmt.Fprintf(&b, "# Tags: %s\n", headerValue(strings.Join(meta.Tags, ", ")))
+		}
+		if meta.Owner != "" {
+			fmt.Fprintf(&b, "# Owner: %s\n", headerValue(meta.Owner))
+		}
+		if meta.Source != "" {
+			fmt.Fprintf(&b, "# Source: %s\n", headerValue(meta.Source))
+		}
+	}
+
+	fmt.Fprintf(&b, "# Generated: Do not edit directly\n\n%s\n", value)
+
+	return b.String()
+}
+
+// readMetadata reads the metadata fields from the header of a variable file
+func (g *GitBackend) readMetadata(filePath string) (*SecretMetadata, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &SecretMetadata{}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			// The header ends at the first non-comment line
+			break
+		}
+
+		field, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "#")), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "Description":
+			meta.Description = value
+		case "Tags":
+			meta.Tags = normalizeTags(strings.Split(value, ","))
+		case "Owner":
+			meta.Owner = value
+		case "Source":
+			meta.Source = value
+		}
 	}
 
-	return filepath.Join(g.basePath, "git", g.environment, strings.ToLower(key)+".env")
+	return meta, nil
 }
 
-func (g *GitBackend) formatContent(key, value string) string {
-	// Format for Git readability and diff-ability
-	timestamp := time.Now().Format(time.RFC3339)
-	return fmt.Sprintf("# Variable: %s\n# Environment: %s\n# Modified: %s\n# Generated: Do not edit directly\n\n%s\n",
-		key, g.environment, timestamp, value)
+// headerValue keeps a metadata value on a single header line
+func headerValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
 }
 
 func (g *GitBackend) parseContent(content string) (string, error) {
@@ -218,19 +973,6 @@ func (g *GitBackend) parseContent(content string) (string, error) {
 	return strings.Join(valueLines, "\n"), nil
 }
 
-func (g *GitBackend) filePathToKey(path string) string {
-	// Remove .env extension
-	path = strings.TrimSuffix(path, ".env")
-
-	// Convert path separators to underscores
-	parts := strings.Split(path, string(os.PathSeparator))
-
-	// Convert to uppercase
-	key := strings.ToUpper(strings.Join(parts, "_"))
-
-	return key
-}
-
 // Additional Git-specific methods
 
 func (g *GitBackend) GenerateGitIgnore() string {
@@ -245,6 +987,7 @@ func (g *GitBackend) GenerateGitIgnore() string {
 # Temporary files
 *.tmp
 *.bak
+*.lock
 
 # Decrypted files (never commit)
 *.decrypted
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Variable files of the git backend are named after their key so the tree
+// stays readable in directory listings and diffs. Upper case letters,
+// digits and underscores are kept as they are, and every run of lower case
+// letters is wrapped in '+' signs:
+//
+//	DATABASE_URL -> DATABASE_URL.env
+//	nodeEnv      -> +node+E+nv+.env
+//
+// Each file name decodes to exactly one key, and no two keys get names that
+// differ only in case, so the layout is safe on case-insensitive filesystems.
+
+const (
+	gitKeyExt       = ".env"
+	gitLowerRunMark = '+'
+)
+
+// encodeGitKey returns the file name, without extension, for a key
+func encodeGitKey(key string) string {
+	var b strings.Builder
+
+	inRun := false
+	for _, r := range key {
+		lower := r >= 'a' && r <= 'z'
+		if lower != inRun {
+			b.WriteRune(gitLowerRunMark)
+			inRun = lower
+		}
+		b.WriteRune(r)
+	}
+	if inRun {
+		b.WriteRune(gitLowerRunMark)
+	}
+
+	return b.String()
+}
+
+// decodeGitKey returns the key stored under a file name without extension.
+// Only names produced by encodeGitKey are accepted.
+func decodeGitKey(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty file name")
+	}
+
+	var b strings.Builder
+
+	inRun := false
+	runLen := 0
+	justClosed := false
+	for _, r := range name {
+		switch {
+		case r == gitLowerRunMark && inRun:
+			if runLen == 0 {
+				return "", fmt.Errorf("empty lower case run in %q", name)
+			}
+			inRun = false
+			justClosed = true
+			continue
+		case r == gitLowerRunMark:
+			if justClosed {
+				// Adjacent runs would have been written as one
+				return "", fmt.Errorf("split lower case run in %q", name)
+			}
+			inRun = true
+			runLen = 0
+		case inRun && r >= 'a' && r <= 'z':
+			b.WriteRune(r)
+			runLen++
+		case !inRun && ((r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'):
+			b.WriteRune(r)
+		default:
+			return "", fmt.Errorf("unexpected character %q in %q", r, name)
+		}
+		justClosed = false
+	}
+
+	if inRun {
+		return "", fmt.Errorf("unterminated lower case run in %q", name)
+	}
+
+	return b.String(), nil
+}
+
+// GitPathToKey returns the variable key stored in a git backend file
+func GitPathToKey(path string) (string, error) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(name, gitKeyExt) {
+		return "", fmt.Errorf("not a variable file: %s", path)
+	}
+
+	return decodeGitKey(strings.TrimSuffix(name, gitKeyExt))
+}
+
+// migrateLegacyLayout renames variable files written by earlier versions,
+// which lower-cased keys and split them into a directory on the first
+// underscore (AWS_ACCESS_KEY -> aws/access_key.env). The original key is
+// read from the "# Variable:" header, falling back to the old mapping.
+// The tree is rewritten in a staging directory and swapped in, so a failed
+// migration leaves it untouched.
+func (g *GitBackend) migrateLegacyLayout() error {
+	// An empty environment name would point at the directory of all environments
+	if g.environment == "" {
+		return nil
+	}
+
+	legacy, err := g.findLegacyFiles()
+	if err != nil || len(legacy) == 0 {
+		return err
+	}
+
+	fl, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	// Another process may have migrated the tree while we waited
+	legacy, err = g.findLegacyFiles()
+	if err != nil || len(legacy) == 0 {
+		return err
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(g.dir), "."+g.environment+".migrate-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := copyDir(g.dir, staging); err != nil {
+		return fmt.Errorf("failed to prepare staging directory: %w", err)
+	}
+
+	// Names in use, folded so case-insensitive filesystems are covered
+	taken := make(map[string]string)
+	entries, err := os.ReadDir(g.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if _, err := GitPathToKey(entry.Name()); err == nil && !entry.IsDir() {
+			taken[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+
+	for _, relPath := range legacy {
+		key, err := g.legacyFileKey(relPath)
+		if err != nil {
+			return err
+		}
+		name := encodeGitKey(key) + gitKeyExt
+
+		if other, ok := taken[strings.ToLower(name)]; ok {
+			return fmt.Errorf("cannot migrate %s: %s already holds %s", relPath, other, key)
+		}
+		taken[strings.ToLower(name)] = relPath
+
+		if err := os.Rename(filepath.Join(staging, relPath), filepath.Join(staging, name)); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", relPath, err)
+		}
+	}
+
+	// Drop the namespace directories left empty
+	dirs, err := os.ReadDir(staging)
+	if err != nil {
+		return fmt.Errorf("failed to read staging directory: %w", err)
+	}
+	for _, entry := range dirs {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(staging, entry.Name()))
+		}
+	}
+
+	return g.swapDir(staging)
+}
+
+// findLegacyFiles returns the variable files, relative to the environment
+// directory, that do not follow the current naming
+func (g *GitBackend) findLegacyFiles() ([]string, error) {
+	var legacy []string
+
+	err := filepath.Walk(g.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == g.dir || info.IsDir() || !strings.HasSuffix(path, gitKeyExt) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(g.dir, path)
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(relPath, string(os.PathSeparator)) {
+			legacy = append(legacy, relPath)
+		} else if _, err := decodeGitKey(strings.TrimSuffix(relPath, gitKeyExt)); err != nil {
+			legacy = append(legacy, relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", g.dir, err)
+	}
+
+	return legacy, nil
+}
+
+// legacyFileKey recovers the key of a file written by an earlier version
+func (g *GitBackend) legacyFileKey(relPath string) (string, error) {
+	if key := g.headerKey(filepath.Join(g.dir, relPath)); key != "" {
+		return key, nil
+	}
+
+	// Without a usable header only the upper-cased name can be recovered
+	parts := strings.Split(strings.TrimSuffix(relPath, gitKeyExt), string(os.PathSeparator))
+	key := strings.ToUpper(strings.Join(parts, "_"))
+	if err := g.validateKey(key); err != nil {
+		return "", fmt.Errorf("cannot migrate %s: %w", relPath, err)
+	}
+
+	return key, nil
+}
+
+// headerKey returns the key named in the "# Variable:" header of a file,
+// or "" if the file has no header with a valid key
+func (g *GitBackend) headerKey(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		field, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "#")), ":")
+		if found && field == "Variable" {
+			key := strings.TrimSpace(value)
+			if g.validateKey(key) == nil {
+				return key
+			}
+			break
+		}
+	}
+
+	return ""
+}
+
+// removeEmptyDirs removes dir and its subdirectories if they hold no files
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	os.Remove(dir) // Fails, and is kept, when not empty
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestEncodeGitKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"DATABASE_URL", "DATABASE_URL"},
+		{"KEY123", "KEY123"},
+		{"_PRIVATE", "_PRIVATE"},
+		{"nodeEnv", "+node+E+nv+"},
+		{"port", "+port+"},
+		{"Path", "P+ath+"},
+		{"a_b", "+a+_+b+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := encodeGitKey(tt.key)
+			if got != tt.want {
+				t.Errorf("encodeGitKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+
+			key, err := decodeGitKey(got)
+			if err != nil {
+				t.Fatalf("decodeGitKey(%q) error = %v", got, err)
+			}
+			if key != tt.key {
+				t.Errorf("decodeGitKey(%q) = %q, want %q", got, key, tt.key)
+			}
+		})
+	}
+}
+
+func TestDecodeGitKey_RejectsNonCanonicalNames(t *testing.T) {
+	names := []string{
+		"",
+		"port",        // legacy lower case name
+		"aws_key",     // legacy lower case name
+		"+port",       // unterminated run
+		"++",          // empty run
+		"+ab++cd+",    // split run
+		"+AB+",        // upper case inside a run
+		"KEY-NAME",    // character outside the key alphabet
+		".gitkeep",    // hidden file
+		"access_key+", // unterminated run
+	}
+
+	for _, name := range names {
+		if key, err := decodeGitKey(name); err == nil {
+			t.Errorf("decodeGitKey(%q) = %q, want error", name, key)
+		}
+	}
+}
+
+// gitKey is a random key accepted by the git backend
+type gitKey string
+
+func (gitKey) Generate(r *rand.Rand, size int) reflect.Value {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_"
+
+	n := 1 + r.Intn(12)
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+
+	return reflect.ValueOf(gitKey(b))
+}
+
+func TestGitKeyEncoding_Properties(t *testing.T) {
+	// Every key survives the round trip
+	roundTrip := func(k gitKey) bool {
+		key, err := decodeGitKey(encodeGitKey(string(k)))
+		return err == nil && key == string(k)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+
+	// Distinct keys never get names that differ only in case
+	caseSafe := func(a, b gitKey) bool {
+		if a == b {
+			return true
+		}
+		return !strings.EqualFold(encodeGitKey(string(a)), encodeGitKey(string(b)))
+	}
+	if err := quick.Check(caseSafe, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+
+	// Keys that differ only in case are the ones most likely to collide
+	foldedCaseSafe := func(k gitKey) bool {
+		lower, upper := strings.ToLower(string(k)), strings.ToUpper(string(k))
+		return caseSafe(gitKey(lower), gitKey(upper)) && caseSafe(k, gitKey(lower))
+	}
+	if err := quick.Check(foldedCaseSafe, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGitBackend_ListReturnsSetKeys(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	run := 0
+	listMatchesSet := func(keys []gitKey) bool {
+		run++
+		backend, err := NewGitBackend(filepath.Join(tmpDir, strconv.Itoa(run)), "test")
+		if err != nil {
+			t.Logf("NewGitBackend() error = %v", err)
+			return false
+		}
+
+		want := make(map[string]bool)
+		for _, k := range keys {
+			if err := backend.Set(string(k), "value", false); err != nil {
+				t.Logf("Set(%q) error = %v", k, err)
+				return false
+			}
+			want[string(k)] = true
+		}
+
+		got, err := backend.List()
+		if err != nil {
+			t.Logf("List() error = %v", err)
+			return false
+		}
+
+		wantKeys := make([]string, 0, len(want))
+		for k := range want {
+			wantKeys = append(wantKeys, k)
+		}
+		sort.Strings(wantKeys)
+		sort.Strings(got)
+
+		if len(got) != len(wantKeys) || (len(got) > 0 && !reflect.DeepEqual(got, wantKeys)) {
+			t.Logf("List() = %v, want %v", got, wantKeys)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(listMatchesSet, &quick.Config{MaxCount: 100}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGitBackend_MigrateLegacyLayout(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	envDir := filepath.Join(tmpDir, "git", "test")
+	legacy := map[string]string{
+		// Written with a header naming the original key
+		filepath.Join("aws", "access_key.env"): "# Variable: AWS_ACCESS_KEY\n# Environment: test\n\nAKIA\n",
+		"nodeenv.env":                          "# Variable: nodeEnv\n# Environment: test\n\nproduction\n",
+		// Without a header the upper-cased path is used
+		"port.env": "\n8080\n",
+	}
+	for relPath, content := range legacy {
+		path := filepath.Join(envDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := UpgradeFormat(BackendOptions{Type: "git", BasePath: tmpDir}); err != nil {
+		t.Fatalf("UpgradeFormat() error = %v", err)
+	}
+	backend, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+
+	keys, err := backend.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	sort.Strings(keys)
+	if want := []string{"AWS_ACCESS_KEY", "PORT", "nodeEnv"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() after migration = %v, want %v", keys, want)
+	}
+
+	for key, want := range map[string]string{"AWS_ACCESS_KEY": "AKIA", "nodeEnv": "production", "PORT": "8080"} {
+		if value, err := backend.Get(key); err != nil || value != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, value, err, want)
+		}
+	}
+
+	// The namespace directory is gone
+	if _, err := os.Stat(filepath.Join(envDir, "aws")); !os.IsNotExist(err) {
+		t.Error("legacy namespace directory was not removed")
+	}
+}
+
+func TestGitBackend_MigrateLegacyLayoutConflict(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Both files claim the same key, so neither may be moved
+	envDir := filepath.Join(tmpDir, "git", "test")
+	os.MkdirAll(filepath.Join(envDir, "api"), 0755)
+	os.WriteFile(filepath.Join(envDir, "api", "key.env"), []byte("# Variable: API_KEY\n\none\n"), 0644)
+	os.WriteFile(filepath.Join(envDir, "api_key.env"), []byte("# Variable: API_KEY\n\ntwo\n"), 0644)
+
+	if _, err := UpgradeFormat(BackendOptions{Type: "git", BasePath: tmpDir}); err == nil {
+		t.Fatal("UpgradeFormat() expected error for conflicting legacy files")
+	}
+
+	for _, relPath := range []string{filepath.Join("api", "key.env"), "api_key.env"} {
+		if _, err := os.Stat(filepath.Join(envDir, relPath)); err != nil {
+			t.Errorf("legacy file %s changed by failed migration: %v", relPath, err)
+		}
+	}
+}
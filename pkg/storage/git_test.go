@@ -272,16 +272,68 @@ func TestGitBackend_FileFormat(t *testing.T) {
 		t.Errorf("First line = %v, want comment with key", lines[0])
 	}
 
-	// Should have timestamp comment
-	foundTimestamp := false
+	// No timestamp is written, so unchanged values give unchanged files
 	for _, line := range lines {
 		if strings.HasPrefix(line, "# Modified:") {
-			foundTimestamp = true
-			break
+			t.Errorf("File contains timestamp comment %q", line)
 		}
 	}
-	if !foundTimestamp {
-		t.Error("File missing timestamp comment")
+
+	backend.Set(key, value, false)
+	rewritten, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(rewritten) != string(content) {
+		t.Errorf("Rewriting an unchanged value changed the file:\n%s\nwant:\n%s", rewritten, content)
+	}
+}
+
+func TestGitBackend_DeterministicEncryption(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	backend, err := GetBackendWithOptions(BackendOptions{
+		Environment:   "test",
+		Type:          "git",
+		BasePath:      tmpDir,
+		Password:      "test-password",
+		Deterministic: true,
+	})
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	defer backend.Close()
+
+	filePath := filepath.Join(tmpDir, "git", "test", "API_KEY.env")
+
+	backend.Set("API_KEY", "secret", true)
+	first, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if strings.Contains(string(first), "secret") {
+		t.Error("value stored in plaintext")
+	}
+
+	backend.Set("API_KEY", "secret", true)
+	second, _ := os.ReadFile(filePath)
+	if string(first) != string(second) {
+		t.Errorf("Rewriting an unchanged value changed the file:\n%s\nwant:\n%s", second, first)
+	}
+
+	value, err := backend.Get("API_KEY")
+	if err != nil || value != "secret" {
+		t.Errorf("Get() = %q, %v, want %q", value, err, "secret")
+	}
+
+	backend.Set("API_KEY", "changed", true)
+	third, _ := os.ReadFile(filePath)
+	if string(third) == string(first) {
+		t.Error("Changing the value did not change the file")
 	}
 }
 
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// HeaderFile is the name of the vault header in the vault directory. The
+// header holds no secret and is committed with the configuration, so every
+// clone derives the same keys.
+const HeaderFile = "vault.json"
+
+// ErrNoVaultHeader is returned for vaults created before vault headers
+var ErrNoVaultHeader = errors.New("vault has no header")
+
+// legacyMasterSalt is the salt keys were derived with before vault
+// headers. Values encrypted with such a key have version 1.
+var legacyMasterSalt = []byte("vaultenv-master-salt-v1")
+
+// Versions of EncryptedValue
+const (
+	legacyValueVersion = 1 // master key derived with legacyMasterSalt
+	headerValueVersion = 2 // master key derived with the vault header
+)
+
+// KDFParams are the parameters the master key of a vault is derived with
+type KDFParams struct {
+	Algorithm   string `json:"algorithm"`
+	Salt        []byte `json:"salt"`
+	Iterations  uint32 `json:"iterations"`
+	Memory      uint32 `json:"memory"` // KiB
+	Parallelism uint8  `json:"parallelism"`
+	KeyLength   uint32 `json:"key_length"`
+}
+
+// VaultHeader describes how the keys of a vault are derived
+type VaultHeader struct {
+	Version   int       `json:"version"`
+	KDF       KDFParams `json:"kdf"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewVaultHeader returns a header with a new random salt and the default
+// Argon2id parameters
+func NewVaultHeader() (*VaultHeader, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return &VaultHeader{
+		Version: 1,
+		KDF: KDFParams{
+			Algorithm:   "argon2id",
+			Salt:        salt,
+			Iterations:  3,
+			Memory:      64 * 1024,
+			Parallelism: 4,
+			KeyLength:   32,
+		},
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// DeriveKey derives the master key of the vault from a password
+func (h *VaultHeader) DeriveKey(password string) ([]byte, error) {
+	kdf := h.KDF
+	if kdf.Algorithm != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation algorithm: %s", kdf.Algorithm)
+	}
+	if len(kdf.Salt) < 16 || kdf.Iterations == 0 || kdf.Memory == 0 || kdf.Parallelism == 0 || kdf.KeyLength != 32 {
+		return nil, fmt.Errorf("invalid key derivation parameters in vault header")
+	}
+
+	return argon2.IDKey([]byte(password), kdf.Salt, kdf.Iterations, kdf.Memory, kdf.Parallelism, kdf.KeyLength), nil
+}
+
+// ReadVaultHeader reads the header of the vault in basePath, returning
+// ErrNoVaultHeader if it has none
+func ReadVaultHeader(basePath string) (*VaultHeader, error) {
+	path := filepath.Join(basePath, HeaderFile)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoVaultHeader
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault header: %w", err)
+	}
+
+	var h VaultHeader
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("invalid vault header %s: %w", path, err)
+	}
+	if h.Version > 1 {
+		return nil, fmt.Errorf("%w: vault header version %d", ErrFormatTooNew, h.Version)
+	}
+
+	return &h, nil
+}
+
+// InitVaultHeader returns the header of the vault in basePath, creating
+// one if the vault has none. An existing header is never replaced, as the
+// values of the vault can only be decrypted with its salt.
+func InitVaultHeader(basePath string) (*VaultHeader, error) {
+	h, err := ReadVaultHeader(basePath)
+	if !errors.Is(err, ErrNoVaultHeader) {
+		return h, err
+	}
+
+	if h, err = NewVaultHeader(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal vault header: %w", err)
+	}
+
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create vault directory: %w", err)
+	}
+
+	// Written to a temporary file and linked into place so that two
+	// processes creating a header never overwrite each other's
+	path := filepath.Join(basePath, HeaderFile)
+	tmp, err := os.CreateTemp(basePath, HeaderFile+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write vault header: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write vault header: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write vault header: %w", err)
+	}
+
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return ReadVaultHeader(basePath)
+		}
+		return nil, fmt.Errorf("failed to write vault header: %w", err)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitVaultHeader(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := ReadVaultHeader(dir); !errors.Is(err, ErrNoVaultHeader) {
+		t.Fatalf("ReadVaultHeader() of a vault without header error = %v", err)
+	}
+
+	header, err := InitVaultHeader(dir)
+	if err != nil {
+		t.Fatalf("InitVaultHeader() error = %v", err)
+	}
+	if len(header.KDF.Salt) != 32 || header.KDF.Algorithm != "argon2id" {
+		t.Errorf("header KDF = %+v", header.KDF)
+	}
+
+	// An existing header is kept
+	again, err := InitVaultHeader(dir)
+	if err != nil || !bytes.Equal(again.KDF.Salt, header.KDF.Salt) {
+		t.Errorf("InitVaultHeader() replaced the header: %v", err)
+	}
+
+	other, _ := InitVaultHeader(t.TempDir())
+	if bytes.Equal(other.KDF.Salt, header.KDF.Salt) {
+		t.Error("two vaults got the same salt")
+	}
+
+	key1, _ := header.DeriveKey("password")
+	key2, _ := other.DeriveKey("password")
+	if bytes.Equal(key1, key2) {
+		t.Error("the same password derives the same key in two vaults")
+	}
+
+	os.WriteFile(filepath.Join(dir, HeaderFile), []byte(`{"version": 2}`), 0644)
+	if _, err := ReadVaultHeader(dir); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("ReadVaultHeader() of a newer header error = %v", err)
+	}
+}
+
+func TestEncryptedBackend_VaultHeader(t *testing.T) {
+	dir := t.TempDir()
+	opts := BackendOptions{Environment: "test", Type: "file", BasePath: dir, Password: "test-password"}
+
+	// Written before the vault had a header
+	legacy, err := GetBackendWithOptions(opts)
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	legacy.Set("OLD", "old-value", true)
+	legacy.Close()
+
+	if _, err := InitVaultHeader(dir); err != nil {
+		t.Fatalf("InitVaultHeader() error = %v", err)
+	}
+
+	store, err := GetBackendWithOptions(opts)
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	defer store.Close()
+
+	store.Set("NEW", "new-value", true)
+	store.Set("PLAIN", "plain-value", false)
+
+	for key, want := range map[string]string{"OLD": "old-value", "NEW": "new-value", "PLAIN": "plain-value"} {
+		if got, err := store.Get(key); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	keys, err := StaleKeys(store)
+	if err != nil || len(keys) != 1 || keys[0] != "OLD" {
+		t.Fatalf("StaleKeys() = %v, %v, want [OLD]", keys, err)
+	}
+
+	// Rewriting a value encrypts it with the header key
+	store.Set("OLD", "old-value", true)
+	if keys, _ := StaleKeys(store); len(keys) != 0 {
+		t.Errorf("StaleKeys() after rewrite = %v", keys)
+	}
+
+	raw, _ := NewFileBackend(dir, "test")
+	data, _ := raw.Get("OLD")
+	var ev EncryptedValue
+	json.Unmarshal([]byte(data), &ev)
+	if ev.Version != headerValueVersion {
+		t.Errorf("value version = %d, want %d", ev.Version, headerValueVersion)
+	}
+
+	// Without its header the vault cannot be decrypted
+	os.Remove(filepath.Join(dir, HeaderFile))
+	headerless, _ := GetBackendWithOptions(opts)
+	defer headerless.Close()
+	if _, err := headerless.Get("NEW"); !errors.Is(err, ErrNoVaultHeader) {
+		t.Errorf("Get() without the header error = %v, want ErrNoVaultHeader", err)
+	}
+}
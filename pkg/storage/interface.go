@@ -3,6 +3,9 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/encryption"
 )
 
 // Common errors
@@ -10,8 +13,44 @@ var (
 	ErrNotFound      = errors.New("variable not found")
 	ErrAlreadyExists = errors.New("variable already exists")
 	ErrInvalidName   = errors.New("invalid variable name")
+	ErrValueTooLarge = fmt.Errorf("value exceeds the maximum size of %d bytes", MaxValueSize)
+
+	ErrHistoryNotSupported  = errors.New("storage backend does not support history")
+	ErrMetadataNotSupported = errors.New("storage backend does not support metadata")
+
+	ErrTransactionsNotSupported = errors.New("storage backend does not support transactions")
 )
 
+// MaxValueSize is the largest value a backend stores. It leaves room for
+// files stored with the filesecret package after encryption.
+const MaxValueSize = 4 << 20
+
+// IsValidVariableName reports whether name follows the conventions of
+// environment variable names: a letter or underscore followed by letters,
+// digits and underscores
+func IsValidVariableName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	for i, ch := range name {
+		letter := (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || ch == '_'
+		if !letter && (i == 0 || ch < '0' || ch > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkValue rejects values larger than MaxValueSize
+func checkValue(value string) error {
+	if len(value) > MaxValueSize {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
 // Backend defines the interface for storage implementations
 type Backend interface {
 	// Set stores a variable with optional encryption
@@ -23,7 +62,8 @@ type Backend interface {
 	// Exists checks if a variable exists
 	Exists(key string) (bool, error)
 
-	// Delete removes a variable
+	// Delete removes a variable. Backends implementing TrashBackend keep
+	// it in the trash until it is purged.
 	Delete(key string) error
 
 	// List returns all variable names
@@ -33,6 +73,22 @@ type Backend interface {
 	Close() error
 }
 
+// AsHistoryBackend returns the history view of a backend. Wrapping backends
+// such as EncryptedBackend always carry the history methods, so the wrapped
+// backend is checked as well.
+func AsHistoryBackend(backend Backend) (HistoryBackend, bool) {
+	hb, ok := backend.(HistoryBackend)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := innermostBackend(backend).(HistoryBackend); !ok {
+		return nil, false
+	}
+
+	return hb, true
+}
+
 // testBackend is used for testing to override the default backend
 var testBackend Backend
 
@@ -50,8 +106,24 @@ func ResetTestBackend() {
 type BackendOptions struct {
 	Environment string
 	Password    string // Optional: if provided, backend will be encrypted
-	Type        string // Optional: backend type ("file", "sqlite"), defaults to "file"
+	Type        string // Optional: registered backend type ("file", "sqlite", "git", "cloud"), defaults to "file"
 	BasePath    string // Optional: base path for storage, defaults to ".vaultenv"
+
+	// Optional: encrypt values deterministically so rewriting an unchanged
+	// value produces the same ciphertext, used for git vaults
+	Deterministic bool
+
+	// Optional: algorithm new values are encrypted with, see
+	// encryption.NewEncryptor; defaults to AES-256-GCM. Values are always
+	// decrypted with the algorithm they were encrypted with.
+	Algorithm string
+
+	// Remote server settings, required by the "cloud" type
+	Remote RemoteOptions
+
+	// Optional: how long to wait for a vault locked by another process,
+	// defaults to the value set with SetDefaultLockTimeout
+	LockTimeout time.Duration
 }
 
 // GetBackend returns a storage backend for the given environment
@@ -76,28 +148,57 @@ func GetBackendWithOptions(opts BackendOptions) (Backend, error) {
 		opts.Type = "file"
 	}
 
-	// Create base backend based on type
-	var baseBackend Backend
-	var err error
-
-	switch opts.Type {
-	case "sqlite":
-		baseBackend, err = NewSQLiteBackend(opts.BasePath, opts.Environment)
-	case "file":
-		baseBackend, err = NewFileBackend(opts.BasePath, opts.Environment)
-	case "git":
-		baseBackend, err = NewGitBackend(opts.BasePath, opts.Environment)
-	default:
-		return nil, fmt.Errorf("unsupported backend type: %s", opts.Type)
+	// Values leave the machine for remote backends, so they are only
+	// opened with encryption
+	caps, err := CapabilitiesOf(opts.Type)
+	if err != nil {
+		return nil, err
+	}
+	if caps.Remote && opts.Password == "" {
+		return nil, fmt.Errorf("%s vaults require an encryption password", opts.Type)
 	}
 
+	// Create base backend from the registry
+	baseBackend, err := newBaseBackend(opts)
 	if err != nil {
 		return nil, err
 	}
 
 	// If password is provided, wrap with encryption
 	if opts.Password != "" {
-		return NewEncryptedBackend(baseBackend, opts.Password)
+		encryptor := encryption.DefaultEncryptor()
+		if opts.Algorithm != "" {
+			if encryptor, err = encryption.NewEncryptor(opts.Algorithm); err != nil {
+				baseBackend.Close()
+				return nil, err
+			}
+		}
+
+		// Keys are derived with the salt in the vault header; vaults
+		// created before headers keep the legacy key until rekeyed
+		header, err := ReadVaultHeader(opts.BasePath)
+		if errors.Is(err, ErrNoVaultHeader) {
+			header = nil
+		} else if err != nil {
+			baseBackend.Close()
+			return nil, err
+		}
+
+		if opts.Deterministic {
+			backend, err := newDeterministicEncryptedBackend(baseBackend, opts.Password, encryptor, true, header)
+			if err != nil {
+				baseBackend.Close()
+				return nil, err
+			}
+			return backend, nil
+		}
+		backend, err := newEncryptedBackend(baseBackend, opts.Password, encryptor, header)
+		if err != nil {
+			baseBackend.Close()
+			return nil, err
+		}
+		backend.alwaysEncrypt = caps.Remote
+		return backend, nil
 	}
 
 	return baseBackend, nil
@@ -1,10 +1,33 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/vaultenv/vaultenv-cli/pkg/filesecret"
 )
 
+// inTempDir runs the rest of a test in a new directory, so backends opened
+// at their default relative path start empty
+func inTempDir(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
 func TestGetBackend(t *testing.T) {
+	inTempDir(t)
+
 	// Test with default options
 	backend, err := GetBackend("test-env")
 	if err != nil {
@@ -19,6 +42,8 @@ func TestGetBackend(t *testing.T) {
 }
 
 func TestGetBackendWithOptions(t *testing.T) {
+	inTempDir(t)
+
 	tests := []struct {
 		name    string
 		opts    BackendOptions
@@ -128,6 +153,8 @@ func TestGetBackendWithOptions(t *testing.T) {
 }
 
 func TestTestBackend(t *testing.T) {
+	inTempDir(t)
+
 	// Create a test backend
 	testBackend := NewMemoryBackend()
 	testBackend.Set("TEST_KEY", "test_value", false)
@@ -203,6 +230,10 @@ func TestBackendErrors(t *testing.T) {
 func TestHistoryBackendInterface(t *testing.T) {
 	// Verify SQLiteBackend implements HistoryBackend
 	var _ HistoryBackend = (*SQLiteBackend)(nil)
+
+	// Encrypted backends forward history to the wrapped backend
+	var _ HistoryBackend = (*EncryptedBackend)(nil)
+	var _ HistoryBackend = (*DeterministicEncryptedBackend)(nil)
 }
 
 // TestBackendCompatibility tests that all backends work the same way
@@ -296,3 +327,70 @@ func TestBackendCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestFileValuesAndSizeLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newBackends := map[string]func() (Backend, error){
+		"memory": func() (Backend, error) { return NewMemoryBackend(), nil },
+		"file":   func() (Backend, error) { return NewFileBackend(tmpDir, "file") },
+		"sqlite": func() (Backend, error) { return NewSQLiteBackend(tmpDir, "sqlite") },
+		"git":    func() (Backend, error) { return NewGitBackend(tmpDir, "git") },
+		"encrypted": func() (Backend, error) {
+			return NewEncryptedBackend(NewMemoryBackend(), "test-password")
+		},
+	}
+
+	// Bytes that text handling tends to change, and a file at the limit
+	cert := []byte("-----BEGIN CERTIFICATE-----\r\nMIIB\x00\xff\n\n")
+	large := bytes.Repeat([]byte{0xa5}, filesecret.MaxSize)
+
+	for name, newBackend := range newBackends {
+		t.Run(name, func(t *testing.T) {
+			backend, err := newBackend()
+			if err != nil {
+				t.Fatalf("failed to create backend: %v", err)
+			}
+			defer backend.Close()
+
+			for key, data := range map[string][]byte{"TLS_CERT": cert, "BLOB": large} {
+				value, _ := filesecret.Encode(filesecret.File{Name: "data.bin", Data: data})
+				if err := backend.Set(key, value, true); err != nil {
+					t.Fatalf("Set(%s) error = %v", key, err)
+				}
+
+				stored, err := backend.Get(key)
+				if err != nil {
+					t.Fatalf("Get(%s) error = %v", key, err)
+				}
+				if f, err := filesecret.Decode(stored); err != nil || !bytes.Equal(f.Data, data) {
+					t.Errorf("Get(%s) did not return the stored bytes: %v", key, err)
+				}
+			}
+
+			tooLarge := strings.Repeat("x", MaxValueSize+1)
+			if err := backend.Set("HUGE", tooLarge, true); !errors.Is(err, ErrValueTooLarge) {
+				t.Errorf("Set() of an oversized value error = %v", err)
+			}
+
+			tx, _ := BeginTx(backend)
+			if err := tx.Set("HUGE", tooLarge, true); !errors.Is(err, ErrValueTooLarge) {
+				t.Errorf("Tx.Set() of an oversized value error = %v", err)
+			}
+			tx.Rollback()
+		})
+	}
+}
+
+func TestIsValidVariableName(t *testing.T) {
+	for _, name := range []string{"API_KEY", "_PRIVATE", "key2", "a"} {
+		if !IsValidVariableName(name) {
+			t.Errorf("IsValidVariableName(%q) = false", name)
+		}
+	}
+	for _, name := range []string{"", "2KEY", "MY-KEY", "KEY.NAME", "KEY/X", "KÉY"} {
+		if IsValidVariableName(name) {
+			t.Errorf("IsValidVariableName(%q) = true", name)
+		}
+	}
+}
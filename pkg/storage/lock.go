@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned when another process holds the vault lock for
+// longer than the lock timeout
+var ErrLocked = errors.New("vault is locked")
+
+// lockRetryInterval is how often a busy lock is retried
+const lockRetryInterval = 50 * time.Millisecond
+
+var (
+	lockTimeoutMu      sync.RWMutex
+	defaultLockTimeout = 10 * time.Second
+)
+
+// SetDefaultLockTimeout sets how long backends wait for a vault locked
+// by another process when BackendOptions.LockTimeout is not set
+func SetDefaultLockTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	lockTimeoutMu.Lock()
+	defer lockTimeoutMu.Unlock()
+	defaultLockTimeout = timeout
+}
+
+// lockTimeoutOrDefault returns timeout, or the default when it is not set
+func lockTimeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+
+	lockTimeoutMu.RLock()
+	defer lockTimeoutMu.RUnlock()
+	return defaultLockTimeout
+}
+
+// LockedError reports the process holding a vault lock
+type LockedError struct {
+	Path string
+	PID  int // 0 if the owner is unknown
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("vault is locked by another process (%s)", e.Path)
+	}
+	return fmt.Sprintf("vault is locked by PID %d (%s)", e.PID, e.Path)
+}
+
+// Is makes errors.Is(err, ErrLocked) match
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// fileLock is an advisory lock held on a lock file
+type fileLock struct {
+	file      *os.File
+	exclusive bool
+}
+
+// acquireLock takes an exclusive advisory lock on path, waiting up to
+// timeout for other processes to release it. The lock file records the
+// PID of the holder so waiting processes can report it.
+func acquireLock(path string, timeout time.Duration) (*fileLock, error) {
+	return lockFile(path, timeout, true)
+}
+
+// acquireSharedLock takes a shared advisory lock on path, held by readers
+// so they never see a change half-applied. Shared locks wait for the
+// exclusive lock of a writer but not for each other.
+func acquireSharedLock(path string, timeout time.Duration) (*fileLock, error) {
+	return lockFile(path, timeout, false)
+}
+
+func lockFile(path string, timeout time.Duration, exclusive bool) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeoutOrDefault(timeout))
+	for {
+		err := tryLockFile(file, exclusive)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockBusy) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock vault: %w", err)
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, &LockedError{Path: path, PID: readLockOwner(path)}
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	// Record the owner; failing to do so only affects error messages.
+	// Readers share the lock, so only writers are recorded.
+	if exclusive {
+		if err := file.Truncate(0); err == nil {
+			file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+		}
+	}
+
+	return &fileLock{file: file, exclusive: exclusive}, nil
+}
+
+// release drops the lock
+func (l *fileLock) release() error {
+	if l.exclusive {
+		l.file.Truncate(0)
+	}
+
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to unlock vault: %w", err)
+	}
+
+	return l.file.Close()
+}
+
+// readLockOwner returns the PID recorded in a lock file, or 0
+func readLockOwner(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const writersPerProcess = 20
+
+// TestLockHelperProcess is not a real test. It is run as a separate
+// process by TestConcurrentWriters and writes variables to a vault.
+func TestLockHelperProcess(t *testing.T) {
+	dir := os.Getenv("VAULTENV_LOCK_TEST_DIR")
+	if dir == "" {
+		t.Skip("helper process")
+	}
+
+	var backend Backend
+	var err error
+	switch os.Getenv("VAULTENV_LOCK_TEST_TYPE") {
+	case "git":
+		backend, err = NewGitBackend(dir, "test")
+	default:
+		backend, err = NewFileBackend(dir, "test")
+	}
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	writer := os.Getenv("VAULTENV_LOCK_TEST_WRITER")
+	for i := 0; i < writersPerProcess; i++ {
+		key := fmt.Sprintf("WRITER%s_KEY%d", writer, i)
+		if err := backend.Set(key, strconv.Itoa(i), false); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	const processes = 4
+
+	for _, backendType := range []string{"file", "git"} {
+		t.Run(backendType, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "lock_test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			var cmds []*exec.Cmd
+			for i := 0; i < processes; i++ {
+				cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+				cmd.Env = append(os.Environ(),
+					"VAULTENV_LOCK_TEST_DIR="+tmpDir,
+					"VAULTENV_LOCK_TEST_TYPE="+backendType,
+					"VAULTENV_LOCK_TEST_WRITER="+strconv.Itoa(i),
+				)
+				if err := cmd.Start(); err != nil {
+					t.Fatalf("failed to start writer: %v", err)
+				}
+				cmds = append(cmds, cmd)
+			}
+
+			for _, cmd := range cmds {
+				if err := cmd.Wait(); err != nil {
+					t.Fatalf("writer failed: %v", err)
+				}
+			}
+
+			var backend Backend
+			if backendType == "git" {
+				backend, err = NewGitBackend(tmpDir, "test")
+			} else {
+				backend, err = NewFileBackend(tmpDir, "test")
+			}
+			if err != nil {
+				t.Fatalf("failed to create backend: %v", err)
+			}
+
+			keys, err := backend.List()
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(keys) != processes*writersPerProcess {
+				t.Errorf("List() returned %d variables, want %d; writes were lost",
+					len(keys), processes*writersPerProcess)
+			}
+		})
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "lock_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	backend, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	backend.lockTimeout = 100 * time.Millisecond
+
+	// Hold the lock through a separate file description, as another process would
+	held, err := acquireLock(filepath.Join(tmpDir, "data", "test.lock"), time.Second)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+
+	err = backend.Set("KEY", "value", false)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Set() error = %v, want %v", err, ErrLocked)
+	}
+
+	var lockedErr *LockedError
+	if !errors.As(err, &lockedErr) || lockedErr.PID != os.Getpid() {
+		t.Errorf("Set() error = %v, want lock held by PID %d", err, os.Getpid())
+	}
+
+	if err := held.release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+
+	if err := backend.Set("KEY", "value", false); err != nil {
+		t.Errorf("Set() after release error = %v", err)
+	}
+}
@@ -2,28 +2,43 @@ package storage
 
 import (
 	"sync"
+	"time"
 )
 
 // MemoryBackend is a simple in-memory storage backend for development
 type MemoryBackend struct {
-	mu   sync.RWMutex
-	data map[string]string
+	mu       sync.RWMutex
+	data     map[string]string
+	metadata map[string]*SecretMetadata
 }
 
 // NewMemoryBackend creates a new in-memory storage backend
 func NewMemoryBackend() *MemoryBackend {
 	return &MemoryBackend{
-		data: make(map[string]string),
+		data:     make(map[string]string),
+		metadata: make(map[string]*SecretMetadata),
 	}
 }
 
 // Set stores a variable
 func (m *MemoryBackend) Set(key, value string, encrypt bool) error {
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// TODO: Implement encryption when encrypt is true
 	m.data[key] = value
+
+	meta, ok := m.metadata[key]
+	if !ok {
+		meta = &SecretMetadata{}
+		m.metadata[key] = meta
+	}
+	meta.touch(time.Now().UTC())
+
 	return nil
 }
 
@@ -55,6 +70,7 @@ func (m *MemoryBackend) Delete(key string) error {
 	defer m.mu.Unlock()
 
 	delete(m.data, key)
+	delete(m.metadata, key)
 	return nil
 }
 
@@ -71,6 +87,86 @@ func (m *MemoryBackend) List() ([]string, error) {
 	return keys, nil
 }
 
+// GetAll returns every variable
+func (m *MemoryBackend) GetAll() (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]string, len(m.data))
+	for key, value := range m.data {
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+// GetMany returns the given variables that exist
+func (m *MemoryBackend) GetMany(keys []string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return pickKeys(m.data, keys), nil
+}
+
+// GetMetadata returns the metadata of a variable
+func (m *MemoryBackend) GetMetadata(key string) (*SecretMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	meta, exists := m.metadata[key]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	result := *meta
+	return &result, nil
+}
+
+// SetMetadata replaces the user-provided metadata of a variable
+func (m *MemoryBackend) SetMetadata(key string, metadata *SecretMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta, exists := m.metadata[key]
+	if !exists {
+		return ErrNotFound
+	}
+
+	meta.mergeUserFields(metadata)
+	return nil
+}
+
+// Begin starts a transaction that is applied under a single lock
+func (m *MemoryBackend) Begin() (Tx, error) {
+	return newBufferedTx(m.commit), nil
+}
+
+// commit applies the changes of a transaction
+func (m *MemoryBackend) commit(ops []txOp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, op := range ops {
+		if op.delete {
+			delete(m.data, op.key)
+			delete(m.metadata, op.key)
+			continue
+		}
+
+		m.data[op.key] = op.value
+
+		meta, ok := m.metadata[op.key]
+		if !ok {
+			meta = &SecretMetadata{}
+			m.metadata[op.key] = meta
+		}
+		meta.touch(now)
+	}
+
+	return nil
+}
+
 // Close closes the backend (no-op for memory backend)
 func (m *MemoryBackend) Close() error {
 	return nil
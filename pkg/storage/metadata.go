@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// SecretMetadata describes what a variable is for and where it came from.
+// Description, Tags, Owner and Source are provided by users; the timestamps
+// and user names are maintained by the backend.
+type SecretMetadata struct {
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+}
+
+// MetadataBackend extends Backend with per-variable metadata.
+// Metadata is stored unencrypted and removed together with the variable.
+type MetadataBackend interface {
+	Backend
+
+	// GetMetadata returns the metadata of an existing variable
+	GetMetadata(key string) (*SecretMetadata, error)
+
+	// SetMetadata replaces the user-provided metadata of an existing variable
+	SetMetadata(key string, metadata *SecretMetadata) error
+}
+
+// AsMetadataBackend returns the metadata view of a backend, checking
+// wrapped backends the same way as AsHistoryBackend.
+func AsMetadataBackend(backend Backend) (MetadataBackend, bool) {
+	mb, ok := backend.(MetadataBackend)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := innermostBackend(backend).(MetadataBackend); !ok {
+		return nil, false
+	}
+
+	return mb, true
+}
+
+// innermostBackend follows Unwrap until it reaches a backend that does
+// not wrap another one
+func innermostBackend(backend Backend) Backend {
+	for {
+		w, ok := backend.(interface{ Unwrap() Backend })
+		if !ok {
+			return backend
+		}
+		backend = w.Unwrap()
+	}
+}
+
+// HasTag reports whether the metadata carries the given tag
+func (m *SecretMetadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeUserFields copies the user-provided fields from src into m
+func (m *SecretMetadata) mergeUserFields(src *SecretMetadata) {
+	m.Description = src.Description
+	m.Tags = normalizeTags(src.Tags)
+	m.Owner = src.Owner
+	m.Source = src.Source
+}
+
+// touch records a change made by the current user
+func (m *SecretMetadata) touch(now time.Time) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+		m.CreatedBy = getCurrentUser()
+	}
+	m.UpdatedAt = now
+	m.UpdatedBy = getCurrentUser()
+}
+
+// normalizeTags trims tags and drops empty and duplicate entries
+func normalizeTags(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		result = append(result, tag)
+	}
+
+	return result
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataBackends(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "metadata_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fileBackend, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+
+	sqliteBackend, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer sqliteBackend.Close()
+
+	gitBackend, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+
+	backends := []struct {
+		name    string
+		backend MetadataBackend
+	}{
+		{"memory", NewMemoryBackend()},
+		{"file", fileBackend},
+		{"sqlite", sqliteBackend},
+		{"git", gitBackend},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			backend := b.backend
+
+			// Metadata requires an existing variable
+			if err := backend.SetMetadata("MISSING_KEY", &SecretMetadata{Description: "x"}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("SetMetadata() on missing key error = %v, want %v", err, ErrNotFound)
+			}
+			if _, err := backend.GetMetadata("MISSING_KEY"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetMetadata() on missing key error = %v, want %v", err, ErrNotFound)
+			}
+
+			if err := backend.Set("API_KEY", "secret", false); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			meta := &SecretMetadata{
+				Description: "Key for the payments API",
+				Tags:        []string{"payments", " external ", "payments"},
+				Owner:       "platform-team",
+				Source:      "manual",
+			}
+			if err := backend.SetMetadata("API_KEY", meta); err != nil {
+				t.Fatalf("SetMetadata() error = %v", err)
+			}
+
+			// Updating the value must keep the metadata
+			if err := backend.Set("API_KEY", "new-secret", false); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			got, err := backend.GetMetadata("API_KEY")
+			if err != nil {
+				t.Fatalf("GetMetadata() error = %v", err)
+			}
+
+			if got.Description != meta.Description {
+				t.Errorf("Description = %q, want %q", got.Description, meta.Description)
+			}
+			if !reflect.DeepEqual(got.Tags, []string{"payments", "external"}) {
+				t.Errorf("Tags = %v, want [payments external]", got.Tags)
+			}
+			if got.Owner != meta.Owner {
+				t.Errorf("Owner = %q, want %q", got.Owner, meta.Owner)
+			}
+			if got.Source != meta.Source {
+				t.Errorf("Source = %q, want %q", got.Source, meta.Source)
+			}
+			if got.UpdatedAt.IsZero() {
+				t.Error("UpdatedAt not set")
+			}
+			if !got.HasTag("PAYMENTS") {
+				t.Error("HasTag() should match case-insensitively")
+			}
+
+			// The value itself must be untouched by metadata updates
+			value, err := backend.Get("API_KEY")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if value != "new-secret" {
+				t.Errorf("Get() = %q, want %q", value, "new-secret")
+			}
+
+			// Deleting the variable drops its metadata
+			if err := backend.Delete("API_KEY"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := backend.Set("API_KEY", "again", false); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			got, err = backend.GetMetadata("API_KEY")
+			if err != nil {
+				t.Fatalf("GetMetadata() error = %v", err)
+			}
+			if got.Description != "" || len(got.Tags) != 0 {
+				t.Errorf("GetMetadata() after delete = %+v, want empty user fields", got)
+			}
+		})
+	}
+}
+
+func TestEncryptedBackend_Metadata_Forwarding(t *testing.T) {
+	encBackend, _ := NewEncryptedBackend(NewMemoryBackend(), "test-password")
+
+	mb, ok := AsMetadataBackend(encBackend)
+	if !ok {
+		t.Fatal("AsMetadataBackend() = false, want true for encrypted memory backend")
+	}
+
+	encBackend.Set("DB_PASSWORD", "secret", true)
+
+	if err := mb.SetMetadata("DB_PASSWORD", &SecretMetadata{Description: "Primary database"}); err != nil {
+		t.Fatalf("SetMetadata() error = %v", err)
+	}
+
+	got, err := mb.GetMetadata("DB_PASSWORD")
+	if err != nil {
+		t.Fatalf("GetMetadata() error = %v", err)
+	}
+	if got.Description != "Primary database" {
+		t.Errorf("Description = %q, want %q", got.Description, "Primary database")
+	}
+}
+
+func TestAsMetadataBackend_NotSupported(t *testing.T) {
+	encBackend, _ := NewEncryptedBackend(&plainBackend{NewMemoryBackend()}, "test-password")
+
+	if _, ok := AsMetadataBackend(encBackend); ok {
+		t.Error("AsMetadataBackend() = true, want false when the wrapped backend has no metadata")
+	}
+
+	if _, err := encBackend.GetMetadata("KEY"); !errors.Is(err, ErrMetadataNotSupported) {
+		t.Errorf("GetMetadata() error = %v, want %v", err, ErrMetadataNotSupported)
+	}
+}
+
+// plainBackend hides every optional interface of the wrapped backend
+type plainBackend struct {
+	b Backend
+}
+
+func (p *plainBackend) Set(key, value string, encrypt bool) error {
+	return p.b.Set(key, value, encrypt)
+}
+
+func (p *plainBackend) Get(key string) (string, error) {
+	return p.b.Get(key)
+}
+
+func (p *plainBackend) Exists(key string) (bool, error) {
+	return p.b.Exists(key)
+}
+
+func (p *plainBackend) Delete(key string) error {
+	return p.b.Delete(key)
+}
+
+func (p *plainBackend) List() ([]string, error) {
+	return p.b.List()
+}
+
+func (p *plainBackend) Close() error {
+	return p.b.Close()
+}
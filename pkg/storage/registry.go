@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Capabilities describes the optional features a storage backend provides
+type Capabilities struct {
+	History      bool // Keeps previous versions of each variable
+	Audit        bool // Records an audit log of operations
+	Metadata     bool // Stores descriptions, tags and owners per variable
+	Transactions bool // Applies several changes atomically
+	Trash        bool // Keeps deleted variables until they are purged
+	Watch        bool // Notifies about changes made by other processes
+	Remote       bool // Stores variables on a server; values are always encrypted before they are sent
+}
+
+// Factory creates a storage backend from the given options.
+// Encryption is applied by GetBackendWithOptions, so factories
+// only need to build the plain backend.
+type Factory func(opts BackendOptions) (Backend, error)
+
+type registeredBackend struct {
+	factory      Factory
+	capabilities Capabilities
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registeredBackend)
+)
+
+func init() {
+	Register("file", func(opts BackendOptions) (Backend, error) {
+		backend, err := NewFileBackend(opts.BasePath, opts.Environment)
+		if err != nil {
+			return nil, err
+		}
+		backend.lockTimeout = opts.LockTimeout
+		return backend, nil
+	}, Capabilities{Metadata: true, Transactions: true, Trash: true})
+
+	Register("sqlite", func(opts BackendOptions) (Backend, error) {
+		return NewSQLiteBackend(opts.BasePath, opts.Environment)
+	}, Capabilities{History: true, Audit: true, Metadata: true, Transactions: true, Trash: true})
+
+	Register("git", func(opts BackendOptions) (Backend, error) {
+		backend, err := NewGitBackend(opts.BasePath, opts.Environment)
+		if err != nil {
+			return nil, err
+		}
+		backend.lockTimeout = opts.LockTimeout
+		return backend, nil
+	}, Capabilities{Metadata: true, Transactions: true, Trash: true})
+
+	// "cloud" is the vault type users configure, served by the remote backend
+	Register("cloud", func(opts BackendOptions) (Backend, error) {
+		return NewRemoteBackend(opts.Environment, opts.Remote)
+	}, Capabilities{Remote: true})
+}
+
+// Register makes a storage backend available under the given name.
+// It is intended to be called from an init function and panics if
+// the name is empty, the factory is nil or the name is already taken.
+func Register(name string, factory Factory, capabilities Capabilities) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("storage: Register called with empty name")
+	}
+	if factory == nil {
+		panic("storage: Register factory is nil for " + name)
+	}
+	if _, exists := registry[name]; exists {
+		panic("storage: Register called twice for " + name)
+	}
+
+	registry[name] = registeredBackend{
+		factory:      factory,
+		capabilities: capabilities,
+	}
+}
+
+// Types returns the names of all registered backends in sorted order
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for name := range registry {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// IsRegistered reports whether a backend with the given name exists
+func IsRegistered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	_, ok := registry[name]
+	return ok
+}
+
+// CapabilitiesOf returns the capabilities of a registered backend
+func CapabilitiesOf(name string) (Capabilities, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	rb, ok := registry[name]
+	if !ok {
+		return Capabilities{}, fmt.Errorf("unsupported backend type: %s", name)
+	}
+
+	return rb.capabilities, nil
+}
+
+// newBaseBackend creates an unencrypted backend through the registry
+func newBaseBackend(opts BackendOptions) (Backend, error) {
+	registryMu.RLock()
+	rb, ok := registry[opts.Type]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported backend type: %s", opts.Type)
+	}
+
+	return rb.factory(opts)
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry_BuiltinTypes(t *testing.T) {
+	for _, name := range []string{"file", "sqlite", "git", "cloud"} {
+		if !IsRegistered(name) {
+			t.Errorf("IsRegistered(%q) = false, want true", name)
+		}
+	}
+
+	if caps, _ := CapabilitiesOf("cloud"); !caps.Remote {
+		t.Errorf("CapabilitiesOf(\"cloud\") = %+v, want remote", caps)
+	}
+
+	caps, err := CapabilitiesOf("sqlite")
+	if err != nil {
+		t.Fatalf("CapabilitiesOf() error = %v", err)
+	}
+	if !caps.History || !caps.Audit {
+		t.Errorf("CapabilitiesOf(\"sqlite\") = %+v, want history and audit", caps)
+	}
+
+	if _, err := CapabilitiesOf("unknown"); err == nil {
+		t.Error("CapabilitiesOf(\"unknown\") should fail")
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	const name = "registry-test"
+
+	Register(name, func(opts BackendOptions) (Backend, error) {
+		return NewMemoryBackend(), nil
+	}, Capabilities{Watch: true})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, name)
+		registryMu.Unlock()
+	}()
+
+	found := false
+	for _, typ := range Types() {
+		if typ == name {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Types() = %v, missing %q", Types(), name)
+	}
+
+	caps, _ := CapabilitiesOf(name)
+	if !reflect.DeepEqual(caps, Capabilities{Watch: true}) {
+		t.Errorf("CapabilitiesOf() = %+v, want watch only", caps)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "registry_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	backend, err := GetBackendWithOptions(BackendOptions{
+		Environment: "test",
+		Type:        name,
+		BasePath:    tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	defer backend.Close()
+
+	if _, ok := backend.(*MemoryBackend); !ok {
+		t.Errorf("GetBackendWithOptions() returned %T, want *MemoryBackend", backend)
+	}
+}
+
+func TestRegistry_RegisterPanics(t *testing.T) {
+	factory := func(opts BackendOptions) (Backend, error) {
+		return NewMemoryBackend(), nil
+	}
+
+	tests := []struct {
+		name        string
+		backendName string
+		factory     Factory
+	}{
+		{"empty_name", "", factory},
+		{"nil_factory", "nil-factory", nil},
+		{"duplicate", "file", factory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Register() should panic")
+				}
+			}()
+			Register(tt.backendName, tt.factory, Capabilities{})
+		})
+	}
+}
+
+func TestGetBackendWithOptions_ClosesBaseOnEncryptionError(t *testing.T) {
+	const name = "close-test"
+
+	var opened []*closeRecorder
+	Register(name, func(opts BackendOptions) (Backend, error) {
+		b := &closeRecorder{Backend: NewMemoryBackend()}
+		opened = append(opened, b)
+		return b, nil
+	}, Capabilities{})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, name)
+		registryMu.Unlock()
+	}()
+
+	// The key cannot be derived from a header with an unknown algorithm
+	tmpDir := t.TempDir()
+	header := `{"version": 1, "kdf": {"algorithm": "unknown"}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, HeaderFile), []byte(header), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, deterministic := range []bool{false, true} {
+		_, err := GetBackendWithOptions(BackendOptions{
+			Environment:   "test",
+			Type:          name,
+			BasePath:      tmpDir,
+			Password:      "test-password",
+			Deterministic: deterministic,
+		})
+		if err == nil {
+			t.Fatalf("GetBackendWithOptions(deterministic=%v) expected error", deterministic)
+		}
+	}
+
+	for i, b := range opened {
+		if !b.closed {
+			t.Errorf("base backend %d was not closed", i)
+		}
+	}
+}
+
+// closeRecorder records whether a backend was closed
+type closeRecorder struct {
+	Backend
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return c.Backend.Close()
+}
+
+func TestGetBackendWithOptions_UnknownType(t *testing.T) {
+	_, err := GetBackendWithOptions(BackendOptions{
+		Environment: "test",
+		Type:        "unknown",
+	})
+	if err == nil {
+		t.Error("GetBackendWithOptions() should fail for unregistered type")
+	}
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrRemoteUnauthorized is returned when the server rejects the bearer token
+var ErrRemoteUnauthorized = errors.New("remote vault rejected the access token")
+
+// maxRemoteResponseSize limits how much of a response is read
+const maxRemoteResponseSize = 32 << 20
+
+// RemoteOptions configures the connection to a remote vault server
+type RemoteOptions struct {
+	URL           string        // Base URL of the server, e.g. https://vault.example.com
+	Token         string        // Bearer token sent with every request
+	RetryAttempts int           // How often a failed request is retried
+	RetryDelay    time.Duration // How long to wait between retries
+	Client        *http.Client  // Optional: HTTP client, defaults to one with a 30s timeout
+}
+
+// RemoteError is an error response of the remote vault server
+type RemoteError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("remote vault returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("remote vault returned %d: %s", e.StatusCode, e.Message)
+}
+
+// temporary reports whether the request may succeed when it is retried
+func (e *RemoteError) temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// RemoteBackend stores variables on a server speaking the vaultenv REST
+// protocol described in docs/reference/REMOTE_PROTOCOL.md. The backend sends
+// values as it gets them; GetBackendWithOptions always wraps it with
+// encryption so the server only ever sees ciphertext.
+type RemoteBackend struct {
+	baseURL       *url.URL
+	environment   string
+	token         string
+	retryAttempts int
+	retryDelay    time.Duration
+	client        *http.Client
+}
+
+// remoteValue is the body of a variable request and response
+type remoteValue struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value"`
+}
+
+// remoteKeys is the body of a list response
+type remoteKeys struct {
+	Keys []string `json:"keys"`
+}
+
+// remoteErrorBody is the body of an error response
+type remoteErrorBody struct {
+	Error string `json:"error"`
+}
+
+// NewRemoteBackend creates a backend for one environment of a remote vault
+func NewRemoteBackend(environment string, opts RemoteOptions) (*RemoteBackend, error) {
+	if environment == "" {
+		return nil, fmt.Errorf("environment cannot be empty")
+	}
+	if opts.URL == "" {
+		return nil, fmt.Errorf("remote vault URL cannot be empty")
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("remote vault token cannot be empty")
+	}
+	if opts.RetryAttempts < 0 {
+		return nil, fmt.Errorf("retry attempts cannot be negative")
+	}
+
+	baseURL, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote vault URL: %w", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("remote vault URL must use http or https: %s", opts.URL)
+	}
+
+	// The token would be sent in the clear
+	if baseURL.Scheme == "http" && !isLoopbackHost(baseURL.Hostname()) {
+		return nil, fmt.Errorf("remote vault URL must use https unless the server runs on this machine: %s", opts.URL)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &RemoteBackend{
+		baseURL:       baseURL,
+		environment:   environment,
+		token:         opts.Token,
+		retryAttempts: opts.RetryAttempts,
+		retryDelay:    opts.RetryDelay,
+		client:        client,
+	}, nil
+}
+
+// isLoopbackHost reports whether host names this machine
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Set stores a variable on the server
+func (r *RemoteBackend) Set(key, value string, encrypt bool) error {
+	return r.SetContext(context.Background(), key, value, encrypt)
+}
+
+// Get retrieves a variable from the server
+func (r *RemoteBackend) Get(key string) (string, error) {
+	return r.GetContext(context.Background(), key)
+}
+
+// Exists checks if a variable exists on the server
+func (r *RemoteBackend) Exists(key string) (bool, error) {
+	return r.ExistsContext(context.Background(), key)
+}
+
+// Delete removes a variable from the server
+func (r *RemoteBackend) Delete(key string) error {
+	return r.DeleteContext(context.Background(), key)
+}
+
+// List returns all variable names stored on the server
+func (r *RemoteBackend) List() ([]string, error) {
+	return r.ListContext(context.Background())
+}
+
+// SetContext stores a variable on the server
+func (r *RemoteBackend) SetContext(ctx context.Context, key, value string, encrypt bool) error {
+	if key == "" {
+		return ErrInvalidName
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
+	return r.do(ctx, http.MethodPut, r.variableURL(key), remoteValue{Value: value}, nil)
+}
+
+// GetContext retrieves a variable from the server
+func (r *RemoteBackend) GetContext(ctx context.Context, key string) (string, error) {
+	var v remoteValue
+	if err := r.do(ctx, http.MethodGet, r.variableURL(key), nil, &v); err != nil {
+		return "", err
+	}
+
+	return v.Value, nil
+}
+
+// ExistsContext checks if a variable exists on the server
+func (r *RemoteBackend) ExistsContext(ctx context.Context, key string) (bool, error) {
+	err := r.do(ctx, http.MethodHead, r.variableURL(key), nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteContext removes a variable from the server. Deleting a variable
+// that does not exist is not an error.
+func (r *RemoteBackend) DeleteContext(ctx context.Context, key string) error {
+	err := r.do(ctx, http.MethodDelete, r.variableURL(key), nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// ListContext returns all variable names stored on the server
+func (r *RemoteBackend) ListContext(ctx context.Context) ([]string, error) {
+	var keys remoteKeys
+	if err := r.do(ctx, http.MethodGet, r.variablesURL(), nil, &keys); err != nil {
+		return nil, err
+	}
+
+	if keys.Keys == nil {
+		return []string{}, nil
+	}
+
+	return keys.Keys, nil
+}
+
+// Close releases idle connections
+func (r *RemoteBackend) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+func (r *RemoteBackend) variablesURL() string {
+	return r.baseURL.JoinPath("v1", "environments", r.environment, "variables").String()
+}
+
+func (r *RemoteBackend) variableURL(key string) string {
+	return r.baseURL.JoinPath("v1", "environments", r.environment, "variables", key).String()
+}
+
+// do sends a request, retrying network errors and temporary server errors,
+// and decodes the JSON response into out when it is not nil
+func (r *RemoteBackend) do(ctx context.Context, method, target string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = data
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := r.send(ctx, method, target, body, out)
+		if err == nil || !retry {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= r.retryAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retryDelay):
+		}
+	}
+}
+
+// send performs a single request. Network errors and temporary server
+// errors are reported as worth retrying.
+func (r *RemoteBackend) send(ctx context.Context, method, target string, body []byte, out interface{}) (bool, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to reach remote vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteResponseSize))
+	if err != nil {
+		return true, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return false, ErrRemoteUnauthorized
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		var errBody remoteErrorBody
+		json.Unmarshal(data, &errBody) // The message is optional
+		remoteErr := &RemoteError{StatusCode: resp.StatusCode, Message: errBody.Error}
+		return remoteErr.temporary(), remoteErr
+	}
+
+	if out == nil || method == http.MethodHead {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return false, nil
+}
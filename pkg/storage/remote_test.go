@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// remoteStandIn is an in-memory server speaking the remote vault protocol
+type remoteStandIn struct {
+	token string
+
+	mu       sync.Mutex
+	values   map[string]string // "<env>/<key>" -> value
+	requests int
+	failNext int // Number of requests answered with 503
+}
+
+func newRemoteStandIn(t *testing.T, token string) (*remoteStandIn, *httptest.Server) {
+	s := &remoteStandIn{token: token, values: make(map[string]string)}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *remoteStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if s.failNext > 0 {
+		s.failNext--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		writeStandInError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	// /v1/environments/<env>/variables[/<key>]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "v1" || parts[1] != "environments" || parts[3] != "variables" {
+		writeStandInError(w, http.StatusNotFound, "unknown path")
+		return
+	}
+	env := parts[2]
+
+	if len(parts) == 4 {
+		keys := []string{}
+		for id := range s.values {
+			if strings.HasPrefix(id, env+"/") {
+				keys = append(keys, strings.TrimPrefix(id, env+"/"))
+			}
+		}
+		sort.Strings(keys)
+		json.NewEncoder(w).Encode(remoteKeys{Keys: keys})
+		return
+	}
+
+	key := parts[4]
+	id := env + "/" + key
+	value, exists := s.values[id]
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			writeStandInError(w, http.StatusNotFound, "variable not found")
+			return
+		}
+		json.NewEncoder(w).Encode(remoteValue{Key: key, Value: value})
+	case http.MethodPut:
+		var body remoteValue
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeStandInError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+		s.values[id] = body.Value
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !exists {
+			writeStandInError(w, http.StatusNotFound, "variable not found")
+			return
+		}
+		delete(s.values, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeStandInError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// requestCount returns the number of requests received so far
+func (s *remoteStandIn) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func writeStandInError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(remoteErrorBody{Error: message})
+}
+
+func TestRemoteBackend(t *testing.T) {
+	_, server := newRemoteStandIn(t, "secret-token")
+
+	backend, err := NewRemoteBackend("test", RemoteOptions{URL: server.URL, Token: "secret-token"})
+	if err != nil {
+		t.Fatalf("NewRemoteBackend() error = %v", err)
+	}
+	defer backend.Close()
+
+	if err := backend.Set("API_KEY", "value", false); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	backend.Set("DB_URL", "postgres://localhost", false)
+
+	value, err := backend.Get("API_KEY")
+	if err != nil || value != "value" {
+		t.Errorf("Get() = %q, %v, want %q", value, err, "value")
+	}
+
+	if _, err := backend.Get("MISSING"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(MISSING) error = %v, want %v", err, ErrNotFound)
+	}
+
+	if exists, err := backend.Exists("API_KEY"); err != nil || !exists {
+		t.Errorf("Exists(API_KEY) = %v, %v, want true", exists, err)
+	}
+	if exists, err := backend.Exists("MISSING"); err != nil || exists {
+		t.Errorf("Exists(MISSING) = %v, %v, want false", exists, err)
+	}
+
+	keys, err := backend.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if strings.Join(keys, ",") != "API_KEY,DB_URL" {
+		t.Errorf("List() = %v, want [API_KEY DB_URL]", keys)
+	}
+
+	if err := backend.Delete("API_KEY"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := backend.Delete("API_KEY"); err != nil {
+		t.Errorf("Delete() of a missing variable error = %v", err)
+	}
+
+	// Environments are kept apart
+	other, _ := NewRemoteBackend("other", RemoteOptions{URL: server.URL, Token: "secret-token"})
+	if keys, _ := other.List(); len(keys) != 0 {
+		t.Errorf("List() of another environment = %v, want none", keys)
+	}
+}
+
+func TestRemoteBackend_Unauthorized(t *testing.T) {
+	standIn, server := newRemoteStandIn(t, "secret-token")
+
+	backend, _ := NewRemoteBackend("test", RemoteOptions{
+		URL:           server.URL,
+		Token:         "wrong-token",
+		RetryAttempts: 3,
+	})
+
+	if _, err := backend.List(); !errors.Is(err, ErrRemoteUnauthorized) {
+		t.Errorf("List() error = %v, want %v", err, ErrRemoteUnauthorized)
+	}
+	if standIn.requestCount() != 1 {
+		t.Errorf("rejected request sent %d times, want 1", standIn.requestCount())
+	}
+}
+
+func TestRemoteBackend_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		failures     int
+		wantErr      bool
+		wantRequests int
+	}{
+		{"succeeds after retries", 2, 2, false, 3},
+		{"gives up", 1, 2, true, 2},
+		{"no retries", 0, 1, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			standIn, server := newRemoteStandIn(t, "secret-token")
+			standIn.failNext = tt.failures
+
+			backend, _ := NewRemoteBackend("test", RemoteOptions{
+				URL:           server.URL,
+				Token:         "secret-token",
+				RetryAttempts: tt.attempts,
+				RetryDelay:    time.Millisecond,
+			})
+
+			err := backend.Set("API_KEY", "value", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var remoteErr *RemoteError
+			if tt.wantErr && (!errors.As(err, &remoteErr) || remoteErr.StatusCode != http.StatusServiceUnavailable) {
+				t.Errorf("Set() error = %v, want a 503 RemoteError", err)
+			}
+			if got := standIn.requestCount(); got != tt.wantRequests {
+				t.Errorf("sent %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRemoteBackend_RetryDelayIsCancelled(t *testing.T) {
+	standIn, server := newRemoteStandIn(t, "secret-token")
+	standIn.failNext = 1
+
+	backend, _ := NewRemoteBackend("test", RemoteOptions{
+		URL:           server.URL,
+		Token:         "secret-token",
+		RetryAttempts: 1,
+		RetryDelay:    time.Hour,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := backend.SetContext(ctx, "API_KEY", "value", false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SetContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRemoteBackend_EndToEndEncryption(t *testing.T) {
+	standIn, server := newRemoteStandIn(t, "secret-token")
+
+	opts := BackendOptions{
+		Environment: "test",
+		Type:        "cloud",
+		Remote:      RemoteOptions{URL: server.URL, Token: "secret-token"},
+	}
+
+	if _, err := GetBackendWithOptions(opts); err == nil {
+		t.Fatal("GetBackendWithOptions() expected error without a password")
+	}
+
+	opts.Password = "test-password"
+	backend, err := GetBackendWithOptions(opts)
+	if err != nil {
+		t.Fatalf("GetBackendWithOptions() error = %v", err)
+	}
+	defer backend.Close()
+
+	// Even values stored without encryption are encrypted for the server
+	backend.Set("PLAIN", "plain-value", false)
+	backend.Set("SECRET", "secret-value", true)
+
+	for key, want := range map[string]string{"PLAIN": "plain-value", "SECRET": "secret-value"} {
+		if value, err := backend.Get(key); err != nil || value != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, value, err, want)
+		}
+	}
+
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	for id, stored := range standIn.values {
+		if strings.Contains(stored, "plain-value") || strings.Contains(stored, "secret-value") {
+			t.Errorf("server received plaintext for %s: %s", id, stored)
+		}
+	}
+}
+
+func TestNewRemoteBackend_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		opts RemoteOptions
+	}{
+		{"missing environment", "", RemoteOptions{URL: "https://vault.example.com", Token: "t"}},
+		{"missing URL", "test", RemoteOptions{Token: "t"}},
+		{"missing token", "test", RemoteOptions{URL: "https://vault.example.com"}},
+		{"unsupported scheme", "test", RemoteOptions{URL: "ftp://vault.example.com", Token: "t"}},
+		{"plain http", "test", RemoteOptions{URL: "http://vault.example.com", Token: "t"}},
+		{"plain http to a private address", "test", RemoteOptions{URL: "http://10.0.0.5:8080", Token: "t"}},
+		{"negative retries", "test", RemoteOptions{URL: "https://vault.example.com", Token: "t", RetryAttempts: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRemoteBackend(tt.env, tt.opts); err == nil {
+				t.Error("NewRemoteBackend() expected error")
+			}
+		})
+	}
+
+	for _, url := range []string{"http://localhost:8080", "http://127.0.0.1:8080", "http://[::1]:8080", "https://vault.example.com"} {
+		if _, err := NewRemoteBackend("test", RemoteOptions{URL: url, Token: "t"}); err != nil {
+			t.Errorf("NewRemoteBackend(%s) error = %v", url, err)
+		}
+	}
+}
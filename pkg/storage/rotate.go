@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// valueCodec encodes and decodes stored values, implemented by the
+// encrypted backends
+type valueCodec interface {
+	encodeValue(key, value string, encrypt bool) (string, error)
+	decrypt(data string) (string, error)
+}
+
+// archiveBackend is implemented by backends that keep values besides the
+// live ones, in a trash or a history, so a key rotation can re-encrypt
+// them as well
+type archiveBackend interface {
+	// archivedValues returns the stored values of the trash and history
+	archivedValues() ([]string, error)
+
+	// rewriteArchive replaces every value of the trash and history with
+	// the one rewrite returns, all or nothing where the backend can
+	rewriteArchive(rewrite func(key, value string) (string, error)) error
+}
+
+// RotateKey re-encrypts an environment from the key of one encrypted
+// backend to the key of another over the same storage: the variables, in
+// one transaction, then the deleted variables in the trash and the value
+// history. Values that already decrypt with the new key are skipped, so an
+// interrupted rotation is completed by running it again. It fails if a
+// variable decrypts with neither key; deleted and historic values that do
+// not are left as they are. It returns the number of variables
+// re-encrypted.
+func RotateKey(from, to Backend) (int, error) {
+	oldCodec, ok := findCodec(from)
+	if !ok {
+		return 0, fmt.Errorf("storage backend is not encrypted")
+	}
+	newCodec, ok := findCodec(to)
+	if !ok {
+		return 0, fmt.Errorf("storage backend is not encrypted")
+	}
+
+	data, err := GetAll(context.Background(), innermostBackend(from))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read variables: %w", err)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tx, err := BeginTx(to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rotated := 0
+	for _, key := range keys {
+		if isEncrypted(data[key]) {
+			if _, err := newCodec.decrypt(data[key]); err == nil {
+				continue
+			}
+		}
+
+		value, err := oldCodec.decrypt(data[key])
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt %s with either key: %w", key, err)
+		}
+		if err := tx.Set(key, value, true); err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt variable %s: %w", key, err)
+		}
+		rotated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt variables, no changes were made: %w", err)
+	}
+
+	// Rewritten after the variables, as the sqlite backend records the
+	// values replaced above in the history
+	ab, ok := innermostBackend(from).(archiveBackend)
+	if !ok {
+		return rotated, nil
+	}
+
+	err = ab.rewriteArchive(func(key, data string) (string, error) {
+		if !isEncrypted(data) {
+			return data, nil
+		}
+		value, err := oldCodec.decrypt(data)
+		if err != nil {
+			// Already rotated, or damaged; fsck reports the latter
+			return data, nil
+		}
+		return newCodec.encodeValue(key, value, true)
+	})
+	if err != nil {
+		return rotated, fmt.Errorf("failed to re-encrypt deleted and historic values: %w", err)
+	}
+
+	return rotated, nil
+}
+
+// RotateValues re-encrypts stored values kept outside the storage, like
+// the ones a snapshot captures, from the key of one encrypted backend to
+// the key of another, replacing them in the map. Values that do not decrypt
+// with the old key are left as they are. It returns the number of values
+// re-encrypted.
+func RotateValues(from, to Backend, values map[string]string) (int, error) {
+	oldCodec, ok := findCodec(from)
+	if !ok {
+		return 0, fmt.Errorf("storage backend is not encrypted")
+	}
+	newCodec, ok := findCodec(to)
+	if !ok {
+		return 0, fmt.Errorf("storage backend is not encrypted")
+	}
+
+	rotated := 0
+	for key, data := range values {
+		if !isEncrypted(data) {
+			continue
+		}
+		value, err := oldCodec.decrypt(data)
+		if err != nil {
+			continue
+		}
+		if values[key], err = newCodec.encodeValue(key, value, true); err != nil {
+			return rotated, fmt.Errorf("failed to re-encrypt %s: %w", key, err)
+		}
+		rotated++
+	}
+
+	return rotated, nil
+}
+
+// KeyInUse reports whether any encrypted value of an environment,
+// including deleted and historic values, decrypts with the key of an
+// encrypted backend
+func KeyInUse(b Backend) (bool, error) {
+	codec, ok := findCodec(b)
+	if !ok {
+		return false, fmt.Errorf("storage backend is not encrypted")
+	}
+
+	data, err := GetAll(context.Background(), innermostBackend(b))
+	if err != nil {
+		return false, fmt.Errorf("failed to read variables: %w", err)
+	}
+
+	values := make([]string, 0, len(data))
+	for _, value := range data {
+		values = append(values, value)
+	}
+
+	if ab, ok := innermostBackend(b).(archiveBackend); ok {
+		archived, err := ab.archivedValues()
+		if err != nil {
+			return false, fmt.Errorf("failed to read deleted and historic values: %w", err)
+		}
+		values = append(values, archived...)
+	}
+
+	for _, value := range values {
+		if !isEncrypted(value) {
+			continue
+		}
+		if _, err := codec.decrypt(value); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// findCodec returns the outermost encrypted backend of a chain of wrapped
+// backends
+func findCodec(backend Backend) (valueCodec, bool) {
+	for {
+		if c, ok := backend.(valueCodec); ok {
+			return c, true
+		}
+		w, ok := backend.(interface{ Unwrap() Backend })
+		if !ok {
+			return nil, false
+		}
+		backend = w.Unwrap()
+	}
+}
+
+// isEncrypted reports whether a stored value is an encrypted value rather
+// than plain text
+func isEncrypted(data string) bool {
+	var ev EncryptedValue
+	return json.Unmarshal([]byte(data), &ev) == nil && ev.IsEncrypted
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+// openRotationPair opens an environment twice, encrypted with the old and
+// the new key
+func openRotationPair(t *testing.T, open func() Backend) (*EncryptedBackend, *EncryptedBackend) {
+	t.Helper()
+
+	from, err := NewEncryptedBackend(open(), "old-key")
+	if err != nil {
+		t.Fatalf("NewEncryptedBackend() error = %v", err)
+	}
+	t.Cleanup(func() { from.Close() })
+
+	to, err := NewEncryptedBackend(open(), "new-key")
+	if err != nil {
+		t.Fatalf("NewEncryptedBackend() error = %v", err)
+	}
+	t.Cleanup(func() { to.Close() })
+
+	return from, to
+}
+
+func TestRotateKey_ArchivedValues(t *testing.T) {
+	backends := map[string]func(dir string) (Backend, error){
+		"sqlite": func(dir string) (Backend, error) { return NewSQLiteBackend(dir, "test") },
+		"file":   func(dir string) (Backend, error) { return NewFileBackend(dir, "test") },
+		"git":    func(dir string) (Backend, error) { return NewGitBackend(dir, "test") },
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			from, to := openRotationPair(t, func() Backend {
+				b, err := newBackend(dir)
+				if err != nil {
+					t.Fatalf("open backend: %v", err)
+				}
+				return b
+			})
+
+			from.Set("KEEP", "first", true)
+			from.Set("KEEP", "second", true)
+			from.Set("GONE", "deleted", true)
+			from.Delete("GONE")
+
+			n, err := RotateKey(from, to)
+			if err != nil {
+				t.Fatalf("RotateKey() error = %v", err)
+			}
+			if n != 1 {
+				t.Errorf("RotateKey() = %d, want 1", n)
+			}
+
+			if value, err := to.Get("KEEP"); err != nil || value != "second" {
+				t.Errorf("Get(KEEP) = %q, %v, want second", value, err)
+			}
+
+			trash, err := to.ListTrash()
+			if err != nil {
+				t.Fatalf("ListTrash() error = %v", err)
+			}
+			if len(trash) != 1 || trash[0].Value != "deleted" {
+				t.Errorf("ListTrash() = %+v, want GONE=deleted", trash)
+			}
+
+			if _, err := from.ListTrash(); err == nil {
+				t.Error("ListTrash() with the old key succeeded, want the trash re-encrypted")
+			}
+
+			if hb, ok := AsHistoryBackend(to); ok {
+				history, err := hb.GetEnvironmentHistory(10)
+				if err != nil {
+					t.Fatalf("GetEnvironmentHistory() error = %v", err)
+				}
+				if len(history) == 0 {
+					t.Fatal("GetEnvironmentHistory() returned no entries")
+				}
+			}
+
+			// Running it again finds nothing left to re-encrypt
+			if n, err := RotateKey(from, to); err != nil || n != 0 {
+				t.Errorf("RotateKey() again = %d, %v, want 0, nil", n, err)
+			}
+		})
+	}
+}
+
+func TestRotateKey_CompletesInterruptedRotation(t *testing.T) {
+	mem := NewMemoryBackend()
+	from, _ := NewEncryptedBackend(mem, "old-key")
+	to, _ := NewEncryptedBackend(mem, "new-key")
+
+	from.Set("OLD", "old-value", true)
+	to.Set("NEW", "new-value", true)
+
+	inUse, err := KeyInUse(to)
+	if err != nil || !inUse {
+		t.Fatalf("KeyInUse() = %v, %v, want true", inUse, err)
+	}
+
+	n, err := RotateKey(from, to)
+	if err != nil {
+		t.Fatalf("RotateKey() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("RotateKey() = %d, want 1", n)
+	}
+
+	all, err := to.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if all["OLD"] != "old-value" || all["NEW"] != "new-value" {
+		t.Errorf("GetAll() = %v", all)
+	}
+}
+
+func TestRotateValues(t *testing.T) {
+	mem := NewMemoryBackend()
+	other, _ := NewEncryptedBackend(mem, "other-key")
+	from, _ := NewEncryptedBackend(mem, "old-key")
+	to, _ := NewEncryptedBackend(mem, "new-key")
+
+	from.Set("API_KEY", "secret", true)
+	other.Set("OTHER", "value", true)
+	values, err := GetAll(context.Background(), mem)
+	if err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	values["PLAIN"] = "text"
+	otherValue := values["OTHER"]
+
+	n, err := RotateValues(from, to, values)
+	if err != nil || n != 1 {
+		t.Fatalf("RotateValues() = %d, %v, want 1", n, err)
+	}
+
+	codec, _ := findCodec(to)
+	if value, err := codec.decrypt(values["API_KEY"]); err != nil || value != "secret" {
+		t.Errorf("API_KEY decrypts to %q, %v with the new key", value, err)
+	}
+	if values["OTHER"] != otherValue || values["PLAIN"] != "text" {
+		t.Errorf("RotateValues() changed values it cannot decrypt: %v", values)
+	}
+}
+
+func TestRotateKey_UnknownKey(t *testing.T) {
+	mem := NewMemoryBackend()
+	other, _ := NewEncryptedBackend(mem, "other-key")
+	from, _ := NewEncryptedBackend(mem, "old-key")
+	to, _ := NewEncryptedBackend(mem, "new-key")
+
+	other.Set("LOST", "value", true)
+
+	if inUse, err := KeyInUse(to); err != nil || inUse {
+		t.Errorf("KeyInUse() = %v, %v, want false", inUse, err)
+	}
+
+	if _, err := RotateKey(from, to); err == nil {
+		t.Error("RotateKey() succeeded with a value neither key decrypts")
+	}
+
+	if value, err := other.Get("LOST"); err != nil || value != "value" {
+		t.Errorf("Get(LOST) = %q, %v, want the value untouched", value, err)
+	}
+}
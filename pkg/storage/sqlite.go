@@ -2,9 +2,11 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -18,6 +20,8 @@ type SQLiteBackend struct {
 
 // SecretHistory represents a historical version of a secret
 type SecretHistory struct {
+	ID         int64     `json:"id"` // Increases with every change recorded in the vault
+	Key        string    `json:"key"`
 	Version    int       `json:"version"`
 	Value      string    `json:"value"`
 	ChangedAt  time.Time `json:"changed_at"`
@@ -40,6 +44,10 @@ type HistoryBackend interface {
 	Backend
 	GetHistory(key string, limit int) ([]SecretHistory, error)
 	GetAuditLog(limit int) ([]AuditEntry, error)
+
+	// GetEnvironmentHistory returns the changes of every variable of the
+	// environment, including deleted ones, most recent first
+	GetEnvironmentHistory(limit int) ([]SecretHistory, error)
 }
 
 // NewSQLiteBackend creates a new SQLite storage backend
@@ -77,52 +85,10 @@ func NewSQLiteBackend(basePath, environment string) (*SQLiteBackend, error) {
 	return backend, nil
 }
 
+// initSchema creates the tables of a new database and refuses an existing
+// one with pending migrations, see sqlite_schema.go
 func (s *SQLiteBackend) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS secrets (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		environment TEXT NOT NULL,
-		key TEXT NOT NULL,
-		value TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		created_by TEXT,
-		updated_by TEXT,
-		version INTEGER DEFAULT 1,
-		UNIQUE(environment, key)
-	);
-	
-	CREATE INDEX IF NOT EXISTS idx_env_key ON secrets(environment, key);
-	
-	CREATE TABLE IF NOT EXISTS secret_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		secret_id INTEGER NOT NULL,
-		environment TEXT NOT NULL,
-		key TEXT NOT NULL,
-		value TEXT NOT NULL,
-		version INTEGER NOT NULL,
-		changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		changed_by TEXT,
-		change_type TEXT NOT NULL,
-		FOREIGN KEY (secret_id) REFERENCES secrets(id)
-	);
-	
-	CREATE TABLE IF NOT EXISTS audit_log (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		environment TEXT NOT NULL,
-		action TEXT NOT NULL,
-		key TEXT,
-		user TEXT,
-		ip_address TEXT,
-		user_agent TEXT,
-		success BOOLEAN DEFAULT TRUE,
-		error_message TEXT
-	);
-	`
-
-	_, err := s.db.Exec(schema)
-	return err
+	return openFormat("sqlite", &sqliteFormat{db: s.db})
 }
 
 // Set stores a variable with optional encryption
@@ -133,10 +99,23 @@ func (s *SQLiteBackend) Set(key, value string, encrypt bool) error {
 	}
 	defer tx.Rollback()
 
+	if err := s.setInTx(tx, key, value); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setInTx stores a variable and records its history within a transaction
+func (s *SQLiteBackend) setInTx(tx *sql.Tx, key, value string) error {
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
 	// Check if key exists
 	var id int64
 	var version int
-	err = tx.QueryRow(`
+	err := tx.QueryRow(`
 		SELECT id, version FROM secrets 
 		WHERE environment = ? AND key = ?
 	`, s.environment, key).Scan(&id, &version)
@@ -191,7 +170,7 @@ func (s *SQLiteBackend) Set(key, value string, encrypt bool) error {
 		return fmt.Errorf("failed to add audit log: %w", err)
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 // Get retrieves a variable value
@@ -245,10 +224,35 @@ func (s *SQLiteBackend) Delete(key string) error {
 	}
 	defer tx.Rollback()
 
+	if err := s.deleteInTx(tx, key, true); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// purge removes a variable without keeping it in the trash
+func (s *SQLiteBackend) purge(key string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.deleteInTx(tx, key, false); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteInTx removes a variable and records its history within a
+// transaction, moving it to the trash when trash is set
+func (s *SQLiteBackend) deleteInTx(tx *sql.Tx, key string, trash bool) error {
 	// Get secret ID for history
 	var id int64
 	var version int
-	err = tx.QueryRow(`
+	err := tx.QueryRow(`
 		SELECT id, version FROM secrets 
 		WHERE environment = ? AND key = ?
 	`, s.environment, key).Scan(&id, &version)
@@ -273,6 +277,20 @@ func (s *SQLiteBackend) Delete(key string) error {
 		return fmt.Errorf("failed to add history: %w", err)
 	}
 
+	// Keep the secret in the trash until it is purged
+	if trash {
+		_, err = tx.Exec(`
+			INSERT OR REPLACE INTO trash (environment, key, value, description, tags, owner, source,
+				created_at, created_by, deleted_at, deleted_by)
+			SELECT environment, key, value, description, tags, owner, source, created_at, created_by, ?, ?
+			FROM secrets WHERE id = ?
+		`, time.Now().UTC(), getCurrentUser(), id)
+
+		if err != nil {
+			return fmt.Errorf("failed to move secret to trash: %w", err)
+		}
+	}
+
 	// Delete the secret
 	_, err = tx.Exec(`
 		DELETE FROM secrets WHERE id = ?
@@ -292,9 +310,411 @@ func (s *SQLiteBackend) Delete(key string) error {
 		return fmt.Errorf("failed to add audit log: %w", err)
 	}
 
+	return nil
+}
+
+// ListTrash returns the deleted variables, most recently deleted first
+func (s *SQLiteBackend) ListTrash() ([]TrashedSecret, error) {
+	rows, err := s.db.Query(`
+		SELECT key, value, description, tags, owner, source, created_at, created_by, deleted_at, deleted_by
+		FROM trash
+		WHERE environment = ?
+		ORDER BY deleted_at DESC, key
+	`, s.environment)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var trash []TrashedSecret
+	for rows.Next() {
+		var (
+			t                                TrashedSecret
+			meta                             SecretMetadata
+			description, tags, owner, source sql.NullString
+			createdBy, deletedBy             sql.NullString
+			createdAt                        sql.NullTime
+		)
+		err := rows.Scan(&t.Key, &t.Value, &description, &tags, &owner, &source,
+			&createdAt, &createdBy, &t.DeletedAt, &deletedBy)
+		if err != nil {
+			return nil, err
+		}
+
+		meta.Description = description.String
+		meta.Owner = owner.String
+		meta.Source = source.String
+		meta.CreatedAt = createdAt.Time
+		meta.CreatedBy = createdBy.String
+		if tags.String != "" {
+			if err := json.Unmarshal([]byte(tags.String), &meta.Tags); err != nil {
+				return nil, fmt.Errorf("failed to decode tags: %w", err)
+			}
+		}
+
+		t.Metadata = &meta
+		t.DeletedBy = deletedBy.String
+		trash = append(trash, t)
+	}
+
+	return trash, rows.Err()
+}
+
+// archiveTables are the tables keeping values besides the live ones
+var archiveTables = []string{"trash", "secret_history"}
+
+// archivedValues returns the stored values of the trash and history
+func (s *SQLiteBackend) archivedValues() ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT value FROM trash WHERE environment = ?
+		UNION ALL
+		SELECT value FROM secret_history WHERE environment = ?
+	`, s.environment, s.environment)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query archived values: %w", err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// rewriteArchive rewrites the stored values of the trash and history in
+// one transaction
+func (s *SQLiteBackend) rewriteArchive(rewrite func(key, value string) (string, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type row struct {
+		id         int64
+		key, value string
+	}
+
+	for _, table := range archiveTables {
+		rows, err := tx.Query(`SELECT id, key, value FROM `+table+` WHERE environment = ?`, s.environment)
+		if err != nil {
+			return fmt.Errorf("failed to query %s: %w", table, err)
+		}
+
+		var archived []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.key, &r.value); err != nil {
+				rows.Close()
+				return err
+			}
+			archived = append(archived, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range archived {
+			value, err := rewrite(r.key, r.value)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite %s of %s: %w", table, r.key, err)
+			}
+			if value == r.value {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE `+table+` SET value = ? WHERE id = ?`, value, r.id); err != nil {
+				return fmt.Errorf("failed to update %s: %w", table, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Undelete moves a variable from the trash back into the environment. The
+// history continues with the version after the deletion.
+func (s *SQLiteBackend) Undelete(key string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var trashID int64
+	err = tx.QueryRow(`
+		SELECT id FROM trash
+		WHERE environment = ? AND key = ?
+	`, s.environment, key).Scan(&trashID)
+
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query trash: %w", err)
+	}
+
+	var count int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM secrets
+		WHERE environment = ? AND key = ?
+	`, s.environment, key).Scan(&count)
+
+	if err != nil {
+		return fmt.Errorf("failed to check existence: %w", err)
+	}
+	if count > 0 {
+		return ErrAlreadyExists
+	}
+
+	var version int
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(version), 0) FROM secret_history
+		WHERE environment = ? AND key = ?
+	`, s.environment, key).Scan(&version)
+
+	if err != nil {
+		return fmt.Errorf("failed to query history: %w", err)
+	}
+	version++
+
+	result, err := tx.Exec(`
+		INSERT INTO secrets (environment, key, value, description, tags, owner, source,
+			created_at, created_by, updated_by, version)
+		SELECT environment, key, value, description, tags, owner, source,
+			COALESCE(created_at, CURRENT_TIMESTAMP), created_by, ?, ?
+		FROM trash WHERE id = ?
+	`, getCurrentUser(), version, trashID)
+
+	if err != nil {
+		return fmt.Errorf("failed to restore secret: %w", err)
+	}
+
+	id, _ := result.LastInsertId()
+
+	_, err = tx.Exec(`
+		INSERT INTO secret_history (secret_id, environment, key, value, version, changed_by, change_type)
+		SELECT id, environment, key, value, version, ?, 'UNDELETE'
+		FROM secrets WHERE id = ?
+	`, getCurrentUser(), id)
+
+	if err != nil {
+		return fmt.Errorf("failed to add history: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM trash WHERE id = ?`, trashID); err != nil {
+		return fmt.Errorf("failed to remove secret from trash: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO audit_log (environment, action, key, user, success)
+		VALUES (?, ?, ?, ?, ?)
+	`, s.environment, "UNDELETE", key, getCurrentUser(), true)
+
+	if err != nil {
+		return fmt.Errorf("failed to add audit log: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// PurgeTrash permanently removes the variables deleted before the given time
+func (s *SQLiteBackend) PurgeTrash(before time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, key, deleted_at FROM trash
+		WHERE environment = ?
+	`, s.environment)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to list trash: %w", err)
+	}
+
+	// Times are compared here rather than in SQL, where they are text
+	expired := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id        int64
+			key       string
+			deletedAt time.Time
+		)
+		if err := rows.Scan(&id, &key, &deletedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if deletedAt.Before(before) {
+			expired[id] = key
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, key := range expired {
+		if _, err := tx.Exec(`DELETE FROM trash WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to purge %s: %w", key, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO audit_log (environment, action, key, user, success)
+			VALUES (?, ?, ?, ?, ?)
+		`, s.environment, "PURGE", key, getCurrentUser(), true)
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to add audit log: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+// Begin starts a transaction. Changes are staged in memory and written
+// in a single SQLite transaction on commit, so other operations on the
+// shared connection are not blocked while the transaction is open.
+func (s *SQLiteBackend) Begin() (Tx, error) {
+	return newBufferedTx(s.commit), nil
+}
+
+// commit applies the changes of a transaction
+func (s *SQLiteBackend) commit(ops []txOp) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, op := range ops {
+		if op.delete {
+			err = s.deleteInTx(tx, op.key, true)
+		} else {
+			err = s.setInTx(tx, op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
+// GetAll returns every variable with a single query
+func (s *SQLiteBackend) GetAll() (map[string]string, error) {
+	rows, err := s.db.Query(`
+		SELECT key, value FROM secrets
+		WHERE environment = ?
+	`, s.environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secrets: %w", err)
+	}
+
+	result, err := scanValues(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditReads(result)
+	return result, nil
+}
+
+// sqliteMaxVariables keeps IN lists below the limit on bound parameters
+// of older SQLite versions
+const sqliteMaxVariables = 500
+
+// GetMany returns the given variables that exist, querying them in batches
+func (s *SQLiteBackend) GetMany(keys []string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+
+	for start := 0; start < len(keys); start += sqliteMaxVariables {
+		batch := keys[start:min(start+sqliteMaxVariables, len(keys))]
+
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, s.environment)
+		for _, key := range batch {
+			args = append(args, key)
+		}
+
+		rows, err := s.db.Query(`
+			SELECT key, value FROM secrets
+			WHERE environment = ? AND key IN (?`+strings.Repeat(", ?", len(batch)-1)+`)
+		`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secrets: %w", err)
+		}
+
+		values, err := scanValues(rows)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			result[key] = value
+		}
+	}
+
+	s.auditReads(result)
+	return result, nil
+}
+
+// scanValues reads key and value rows into a map and closes them
+func scanValues(rows *sql.Rows) (map[string]string, error) {
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to get secrets: %w", err)
+		}
+		result[key] = value
+	}
+
+	return result, rows.Err()
+}
+
+// auditReads records a GET for every variable read in bulk, in one
+// transaction and in the background like Get
+func (s *SQLiteBackend) auditReads(values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	user := getCurrentUser()
+	go func() {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return
+		}
+		defer tx.Rollback()
+
+		for key := range values {
+			if _, err := tx.Exec(`
+				INSERT INTO audit_log (environment, action, key, user, success)
+				VALUES (?, ?, ?, ?, ?)
+			`, s.environment, "GET", key, user, true); err != nil {
+				return
+			}
+		}
+		tx.Commit()
+	}()
+}
+
 // List returns all variable names
 func (s *SQLiteBackend) List() ([]string, error) {
 	rows, err := s.db.Query(`
@@ -333,13 +753,85 @@ func (s *SQLiteBackend) Close() error {
 	return s.db.Close()
 }
 
+// GetMetadata returns the metadata of a variable
+func (s *SQLiteBackend) GetMetadata(key string) (*SecretMetadata, error) {
+	var (
+		meta                             SecretMetadata
+		description, tags, owner, source sql.NullString
+		createdBy, updatedBy             sql.NullString
+	)
+
+	err := s.db.QueryRow(`
+		SELECT description, tags, owner, source, created_at, updated_at, created_by, updated_by
+		FROM secrets
+		WHERE environment = ? AND key = ?
+	`, s.environment, key).Scan(&description, &tags, &owner, &source,
+		&meta.CreatedAt, &meta.UpdatedAt, &createdBy, &updatedBy)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+
+	meta.Description = description.String
+	meta.Owner = owner.String
+	meta.Source = source.String
+	meta.CreatedBy = createdBy.String
+	meta.UpdatedBy = updatedBy.String
+
+	if tags.String != "" {
+		if err := json.Unmarshal([]byte(tags.String), &meta.Tags); err != nil {
+			return nil, fmt.Errorf("failed to decode tags: %w", err)
+		}
+	}
+
+	return &meta, nil
+}
+
+// SetMetadata replaces the user-provided metadata of a variable
+func (s *SQLiteBackend) SetMetadata(key string, metadata *SecretMetadata) error {
+	var meta SecretMetadata
+	meta.mergeUserFields(metadata)
+
+	var tags sql.NullString
+	if len(meta.Tags) > 0 {
+		data, err := json.Marshal(meta.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to encode tags: %w", err)
+		}
+		tags = sql.NullString{String: string(data), Valid: true}
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE secrets
+		SET description = ?, tags = ?, owner = ?, source = ?
+		WHERE environment = ? AND key = ?
+	`, meta.Description, tags, meta.Owner, meta.Source, s.environment, key)
+
+	if err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 // GetHistory returns the change history for a specific key
 func (s *SQLiteBackend) GetHistory(key string, limit int) ([]SecretHistory, error) {
 	rows, err := s.db.Query(`
-		SELECT version, value, changed_at, changed_by, change_type
+		SELECT id, version, value, changed_at, changed_by, change_type
 		FROM secret_history
 		WHERE environment = ? AND key = ?
-		ORDER BY version DESC
+		ORDER BY id DESC
 		LIMIT ?
 	`, s.environment, key, limit)
 
@@ -348,10 +840,38 @@ func (s *SQLiteBackend) GetHistory(key string, limit int) ([]SecretHistory, erro
 	}
 	defer rows.Close()
 
+	var history []SecretHistory
+	for rows.Next() {
+		h := SecretHistory{Key: key}
+		err := rows.Scan(&h.ID, &h.Version, &h.Value, &h.ChangedAt, &h.ChangedBy, &h.ChangeType)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
+}
+
+// GetEnvironmentHistory returns the change history of the environment
+func (s *SQLiteBackend) GetEnvironmentHistory(limit int) ([]SecretHistory, error) {
+	rows, err := s.db.Query(`
+		SELECT id, key, version, value, changed_at, changed_by, change_type
+		FROM secret_history
+		WHERE environment = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, s.environment, limit)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var history []SecretHistory
 	for rows.Next() {
 		var h SecretHistory
-		err := rows.Scan(&h.Version, &h.Value, &h.ChangedAt, &h.ChangedBy, &h.ChangeType)
+		err := rows.Scan(&h.ID, &h.Key, &h.Version, &h.Value, &h.ChangedAt, &h.ChangedBy, &h.ChangeType)
 		if err != nil {
 			return nil, err
 		}
@@ -393,6 +913,154 @@ func (s *SQLiteBackend) GetAuditLog(limit int) ([]AuditEntry, error) {
 	return entries, rows.Err()
 }
 
+// Check runs the consistency check of SQLite on the whole database and
+// reports history rows of secrets that were removed without recording a
+// deletion, which leaves their secret_id pointing nowhere
+func (s *SQLiteBackend) Check(repair bool) ([]Problem, error) {
+	problems, err := s.checkDatabase()
+	if err != nil {
+		return problems, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT h.secret_id, h.key, h.value, h.version,
+			(SELECT COUNT(*) FROM secret_history WHERE secret_id = h.secret_id)
+		FROM secret_history h
+		WHERE h.environment = ?
+			AND h.id = (SELECT MAX(id) FROM secret_history WHERE secret_id = h.secret_id)
+			AND NOT EXISTS (SELECT 1 FROM secrets WHERE id = h.secret_id)
+			AND NOT EXISTS (SELECT 1 FROM secret_history WHERE secret_id = h.secret_id AND change_type = 'DELETE')
+		ORDER BY h.key, h.secret_id
+	`, s.environment)
+	if err != nil {
+		return problems, fmt.Errorf("failed to check history: %w", err)
+	}
+
+	type orphan struct {
+		secretID int64
+		key      string
+		value    string
+		version  int
+		rows     int
+	}
+	var orphans []orphan
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.secretID, &o.key, &o.value, &o.version, &o.rows); err != nil {
+			rows.Close()
+			return problems, fmt.Errorf("failed to check history: %w", err)
+		}
+		orphans = append(orphans, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return problems, fmt.Errorf("failed to check history: %w", err)
+	}
+
+	for _, o := range orphans {
+		p := Problem{
+			Environment: s.environment,
+			Kind:        ProblemOrphanedHistory,
+			Path:        fmt.Sprintf("secret_history (secret_id %d)", o.secretID),
+			Message:     fmt.Sprintf("%d history row(s) of %s point to a secret that no longer exists", o.rows, o.key),
+			Repair:      "record the deletion",
+		}
+
+		recoverable, err := s.needsTrashEntry(o.key)
+		if err != nil {
+			return problems, err
+		}
+		if recoverable {
+			p.Repair = "record the deletion and move the last value to the trash"
+		}
+
+		if repair {
+			if err := s.recordLostDeletion(o.secretID, o.key, o.value, o.version, recoverable); err != nil {
+				return problems, err
+			}
+			p.Repaired = true
+		}
+		problems = append(problems, p)
+	}
+
+	return problems, nil
+}
+
+// checkDatabase runs PRAGMA quick_check. The database holds every
+// environment, so each one reports the same damage.
+func (s *SQLiteBackend) checkDatabase() ([]Problem, error) {
+	rows, err := s.db.Query("PRAGMA quick_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check database: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []Problem
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, fmt.Errorf("failed to check database: %w", err)
+		}
+		if result == "ok" {
+			continue
+		}
+		problems = append(problems, Problem{
+			Environment: s.environment,
+			Kind:        ProblemCorruptData,
+			Path:        "vaultenv.db",
+			Message:     result + "; restore the vault with vaultenv snapshot restore",
+		})
+	}
+
+	return problems, rows.Err()
+}
+
+// needsTrashEntry reports whether the last value of a removed secret can
+// only be recovered by moving it to the trash: the key was not set again
+// and nothing is in the trash under it
+func (s *SQLiteBackend) needsTrashEntry(key string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM secrets WHERE environment = ? AND key = ?)
+			+ (SELECT COUNT(*) FROM trash WHERE environment = ? AND key = ?)
+	`, s.environment, key, s.environment, key).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check history: %w", err)
+	}
+
+	return count == 0, nil
+}
+
+// recordLostDeletion adds the DELETE history row a removed secret is
+// missing and optionally keeps its last value in the trash
+func (s *SQLiteBackend) recordLostDeletion(secretID int64, key, value string, version int, toTrash bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO secret_history (secret_id, environment, key, value, version, changed_by, change_type)
+		VALUES (?, ?, ?, ?, ?, ?, 'DELETE')
+	`, secretID, s.environment, key, value, version+1, getCurrentUser())
+	if err != nil {
+		return fmt.Errorf("failed to add history: %w", err)
+	}
+
+	if toTrash {
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO trash (environment, key, value, deleted_at, deleted_by)
+			VALUES (?, ?, ?, ?, ?)
+		`, s.environment, key, value, time.Now().UTC(), getCurrentUser())
+		if err != nil {
+			return fmt.Errorf("failed to move secret to trash: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
 // getCurrentUser returns the current OS user
 func getCurrentUser() string {
 	if user := os.Getenv("USER"); user != "" {
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The schema of the SQLite backend is built by ordered migrations recorded
+// in the schema_version table, the same way as the keystore. Databases
+// created before the schema was versioned have no schema_version table;
+// every migration is written so it can be applied to them safely.
+
+// sqlExecer is implemented by *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// sqliteFormat is the schema of a vault database
+type sqliteFormat struct {
+	db    *sql.DB
+	owned bool // db was opened by openSQLiteFormat and is closed by close
+}
+
+// openSQLiteFormat opens the database of a vault to inspect or upgrade its
+// schema. A read-only view of a vault without a database inspects an empty
+// one, so every migration is listed.
+func openSQLiteFormat(basePath string, readOnly bool) (*sqliteFormat, error) {
+	dbPath := filepath.Join(basePath, "vaultenv.db")
+
+	dsn := dbPath + "?mode=rwc&_journal_mode=WAL&_busy_timeout=5000"
+	if readOnly {
+		dsn = dbPath + "?mode=ro&_busy_timeout=5000"
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+			dsn = ":memory:"
+		}
+	} else if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	return &sqliteFormat{db: db, owned: true}, nil
+}
+
+func (f *sqliteFormat) close() {
+	if f.owned {
+		f.db.Close()
+	}
+}
+
+func (f *sqliteFormat) version() (int, error) {
+	exists, err := sqliteTableExists(f.db, "schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := f.db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// empty reports whether the database has no tables yet
+func (f *sqliteFormat) empty() (bool, error) {
+	exists, err := sqliteTableExists(f.db, "secrets")
+	return !exists, err
+}
+
+func (f *sqliteFormat) migrations() []formatMigration {
+	return []formatMigration{
+		f.migration(1, "create the secrets, history and audit log tables",
+			f.planTables("secrets", "secret_history", "audit_log"),
+			func(tx *sql.Tx) error {
+				_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS secrets (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					environment TEXT NOT NULL,
+					key TEXT NOT NULL,
+					value TEXT NOT NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					created_by TEXT,
+					updated_by TEXT,
+					version INTEGER DEFAULT 1,
+					UNIQUE(environment, key)
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_env_key ON secrets(environment, key);
+
+				CREATE TABLE IF NOT EXISTS secret_history (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					secret_id INTEGER NOT NULL,
+					environment TEXT NOT NULL,
+					key TEXT NOT NULL,
+					value TEXT NOT NULL,
+					version INTEGER NOT NULL,
+					changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					changed_by TEXT,
+					change_type TEXT NOT NULL,
+					FOREIGN KEY (secret_id) REFERENCES secrets(id)
+				);
+
+				CREATE TABLE IF NOT EXISTS audit_log (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					environment TEXT NOT NULL,
+					action TEXT NOT NULL,
+					key TEXT,
+					user TEXT,
+					ip_address TEXT,
+					user_agent TEXT,
+					success BOOLEAN DEFAULT TRUE,
+					error_message TEXT
+				);
+				`)
+				return err
+			}),
+
+		f.migration(2, "add description, tags, owner and source columns to secrets",
+			f.planMetadataColumns,
+			func(tx *sql.Tx) error {
+				return addMetadataColumns(tx)
+			}),
+
+		f.migration(3, "add the trash table",
+			f.planTables("trash"),
+			func(tx *sql.Tx) error {
+				_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS trash (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					environment TEXT NOT NULL,
+					key TEXT NOT NULL,
+					value TEXT NOT NULL,
+					description TEXT,
+					tags TEXT,
+					owner TEXT,
+					source TEXT,
+					created_at TIMESTAMP,
+					created_by TEXT,
+					deleted_at TIMESTAMP NOT NULL,
+					deleted_by TEXT,
+					UNIQUE(environment, key)
+				);
+				`)
+				return err
+			}),
+	}
+}
+
+// migration applies a schema change and records its version in one
+// transaction
+func (f *sqliteFormat) migration(version int, description string, plan func() ([]string, error), apply func(tx *sql.Tx) error) formatMigration {
+	return formatMigration{
+		version:     version,
+		description: description,
+		plan:        plan,
+		apply: func() error {
+			tx, err := f.db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			if _, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS schema_version (
+					version INTEGER PRIMARY KEY,
+					applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+				)
+			`); err != nil {
+				return fmt.Errorf("failed to create version table: %w", err)
+			}
+
+			if err := apply(tx); err != nil {
+				return err
+			}
+
+			// Another process may have applied the same migration meanwhile
+			if _, err := tx.Exec("INSERT OR IGNORE INTO schema_version (version) VALUES (?)", version); err != nil {
+				return err
+			}
+
+			return tx.Commit()
+		},
+	}
+}
+
+// planTables lists the tables a migration would create
+func (f *sqliteFormat) planTables(tables ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		var changes []string
+		for _, name := range tables {
+			exists, err := sqliteTableExists(f.db, name)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				changes = append(changes, "create table "+name)
+			}
+		}
+		return changes, nil
+	}
+}
+
+// planMetadataColumns lists the columns addMetadataColumns would add
+func (f *sqliteFormat) planMetadataColumns() ([]string, error) {
+	existing, err := sqliteColumns(f.db, "secrets")
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, column := range metadataColumns {
+		if !existing[column] {
+			changes = append(changes, "add column secrets."+column)
+		}
+	}
+	return changes, nil
+}
+
+// metadataColumns are the columns of secrets holding SecretMetadata
+var metadataColumns = []string{"description", "tags", "owner", "source"}
+
+// addMetadataColumns adds the metadata columns to databases created
+// before they were part of the schema
+func addMetadataColumns(db sqlExecer) error {
+	existing, err := sqliteColumns(db, "secrets")
+	if err != nil {
+		return err
+	}
+
+	for _, column := range metadataColumns {
+		if existing[column] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE secrets ADD COLUMN %s TEXT", column)); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+// sqliteColumns returns the column names of a table, none if it does not exist
+func sqliteColumns(db sqlExecer, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		existing[name] = true
+	}
+
+	return existing, rows.Err()
+}
+
+// sqliteTableExists reports whether a table exists
+func sqliteTableExists(db sqlExecer, table string) (bool, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	exists := rows.Next()
+	return exists, rows.Err()
+}
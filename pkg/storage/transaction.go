@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or Rollback
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx groups several changes so they are applied to a backend as a single
+// unit. Changes are not visible until Commit; Rollback discards them.
+type Tx interface {
+	// Set stages a variable to be stored on commit
+	Set(key, value string, encrypt bool) error
+
+	// Delete stages a variable to be removed on commit
+	Delete(key string) error
+
+	// Commit applies all staged changes, either all of them or none
+	Commit() error
+
+	// Rollback discards all staged changes
+	Rollback() error
+}
+
+// TransactionalBackend extends Backend with atomic multi-key changes
+type TransactionalBackend interface {
+	Backend
+
+	// Begin starts a new transaction
+	Begin() (Tx, error)
+}
+
+// AsTransactionalBackend returns the transactional view of a backend,
+// checking wrapped backends the same way as AsHistoryBackend.
+func AsTransactionalBackend(backend Backend) (TransactionalBackend, bool) {
+	tb, ok := backend.(TransactionalBackend)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := innermostBackend(backend).(TransactionalBackend); !ok {
+		return nil, false
+	}
+
+	return tb, true
+}
+
+// BeginTx starts a transaction on any backend. Backends without native
+// transactions get a best-effort one: changes are applied one by one and
+// the previous values are restored if a change fails.
+func BeginTx(backend Backend) (Tx, error) {
+	if tb, ok := AsTransactionalBackend(backend); ok {
+		return tb.Begin()
+	}
+
+	return newBufferedTx(func(ops []txOp) error {
+		return applyWithUndo(backend, ops)
+	}), nil
+}
+
+// txOp is a single staged change
+type txOp struct {
+	key     string
+	value   string
+	encrypt bool
+	delete  bool
+}
+
+// bufferedTx collects changes in memory and hands them to the backend
+// in one call on commit
+type bufferedTx struct {
+	ops    []txOp
+	commit func(ops []txOp) error
+	done   bool
+}
+
+func newBufferedTx(commit func(ops []txOp) error) *bufferedTx {
+	return &bufferedTx{commit: commit}
+}
+
+func (t *bufferedTx) Set(key, value string, encrypt bool) error {
+	if t.done {
+		return ErrTxDone
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
+	t.ops = append(t.ops, txOp{key: key, value: value, encrypt: encrypt})
+	return nil
+}
+
+func (t *bufferedTx) Delete(key string) error {
+	if t.done {
+		return ErrTxDone
+	}
+
+	t.ops = append(t.ops, txOp{key: key, delete: true})
+	return nil
+}
+
+func (t *bufferedTx) Commit() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+
+	if len(t.ops) == 0 {
+		return nil
+	}
+
+	return t.commit(t.ops)
+}
+
+func (t *bufferedTx) Rollback() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	t.ops = nil
+
+	return nil
+}
+
+// encryptedTx encodes values before staging them in the wrapped transaction
+type encryptedTx struct {
+	tx     Tx
+	encode func(key, value string, encrypt bool) (string, error)
+}
+
+func (t *encryptedTx) Set(key, value string, encrypt bool) error {
+	data, err := t.encode(key, value, encrypt)
+	if err != nil {
+		return err
+	}
+
+	return t.tx.Set(key, data, false)
+}
+
+func (t *encryptedTx) Delete(key string) error {
+	return t.tx.Delete(key)
+}
+
+func (t *encryptedTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *encryptedTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// purger is implemented by backends with a trash to remove a variable
+// without moving it there
+type purger interface {
+	purge(key string) error
+}
+
+// applyWithUndo applies changes one by one and restores the previous
+// stored values when a change fails
+func applyWithUndo(backend Backend, ops []txOp) error {
+	type previous struct {
+		key    string
+		value  string
+		exists bool
+	}
+
+	// Snapshots are taken from the innermost backend so the restored
+	// values are byte-for-byte what was stored before
+	raw := innermostBackend(backend)
+
+	// Variables created by the failed transaction never existed, so they
+	// must not show up in the trash
+	remove := raw.Delete
+	if p, ok := raw.(purger); ok {
+		remove = p.purge
+	}
+
+	var undo []previous
+	for _, op := range ops {
+		value, err := raw.Get(op.key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to read %s: %w", op.key, err)
+		}
+		undo = append(undo, previous{key: op.key, value: value, exists: err == nil})
+
+		if op.delete {
+			err = backend.Delete(op.key)
+		} else {
+			err = backend.Set(op.key, op.value, op.encrypt)
+		}
+		if err == nil {
+			continue
+		}
+
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undo[i].exists {
+				raw.Set(undo[i].key, undo[i].value, false)
+			} else {
+				remove(undo[i].key)
+			}
+		}
+
+		return fmt.Errorf("failed to apply change to %s: %w", op.key, err)
+	}
+
+	return nil
+}
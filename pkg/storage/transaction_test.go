@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTransactionalBackends(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "transaction_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fileBackend, err := NewFileBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+
+	sqliteBackend, err := NewSQLiteBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer sqliteBackend.Close()
+
+	gitBackend, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+
+	encBackend, err := NewEncryptedBackend(NewMemoryBackend(), "test-password")
+	if err != nil {
+		t.Fatalf("NewEncryptedBackend() error = %v", err)
+	}
+
+	backends := []struct {
+		name    string
+		backend TransactionalBackend
+	}{
+		{"memory", NewMemoryBackend()},
+		{"file", fileBackend},
+		{"sqlite", sqliteBackend},
+		{"git", gitBackend},
+		{"encrypted", encBackend},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			backend := b.backend
+
+			if err := backend.Set("OLD_KEY", "old", false); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			tx, err := backend.Begin()
+			if err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+
+			tx.Set("API_KEY", "secret", true)
+			tx.Set("DB_URL", "postgres://localhost", true)
+			tx.Delete("OLD_KEY")
+
+			// Nothing is visible before commit
+			if exists, _ := backend.Exists("API_KEY"); exists {
+				t.Error("Exists() = true before Commit()")
+			}
+
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			keys, err := backend.List()
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != "API_KEY,DB_URL" {
+				t.Errorf("List() = %v, want [API_KEY DB_URL]", keys)
+			}
+
+			value, err := backend.Get("API_KEY")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if value != "secret" {
+				t.Errorf("Get() = %q, want %q", value, "secret")
+			}
+
+			if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+				t.Errorf("second Commit() error = %v, want %v", err, ErrTxDone)
+			}
+
+			// Rolled back changes are discarded
+			tx, err = backend.Begin()
+			if err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+			tx.Set("API_KEY", "changed", true)
+			tx.Delete("DB_URL")
+
+			if err := tx.Rollback(); err != nil {
+				t.Fatalf("Rollback() error = %v", err)
+			}
+			if err := tx.Set("OTHER", "x", false); !errors.Is(err, ErrTxDone) {
+				t.Errorf("Set() after Rollback() error = %v, want %v", err, ErrTxDone)
+			}
+
+			value, _ = backend.Get("API_KEY")
+			if value != "secret" {
+				t.Errorf("Get() after Rollback() = %q, want %q", value, "secret")
+			}
+			if exists, _ := backend.Exists("DB_URL"); !exists {
+				t.Error("DB_URL deleted by rolled back transaction")
+			}
+		})
+	}
+}
+
+func TestGitBackend_TransactionIsAtomic(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "git_tx_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	backend, err := NewGitBackend(tmpDir, "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+
+	backend.Set("EXISTING", "keep", false)
+
+	tx, _ := backend.Begin()
+	tx.Set("FIRST", "1", false)
+	tx.Delete("EXISTING")
+	tx.Set("INVALID-KEY", "2", false)
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Commit() expected error for invalid key")
+	}
+
+	keys, _ := backend.List()
+	if len(keys) != 1 || keys[0] != "EXISTING" {
+		t.Errorf("List() after failed Commit() = %v, want [EXISTING]", keys)
+	}
+
+	// The staging directory must not be left behind
+	entries, _ := os.ReadDir(filepath.Dir(backend.dir))
+	for _, entry := range entries {
+		if entry.Name() != "test" && entry.Name() != ".test.lock" && entry.Name() != ".format" {
+			t.Errorf("unexpected entry %s left in git directory", entry.Name())
+		}
+	}
+}
+
+func TestGitBackend_ReadDuringCommit(t *testing.T) {
+	backend, err := NewGitBackend(t.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+	backend.Set("EXISTING", "keep", false)
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 50; i++ {
+			tx, _ := backend.Begin()
+			tx.Set("COUNTER", strconv.Itoa(i), false)
+			if err := tx.Commit(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	// Readers never see the environment directory swapped out
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			return
+		default:
+		}
+
+		values, err := backend.GetAll()
+		if err != nil {
+			t.Fatalf("GetAll() during a commit error = %v", err)
+		}
+		if values["EXISTING"] != "keep" {
+			t.Fatalf("GetAll() during a commit = %v", values)
+		}
+	}
+}
+
+func TestBeginTx_Fallback(t *testing.T) {
+	backend := &failingBackend{Backend: NewMemoryBackend(), failKey: "BROKEN"}
+	backend.Set("EXISTING", "old", false)
+
+	if _, ok := AsTransactionalBackend(backend); ok {
+		t.Fatal("AsTransactionalBackend() = true for backend without Begin()")
+	}
+
+	tx, err := BeginTx(backend)
+	if err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	tx.Set("EXISTING", "new", false)
+	tx.Set("ADDED", "value", false)
+	tx.Set("BROKEN", "value", false)
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Commit() expected error")
+	}
+
+	// Changes applied before the failure are undone
+	if value, _ := backend.Get("EXISTING"); value != "old" {
+		t.Errorf("Get(EXISTING) = %q, want %q", value, "old")
+	}
+	if exists, _ := backend.Exists("ADDED"); exists {
+		t.Error("ADDED still exists after failed Commit()")
+	}
+}
+
+func TestAsTransactionalBackend_NotSupported(t *testing.T) {
+	encBackend, _ := NewEncryptedBackend(&plainBackend{NewMemoryBackend()}, "test-password")
+
+	if _, ok := AsTransactionalBackend(encBackend); ok {
+		t.Error("AsTransactionalBackend() = true, want false when the wrapped backend has no transactions")
+	}
+
+	if _, err := encBackend.Begin(); !errors.Is(err, ErrTransactionsNotSupported) {
+		t.Errorf("Begin() error = %v, want %v", err, ErrTransactionsNotSupported)
+	}
+
+	// BeginTx still works through the fallback and encrypts values
+	tx, err := BeginTx(encBackend)
+	if err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	tx.Set("API_KEY", "secret", true)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	raw, _ := encBackend.Unwrap().Get("API_KEY")
+	if strings.Contains(raw, "secret") {
+		t.Error("value stored in plaintext")
+	}
+}
+
+func TestBeginTx_FallbackKeepsTrashClean(t *testing.T) {
+	fileBackend, err := NewFileBackend(t.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	backend := &failingBackend{Backend: fileBackend, failKey: "BROKEN"}
+
+	tx, err := BeginTx(backend)
+	if err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	tx.Set("ADDED", "value", false)
+	tx.Set("BROKEN", "value", false)
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Commit() expected error")
+	}
+
+	if exists, _ := fileBackend.Exists("ADDED"); exists {
+		t.Error("ADDED still exists after failed Commit()")
+	}
+	trashed, err := fileBackend.ListTrash()
+	if err != nil {
+		t.Fatalf("ListTrash() error = %v", err)
+	}
+	if len(trashed) != 0 {
+		t.Errorf("ListTrash() = %v, want no entries after a failed Commit()", trashed)
+	}
+}
+
+// failingBackend fails to store one key. It hides the transactions of the
+// wrapped backend so BeginTx uses the fallback.
+type failingBackend struct {
+	Backend
+	failKey string
+}
+
+func (f *failingBackend) Unwrap() Backend {
+	return f.Backend
+}
+
+func (f *failingBackend) Set(key, value string, encrypt bool) error {
+	if key == f.failKey {
+		return errors.New("write failed")
+	}
+	return f.Backend.Set(key, value, encrypt)
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrTrashNotSupported is returned by backends that remove deleted
+// variables immediately
+var ErrTrashNotSupported = errors.New("storage backend does not support a trash")
+
+// TrashedSecret is a deleted variable kept in the trash of an environment
+type TrashedSecret struct {
+	Key       string          `json:"key"`
+	Value     string          `json:"value"`
+	Metadata  *SecretMetadata `json:"metadata,omitempty"`
+	DeletedAt time.Time       `json:"deleted_at"`
+	DeletedBy string          `json:"deleted_by"`
+}
+
+// TrashBackend extends Backend with a trash. Delete moves a variable into
+// the trash of its environment, replacing an earlier deleted version of
+// the same key, and the variable can be brought back until it is purged.
+type TrashBackend interface {
+	Backend
+
+	// ListTrash returns the deleted variables, most recently deleted first
+	ListTrash() ([]TrashedSecret, error)
+
+	// Undelete moves a variable from the trash back into the environment.
+	// It returns ErrNotFound if the key is not in the trash and
+	// ErrAlreadyExists if a variable with the same key was set since.
+	Undelete(key string) error
+
+	// PurgeTrash permanently removes the variables deleted before the given
+	// time and returns how many were removed
+	PurgeTrash(before time.Time) (int, error)
+}
+
+// AsTrashBackend returns the trash view of a backend, checking wrapped
+// backends the same way as AsHistoryBackend.
+func AsTrashBackend(backend Backend) (TrashBackend, bool) {
+	tb, ok := backend.(TrashBackend)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := innermostBackend(backend).(TrashBackend); !ok {
+		return nil, false
+	}
+
+	return tb, true
+}
+
+// trashFile keeps the trash of one environment in a JSON file, used by
+// the file and git backends
+type trashFile struct {
+	path string
+}
+
+// newTrashFile returns the trash of an environment below basePath
+func newTrashFile(basePath, environment string) *trashFile {
+	return &trashFile{path: filepath.Join(basePath, "trash", environment+".json")}
+}
+
+// load reads the trashed variables by key
+func (t *trashFile) load() (map[string]*TrashedSecret, error) {
+	result := make(map[string]*TrashedSecret)
+
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trash: %w", err)
+	}
+
+	return result, nil
+}
+
+// save writes the trashed variables, removing the file once it is empty
+func (t *trashFile) save(trash map[string]*TrashedSecret) error {
+	if len(trash) == 0 {
+		if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove trash file: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+
+	return writeJSONFile(t.path, trash)
+}
+
+// add moves a deleted variable into the trash
+func (t *trashFile) add(key, value string, meta *SecretMetadata, now time.Time) error {
+	trash, err := t.load()
+	if err != nil {
+		return err
+	}
+
+	trash[key] = &TrashedSecret{
+		Key:       key,
+		Value:     value,
+		Metadata:  meta,
+		DeletedAt: now,
+		DeletedBy: getCurrentUser(),
+	}
+
+	return t.save(trash)
+}
+
+// list returns the trashed variables, most recently deleted first
+func (t *trashFile) list() ([]TrashedSecret, error) {
+	trash, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return sortTrash(trash), nil
+}
+
+// take removes a variable from the trash and returns it
+func (t *trashFile) take(key string) (*TrashedSecret, error) {
+	trash, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := trash[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(trash, key)
+
+	if err := t.save(trash); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// purge removes the variables deleted before the given time
+func (t *trashFile) purge(before time.Time) (int, error) {
+	trash, err := t.load()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for key, entry := range trash {
+		if entry.DeletedAt.Before(before) {
+			delete(trash, key)
+			purged++
+		}
+	}
+
+	if purged == 0 {
+		return 0, nil
+	}
+
+	return purged, t.save(trash)
+}
+
+// values returns the stored values of the trashed variables
+func (t *trashFile) values() ([]string, error) {
+	trash, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(trash))
+	for _, entry := range trash {
+		values = append(values, entry.Value)
+	}
+
+	return values, nil
+}
+
+// rewrite replaces the stored value of every trashed variable with the
+// one rewrite returns
+func (t *trashFile) rewrite(rewrite func(key, value string) (string, error)) error {
+	trash, err := t.load()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for key, entry := range trash {
+		value, err := rewrite(key, entry.Value)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite deleted %s: %w", key, err)
+		}
+		if value != entry.Value {
+			entry.Value = value
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return t.save(trash)
+}
+
+// sortTrash orders trashed variables by deletion time, newest first
+func sortTrash(trash map[string]*TrashedSecret) []TrashedSecret {
+	result := make([]TrashedSecret, 0, len(trash))
+	for _, entry := range trash {
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].DeletedAt.Equal(result[j].DeletedAt) {
+			return result[i].DeletedAt.After(result[j].DeletedAt)
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrashBackends(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "trash_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fileBackend, err := NewFileBackend(filepath.Join(tmpDir, "file"), "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+
+	sqliteBackend, err := NewSQLiteBackend(filepath.Join(tmpDir, "sqlite"), "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer sqliteBackend.Close()
+
+	gitBackend, err := NewGitBackend(filepath.Join(tmpDir, "git"), "test")
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+
+	backends := []struct {
+		name    string
+		backend Backend
+	}{
+		{"file", fileBackend},
+		{"sqlite", sqliteBackend},
+		{"git", gitBackend},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			tb, ok := AsTrashBackend(b.backend)
+			if !ok {
+				t.Fatal("backend does not support a trash")
+			}
+
+			if err := tb.Set("API_KEY", "secret", false); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			mb := b.backend.(MetadataBackend)
+			if err := mb.SetMetadata("API_KEY", &SecretMetadata{Description: "Payment API", Owner: "billing"}); err != nil {
+				t.Fatalf("SetMetadata() error = %v", err)
+			}
+
+			if err := tb.Delete("API_KEY"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if exists, _ := tb.Exists("API_KEY"); exists {
+				t.Fatal("deleted variable still exists")
+			}
+
+			trash, err := tb.ListTrash()
+			if err != nil {
+				t.Fatalf("ListTrash() error = %v", err)
+			}
+			if len(trash) != 1 || trash[0].Key != "API_KEY" || trash[0].Value != "secret" {
+				t.Fatalf("ListTrash() = %+v", trash)
+			}
+			if trash[0].DeletedAt.IsZero() || trash[0].DeletedBy == "" {
+				t.Errorf("trash entry lacks deletion details: %+v", trash[0])
+			}
+
+			// A variable set again under the same name blocks the undelete
+			if err := tb.Set("API_KEY", "new", false); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if err := tb.Undelete("API_KEY"); !errors.Is(err, ErrAlreadyExists) {
+				t.Errorf("Undelete() over existing variable error = %v, want ErrAlreadyExists", err)
+			}
+			if err := mb.SetMetadata("API_KEY", &SecretMetadata{Description: "New payment API", Owner: "billing"}); err != nil {
+				t.Fatalf("SetMetadata() error = %v", err)
+			}
+			if err := tb.Delete("API_KEY"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			// The latest deleted version replaced the earlier one
+			if trash, _ := tb.ListTrash(); len(trash) != 1 || trash[0].Value != "new" {
+				t.Errorf("ListTrash() after second delete = %+v", trash)
+			}
+
+			if err := tb.Undelete("API_KEY"); err != nil {
+				t.Fatalf("Undelete() error = %v", err)
+			}
+			if value, err := tb.Get("API_KEY"); err != nil || value != "new" {
+				t.Errorf("Get() after undelete = %q, %v", value, err)
+			}
+			if meta, err := mb.GetMetadata("API_KEY"); err != nil || meta.Description != "New payment API" || meta.Owner != "billing" {
+				t.Errorf("GetMetadata() after undelete = %+v, %v", meta, err)
+			}
+			if trash, _ := tb.ListTrash(); len(trash) != 0 {
+				t.Errorf("ListTrash() after undelete = %+v", trash)
+			}
+			if err := tb.Undelete("API_KEY"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Undelete() of variable not in trash error = %v, want ErrNotFound", err)
+			}
+
+			// Deletes staged in a transaction go to the trash as well
+			tx, err := BeginTx(tb)
+			if err != nil {
+				t.Fatalf("BeginTx() error = %v", err)
+			}
+			tx.Delete("API_KEY")
+			tx.Delete("MISSING")
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			if trash, _ := tb.ListTrash(); len(trash) != 1 || trash[0].Key != "API_KEY" {
+				t.Errorf("ListTrash() after transaction = %+v", trash)
+			}
+
+			// Only variables deleted before the cut-off are purged
+			if purged, err := tb.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+				t.Errorf("PurgeTrash(an hour ago) = %d, %v", purged, err)
+			}
+			if purged, err := tb.PurgeTrash(time.Now().Add(time.Second)); err != nil || purged != 1 {
+				t.Errorf("PurgeTrash(now) = %d, %v", purged, err)
+			}
+			if trash, _ := tb.ListTrash(); len(trash) != 0 {
+				t.Errorf("ListTrash() after purge = %+v", trash)
+			}
+		})
+	}
+}
+
+func TestEncryptedBackend_Trash(t *testing.T) {
+	fileBackend, err := NewFileBackend(t.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+
+	backend, err := NewEncryptedBackend(fileBackend, "test-password")
+	if err != nil {
+		t.Fatalf("NewEncryptedBackend() error = %v", err)
+	}
+
+	if err := backend.Set("API_KEY", "secret", true); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := backend.Delete("API_KEY"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	// The wrapped backend only holds the ciphertext
+	raw, _ := fileBackend.ListTrash()
+	if len(raw) != 1 || raw[0].Value == "secret" {
+		t.Errorf("trash of wrapped backend = %+v", raw)
+	}
+
+	trash, err := backend.ListTrash()
+	if err != nil || len(trash) != 1 || trash[0].Value != "secret" {
+		t.Fatalf("ListTrash() = %+v, %v", trash, err)
+	}
+
+	if err := backend.Undelete("API_KEY"); err != nil {
+		t.Fatalf("Undelete() error = %v", err)
+	}
+	if value, err := backend.Get("API_KEY"); err != nil || value != "secret" {
+		t.Errorf("Get() after undelete = %q, %v", value, err)
+	}
+
+	if _, ok := AsTrashBackend(NewMemoryBackend()); ok {
+		t.Error("memory backend reported a trash")
+	}
+	memory, _ := NewEncryptedBackend(NewMemoryBackend(), "test-password")
+	if _, ok := AsTrashBackend(memory); ok {
+		t.Error("encrypted memory backend reported a trash")
+	}
+}
+
+func TestSQLiteBackend_UndeleteContinuesHistory(t *testing.T) {
+	backend, err := NewSQLiteBackend(t.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	defer backend.Close()
+
+	backend.Set("API_KEY", "secret", false)
+	backend.Delete("API_KEY")
+	if err := backend.Undelete("API_KEY"); err != nil {
+		t.Fatalf("Undelete() error = %v", err)
+	}
+
+	history, err := backend.GetHistory("API_KEY", 10)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+
+	want := []string{"UNDELETE", "DELETE", "SET"}
+	if len(history) != len(want) {
+		t.Fatalf("GetHistory() = %+v", history)
+	}
+	for i, h := range history {
+		if h.ChangeType != want[i] || h.Version != len(want)-i || h.Value != "secret" {
+			t.Errorf("history[%d] = %+v, want %s version %d", i, h, want[i], len(want)-i)
+		}
+	}
+}